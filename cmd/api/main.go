@@ -3,16 +3,19 @@ package main
 import (
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
+	"github.com/yourusername/inventory-management-system/internal/alerts"
 	"github.com/yourusername/inventory-management-system/internal/config"
 	"github.com/yourusername/inventory-management-system/internal/database"
 	"github.com/yourusername/inventory-management-system/internal/handlers"
 	"github.com/yourusername/inventory-management-system/internal/middleware"
+	"github.com/yourusername/inventory-management-system/internal/models"
 )
 
 func main() {
@@ -23,6 +26,32 @@ func main() {
 
 	// Initialize configuration
 	cfg := config.NewConfig()
+	if cfg.JWTSecret == "" {
+		log.Fatal("Invalid configuration: JWT_SECRET must be set")
+	}
+
+	if err := models.SetRoundingMode(models.RoundingMode(cfg.RoundingMode)); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if err := models.SetMarginPolicy(cfg.MinimumMarginPercent, models.MarginEnforcement(cfg.MarginEnforcement)); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if err := models.SetBarcodePrefix(cfg.BarcodePrefix); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	
+	// Structured logging; slog.SetDefault also routes the log package through it
+	logger, err := middleware.NewLogger(os.Stderr, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	slog.SetDefault(logger)
+	
+	// Low stock alerts go to the log unless a webhook is configured
+	var stockAlerter alerts.StockAlerter = alerts.NewLogAlerter()
+	if cfg.StockAlertWebhookURL != "" {
+		stockAlerter = alerts.NewWebhookAlerter(cfg.StockAlertWebhookURL)
+	}
 
 	// Initialize database
 	db, err := database.InitDB(cfg)
@@ -31,7 +60,7 @@ func main() {
 	}
 
 	// Run database migrations
-	if err := database.MigrateDB(db); err != nil {
+	if err := database.MigrateDB(db, cfg); err != nil {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 
@@ -46,19 +75,24 @@ func main() {
 	router := mux.NewRouter()
 
 	// Apply global middleware
-	router.Use(middleware.Logging)
+	router.Use(middleware.RequestID)
+	router.Use(middleware.Logging(logger))
 	
 	// API routes
 	apiRouter := router.PathPrefix("/api").Subrouter()
+	apiRouter.Use(middleware.RequireJSON)
 	
 	// Public routes
 	public := apiRouter.PathPrefix("").Subrouter()
-	handlers.RegisterPublicRoutes(public, db)
+	handlers.RegisterPublicRoutes(public, db, cfg.JWTSecret)
 	
 	// Protected routes
 	protected := apiRouter.PathPrefix("").Subrouter()
 	protected.Use(middleware.Authenticate(cfg.JWTSecret))
-	handlers.RegisterProtectedRoutes(protected, db)
+	if cfg.ReadAuditEnabled {
+		protected.Use(middleware.ReadAudit(db, cfg.ReadAuditRoutes))
+	}
+	handlers.RegisterProtectedRoutes(protected, db, stockAlerter)
 	
 	// Start server
 	port := os.Getenv("PORT")
@@ -0,0 +1,86 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/yourusername/inventory-management-system/internal/models"
+)
+
+// StockAlerter is told when a product's stock falls to or below its reorder level
+type StockAlerter interface {
+	Notify(product models.Product, currentQty int)
+}
+
+// LogAlerter writes low stock alerts to the application log
+type LogAlerter struct{}
+
+// NewLogAlerter creates a new logging alerter
+func NewLogAlerter() *LogAlerter {
+	return &LogAlerter{}
+}
+
+// Notify logs the product that has reached its reorder level
+func (a *LogAlerter) Notify(product models.Product, currentQty int) {
+	log.Printf("Low stock: product %d (%s) is at %d, reorder level %d",
+		product.ID, product.SKU, currentQty, product.ReorderLevel)
+}
+
+// WebhookAlerter POSTs low stock alerts as JSON to a configured URL
+type WebhookAlerter struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookAlerter creates a new webhook alerter that posts to url
+func NewWebhookAlerter(url string) *WebhookAlerter {
+	return &WebhookAlerter{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// lowStockEvent is the JSON body sent to the webhook
+type lowStockEvent struct {
+	Event        string    `json:"event"`
+	ProductID    uint      `json:"product_id"`
+	SKU          string    `json:"sku"`
+	Name         string    `json:"name"`
+	Quantity     int       `json:"quantity"`
+	ReorderLevel int       `json:"reorder_level"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+// Notify sends the alert in the background so a slow receiver doesn't hold up the
+// stock movement that triggered it. Failures are logged, not retried.
+func (a *WebhookAlerter) Notify(product models.Product, currentQty int) {
+	body, err := json.Marshal(lowStockEvent{
+		Event:        "low_stock",
+		ProductID:    product.ID,
+		SKU:          product.SKU,
+		Name:         product.Name,
+		Quantity:     currentQty,
+		ReorderLevel: product.ReorderLevel,
+		Timestamp:    time.Now(),
+	})
+	if err != nil {
+		log.Printf("Failed to encode low stock alert for product %d: %v", product.ID, err)
+		return
+	}
+	
+	go func() {
+		resp, err := a.client.Post(a.url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Printf("Failed to send low stock alert for product %d: %v", product.ID, err)
+			return
+		}
+		defer resp.Body.Close()
+		
+		if resp.StatusCode >= 300 {
+			log.Printf("Low stock webhook returned %s for product %d", resp.Status, product.ID)
+		}
+	}()
+}
@@ -3,6 +3,9 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Config holds all configuration for the application
@@ -14,6 +17,41 @@ type Config struct {
 	DBName       string
 	JWTSecret    string
 	Environment  string
+	
+	// Read auditing is off by default because of the log volume it produces
+	ReadAuditEnabled bool
+	ReadAuditRoutes  []string
+	
+	// Seed admin account; the password is only reapplied to an existing admin when
+	// AdminPasswordReset is set, for recovering access to a locked-out deployment
+	AdminUsername      string
+	AdminEmail         string
+	AdminPassword      string
+	AdminPasswordReset bool
+	
+	// Currency rounding: "half_up" (default) or "half_even"
+	RoundingMode string
+	
+	// Default minimum margin over cost for sales order lines, and whether lines below it
+	// are rejected ("block") or need acknowledging ("warn", the default)
+	MinimumMarginPercent float64
+	MarginEnforcement    string
+	
+	// Leading digits of the internal EAN-13 barcodes generated for products without one
+	BarcodePrefix string
+	
+	// Low stock alerts are logged unless a webhook URL is set to POST them to
+	StockAlertWebhookURL string
+	
+	// GORM logging: "silent", "error", "warn" or "info" (every query), and the duration
+	// above which a query is logged as slow at "warn" and above (0 disables it)
+	DBLogLevel           string
+	DBSlowQueryThreshold time.Duration
+	
+	// Application logging: "text" (the default in development) or "json" for log
+	// aggregators, and the minimum level logged
+	LogFormat string
+	LogLevel  string
 }
 
 // NewConfig creates a new configuration instance
@@ -25,6 +63,15 @@ func NewConfig() *Config {
 	log.Println("DB_USER:", os.Getenv("DB_USER"))
 	log.Println("DB_NAME:", os.Getenv("DB_NAME"))
 	log.Println("ENVIRONMENT:", os.Getenv("ENVIRONMENT"))
+	
+	// Development logs every query by default; elsewhere only slow queries and errors
+	environment := getEnv("ENVIRONMENT", "development")
+	defaultDBLogLevel := "warn"
+	defaultLogFormat := "json"
+	if environment == "development" {
+		defaultDBLogLevel = "info"
+		defaultLogFormat = "text"
+	}
 
 	return &Config{
 		DBHost:       getEnv("DB_HOST", "localhost"),
@@ -32,8 +79,31 @@ func NewConfig() *Config {
 		DBUser:       getEnv("DB_USER", "postgres"),
 		DBPassword:   getEnv("DB_PASSWORD", "postgres"),
 		DBName:       getEnv("DB_NAME", "inventory"),
-		JWTSecret:    getEnv("JWT_SECRET", "your-secret-key"),
-		Environment:  getEnv("ENVIRONMENT", "development"),
+		JWTSecret:    os.Getenv("JWT_SECRET"), // No default: a guessable secret would let anyone mint tokens
+		Environment:  environment,
+		
+		ReadAuditEnabled: getEnv("READ_AUDIT_ENABLED", "false") == "true",
+		ReadAuditRoutes:  getEnvList("READ_AUDIT_ROUTES", "/api/users,/api/reports,/api/customers"),
+		
+		AdminUsername:      getEnv("ADMIN_USERNAME", "admin"),
+		AdminEmail:         getEnv("ADMIN_EMAIL", "admin@example.com"),
+		AdminPassword:      os.Getenv("ADMIN_PASSWORD"), // Read directly so it is never logged
+		AdminPasswordReset: getEnv("ADMIN_PASSWORD_RESET", "false") == "true",
+		
+		RoundingMode: getEnv("ROUNDING_MODE", "half_up"),
+		
+		MinimumMarginPercent: getEnvFloat("MINIMUM_MARGIN_PERCENT", 0), // 0 turns the check off
+		MarginEnforcement:    getEnv("MARGIN_ENFORCEMENT", "warn"),
+		
+		BarcodePrefix: getEnv("BARCODE_PREFIX", "200"),
+		
+		StockAlertWebhookURL: os.Getenv("STOCK_ALERT_WEBHOOK_URL"),
+		
+		DBLogLevel:           getEnv("DB_LOG_LEVEL", defaultDBLogLevel),
+		DBSlowQueryThreshold: getEnvDuration("DB_SLOW_QUERY_THRESHOLD", 200*time.Millisecond),
+		
+		LogFormat: getEnv("LOG_FORMAT", defaultLogFormat),
+		LogLevel:  getEnv("LOG_LEVEL", "info"),
 	}
 }
 
@@ -45,4 +115,48 @@ func getEnv(key, defaultValue string) string {
 		return defaultValue
 	}
 	return value
+}
+
+// getEnvList reads a comma separated environment variable or returns a default list. Entries
+// are trimmed and empty ones dropped, so "a, b," yields [a b] rather than a blank entry.
+func getEnvList(key, defaultValue string) []string {
+	list := []string{}
+	for _, entry := range strings.Split(getEnv(key, defaultValue), ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+// getEnvFloat reads a numeric environment variable or returns a default value
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		log.Printf("Using default value for %s: %v", key, defaultValue)
+		return defaultValue
+	}
+	
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Invalid value for %s (%q), using default: %v", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvDuration reads a duration environment variable (such as "200ms") or returns a default value
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		log.Printf("Using default value for %s: %v", key, defaultValue)
+		return defaultValue
+	}
+	
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed < 0 {
+		log.Printf("Invalid value for %s (%q), using default: %v", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
 }
\ No newline at end of file
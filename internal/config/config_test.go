@@ -0,0 +1,26 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetEnvList(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"", []string{"/api/default"}},
+		{"/api/users,/api/reports", []string{"/api/users", "/api/reports"}},
+		{" /api/users , /api/reports ", []string{"/api/users", "/api/reports"}},
+		{"/api/users,,/api/reports,", []string{"/api/users", "/api/reports"}},
+		{" , ", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("TEST_LIST", tt.value)
+		if got := getEnvList("TEST_LIST", "/api/default"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("getEnvList with %q = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
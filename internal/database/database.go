@@ -3,15 +3,25 @@ package database
 import (
 	"fmt"
 	"log"
+	"os"
 	"time"
 
 	"github.com/yourusername/inventory-management-system/internal/config"
 	"github.com/yourusername/inventory-management-system/internal/models"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
+// gormLogLevels maps the DB_LOG_LEVEL values to GORM log levels
+var gormLogLevels = map[string]logger.LogLevel{
+	"silent": logger.Silent,
+	"error":  logger.Error,
+	"warn":   logger.Warn,
+	"info":   logger.Info,
+}
+
 // InitDB initializes the database connection
 func InitDB(cfg *config.Config) (*gorm.DB, error) {
 	// Construct the database connection string
@@ -25,10 +35,15 @@ func InitDB(cfg *config.Config) (*gorm.DB, error) {
 	)
 
 	// Configure GORM logger
-	gormLogger := logger.Default
-	if cfg.Environment == "development" {
-		gormLogger = logger.Default.LogMode(logger.Info)
+	logLevel, ok := gormLogLevels[cfg.DBLogLevel]
+	if !ok {
+		return nil, fmt.Errorf("invalid DB_LOG_LEVEL %q: must be silent, error, warn or info", cfg.DBLogLevel)
 	}
+	gormLogger := logger.New(log.New(os.Stdout, "\r\n", log.LstdFlags), logger.Config{
+		SlowThreshold: cfg.DBSlowQueryThreshold,
+		LogLevel:      logLevel,
+		Colorful:      true,
+	})
 
 	// Attempt to connect to the database with retry mechanism
 	var db *gorm.DB
@@ -70,9 +85,15 @@ func InitDB(cfg *config.Config) (*gorm.DB, error) {
 }
 
 // MigrateDB performs database migrations
-func MigrateDB(db *gorm.DB) error {
+func MigrateDB(db *gorm.DB, cfg *config.Config) error {
 	log.Println("Running database migrations...")
 	
+	// Warehouse stock used to be keyed by product, warehouse and location; move it onto its own ID first
+	if err := migrateProductWarehouseKey(db); err != nil {
+		log.Printf("Migrating product warehouse key failed: %v", err)
+		return err
+	}
+	
 	// Migrate all models
 	err := db.AutoMigrate(
 		&models.User{},
@@ -93,7 +114,19 @@ func MigrateDB(db *gorm.DB) error {
 		&models.Customer{},
 		&models.SalesOrder{},
 		&models.SalesOrderItem{},
+		&models.StockReservation{},
 		&models.AuditLog{},
+		&models.RefreshToken{},
+		&models.StockTake{},
+		&models.StockTakeLine{},
+		&models.StockCountSession{},
+		&models.StockCountLine{},
+		&models.IdempotencyKey{},
+		&models.StockAlert{},
+		&models.CustomField{},
+		&models.SalesOrderTemplate{},
+		&models.SalesOrderTemplateItem{},
+		&appliedMigration{},
 	)
 	
 	if err != nil {
@@ -101,8 +134,34 @@ func MigrateDB(db *gorm.DB) error {
 		return err
 	}
 	
+	// One stock record per location, and at most one without a location, per product and warehouse
+	if err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_product_warehouse_location
+		ON product_warehouses (product_id, warehouse_id, location_id) NULLS NOT DISTINCT`).Error; err != nil {
+		log.Printf("Indexing product warehouse stock failed: %v", err)
+		return err
+	}
+	
+	// Transactions recorded before unit costs were captured fall back to the cost price at upgrade
+	if err := runOnce(db, "backfill_transaction_unit_costs", backfillTransactionUnitCosts); err != nil {
+		log.Printf("Backfilling transaction unit costs failed: %v", err)
+		return err
+	}
+	
+	// Supplier links used to be split between two tables; keep only product_suppliers
+	if err := runOnce(db, "migrate_legacy_supplier_links", migrateLegacySupplierLinks); err != nil {
+		log.Printf("Migrating legacy supplier links failed: %v", err)
+		return err
+	}
+	
+	// Orders left in the old "pending" status have to go through approval before receiving
+	if err := db.Model(&models.PurchaseOrder{}).Where("status = ?", "pending").
+		Update("status", "pending_approval").Error; err != nil {
+		log.Printf("Migrating pending purchase orders failed: %v", err)
+		return err
+	}
+	
 	// Optional: Insert default admin user if not exists
-	if err := seedAdminUser(db); err != nil {
+	if err := seedAdminUser(db, cfg); err != nil {
 		log.Printf("Seeding admin user failed: %v", err)
 		return err
 	}
@@ -111,23 +170,154 @@ func MigrateDB(db *gorm.DB) error {
 	return nil
 }
 
-// seedAdminUser creates a default admin user if no admin exists
-func seedAdminUser(db *gorm.DB) error {
+// seedAdminUser creates the configured admin user if no admin exists. When password reset
+// is enabled it also reapplies the configured password to that admin. It never creates a
+// second admin and never changes an existing user's role.
+func seedAdminUser(db *gorm.DB, cfg *config.Config) error {
 	var userCount int64
-	db.Model(&models.User{}).Where("role = ?", "admin").Count(&userCount)
+	if err := db.Model(&models.User{}).Where("role = ?", "admin").Count(&userCount).Error; err != nil {
+		return err
+	}
 	
 	if userCount == 0 {
+		// A non-admin already holding the username is left alone rather than promoted
+		var existing int64
+		if err := db.Model(&models.User{}).Where("username = ?", cfg.AdminUsername).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			log.Printf("Not seeding admin user: username %q is taken by a non-admin user", cfg.AdminUsername)
+			return nil
+		}
+		
+		password := cfg.AdminPassword
+		if password == "" {
+			password = "admin123"
+		}
+		
 		defaultAdmin := models.User{
-			Username:     "admin",
-			Email:        "admin@example.com",
+			Username:     cfg.AdminUsername,
+			Email:        cfg.AdminEmail,
 			FullName:     "System Administrator",
 			Role:         "admin",
 			Status:       "active",
-			PasswordHash: "admin123", // This will trigger password hashing in the BeforeCreate hook
+			PasswordHash: password, // This will trigger password hashing in the BeforeCreate hook
 		}
 		
+		log.Printf("Seeding admin user %q", cfg.AdminUsername)
 		return db.Create(&defaultAdmin).Error
 	}
 	
+	if !cfg.AdminPasswordReset {
+		return nil
+	}
+	
+	if cfg.AdminPassword == "" {
+		log.Println("ADMIN_PASSWORD_RESET is enabled but ADMIN_PASSWORD is empty; skipping admin password reset")
+		return nil
+	}
+	
+	var admin models.User
+	if err := db.Where("username = ? AND role = ?", cfg.AdminUsername, "admin").First(&admin).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			log.Printf("ADMIN_PASSWORD_RESET is enabled but no admin user %q exists; skipping admin password reset", cfg.AdminUsername)
+			return nil
+		}
+		return err
+	}
+	
+	if err := admin.SetPassword(cfg.AdminPassword); err != nil {
+		return err
+	}
+	
+	if err := db.Model(&admin).Update("password_hash", admin.PasswordHash).Error; err != nil {
+		return err
+	}
+	
+	log.Printf("Reset password for admin user %q from ADMIN_PASSWORD; unset ADMIN_PASSWORD_RESET once access is restored", cfg.AdminUsername)
 	return nil
+}
+
+// migrateLegacySupplierLinks copies links from the old product_supplier join table into
+// product_suppliers, which holds supplier pricing and the primary flag. Links already
+// there are left alone. The old table is then renamed out of the way, so links deleted or
+// merged away later can't be copied back in.
+func migrateLegacySupplierLinks(db *gorm.DB) error {
+	if !db.Migrator().HasTable("product_supplier") {
+		return nil
+	}
+	if err := db.Exec(`
+		INSERT INTO product_suppliers (product_id, supplier_id, min_order_quantity, is_primary, created_at, updated_at)
+		SELECT product_id, supplier_id, 1, false, NOW(), NOW() FROM product_supplier
+		ON CONFLICT (product_id, supplier_id) DO NOTHING
+	`).Error; err != nil {
+		return err
+	}
+	return db.Migrator().RenameTable("product_supplier", "product_supplier_migrated")
+}
+
+// migrateProductWarehouseKey gives an existing product_warehouses table its own ID and a
+// nullable location_id. The table used to be keyed by product and warehouse, and later by
+// location too, with 0 standing in for "no location"; the foreign key to warehouse_locations
+// rejects 0, so those records are moved to NULL. Migrated tables, and new databases, are left
+// to AutoMigrate.
+func migrateProductWarehouseKey(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&models.ProductWarehouse{}) || db.Migrator().HasColumn(&models.ProductWarehouse{}, "id") {
+		return nil
+	}
+	
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`
+			ALTER TABLE product_warehouses
+				DROP CONSTRAINT IF EXISTS product_warehouses_pkey,
+				ADD COLUMN id BIGSERIAL PRIMARY KEY,
+				ALTER COLUMN location_id DROP NOT NULL,
+				ALTER COLUMN location_id DROP DEFAULT
+		`).Error; err != nil {
+			return err
+		}
+		return tx.Exec("UPDATE product_warehouses SET location_id = NULL WHERE location_id = 0").Error
+	})
+}
+
+// appliedMigration records a one-time data migration that has already run
+type appliedMigration struct {
+	Name      string    `gorm:"primaryKey"`
+	AppliedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// TableName keeps the marker table's name independent of the type's
+func (appliedMigration) TableName() string {
+	return "applied_migrations"
+}
+
+// runOnce runs a data migration unless its name is already recorded. The marker is written
+// in the same transaction, so a failed migration is retried on the next start, and a
+// second instance starting at the same time waits on it instead of running it again.
+func runOnce(db *gorm.DB, name string, migrate func(tx *gorm.DB) error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&appliedMigration{Name: name})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		
+		log.Printf("Running one-time migration %s", name)
+		return migrate(tx)
+	})
+}
+
+// backfillTransactionUnitCosts sets a unit cost on transactions recorded before unit costs
+// were captured. It runs once: afterwards a zero unit cost is a real value, such as a free
+// receipt, and must not be replaced by a later cost price.
+func backfillTransactionUnitCosts(db *gorm.DB) error {
+	return db.Exec(`
+		UPDATE inventory_transactions SET unit_cost = products.cost_price
+		FROM products
+		WHERE products.id = inventory_transactions.product_id
+			AND inventory_transactions.unit_cost = 0
+			AND products.cost_price > 0
+	`).Error
 }
\ No newline at end of file
@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/yourusername/inventory-management-system/internal/models"
+	"github.com/yourusername/inventory-management-system/internal/repository"
+	"gorm.io/gorm"
+)
+
+// AuditLogHandler handles HTTP requests for audit log endpoints
+type AuditLogHandler struct {
+	repo *repository.AuditLogRepository
+	db   *gorm.DB
+}
+
+// NewAuditLogHandler creates a new audit log handler
+func NewAuditLogHandler(db *gorm.DB) *AuditLogHandler {
+	return &AuditLogHandler{
+		repo: repository.NewAuditLogRepository(db),
+		db:   db,
+	}
+}
+
+// recordAudit writes an audit entry for a change made by the requesting user, with the old
+// and new states serialized as JSON. Users serialize without their password hash, as the
+// field is excluded from JSON. A failed write is logged rather than failing a change that
+// has already been made.
+func recordAudit(db *gorm.DB, r *http.Request, action, entityType string, entityID uint, oldValue, newValue interface{}) {
+	userID, _ := r.Context().Value("userID").(uint)
+	
+	entry := models.AuditLog{
+		UserID:     userID,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		OldValues:  auditJSON(oldValue),
+		NewValues:  auditJSON(newValue),
+		IPAddress:  clientIP(r),
+	}
+	if err := repository.NewAuditLogRepository(db).CreateLog(&entry); err != nil {
+		log.Printf("Failed to write audit log for %s %s %d: %v", action, entityType, entityID, err)
+	}
+}
+
+// auditJSON serializes an entity state for the audit log; a missing state is an empty object
+func auditJSON(value interface{}) string {
+	if value == nil {
+		return "{}"
+	}
+	
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+// GetAuditLogs handles GET requests to page through audit entries, newest first, filtered by
+// user_id, entity_type, entity_id, action and a start/end date range
+func (h *AuditLogHandler) GetAuditLogs(w http.ResponseWriter, r *http.Request) {
+	page, limit := parsePagination(r)
+	params := map[string]interface{}{
+		"page":  page,
+		"limit": limit,
+	}
+	
+	if userIDStr := r.URL.Query().Get("user_id"); userIDStr != "" {
+		userID, err := strconv.ParseUint(userIDStr, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid user_id")
+			return
+		}
+		params["user_id"] = uint(userID)
+	}
+	
+	if entityType := r.URL.Query().Get("entity_type"); entityType != "" {
+		params["entity_type"] = entityType
+	}
+	
+	if entityIDStr := r.URL.Query().Get("entity_id"); entityIDStr != "" {
+		entityID, err := strconv.ParseUint(entityIDStr, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid entity_id")
+			return
+		}
+		params["entity_id"] = uint(entityID)
+	}
+	
+	if action := r.URL.Query().Get("action"); action != "" {
+		params["action"] = action
+	}
+	
+	if startStr := r.URL.Query().Get("start"); startStr != "" {
+		startDate, err := parseDateParam(startStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid start")
+			return
+		}
+		params["start_date"] = startDate
+	}
+	
+	if endStr := r.URL.Query().Get("end"); endStr != "" {
+		endDate, err := parseDateParam(endStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid end")
+			return
+		}
+		// A bare date includes the whole day
+		if len(endStr) == len("2006-01-02") {
+			endDate = endDate.Add(24 * time.Hour)
+		}
+		params["end_date"] = endDate
+	}
+	
+	logs, err := h.repo.GetLogs(params)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve audit logs: "+err.Error())
+		return
+	}
+	
+	total, err := h.repo.Count(params)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to count audit logs: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newPaginatedResponse(logs, page, limit, total))
+}
+
+// auditLogExportRow is one audit entry as exported, with the acting user's name resolved
+type auditLogExportRow struct {
+	ID         uint      `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	UserID     uint      `json:"user_id"`
+	Username   string    `json:"username"`
+	Action     string    `json:"action"`
+	EntityType string    `json:"entity_type"`
+	EntityID   uint      `json:"entity_id"`
+	IPAddress  string    `json:"ip_address"`
+	OldValues  string    `json:"old_values,omitempty"`
+	NewValues  string    `json:"new_values,omitempty"`
+}
+
+// ExportAuditLogs handles GET requests to export audit entries as CSV (default) or JSON.
+// Rows are streamed from the database as they are read, as the audit table grows without
+// bound. The old/new value JSON is only included with detail=true.
+func (h *AuditLogHandler) ExportAuditLogs(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid format: must be csv or json")
+		return
+	}
+	
+	detail := r.URL.Query().Get("detail") == "true"
+	
+	query := h.db.Table("audit_logs")
+	
+	if startStr := r.URL.Query().Get("start"); startStr != "" {
+		startDate, err := parseDateParam(startStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid start")
+			return
+		}
+		query = query.Where("audit_logs.created_at >= ?", startDate)
+	}
+	
+	if endStr := r.URL.Query().Get("end"); endStr != "" {
+		endDate, err := parseDateParam(endStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid end")
+			return
+		}
+		// A bare date includes the whole day
+		if len(endStr) == len("2006-01-02") {
+			endDate = endDate.Add(24 * time.Hour)
+		}
+		query = query.Where("audit_logs.created_at < ?", endDate)
+	}
+	
+	if userID := r.URL.Query().Get("user_id"); userID != "" {
+		query = query.Where("audit_logs.user_id = ?", userID)
+	}
+	
+	if entityType := r.URL.Query().Get("entity_type"); entityType != "" {
+		query = query.Where("audit_logs.entity_type = ?", entityType)
+	}
+	
+	if entityID := r.URL.Query().Get("entity_id"); entityID != "" {
+		query = query.Where("audit_logs.entity_id = ?", entityID)
+	}
+	
+	if action := r.URL.Query().Get("action"); action != "" {
+		query = query.Where("audit_logs.action = ?", action)
+	}
+	
+	columns := `
+		audit_logs.id,
+		audit_logs.created_at,
+		audit_logs.user_id,
+		COALESCE(users.username, '') as username,
+		audit_logs.action,
+		audit_logs.entity_type,
+		audit_logs.entity_id,
+		audit_logs.ip_address`
+	if detail {
+		columns += `,
+		COALESCE(audit_logs.old_values::text, '') as old_values,
+		COALESCE(audit_logs.new_values::text, '') as new_values`
+	}
+	
+	rows, err := query.
+		Select(columns).
+		Joins("LEFT JOIN users ON audit_logs.user_id = users.id").
+		Order("audit_logs.created_at ASC, audit_logs.id ASC").
+		Rows()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to export audit logs: "+err.Error())
+		return
+	}
+	defer rows.Close()
+	
+	if format == "json" {
+		streamJSONReport(w, map[string]interface{}{"generated_at": time.Now()}, "audit_logs", rows, func(rows *sql.Rows) (interface{}, error) {
+			var row auditLogExportRow
+			err := h.db.ScanRows(rows, &row)
+			return row, err
+		})
+		return
+	}
+	
+	header := []string{"id", "created_at", "user_id", "username", "action", "entity_type", "entity_id", "ip_address"}
+	if detail {
+		header = append(header, "old_values", "new_values")
+	}
+	
+	streamCSVReport(w, "audit-logs.csv", header, rows, func(rows *sql.Rows) ([]string, error) {
+		var row auditLogExportRow
+		if err := h.db.ScanRows(rows, &row); err != nil {
+			return nil, err
+		}
+		
+		record := []string{
+			strconv.FormatUint(uint64(row.ID), 10),
+			row.CreatedAt.Format(time.RFC3339),
+			strconv.FormatUint(uint64(row.UserID), 10),
+			row.Username,
+			row.Action,
+			row.EntityType,
+			strconv.FormatUint(uint64(row.EntityID), 10),
+			row.IPAddress,
+		}
+		if detail {
+			record = append(record, row.OldValues, row.NewValues)
+		}
+		return record, nil
+	})
+}
\ No newline at end of file
@@ -1,21 +1,65 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"net/http"
-	"os"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/yourusername/inventory-management-system/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// generateJWT generates a secure JWT token
-func generateJWT(user models.User) (string, error) {
-	// Get JWT secret from environment with fallback
-	jwtSecret := []byte(os.Getenv("JWT_SECRET"))
+const (
+	// accessTokenTTL is how long an access token is accepted by the API
+	accessTokenTTL = 15 * time.Minute
+	
+	// refreshTokenTTL is how long a refresh token can be exchanged for a new access token
+	refreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// errInvalidRefreshToken is returned for refresh tokens that are unknown, revoked or expired
+var errInvalidRefreshToken = errors.New("Invalid or expired refresh token")
+
+// AuthHandler handles HTTP requests for authentication endpoints
+type AuthHandler struct {
+	db        *gorm.DB
+	jwtSecret []byte
+}
+
+// NewAuthHandler creates a new auth handler that signs access tokens with jwtSecret
+func NewAuthHandler(db *gorm.DB, jwtSecret string) *AuthHandler {
+	return &AuthHandler{db: db, jwtSecret: []byte(jwtSecret)}
+}
+
+// LoginRequest is the body of a login request
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// RefreshRequest is the body of a refresh or logout request
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// LoginResponse carries a new access token and the refresh token to renew it with
+type LoginResponse struct {
+	Token        string      `json:"token"`
+	ExpiresAt    time.Time   `json:"expires_at"`
+	RefreshToken string      `json:"refresh_token"`
+	User         models.User `json:"user"`
+}
+
+// generateJWT generates a short-lived access token signed with jwtSecret
+func generateJWT(user models.User, jwtSecret []byte) (string, error) {
 	if len(jwtSecret) == 0 {
-		jwtSecret = []byte("your-secure-fallback-secret")
+		return "", errors.New("JWT secret is not configured")
 	}
 
 	// Create token with enhanced claims
@@ -24,7 +68,7 @@ func generateJWT(user models.User) (string, error) {
 		"username":   user.Username,
 		"email":      user.Email,
 		"role":       user.Role,
-		"exp":        time.Now().Add(time.Hour * 24).Unix(), // 24-hour expiration
+		"exp":        time.Now().Add(accessTokenTTL).Unix(),
 		"iat":        time.Now().Unix(),
 		"nbf":        time.Now().Unix(), // Not before current time
 		"token_type": "access",
@@ -37,6 +81,74 @@ func generateJWT(user models.User) (string, error) {
 	return token.SignedString(jwtSecret)
 }
 
+// issueRefreshToken creates a new refresh token for the user and returns it. The token is
+// random rather than a JWT, so it can only be checked against the stored hash.
+func issueRefreshToken(tx *gorm.DB, userID uint) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	
+	refreshToken := models.RefreshToken{
+		UserID:    userID,
+		TokenHash: models.HashRefreshToken(token),
+		ExpiresAt: time.Now().Add(refreshTokenTTL),
+	}
+	if err := tx.Create(&refreshToken).Error; err != nil {
+		return "", err
+	}
+	
+	return token, nil
+}
+
+// newLoginResponse issues an access token and a refresh token for the user
+func (h *AuthHandler) newLoginResponse(tx *gorm.DB, user models.User) (*LoginResponse, error) {
+	token, err := generateJWT(user, h.jwtSecret)
+	if err != nil {
+		return nil, err
+	}
+	
+	refreshToken, err := issueRefreshToken(tx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	
+	// Clear sensitive fields
+	user.PasswordHash = ""
+	
+	return &LoginResponse{
+		Token:        token,
+		ExpiresAt:    time.Now().Add(accessTokenTTL),
+		RefreshToken: refreshToken,
+		User:         user,
+	}, nil
+}
+
+// lockActiveRefreshToken finds and row-locks an unrevoked, unexpired refresh token so
+// two concurrent requests can't both use it
+func lockActiveRefreshToken(tx *gorm.DB, token string) (*models.RefreshToken, error) {
+	if token == "" {
+		return nil, errInvalidRefreshToken
+	}
+	
+	var refreshToken models.RefreshToken
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ?", models.HashRefreshToken(token)).
+		First(&refreshToken).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errInvalidRefreshToken
+		}
+		return nil, err
+	}
+	
+	if !refreshToken.IsActive(time.Now()) {
+		return nil, errInvalidRefreshToken
+	}
+	
+	return &refreshToken, nil
+}
+
 // Additional security enhancements in login handler
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var request LoginRequest
@@ -46,13 +158,13 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	
 	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body")
 		return
 	}
 	
 	// Validate request
 	if request.Username == "" || request.Password == "" {
-		http.Error(w, "Username and password are required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Username and password are required")
 		return
 	}
 	
@@ -61,7 +173,7 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	if err := h.db.Where("username = ? AND status = 'active'", request.Username).First(&user).Error; err != nil {
 		// Deliberate delay to prevent timing attacks
 		time.Sleep(time.Second)
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, errCodeInvalidCredentials, "Invalid credentials")
 		return
 	}
 	
@@ -69,29 +181,163 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	if !user.CheckPassword(request.Password) {
 		// Deliberate delay to prevent timing attacks
 		time.Sleep(time.Second)
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, errCodeInvalidCredentials, "Invalid credentials")
 		return
 	}
 	
-	// Generate JWT token
-	token, err := generateJWT(user)
+	// Generate access and refresh tokens
+	response, err := h.newLoginResponse(h.db, user)
 	if err != nil {
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to generate token")
 		return
 	}
 	
 	// Update last login time
 	h.db.Model(&user).Update("last_login", time.Now())
 	
+	// Return response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Register handles POST requests to create a new account. Self-registered accounts always
+// get the "user" role; other roles are assigned by an admin.
+func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+		FullName string `json:"full_name"`
+		Password string `json:"password"`
+	}
+	
+	r.Body = http.MaxBytesReader(w, r.Body, 1048576) // 1MB limit
+	
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body")
+		return
+	}
+	
+	// Validate required fields
+	request.Username = strings.TrimSpace(request.Username)
+	if request.Username == "" || request.Email == "" || request.FullName == "" || request.Password == "" {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Username, email, full name, and password are required")
+		return
+	}
+	
+	if len(request.Password) < 8 {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Password must be at least 8 characters")
+		return
+	}
+	
+	email, phone := request.Email, ""
+	if err := normalizeContact(&email, &phone); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, err.Error())
+		return
+	}
+	
+	// Check if username or email already exists
+	var count int64
+	if err := h.db.Model(&models.User{}).Where("username = ? OR email = ?", request.Username, email).Count(&count).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to check existing users: "+err.Error())
+		return
+	}
+	
+	if count > 0 {
+		writeError(w, http.StatusConflict, errCodeDuplicate, "Username or email already in use")
+		return
+	}
+	
+	// The password is hashed by the user's BeforeCreate hook
+	user := models.User{
+		Username:     request.Username,
+		Email:        email,
+		FullName:     request.FullName,
+		PasswordHash: request.Password,
+		Role:         models.RoleUser,
+		Status:       "active",
+	}
+	if err := h.db.Create(&user).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to create user: "+err.Error())
+		return
+	}
+	
 	// Clear sensitive fields
 	user.PasswordHash = ""
 	
-	// Return response
-	response := LoginResponse{
-		Token: token,
-		User:  user,
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+// Refresh handles POST requests to exchange a refresh token for a new access token.
+// The refresh token is rotated: the one presented is revoked and a new one is returned.
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var request RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body")
+		return
+	}
+	
+	var response *LoginResponse
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		refreshToken, err := lockActiveRefreshToken(tx, request.RefreshToken)
+		if err != nil {
+			return err
+		}
+		
+		// Deactivated users can't renew their session
+		var user models.User
+		if err := tx.Where("id = ? AND status = 'active'", refreshToken.UserID).First(&user).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errInvalidRefreshToken
+			}
+			return err
+		}
+		
+		if err := tx.Model(refreshToken).Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		
+		response, err = h.newLoginResponse(tx, user)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidRefreshToken) {
+			writeError(w, http.StatusUnauthorized, errCodeInvalidCredentials, err.Error())
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to refresh token")
+		}
+		return
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
+}
+
+// Logout handles POST requests to revoke a refresh token. Access tokens already issued
+// stay valid until they expire, which is at most accessTokenTTL.
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var request RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body")
+		return
+	}
+	
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		refreshToken, err := lockActiveRefreshToken(tx, request.RefreshToken)
+		if err != nil {
+			return err
+		}
+		return tx.Model(refreshToken).Update("revoked_at", time.Now()).Error
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidRefreshToken) {
+			writeError(w, http.StatusUnauthorized, errCodeInvalidCredentials, err.Error())
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to revoke token")
+		}
+		return
+	}
+	
+	w.WriteHeader(http.StatusNoContent)
 }
\ No newline at end of file
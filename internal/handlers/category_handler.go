@@ -15,6 +15,14 @@ type CategoryHandler struct {
 	db *gorm.DB
 }
 
+// categorySortFields maps the sort keys accepted by GetCategories to their columns
+var categorySortFields = map[string]string{
+	"name":       "name",
+	"status":     "status",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
 // NewCategoryHandler creates a new category handler
 func NewCategoryHandler(db *gorm.DB) *CategoryHandler {
 	return &CategoryHandler{db: db}
@@ -24,13 +32,57 @@ func NewCategoryHandler(db *gorm.DB) *CategoryHandler {
 func (h *CategoryHandler) GetCategories(w http.ResponseWriter, r *http.Request) {
 	var categories []models.Category
 	
-	if err := h.db.Find(&categories).Error; err != nil {
-		http.Error(w, "Failed to retrieve categories: "+err.Error(), http.StatusInternalServerError)
+	// Apply filters if any
+	query := withDeleted(r, h.db)
+	
+	if status := r.URL.Query().Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	
+	if name := r.URL.Query().Get("name"); name != "" {
+		query = query.Where("name LIKE ?", "%"+name+"%")
+	}
+	
+	// Root categories only, so a client can load the tree one level at a time
+	if r.URL.Query().Get("top_level") == "true" {
+		query = query.Where("parent_id IS NULL")
+	} else if parentID := r.URL.Query().Get("parent_id"); parentID != "" {
+		id, err := strconv.ParseUint(parentID, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid parent_id")
+			return
+		}
+		query = query.Where("parent_id = ?", id)
+	}
+	
+	// Sorting
+	order := "name ASC"
+	if sort := r.URL.Query().Get("sort"); sort != "" {
+		var err error
+		order, err = parseSort(sort, categorySortFields)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid sort parameter: "+err.Error())
+			return
+		}
+	}
+	
+	// Apply pagination; the total is counted with the same filters
+	page, limit := parsePagination(r)
+	offset := (page - 1) * limit
+	
+	var total int64
+	if err := query.Session(&gorm.Session{}).Model(&models.Category{}).Count(&total).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to count categories: "+err.Error())
+		return
+	}
+	
+	if err := query.Order(order).Limit(limit).Offset(offset).Find(&categories).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve categories: "+err.Error())
 		return
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(categories)
+	json.NewEncoder(w).Encode(newPaginatedResponse(categories, page, limit, total))
 }
 
 // GetCategory handles GET requests to retrieve a single category
@@ -38,16 +90,16 @@ func (h *CategoryHandler) GetCategory(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid category ID")
 		return
 	}
 	
 	var category models.Category
 	if err := h.db.First(&category, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Category not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Category not found")
 		} else {
-			http.Error(w, "Failed to retrieve category: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve category: "+err.Error())
 		}
 		return
 	}
@@ -61,17 +113,17 @@ func (h *CategoryHandler) CreateCategory(w http.ResponseWriter, r *http.Request)
 	var category models.Category
 	
 	if err := json.NewDecoder(r.Body).Decode(&category); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
 		return
 	}
 	
 	if category.Name == "" {
-		http.Error(w, "Category name is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Category name is required")
 		return
 	}
 	
 	if err := h.db.Create(&category).Error; err != nil {
-		http.Error(w, "Failed to create category: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to create category: "+err.Error())
 		return
 	}
 	
@@ -85,30 +137,35 @@ func (h *CategoryHandler) UpdateCategory(w http.ResponseWriter, r *http.Request)
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid category ID")
 		return
 	}
 	
 	var category models.Category
 	if err := h.db.First(&category, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Category not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Category not found")
 		} else {
-			http.Error(w, "Failed to retrieve category: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve category: "+err.Error())
 		}
 		return
 	}
 	
 	var updatedCategory models.Category
 	if err := json.NewDecoder(r.Body).Decode(&updatedCategory); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
 		return
 	}
 	
 	updatedCategory.ID = uint(id)
 	
+	// Save writes every column, so keep the status when it isn't given
+	if updatedCategory.Status == "" {
+		updatedCategory.Status = category.Status
+	}
+	
 	if err := h.db.Save(&updatedCategory).Error; err != nil {
-		http.Error(w, "Failed to update category: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update category: "+err.Error())
 		return
 	}
 	
@@ -121,22 +178,22 @@ func (h *CategoryHandler) DeleteCategory(w http.ResponseWriter, r *http.Request)
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid category ID")
 		return
 	}
 	
 	var category models.Category
 	if err := h.db.First(&category, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Category not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Category not found")
 		} else {
-			http.Error(w, "Failed to retrieve category: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve category: "+err.Error())
 		}
 		return
 	}
 	
 	if err := h.db.Delete(&category).Error; err != nil {
-		http.Error(w, "Failed to delete category: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to delete category: "+err.Error())
 		return
 	}
 	
@@ -148,13 +205,13 @@ func (h *CategoryHandler) GetSubcategories(w http.ResponseWriter, r *http.Reques
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid category ID")
 		return
 	}
 	
 	var subcategories []models.Category
 	if err := h.db.Where("parent_id = ?", id).Find(&subcategories).Error; err != nil {
-		http.Error(w, "Failed to retrieve subcategories: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve subcategories: "+err.Error())
 		return
 	}
 	
@@ -162,21 +219,217 @@ func (h *CategoryHandler) GetSubcategories(w http.ResponseWriter, r *http.Reques
 	json.NewEncoder(w).Encode(subcategories)
 }
 
+// categoryTreeNode is a category with its descendants nested beneath it
+type categoryTreeNode struct {
+	ID           uint                `json:"id"`
+	Name         string              `json:"name"`
+	Description  string              `json:"description"`
+	ParentID     *uint               `json:"parent_id"`
+	Depth        int                 `json:"depth"`
+	ProductCount *int64              `json:"product_count,omitempty"`
+	Children     []*categoryTreeNode `json:"children"`
+}
+
+// GetCategoryTree handles GET requests to retrieve a category with its whole subtree nested
+// beneath it. The subtree is read with one recursive query that tracks the path walked, so
+// a parent_id cycle ends the walk instead of looping. With counts=true (or include_counts=true)
+// each node also carries the number of products assigned directly to it.
+func (h *CategoryHandler) GetCategoryTree(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid category ID")
+		return
+	}
+	
+	var nodes []*categoryTreeNode
+	if err := h.db.Raw(`
+		WITH RECURSIVE tree AS (
+			SELECT id, name, description, parent_id, ARRAY[id] AS path, 0 AS depth
+			FROM categories
+			WHERE id = ? AND deleted_at IS NULL
+			UNION ALL
+			SELECT c.id, c.name, c.description, c.parent_id, tree.path || c.id, tree.depth + 1
+			FROM categories c
+			JOIN tree ON c.parent_id = tree.id
+			WHERE NOT c.id = ANY(tree.path) AND c.deleted_at IS NULL
+		)
+		SELECT id, name, description, parent_id, depth FROM tree ORDER BY depth, name`, id).
+		Scan(&nodes).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve category tree: "+err.Error())
+		return
+	}
+	
+	if len(nodes) == 0 {
+		writeError(w, http.StatusNotFound, errCodeNotFound, "Category not found")
+		return
+	}
+	
+	byID := make(map[uint]*categoryTreeNode, len(nodes))
+	for _, node := range nodes {
+		node.Children = []*categoryTreeNode{}
+		byID[node.ID] = node
+	}
+	
+	if wantsProductCounts(r) {
+		if err := h.attachProductCounts(byID); err != nil {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to count category products: "+err.Error())
+			return
+		}
+	}
+	
+	// Rows come out parents first, so every child's parent is already in place
+	for _, node := range nodes[1:] {
+		if parent, ok := byID[*node.ParentID]; ok {
+			parent.Children = append(parent.Children, node)
+		}
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(nodes[0])
+}
+
+// GetCategoryForest handles GET requests for the whole category hierarchy, nested under each
+// root category. All categories are read in one query and linked up in memory. A category
+// whose parent is missing (deleted) is listed as a root; categories caught in a parent_id
+// cycle can't be reached from any root and are left out rather than looping.
+func (h *CategoryHandler) GetCategoryForest(w http.ResponseWriter, r *http.Request) {
+	var nodes []*categoryTreeNode
+	if err := h.db.Model(&models.Category{}).
+		Select("id, name, description, parent_id").
+		Order("name").
+		Scan(&nodes).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve categories: "+err.Error())
+		return
+	}
+	
+	byID := make(map[uint]*categoryTreeNode, len(nodes))
+	for _, node := range nodes {
+		node.Children = []*categoryTreeNode{}
+		byID[node.ID] = node
+	}
+	
+	if wantsProductCounts(r) && len(nodes) > 0 {
+		if err := h.attachProductCounts(byID); err != nil {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to count category products: "+err.Error())
+			return
+		}
+	}
+	
+	// Children keep the name order of the query
+	roots := []*categoryTreeNode{}
+	children := make(map[uint][]*categoryTreeNode)
+	for _, node := range nodes {
+		if node.ParentID == nil || byID[*node.ParentID] == nil {
+			roots = append(roots, node)
+		} else {
+			children[*node.ParentID] = append(children[*node.ParentID], node)
+		}
+	}
+	
+	// Walk down from the roots; visited guards against a node being linked twice
+	visited := make(map[uint]bool, len(nodes))
+	var attach func(node *categoryTreeNode, depth int)
+	attach = func(node *categoryTreeNode, depth int) {
+		visited[node.ID] = true
+		node.Depth = depth
+		for _, child := range children[node.ID] {
+			if visited[child.ID] {
+				continue
+			}
+			node.Children = append(node.Children, child)
+			attach(child, depth+1)
+		}
+	}
+	for _, root := range roots {
+		attach(root, 0)
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(roots)
+}
+
+// wantsProductCounts reports whether a tree request asked for per-node product counts
+func wantsProductCounts(r *http.Request) bool {
+	return r.URL.Query().Get("counts") == "true" || r.URL.Query().Get("include_counts") == "true"
+}
+
+// attachProductCounts sets each node's count of products assigned directly to it
+func (h *CategoryHandler) attachProductCounts(byID map[uint]*categoryTreeNode) error {
+	ids := make([]uint, 0, len(byID))
+	for id, node := range byID {
+		ids = append(ids, id)
+		node.ProductCount = new(int64)
+	}
+	
+	var counts []struct {
+		CategoryID uint
+		Count      int64
+	}
+	if err := h.db.Table("product_category").
+		Select("category_id, COUNT(*) as count").
+		Where("category_id IN ?", ids).
+		Group("category_id").
+		Scan(&counts).Error; err != nil {
+		return err
+	}
+	
+	for _, count := range counts {
+		*byID[count.CategoryID].ProductCount = count.Count
+	}
+	return nil
+}
+
+// GetCategoryPath handles GET requests for the breadcrumb trail of a category: its ancestors
+// from the root down to the category. complete is false when a broken parent reference cut
+// the walk short, in which case the path starts at the highest category that resolved.
+func (h *CategoryHandler) GetCategoryPath(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid category ID")
+		return
+	}
+	
+	var category models.Category
+	if err := h.db.First(&category, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Category not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve category: "+err.Error())
+		}
+		return
+	}
+	
+	path, err := category.GetCategoryPath(h.db)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve category path: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"category_id": category.ID,
+		"path":        path,
+		"complete":    len(path) > 0 && path[0].ParentID == nil,
+	})
+}
+
 // GetCategoryProducts handles GET requests to retrieve products in a category
 func (h *CategoryHandler) GetCategoryProducts(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid category ID")
 		return
 	}
 	
 	var category models.Category
 	if err := h.db.First(&category, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Category not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Category not found")
 		} else {
-			http.Error(w, "Failed to retrieve category: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve category: "+err.Error())
 		}
 		return
 	}
@@ -185,10 +438,15 @@ func (h *CategoryHandler) GetCategoryProducts(w http.ResponseWriter, r *http.Req
 	if err := h.db.Joins("JOIN product_category ON products.id = product_category.product_id").
 		Where("product_category.category_id = ?", id).
 		Find(&products).Error; err != nil {
-		http.Error(w, "Failed to retrieve products: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve products: "+err.Error())
 		return
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(products)
+}
+
+// RestoreCategory handles POST requests to undo a category's soft delete
+func (h *CategoryHandler) RestoreCategory(w http.ResponseWriter, r *http.Request) {
+	restoreDeleted(w, r, h.db, &models.Category{}, "category", "category")
 }
\ No newline at end of file
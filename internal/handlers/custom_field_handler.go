@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/yourusername/inventory-management-system/internal/models"
+	"gorm.io/gorm"
+)
+
+// CustomFieldHandler handles HTTP requests for product custom field definitions
+type CustomFieldHandler struct {
+	db *gorm.DB
+}
+
+// NewCustomFieldHandler creates a new custom field handler
+func NewCustomFieldHandler(db *gorm.DB) *CustomFieldHandler {
+	return &CustomFieldHandler{db: db}
+}
+
+// GetCustomFields handles GET requests to list the custom field definitions
+func (h *CustomFieldHandler) GetCustomFields(w http.ResponseWriter, r *http.Request) {
+	fields := []models.CustomField{}
+	if err := h.db.Order("name").Find(&fields).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve custom fields: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fields)
+}
+
+// CreateCustomField handles POST requests to define a new custom field
+func (h *CustomFieldHandler) CreateCustomField(w http.ResponseWriter, r *http.Request) {
+	var field models.CustomField
+	if err := json.NewDecoder(r.Body).Decode(&field); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	field.ID = 0
+	
+	if err := field.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, err.Error())
+		return
+	}
+	
+	var existing int64
+	if err := h.db.Model(&models.CustomField{}).Where("name = ?", field.Name).Count(&existing).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to check custom field: "+err.Error())
+		return
+	}
+	if existing > 0 {
+		writeError(w, http.StatusConflict, errCodeDuplicate, "Custom field with this name already exists")
+		return
+	}
+	
+	if err := h.db.Create(&field).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to create custom field: "+err.Error())
+		return
+	}
+	recordAudit(h.db, r, "create", "custom_field", field.ID, nil, field)
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(field)
+}
+
+// UpdateCustomField handles PUT requests to change a custom field's label or options. The
+// name and type can't change, since products already hold values under them.
+func (h *CustomFieldHandler) UpdateCustomField(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid custom field ID")
+		return
+	}
+	
+	var field models.CustomField
+	if err := h.db.First(&field, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Custom field not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve custom field: "+err.Error())
+		}
+		return
+	}
+	oldField := field
+	
+	var request struct {
+		Label   string   `json:"label"`
+		Options []string `json:"options"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	
+	field.Label = request.Label
+	field.OptionList = request.Options
+	if err := field.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, err.Error())
+		return
+	}
+	
+	if err := h.db.Save(&field).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update custom field: "+err.Error())
+		return
+	}
+	recordAudit(h.db, r, "update", "custom_field", field.ID, oldField, field)
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(field)
+}
+
+// DeleteCustomField handles DELETE requests to remove a custom field definition along
+// with every product's value for it
+func (h *CustomFieldHandler) DeleteCustomField(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid custom field ID")
+		return
+	}
+	
+	var field models.CustomField
+	if err := h.db.First(&field, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Custom field not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve custom field: "+err.Error())
+		}
+		return
+	}
+	
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// Deleted products keep their history, so their values go too
+		if err := tx.Unscoped().Model(&models.Product{}).Where("jsonb_exists(custom_fields, ?)", field.Name).
+			UpdateColumns(map[string]interface{}{
+				"custom_fields": gorm.Expr("custom_fields - ?", field.Name),
+				"version":       gorm.Expr("version + 1"),
+			}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&field).Error
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to delete custom field: "+err.Error())
+		return
+	}
+	recordAudit(h.db, r, "delete", "custom_field", field.ID, field, nil)
+	
+	w.WriteHeader(http.StatusNoContent)
+}
\ No newline at end of file
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/yourusername/inventory-management-system/internal/models"
@@ -25,7 +26,7 @@ func (h *CustomerHandler) GetCustomers(w http.ResponseWriter, r *http.Request) {
 	var customers []models.Customer
 	
 	// Apply filters if any
-	query := h.db
+	query := withDeleted(r, h.db.Model(&models.Customer{}))
 	
 	if status := r.URL.Query().Get("status"); status != "" {
 		query = query.Where("status = ?", status)
@@ -36,35 +37,35 @@ func (h *CustomerHandler) GetCustomers(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	if email := r.URL.Query().Get("email"); email != "" {
-		query = query.Where("email LIKE ?", "%"+email+"%")
+		// Stored emails are lowercased on save
+		query = query.Where("email LIKE ?", "%"+strings.ToLower(strings.TrimSpace(email))+"%")
 	}
 	
-	// Apply pagination
-	page := 1
-	limit := 10
-	
-	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
-		if pageNum, err := strconv.Atoi(pageStr); err == nil && pageNum > 0 {
-			page = pageNum
-		}
-	}
-	
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-		if limitNum, err := strconv.Atoi(limitStr); err == nil && limitNum > 0 {
-			limit = limitNum
-		}
+	timestamps, err := parseTimestampFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidParameter, err.Error())
+		return
 	}
+	query = timestamps.apply(query, "customers")
 	
+	// Apply pagination; the total is counted with the same filters
+	page, limit := parsePagination(r)
 	offset := (page - 1) * limit
 	
+	var total int64
+	if err := query.Session(&gorm.Session{}).Model(&models.Customer{}).Count(&total).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to count customers: "+err.Error())
+		return
+	}
+	
 	// Execute query
 	if err := query.Order("name ASC").Limit(limit).Offset(offset).Find(&customers).Error; err != nil {
-		http.Error(w, "Failed to retrieve customers: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve customers: "+err.Error())
 		return
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(customers)
+	json.NewEncoder(w).Encode(newPaginatedResponse(customers, page, limit, total))
 }
 
 // GetCustomer handles GET requests to retrieve a single customer
@@ -72,16 +73,16 @@ func (h *CustomerHandler) GetCustomer(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid customer ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid customer ID")
 		return
 	}
 	
 	var customer models.Customer
 	if err := h.db.First(&customer, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Customer not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Customer not found")
 		} else {
-			http.Error(w, "Failed to retrieve customer: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve customer: "+err.Error())
 		}
 		return
 	}
@@ -95,13 +96,23 @@ func (h *CustomerHandler) CreateCustomer(w http.ResponseWriter, r *http.Request)
 	var customer models.Customer
 	
 	if err := json.NewDecoder(r.Body).Decode(&customer); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
 		return
 	}
 	
 	// Validate required fields
 	if customer.Name == "" {
-		http.Error(w, "Customer name is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Customer name is required")
+		return
+	}
+	
+	if customer.PaymentTerms != "" && !models.IsValidPaymentTerms(customer.PaymentTerms) {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Invalid payment terms: "+customer.PaymentTerms)
+		return
+	}
+	
+	if err := normalizeContact(&customer.Email, &customer.Phone); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, err.Error())
 		return
 	}
 	
@@ -112,7 +123,7 @@ func (h *CustomerHandler) CreateCustomer(w http.ResponseWriter, r *http.Request)
 	
 	// Create customer in database
 	if err := h.db.Create(&customer).Error; err != nil {
-		http.Error(w, "Failed to create customer: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to create customer: "+err.Error())
 		return
 	}
 	
@@ -126,7 +137,7 @@ func (h *CustomerHandler) UpdateCustomer(w http.ResponseWriter, r *http.Request)
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid customer ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid customer ID")
 		return
 	}
 	
@@ -134,9 +145,9 @@ func (h *CustomerHandler) UpdateCustomer(w http.ResponseWriter, r *http.Request)
 	var existingCustomer models.Customer
 	if err := h.db.First(&existingCustomer, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Customer not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Customer not found")
 		} else {
-			http.Error(w, "Failed to retrieve customer: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve customer: "+err.Error())
 		}
 		return
 	}
@@ -144,7 +155,17 @@ func (h *CustomerHandler) UpdateCustomer(w http.ResponseWriter, r *http.Request)
 	// Parse request body
 	var updatedCustomer models.Customer
 	if err := json.NewDecoder(r.Body).Decode(&updatedCustomer); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	
+	if updatedCustomer.PaymentTerms != "" && !models.IsValidPaymentTerms(updatedCustomer.PaymentTerms) {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Invalid payment terms: "+updatedCustomer.PaymentTerms)
+		return
+	}
+	
+	if err := normalizeContact(&updatedCustomer.Email, &updatedCustomer.Phone); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, err.Error())
 		return
 	}
 	
@@ -153,14 +174,14 @@ func (h *CustomerHandler) UpdateCustomer(w http.ResponseWriter, r *http.Request)
 	
 	// Update in database
 	if err := h.db.Model(&updatedCustomer).Updates(updatedCustomer).Error; err != nil {
-		http.Error(w, "Failed to update customer: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update customer: "+err.Error())
 		return
 	}
 	
 	// Retrieve updated customer
 	var finalCustomer models.Customer
 	if err := h.db.First(&finalCustomer, id).Error; err != nil {
-		http.Error(w, "Failed to retrieve updated customer: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve updated customer: "+err.Error())
 		return
 	}
 	
@@ -173,7 +194,7 @@ func (h *CustomerHandler) DeleteCustomer(w http.ResponseWriter, r *http.Request)
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid customer ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid customer ID")
 		return
 	}
 	
@@ -181,34 +202,19 @@ func (h *CustomerHandler) DeleteCustomer(w http.ResponseWriter, r *http.Request)
 	var customer models.Customer
 	if err := h.db.First(&customer, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Customer not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Customer not found")
 		} else {
-			http.Error(w, "Failed to retrieve customer: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve customer: "+err.Error())
 		}
 		return
 	}
 	
-	// Check if customer has any sales orders
-	var count int64
-	if err := h.db.Model(&models.SalesOrder{}).Where("customer_id = ?", id).Count(&count).Error; err != nil {
-		http.Error(w, "Failed to check customer usage: "+err.Error(), http.StatusInternalServerError)
+	// Soft delete; the customer stays linked to its sales orders and can be restored
+	if err := h.db.Delete(&customer).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to delete customer: "+err.Error())
 		return
 	}
 	
-	if count > 0 {
-		// Soft delete by updating status
-		if err := h.db.Model(&customer).Update("status", "inactive").Error; err != nil {
-			http.Error(w, "Failed to deactivate customer: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-	} else {
-		// Hard delete if no orders are associated
-		if err := h.db.Delete(&customer).Error; err != nil {
-			http.Error(w, "Failed to delete customer: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-	}
-	
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -217,7 +223,7 @@ func (h *CustomerHandler) GetCustomerSalesOrders(w http.ResponseWriter, r *http.
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid customer ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid customer ID")
 		return
 	}
 	
@@ -225,9 +231,9 @@ func (h *CustomerHandler) GetCustomerSalesOrders(w http.ResponseWriter, r *http.
 	var customer models.Customer
 	if err := h.db.First(&customer, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Customer not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Customer not found")
 		} else {
-			http.Error(w, "Failed to retrieve customer: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve customer: "+err.Error())
 		}
 		return
 	}
@@ -235,10 +241,15 @@ func (h *CustomerHandler) GetCustomerSalesOrders(w http.ResponseWriter, r *http.
 	// Get orders
 	var orders []models.SalesOrder
 	if err := h.db.Where("customer_id = ?", id).Order("created_at DESC").Find(&orders).Error; err != nil {
-		http.Error(w, "Failed to retrieve sales orders: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve sales orders: "+err.Error())
 		return
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(orders)
+}
+
+// RestoreCustomer handles POST requests to undo a customer's soft delete
+func (h *CustomerHandler) RestoreCustomer(w http.ResponseWriter, r *http.Request) {
+	restoreDeleted(w, r, h.db, &models.Customer{}, "customer", "customer")
 }
\ No newline at end of file
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/yourusername/inventory-management-system/internal/models"
+	"github.com/yourusername/inventory-management-system/internal/repository"
+	"gorm.io/gorm"
+)
+
+// Error codes returned in the "code" field of error responses. Clients should branch on
+// these rather than on the message text, which is meant for people and may change.
+const (
+	errCodeInvalidBody            = "INVALID_BODY"            // The body isn't valid JSON for the endpoint
+	errCodeInvalidID              = "INVALID_ID"              // A path ID isn't a number
+	errCodeInvalidParameter       = "INVALID_PARAMETER"       // A query parameter has a bad value
+	errCodeValidationFailed       = "VALIDATION_FAILED"       // A field is missing or out of range
+	errCodeInvalidReference       = "INVALID_REFERENCE"       // A field refers to a missing or inactive record
+	errCodeInvalidState           = "INVALID_STATE"           // The record's status doesn't allow the action
+	errCodeInsufficientStock      = "INSUFFICIENT_STOCK"      // Not enough stock to carry out the request
+	errCodeNotFound               = "NOT_FOUND"               // The record in the path doesn't exist
+	errCodeDuplicate              = "DUPLICATE"               // A unique value is already taken
+	errCodeConflict               = "CONFLICT"                // The request clashes with the current data
+	errCodeVersionConflict        = "VERSION_CONFLICT"        // The record changed since the client read its version
+	errCodeIdempotencyConflict    = "IDEMPOTENCY_CONFLICT"    // An Idempotency-Key is in use or was used differently
+	errCodeUnacknowledgedWarnings = "UNACKNOWLEDGED_WARNINGS" // Retry with acknowledge_warnings=true
+	errCodeUnauthenticated        = "UNAUTHENTICATED"         // No authenticated user
+	errCodeInvalidCredentials     = "INVALID_CREDENTIALS"     // Wrong username, password or refresh token
+	errCodeNotImplemented         = "NOT_IMPLEMENTED"         // The requested option isn't supported yet
+	errCodeInternal               = "INTERNAL_ERROR"          // Unexpected server or database failure
+)
+
+// errorBody is the "error" member of every error response
+type errorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeError writes a JSON error response: {"error": {"code": ..., "message": ...}}
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeErrorDetails(w, status, code, message, nil)
+}
+
+// writeErrorDetails writes a JSON error response with extra top-level members alongside
+// "error", such as the warnings a request has to acknowledge
+func writeErrorDetails(w http.ResponseWriter, status int, code, message string, details map[string]interface{}) {
+	body := map[string]interface{}{
+		"error": errorBody{Code: code, Message: message},
+	}
+	for key, value := range details {
+		body[key] = value
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeVersionConflict writes the 409 for an update made against a stale version, with
+// the record's current version so the client can reload and retry
+func writeVersionConflict(w http.ResponseWriter, db *gorm.DB, model interface{}, id uint) {
+	var current int
+	db.Model(model).Select("version").Where("id = ?", id).Scan(&current)
+	writeErrorDetails(w, http.StatusConflict, errCodeVersionConflict, models.ErrVersionConflict.Error(), map[string]interface{}{
+		"current_version": current,
+	})
+}
+
+// writeLocationStockError writes the response for an error from repository.ApplyLocationStock
+// or TransactionRepository.Create. A missing, foreign or understocked location, or too little
+// stock overall, is the client's to fix; anything else is reported as failure followed by the error.
+func writeLocationStockError(w http.ResponseWriter, err error, failure string) {
+	switch {
+	case errors.Is(err, repository.ErrLocationRequired), errors.Is(err, repository.ErrLocationNotInWarehouse):
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, err.Error())
+	case errors.Is(err, repository.ErrInsufficientLocationStock), errors.Is(err, repository.ErrNegativeStock):
+		writeError(w, http.StatusBadRequest, errCodeInsufficientStock, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, errCodeInternal, failure+": "+err.Error())
+	}
+}
\ No newline at end of file
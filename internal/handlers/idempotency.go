@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/yourusername/inventory-management-system/internal/models"
+	"gorm.io/gorm"
+)
+
+// recordingResponseWriter passes a response through while keeping a copy of it
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// WriteHeader captures the status code and passes it to the wrapped ResponseWriter
+func (rw *recordingResponseWriter) WriteHeader(code int) {
+	rw.status = code
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+// Write copies the body and passes it to the wrapped ResponseWriter
+func (rw *recordingResponseWriter) Write(b []byte) (int, error) {
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+// idempotent wraps a create handler so requests sent with an Idempotency-Key header are
+// only processed once per user and key. A repeat with the same body within
+// models.IdempotencyKeyTTL gets the original response replayed; a repeat with a different
+// body, or one arriving while the first is still running, gets 409. Only successful
+// responses are kept, so a request that failed can be retried with the same key.
+func idempotent(db *gorm.DB, endpoint string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > 255 {
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Idempotency-Key must be at most 255 characters")
+			return
+		}
+		
+		userID, ok := r.Context().Value("userID").(uint)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
+			return
+		}
+		
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Failed to read request body: "+err.Error())
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		
+		record := models.IdempotencyKey{
+			UserID:      userID,
+			Key:         key,
+			Endpoint:    endpoint,
+			RequestHash: requestHash(body),
+			ExpiresAt:   time.Now().Add(models.IdempotencyKeyTTL),
+		}
+		
+		// Claim the key; the unique index makes a concurrent claim of the same key fail
+		if err := db.Where("user_id = ? AND key = ? AND expires_at <= ?", userID, key, time.Now()).
+			Delete(&models.IdempotencyKey{}).Error; err != nil {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to check idempotency key: "+err.Error())
+			return
+		}
+		if err := db.Create(&record).Error; err != nil {
+			var existing models.IdempotencyKey
+			if findErr := db.Where("user_id = ? AND key = ?", userID, key).First(&existing).Error; findErr != nil {
+				writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to check idempotency key: "+findErr.Error())
+				return
+			}
+			replayIdempotentResponse(w, &existing, &record)
+			return
+		}
+		
+		recorder := &recordingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, r)
+		
+		if recorder.status < 200 || recorder.status >= 300 {
+			releaseIdempotencyKey(db, &record)
+			return
+		}
+		
+		var created struct {
+			ID uint `json:"id"`
+		}
+		json.Unmarshal(recorder.body.Bytes(), &created)
+		
+		if err := db.Model(&record).Updates(map[string]interface{}{
+			"resource_id":   created.ID,
+			"status_code":   recorder.status,
+			"response_body": recorder.body.String(),
+		}).Error; err != nil {
+			// Without the stored response a retry would be told the request is still running
+			// until the key expires; releasing it lets the client retry instead
+			log.Printf("Failed to store response for idempotency key %q: %v", record.Key, err)
+			releaseIdempotencyKey(db, &record)
+		}
+	}
+}
+
+// releaseIdempotencyKey deletes a claimed key so the request can be retried with it. A key
+// that can't be deleted blocks retries until it expires, so the failure is logged.
+func releaseIdempotencyKey(db *gorm.DB, record *models.IdempotencyKey) {
+	if err := db.Delete(record).Error; err != nil {
+		log.Printf("Failed to release idempotency key %q; retries are blocked until it expires: %v", record.Key, err)
+	}
+}
+
+// requestHash fingerprints a request body. JSON is hashed in a canonical form, so a retry
+// that only reorders keys or changes whitespace still counts as the same request.
+func requestHash(body []byte) string {
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err == nil {
+		if canonical, err := json.Marshal(decoded); err == nil {
+			body = canonical
+		}
+	}
+	
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// replayIdempotentResponse answers a request whose key is already stored
+func replayIdempotentResponse(w http.ResponseWriter, existing, request *models.IdempotencyKey) {
+	if existing.Endpoint != request.Endpoint || existing.RequestHash != request.RequestHash {
+		writeError(w, http.StatusConflict, errCodeIdempotencyConflict, "Idempotency-Key was already used with a different request")
+		return
+	}
+	
+	if existing.StatusCode == 0 {
+		writeError(w, http.StatusConflict, errCodeIdempotencyConflict, "A request with this Idempotency-Key is still being processed")
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Idempotent-Replayed", "true")
+	if existing.ResourceID != 0 {
+		w.Header().Set("Idempotent-Resource-Id", strconv.FormatUint(uint64(existing.ResourceID), 10))
+	}
+	w.WriteHeader(existing.StatusCode)
+	io.WriteString(w, existing.ResponseBody)
+}
\ No newline at end of file
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// parseSort validates a client-supplied sort expression against an allowlist.
+// The expression is a field name optionally followed by a direction, either as
+// "field:desc" or "field desc". The allowed map translates API field names to
+// the SQL column used in the ORDER BY clause, so raw input never reaches the query.
+func parseSort(sort string, allowed map[string]string) (string, error) {
+	sort = strings.TrimSpace(sort)
+	field := sort
+	direction := "ASC"
+	
+	if i := strings.IndexAny(sort, ": "); i >= 0 {
+		field = sort[:i]
+		switch strings.ToLower(strings.TrimSpace(sort[i+1:])) {
+		case "asc":
+			direction = "ASC"
+		case "desc":
+			direction = "DESC"
+		default:
+			return "", fmt.Errorf("invalid sort direction in %q", sort)
+		}
+	}
+	
+	column, ok := allowed[strings.ToLower(field)]
+	if !ok {
+		return "", fmt.Errorf("invalid sort field %q", field)
+	}
+	
+	return column + " " + direction, nil
+}
+
+// paginatedResponse is the envelope returned by paginated list endpoints
+type paginatedResponse struct {
+	Data       interface{} `json:"data"`
+	Page       int         `json:"page"`
+	Limit      int         `json:"limit"`
+	Total      int64       `json:"total"`
+	TotalPages int         `json:"total_pages"`
+}
+
+// newPaginatedResponse wraps one page of results with the counts clients need for paging
+func newPaginatedResponse(data interface{}, page, limit int, total int64) paginatedResponse {
+	return paginatedResponse{
+		Data:       data,
+		Page:       page,
+		Limit:      limit,
+		Total:      total,
+		TotalPages: int(math.Ceil(float64(total) / float64(limit))),
+	}
+}
+
+// parsePagination reads the page and limit query parameters, defaulting to the first page of 10
+func parsePagination(r *http.Request) (page, limit int) {
+	page = 1
+	limit = 10
+	
+	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+		if pageNum, err := strconv.Atoi(pageStr); err == nil && pageNum > 0 {
+			page = pageNum
+		}
+	}
+	
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if limitNum, err := strconv.Atoi(limitStr); err == nil && limitNum > 0 {
+			limit = limitNum
+		}
+	}
+	
+	return page, limit
+}
+
+// parseDateParam parses a date query parameter given either as YYYY-MM-DD or RFC 3339
+func parseDateParam(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// timestampFilter bounds a list by record creation and update time, for clients that
+// poll for what changed since their last sync. Zero bounds are not applied.
+type timestampFilter struct {
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+}
+
+// parseTimestampFilter reads the created_after, created_before and updated_after query
+// parameters, each given as YYYY-MM-DD or RFC 3339
+func parseTimestampFilter(r *http.Request) (timestampFilter, error) {
+	var filter timestampFilter
+	bounds := []struct {
+		name  string
+		value *time.Time
+	}{
+		{"created_after", &filter.CreatedAfter},
+		{"created_before", &filter.CreatedBefore},
+		{"updated_after", &filter.UpdatedAfter},
+	}
+	
+	for _, bound := range bounds {
+		raw := r.URL.Query().Get(bound.name)
+		if raw == "" {
+			continue
+		}
+		t, err := parseDateParam(raw)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s: must be YYYY-MM-DD or RFC 3339", bound.name)
+		}
+		*bound.value = t
+	}
+	
+	if !filter.CreatedAfter.IsZero() && !filter.CreatedBefore.IsZero() && filter.CreatedBefore.Before(filter.CreatedAfter) {
+		return filter, errors.New("created_before must not be before created_after")
+	}
+	
+	return filter, nil
+}
+
+// apply adds the filter's bounds to a query on table
+func (f timestampFilter) apply(query *gorm.DB, table string) *gorm.DB {
+	if !f.CreatedAfter.IsZero() {
+		query = query.Where(table+".created_at > ?", f.CreatedAfter)
+	}
+	if !f.CreatedBefore.IsZero() {
+		query = query.Where(table+".created_at < ?", f.CreatedBefore)
+	}
+	if !f.UpdatedAfter.IsZero() {
+		query = query.Where(table+".updated_at > ?", f.UpdatedAfter)
+	}
+	return query
+}
+
+
+// requireActiveReference checks that the record a request field refers to exists and hasn't
+// been deactivated. On failure it writes the response, naming field, and returns false.
+// model is a pointer to the referenced model, e.g. &models.Warehouse{}.
+func requireActiveReference(w http.ResponseWriter, db *gorm.DB, model interface{}, id uint, field, label string) bool {
+	var record struct {
+		Status string
+	}
+	err := db.Model(model).Where("id = ?", id).Select("status").Take(&record).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve "+label+": "+err.Error())
+		return false
+	}
+	
+	message := ""
+	switch {
+	case err == gorm.ErrRecordNotFound:
+		message = fmt.Sprintf("%s %d not found", label, id)
+	case record.Status == "inactive":
+		message = fmt.Sprintf("%s %d is inactive", label, id)
+	default:
+		return true
+	}
+	
+	writeErrorDetails(w, http.StatusBadRequest, errCodeInvalidReference, strings.ToUpper(message[:1])+message[1:], map[string]interface{}{
+		"field": field,
+	})
+	return false
+}
+
+// withDeleted returns query with soft-deleted records included when the request sets include_deleted=true
+func withDeleted(r *http.Request, query *gorm.DB) *gorm.DB {
+	if r.URL.Query().Get("include_deleted") == "true" {
+		return query.Unscoped()
+	}
+	return query
+}
+
+// includeDeleted is a Preload condition that keeps soft-deleted records, so an order still
+// shows the customer, supplier, warehouse, user or product it was placed with after that
+// record is deleted
+func includeDeleted(db *gorm.DB) *gorm.DB {
+	return db.Unscoped()
+}
+
+// restoreDeleted handles a POST /{entity}/{id}/restore request by clearing the soft-delete
+// mark on the record with the route's ID. model is a pointer to an empty model, e.g.
+// &models.Supplier{}, and is filled with the restored record for the response.
+func restoreDeleted(w http.ResponseWriter, r *http.Request, db *gorm.DB, model interface{}, entityType, label string) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid "+label+" ID")
+		return
+	}
+	
+	var deleted int64
+	if err := db.Unscoped().Model(model).Where("id = ? AND deleted_at IS NOT NULL", id).Count(&deleted).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve "+label+": "+err.Error())
+		return
+	}
+	if deleted == 0 {
+		if err := db.First(model, id).Error; err == nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidState, strings.ToUpper(label[:1])+label[1:]+" is not deleted")
+		} else {
+			writeError(w, http.StatusNotFound, errCodeNotFound, strings.ToUpper(label[:1])+label[1:]+" not found")
+		}
+		return
+	}
+	
+	if err := db.Unscoped().Model(model).Where("id = ?", id).Update("deleted_at", nil).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to restore "+label+": "+err.Error())
+		return
+	}
+	
+	if err := db.First(model, id).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve restored "+label+": "+err.Error())
+		return
+	}
+	recordAudit(db, r, "restore", entityType, uint(id), nil, model)
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(model)
+}
+
+// normalizeContact validates and canonicalizes an email address and phone number in place.
+// Emails are trimmed and lowercased and must be a bare address with a dotted domain. Phones
+// keep only their digits and an optional leading "+", e.g. "(555) 123-4567" becomes
+// "5551234567". Empty values are left empty.
+func normalizeContact(email, phone *string) error {
+	if *email = strings.ToLower(strings.TrimSpace(*email)); *email != "" {
+		address, err := mail.ParseAddress(*email)
+		if err != nil || address.Address != *email || address.Name != "" {
+			return fmt.Errorf("invalid email address %q", *email)
+		}
+		
+		domain := (*email)[strings.LastIndex(*email, "@")+1:]
+		if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+			return fmt.Errorf("invalid email address %q", *email)
+		}
+	}
+	
+	if *phone = strings.TrimSpace(*phone); *phone != "" {
+		var b strings.Builder
+		for i, c := range *phone {
+			switch {
+			case c >= '0' && c <= '9':
+				b.WriteRune(c)
+			case c == '+' && i == 0:
+				b.WriteRune(c)
+			case c == ' ' || c == '-' || c == '.' || c == '(' || c == ')':
+				// Formatting characters are dropped
+			default:
+				return fmt.Errorf("invalid phone number %q", *phone)
+			}
+		}
+		
+		// E.164 allows at most 15 digits
+		digits := strings.TrimPrefix(b.String(), "+")
+		if len(digits) < 7 || len(digits) > 15 {
+			return errors.New("invalid phone number: must have between 7 and 15 digits")
+		}
+		*phone = b.String()
+	}
+	
+	return nil
+}
+
+// clientIP returns the address of the client that made the request, without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// expectedVersion returns the version a client expects to update: the If-Match header when
+// sent (the number from the ETag, quoted or not), else the body's version, else current,
+// the version just read. It writes a 400 and returns false if If-Match isn't a version.
+func expectedVersion(w http.ResponseWriter, r *http.Request, bodyVersion, current int) (int, bool) {
+	if header := strings.TrimSpace(r.Header.Get("If-Match")); header != "" {
+		version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(header, "W/"), `"`))
+		if err != nil || version < 1 {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "If-Match must be a version from the record's ETag")
+			return 0, false
+		}
+		return version, true
+	}
+	if bodyVersion > 0 {
+		return bodyVersion, true
+	}
+	return current, true
+}
+
+// setVersionETag exposes a record's version as its ETag, to be sent back in If-Match
+func setVersionETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", strconv.Quote(strconv.Itoa(version)))
+}
\ No newline at end of file
@@ -0,0 +1,46 @@
+package handlers
+
+import "testing"
+
+func TestParseSortAcceptsAllowlistedFields(t *testing.T) {
+	tests := []struct {
+		sort string
+		want string
+	}{
+		{"name", "products.name ASC"},
+		{"price:desc", "products.price DESC"},
+		{"created_at asc", "products.created_at ASC"},
+		{" SKU:DESC ", "products.sku DESC"},
+	}
+
+	for _, tt := range tests {
+		got, err := parseSort(tt.sort, productSortFields)
+		if err != nil {
+			t.Errorf("parseSort(%q): %v", tt.sort, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseSort(%q) = %q, want %q", tt.sort, got, tt.want)
+		}
+	}
+}
+
+func TestParseSortRejectsInjection(t *testing.T) {
+	attempts := []string{
+		"name; DROP TABLE products",
+		"name:desc; DROP TABLE products",
+		"name desc, (SELECT password_hash FROM users LIMIT 1)",
+		"(CASE WHEN (SELECT 1) = 1 THEN name ELSE sku END)",
+		"products.name",
+		"name:sideways",
+		"password_hash",
+		"1",
+		"",
+	}
+
+	for _, sort := range attempts {
+		if order, err := parseSort(sort, productSortFields); err == nil {
+			t.Errorf("parseSort(%q) = %q, want an error", sort, order)
+		}
+	}
+}
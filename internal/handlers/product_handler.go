@@ -1,14 +1,27 @@
 package handlers
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"log"
+	"math"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/yourusername/inventory-management-system/internal/models"
 	"github.com/yourusername/inventory-management-system/internal/repository"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // ProductHandler handles HTTP requests for product endpoints
@@ -17,6 +30,26 @@ type ProductHandler struct {
 	db   *gorm.DB
 }
 
+// productSortFields maps the sortable product list fields to their columns
+var productSortFields = map[string]string{
+	"name":          "products.name",
+	"sku":           "products.sku",
+	"price":         "products.price",
+	"cost_price":    "products.cost_price",
+	"quantity":      "products.quantity",
+	"reorder_level": "products.reorder_level",
+	"status":        "products.status",
+	"created_at":    "products.created_at",
+	"updated_at":    "products.updated_at",
+}
+
+var (
+	errNotABundle              = errors.New("Product is not a bundle")
+	errInsufficientBundleStock = errors.New("Insufficient bundle stock to disassemble")
+	errWarehouseNotFound       = errors.New("Warehouse not found")
+	errInsufficientStock       = errors.New("Insufficient available stock")
+)
+
 // NewProductHandler creates a new product handler
 func NewProductHandler(db *gorm.DB) *ProductHandler {
 	return &ProductHandler{
@@ -38,6 +71,15 @@ func (h *ProductHandler) GetProducts(w http.ResponseWriter, r *http.Request) {
 	// Search
 	if search := r.URL.Query().Get("search"); search != "" {
 		params["search"] = search
+		
+		switch match := r.URL.Query().Get("match"); match {
+		case "", "all":
+		case "exact":
+			params["search_match"] = match
+		default:
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid match: must be all or exact")
+			return
+		}
 	}
 	
 	// Status filter
@@ -45,36 +87,87 @@ func (h *ProductHandler) GetProducts(w http.ResponseWriter, r *http.Request) {
 		params["status"] = status
 	}
 	
-	// Sorting
-	if sort := r.URL.Query().Get("sort"); sort != "" {
-		params["sort"] = sort
+	// Soft-deleted products are only listed on request
+	if r.URL.Query().Get("include_deleted") == "true" {
+		params["include_deleted"] = true
 	}
 	
-	// Pagination
-	if page := r.URL.Query().Get("page"); page != "" {
-		pageNum, err := strconv.Atoi(page)
-		if err == nil && pageNum > 0 {
-			params["page"] = pageNum
-			
-			if limit := r.URL.Query().Get("limit"); limit != "" {
-				limitNum, err := strconv.Atoi(limit)
-				if err == nil && limitNum > 0 {
-					params["limit"] = limitNum
-				}
+	// Creation and update time filters
+	timestamps, err := parseTimestampFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidParameter, err.Error())
+		return
+	}
+	if !timestamps.CreatedAfter.IsZero() {
+		params["created_after"] = timestamps.CreatedAfter
+	}
+	if !timestamps.CreatedBefore.IsZero() {
+		params["created_before"] = timestamps.CreatedBefore
+	}
+	if !timestamps.UpdatedAfter.IsZero() {
+		params["updated_after"] = timestamps.UpdatedAfter
+	}
+	
+	// Custom field filters, given as cf.<name>=<value>
+	customFields := map[string]string{}
+	for key, values := range r.URL.Query() {
+		name, ok := strings.CutPrefix(key, "cf.")
+		if !ok {
+			continue
+		}
+		
+		var field models.CustomField
+		if err := h.db.Where("name = ?", name).First(&field).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Unknown custom field: "+name)
+			} else {
+				writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve custom field: "+err.Error())
 			}
+			return
+		}
+		
+		value, err := field.FilterValue(values[0])
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, err.Error())
+			return
+		}
+		customFields[name] = value
+	}
+	if len(customFields) > 0 {
+		params["custom_fields"] = customFields
+	}
+	
+	// Sorting (validated against an allowlist so it is safe to pass to ORDER BY)
+	if sort := r.URL.Query().Get("sort"); sort != "" {
+		order, err := parseSort(sort, productSortFields)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid sort parameter: "+err.Error())
+			return
 		}
+		params["sort"] = order
 	}
 	
+	// Pagination
+	page, limit := parsePagination(r)
+	params["page"] = page
+	params["limit"] = limit
+	
 	// Get products
 	products, err := h.repo.GetAll(params)
 	if err != nil {
-		http.Error(w, "Failed to retrieve products: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve products: "+err.Error())
+		return
+	}
+	
+	total, err := h.repo.Count(params)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to count products: "+err.Error())
 		return
 	}
 	
 	// Return response
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(products)
+	json.NewEncoder(w).Encode(newPaginatedResponse(products, page, limit, total))
 }
 
 // GetProduct handles GET requests to retrieve a single product
@@ -82,20 +175,26 @@ func (h *ProductHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid product ID")
 		return
 	}
 	
 	product, err := h.repo.GetByID(uint(id))
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Product not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Product not found")
 		} else {
-			http.Error(w, "Failed to retrieve product: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve product: "+err.Error())
 		}
 		return
 	}
 	
+	// Attach the primary supplier if one has been set
+	if primarySupplier, err := h.repo.GetPrimarySupplier(product.ID); err == nil {
+		product.PrimarySupplier = primarySupplier
+	}
+	
+	setVersionETag(w, product.Version)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(product)
 }
@@ -108,9 +207,9 @@ func (h *ProductHandler) GetProductBySKU(w http.ResponseWriter, r *http.Request)
 	product, err := h.repo.GetBySKU(sku)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Product not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Product not found")
 		} else {
-			http.Error(w, "Failed to retrieve product: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve product: "+err.Error())
 		}
 		return
 	}
@@ -126,29 +225,34 @@ func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 	// Decode request body
 	err := json.NewDecoder(r.Body).Decode(&product)
 	if err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
 		return
 	}
 	
 	// Validate product
 	if product.Name == "" || product.SKU == "" {
-		http.Error(w, "Name and SKU are required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Name and SKU are required")
+		return
+	}
+	
+	if !h.validateCustomFields(w, product.CustomFields) {
 		return
 	}
 	
 	// Check if SKU already exists
 	existingProduct, err := h.repo.GetBySKU(product.SKU)
 	if err == nil && existingProduct != nil {
-		http.Error(w, "Product with this SKU already exists", http.StatusConflict)
+		writeError(w, http.StatusConflict, errCodeDuplicate, "Product with this SKU already exists")
 		return
 	}
 	
 	// Create product
 	err = h.repo.Create(&product)
 	if err != nil {
-		http.Error(w, "Failed to create product: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to create product: "+err.Error())
 		return
 	}
+	recordAudit(h.db, r, "create", "product", product.ID, nil, product)
 	
 	// Return response
 	w.Header().Set("Content-Type", "application/json")
@@ -161,7 +265,7 @@ func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid product ID")
 		return
 	}
 	
@@ -169,9 +273,9 @@ func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	existingProduct, err := h.repo.GetByID(uint(id))
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Product not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Product not found")
 		} else {
-			http.Error(w, "Failed to retrieve product: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve product: "+err.Error())
 		}
 		return
 	}
@@ -180,30 +284,51 @@ func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	var updatedProduct models.Product
 	err = json.NewDecoder(r.Body).Decode(&updatedProduct)
 	if err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
 		return
 	}
 	
 	// Set ID to ensure we're updating the correct record
 	updatedProduct.ID = uint(id)
 	
+	expected, ok := expectedVersion(w, r, updatedProduct.Version, existingProduct.Version)
+	if !ok {
+		return
+	}
+	
+	// Custom field values are kept unless the update sends them
+	if updatedProduct.CustomFields == nil {
+		updatedProduct.CustomFields = existingProduct.CustomFields
+	} else if !h.validateCustomFields(w, updatedProduct.CustomFields) {
+		return
+	}
+	
 	// If SKU is being changed, check if new SKU already exists
 	if updatedProduct.SKU != existingProduct.SKU {
 		product, err := h.repo.GetBySKU(updatedProduct.SKU)
 		if err == nil && product != nil && product.ID != uint(id) {
-			http.Error(w, "Product with this SKU already exists", http.StatusConflict)
+			writeError(w, http.StatusConflict, errCodeDuplicate, "Product with this SKU already exists")
 			return
 		}
 	}
 	
-	// Update product
-	err = h.repo.Update(&updatedProduct)
+	// Stock only moves through transactions, so an update keeps the stored quantity
+	updatedProduct.Quantity = existingProduct.Quantity
+	
+	// Update product, unless someone else has since changed it
+	err = h.repo.UpdateVersioned(&updatedProduct, expected)
+	if errors.Is(err, models.ErrVersionConflict) {
+		writeVersionConflict(w, h.db, &models.Product{}, updatedProduct.ID)
+		return
+	}
 	if err != nil {
-		http.Error(w, "Failed to update product: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update product: "+err.Error())
 		return
 	}
+	recordAudit(h.db, r, "update", "product", updatedProduct.ID, existingProduct, updatedProduct)
 	
 	// Return response
+	setVersionETag(w, updatedProduct.Version)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(updatedProduct)
 }
@@ -213,17 +338,17 @@ func (h *ProductHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid product ID")
 		return
 	}
 	
 	// Check if product exists
-	_, err = h.repo.GetByID(uint(id))
+	product, err := h.repo.GetByID(uint(id))
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Product not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Product not found")
 		} else {
-			http.Error(w, "Failed to retrieve product: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve product: "+err.Error())
 		}
 		return
 	}
@@ -231,9 +356,10 @@ func (h *ProductHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 	// Delete product (soft delete)
 	err = h.repo.Delete(uint(id))
 	if err != nil {
-		http.Error(w, "Failed to delete product: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to delete product: "+err.Error())
 		return
 	}
+	recordAudit(h.db, r, "delete", "product", product.ID, product, nil)
 	
 	// Return success response
 	w.WriteHeader(http.StatusNoContent)
@@ -243,7 +369,7 @@ func (h *ProductHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 func (h *ProductHandler) GetLowStockProducts(w http.ResponseWriter, r *http.Request) {
 	products, err := h.repo.GetLowStock()
 	if err != nil {
-		http.Error(w, "Failed to retrieve low stock products: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve low stock products: "+err.Error())
 		return
 	}
 	
@@ -256,13 +382,13 @@ func (h *ProductHandler) GetProductsByWarehouse(w http.ResponseWriter, r *http.R
 	vars := mux.Vars(r)
 	warehouseID, err := strconv.ParseUint(vars["warehouseId"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid warehouse ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid warehouse ID")
 		return
 	}
 	
 	productWarehouses, err := h.repo.GetProductsByWarehouse(uint(warehouseID))
 	if err != nil {
-		http.Error(w, "Failed to retrieve products: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve products: "+err.Error())
 		return
 	}
 	
@@ -275,20 +401,2435 @@ func (h *ProductHandler) GetProductCategories(w http.ResponseWriter, r *http.Req
 	vars := mux.Vars(r)
 	productID, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid product ID")
 		return
 	}
 	
 	categories, err := h.repo.GetProductCategories(uint(productID))
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Product not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Product not found")
 		} else {
-			http.Error(w, "Failed to retrieve categories: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve categories: "+err.Error())
 		}
 		return
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(categories)
+}
+
+// SetPrimarySupplier handles PUT requests to set a product's primary supplier
+func (h *ProductHandler) SetPrimarySupplier(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid product ID")
+		return
+	}
+	
+	var request struct {
+		SupplierID uint `json:"supplier_id"`
+	}
+	
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	
+	if request.SupplierID == 0 {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Supplier ID is required")
+		return
+	}
+	
+	// Check if product exists
+	product, err := h.repo.GetByID(uint(productID))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Product not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve product: "+err.Error())
+		}
+		return
+	}
+	
+	if err := h.repo.SetPrimarySupplier(product.ID, request.SupplierID); err != nil {
+		if err == repository.ErrSupplierNotLinked {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Supplier is not linked to this product")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to set primary supplier: "+err.Error())
+		}
+		return
+	}
+	
+	primarySupplier, err := h.repo.GetPrimarySupplier(product.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve primary supplier: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(primarySupplier)
+}
+
+// GetDemandForecast handles GET requests to project a product's demand over a horizon.
+// Daily issue quantities from recent history are smoothed exponentially to get a daily
+// rate; forecasts are null when there is too little history to say anything useful.
+func (h *ProductHandler) GetDemandForecast(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid product ID")
+		return
+	}
+	
+	days := 30
+	if daysStr := r.URL.Query().Get("days"); daysStr != "" {
+		days, err = strconv.Atoi(daysStr)
+		if err != nil || days < 1 || days > 365 {
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Days must be between 1 and 365")
+			return
+		}
+	}
+	
+	product, err := h.repo.GetByID(uint(id))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Product not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve product: "+err.Error())
+		}
+		return
+	}
+	
+	// Look back at least 90 days, or three horizons for longer forecasts.
+	// History before the product existed isn't counted as zero demand.
+	today := time.Now().Truncate(24 * time.Hour)
+	lookback := 90
+	if days*3 > lookback {
+		lookback = days * 3
+	}
+	historyStart := today.AddDate(0, 0, -lookback)
+	if created := product.CreatedAt.Truncate(24 * time.Hour); created.After(historyStart) {
+		historyStart = created
+	}
+	
+	type dailyIssue struct {
+		Day      time.Time
+		Quantity int
+	}
+	
+	var issues []dailyIssue
+	if err := h.db.Table("inventory_transactions").
+		Select("DATE(created_at) as day, SUM(quantity) as quantity").
+		Where("product_id = ? AND type = ? AND created_at >= ? AND created_at < ?", id, "issue", historyStart, today).
+		Group("DATE(created_at)").
+		Scan(&issues).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve demand history: "+err.Error())
+		return
+	}
+	
+	// Build a gap-free daily series, oldest first
+	historyDays := int(today.Sub(historyStart).Hours() / 24)
+	series := make([]float64, historyDays)
+	for _, issue := range issues {
+		if i := int(issue.Day.Sub(historyStart).Hours() / 24); i >= 0 && i < historyDays {
+			series[i] += float64(issue.Quantity)
+		}
+	}
+	
+	response := map[string]interface{}{
+		"product_id":       product.ID,
+		"horizon_days":     days,
+		"history_days":     historyDays,
+		"active_days":      len(issues),
+		"method":           "exponential_smoothing",
+		"daily_average":    nil,
+		"projected_demand": nil,
+		"confidence":       "insufficient_data",
+	}
+	
+	if historyDays >= 14 && len(issues) >= 3 {
+		dailyAverage := smoothDemand(series, 0.3)
+		response["daily_average"] = dailyAverage
+		response["projected_demand"] = dailyAverage * float64(days)
+		response["confidence"] = forecastConfidence(series, len(issues))
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// smoothDemand returns the exponentially smoothed level of a daily series,
+// seeded with the mean of its first week so one early spike doesn't dominate
+func smoothDemand(series []float64, alpha float64) float64 {
+	seed := 7
+	if seed > len(series) {
+		seed = len(series)
+	}
+	
+	var level float64
+	for _, v := range series[:seed] {
+		level += v
+	}
+	level /= float64(seed)
+	
+	for _, v := range series[seed:] {
+		level = alpha*v + (1-alpha)*level
+	}
+	return level
+}
+
+// forecastConfidence rates a forecast by how much history backs it, dropping a
+// level when weekly demand swings widely (seasonal or lumpy data)
+func forecastConfidence(series []float64, activeDays int) string {
+	levels := []string{"low", "medium", "high"}
+	level := 0
+	switch {
+	case len(series) >= 60 && activeDays >= 20:
+		level = 2
+	case len(series) >= 30 && activeDays >= 8:
+		level = 1
+	}
+	
+	// Coefficient of variation of complete weekly totals
+	var weeks []float64
+	for i := 0; i+7 <= len(series); i += 7 {
+		var total float64
+		for _, v := range series[i : i+7] {
+			total += v
+		}
+		weeks = append(weeks, total)
+	}
+	
+	if len(weeks) >= 2 {
+		var mean float64
+		for _, v := range weeks {
+			mean += v
+		}
+		mean /= float64(len(weeks))
+		
+		var variance float64
+		for _, v := range weeks {
+			variance += (v - mean) * (v - mean)
+		}
+		variance /= float64(len(weeks))
+		
+		if mean > 0 && math.Sqrt(variance)/mean > 1 && level > 0 {
+			level--
+		}
+	}
+	
+	return levels[level]
+}
+
+// productOrderTable describes how an order type links to its items and trading partner
+type productOrderTable struct {
+	orders       string
+	items        string
+	itemOrderFK  string
+	numberColumn string
+	partners     string
+	partnerFK    string
+	label        string
+}
+
+var (
+	productSalesOrders = productOrderTable{
+		orders:       "sales_orders",
+		items:        "sales_order_items",
+		itemOrderFK:  "sales_order_id",
+		numberColumn: "so_number",
+		partners:     "customers",
+		partnerFK:    "customer_id",
+		label:        "sales orders",
+	}
+	productPurchaseOrders = productOrderTable{
+		orders:       "purchase_orders",
+		items:        "purchase_order_items",
+		itemOrderFK:  "purchase_order_id",
+		numberColumn: "po_number",
+		partners:     "suppliers",
+		partnerFK:    "supplier_id",
+		label:        "purchase orders",
+	}
+)
+
+// GetProductSalesOrders handles GET requests to retrieve the sales orders containing a product
+func (h *ProductHandler) GetProductSalesOrders(w http.ResponseWriter, r *http.Request) {
+	h.getProductOrders(w, r, productSalesOrders)
+}
+
+// GetProductPurchaseOrders handles GET requests to retrieve the purchase orders containing a product
+func (h *ProductHandler) GetProductPurchaseOrders(w http.ResponseWriter, r *http.Request) {
+	h.getProductOrders(w, r, productPurchaseOrders)
+}
+
+// getProductOrders lists the orders of one type that contain a product, with the
+// quantity of the product on each. Supports status, date range and pagination.
+func (h *ProductHandler) getProductOrders(w http.ResponseWriter, r *http.Request, t productOrderTable) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid product ID")
+		return
+	}
+	
+	// Check if product exists
+	if _, err := h.repo.GetByID(uint(id)); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Product not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve product: "+err.Error())
+		}
+		return
+	}
+	
+	type ProductOrder struct {
+		OrderID     uint      `json:"order_id"`
+		OrderNumber string    `json:"order_number"`
+		OrderDate   time.Time `json:"order_date"`
+		Status      string    `json:"status"`
+		PartnerID   uint      `json:"partner_id"`
+		PartnerName string    `json:"partner_name"`
+		Quantity    int       `json:"quantity"`
+	}
+	
+	query := h.db.Table(t.orders).
+		Select(t.orders+".id as order_id, "+t.orders+"."+t.numberColumn+" as order_number, "+t.orders+".order_date, "+t.orders+".status, "+
+			t.partners+".id as partner_id, "+t.partners+".name as partner_name, SUM("+t.items+".quantity) as quantity").
+		Joins("JOIN "+t.items+" ON "+t.items+"."+t.itemOrderFK+" = "+t.orders+".id").
+		Joins("LEFT JOIN "+t.partners+" ON "+t.partners+".id = "+t.orders+"."+t.partnerFK).
+		Where(t.items+".product_id = ?", id).
+		Group(t.orders + ".id, " + t.partners + ".id")
+	
+	if status := r.URL.Query().Get("status"); status != "" {
+		query = query.Where(t.orders+".status = ?", status)
+	}
+	
+	if startStr := r.URL.Query().Get("start_date"); startStr != "" {
+		startDate, err := parseDateParam(startStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid start_date")
+			return
+		}
+		query = query.Where(t.orders+".order_date >= ?", startDate)
+	}
+	
+	if endStr := r.URL.Query().Get("end_date"); endStr != "" {
+		endDate, err := parseDateParam(endStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid end_date")
+			return
+		}
+		query = query.Where(t.orders+".order_date <= ?", endDate)
+	}
+	
+	// Apply pagination
+	page := 1
+	limit := 10
+	
+	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+		if pageNum, err := strconv.Atoi(pageStr); err == nil && pageNum > 0 {
+			page = pageNum
+		}
+	}
+	
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if limitNum, err := strconv.Atoi(limitStr); err == nil && limitNum > 0 {
+			limit = limitNum
+		}
+	}
+	
+	offset := (page - 1) * limit
+	
+	orders := []ProductOrder{}
+	if err := query.Order(t.orders + ".order_date DESC").Limit(limit).Offset(offset).Scan(&orders).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve "+t.label+": "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orders)
+}
+
+// DisassembleBundle handles POST requests to break bundles back into their components.
+// The bundle is issued and each component received in one database transaction; all
+// the inventory transactions share a reference number so they can be traced together.
+// Both go through the transaction repository, so location stock and low stock alerts
+// follow as they do for any other issue or receipt.
+func (h *ProductHandler) DisassembleBundle(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid product ID")
+		return
+	}
+	
+	var request struct {
+		Quantity              int    `json:"quantity"`
+		WarehouseID           uint   `json:"warehouse_id"`
+		SourceLocationID      *uint  `json:"source_location_id"`      // Where the bundles are taken from; required when the warehouse has locations
+		DestinationLocationID *uint  `json:"destination_location_id"` // Where the components are put; required when the warehouse has locations
+		Notes                 string `json:"notes"`
+	}
+	
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	
+	if request.Quantity <= 0 || request.WarehouseID == 0 {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Warehouse ID and quantity > 0 are required")
+		return
+	}
+	
+	// Get user ID from context (set by auth middleware)
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
+		return
+	}
+	
+	referenceNumber := fmt.Sprintf("DIS-%d-%d", id, time.Now().Unix())
+	var bundleTransaction models.InventoryTransaction
+	var componentTransactions []models.InventoryTransaction
+	
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		var warehouse models.Warehouse
+		if err := tx.First(&warehouse, request.WarehouseID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errWarehouseNotFound
+			}
+			return err
+		}
+		
+		// Lock the bundle so concurrent disassemblies can't both pass the stock check
+		var bundle models.Product
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("ChildBundles").First(&bundle, id).Error; err != nil {
+			return err
+		}
+		
+		if len(bundle.ChildBundles) == 0 {
+			return errNotABundle
+		}
+		
+		if bundle.Quantity < request.Quantity {
+			return errInsufficientBundleStock
+		}
+		
+		repo := repository.NewTransactionRepository(tx)
+		
+		// Issue the bundles
+		bundleTransaction = models.InventoryTransaction{
+			ProductID:        bundle.ID,
+			WarehouseID:      warehouse.ID,
+			SourceLocationID: request.SourceLocationID,
+			Type:             "issue",
+			Quantity:         request.Quantity,
+			ReferenceNumber:  referenceNumber,
+			UserID:           userID,
+			Notes:            "Disassembled bundle: " + bundle.SKU,
+		}
+		if err := repo.Create(&bundleTransaction); err != nil {
+			return err
+		}
+		
+		// Receive each component
+		for _, component := range bundle.ChildBundles {
+			transaction := models.InventoryTransaction{
+				ProductID:             component.ChildProductID,
+				WarehouseID:           warehouse.ID,
+				DestinationLocationID: request.DestinationLocationID,
+				Type:                  "receive",
+				Quantity:              component.Quantity * request.Quantity,
+				ReferenceNumber:       referenceNumber,
+				UserID:                userID,
+				Notes:                 "Component from disassembled bundle: " + bundle.SKU,
+			}
+			if err := repo.Create(&transaction); err != nil {
+				return err
+			}
+			componentTransactions = append(componentTransactions, transaction)
+		}
+		
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Product not found")
+		case errors.Is(err, errWarehouseNotFound):
+			writeError(w, http.StatusNotFound, errCodeNotFound, err.Error())
+		case errors.Is(err, errNotABundle):
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, err.Error())
+		case errors.Is(err, errInsufficientBundleStock):
+			writeError(w, http.StatusBadRequest, errCodeInsufficientStock, err.Error())
+		default:
+			writeLocationStockError(w, err, "Failed to disassemble bundle")
+		}
+		return
+	}
+	
+	response := map[string]interface{}{
+		"reference_number":       referenceNumber,
+		"bundle_transaction":     bundleTransaction,
+		"component_transactions": componentTransactions,
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetProductDetail handles GET requests to retrieve a product together with its categories,
+// variants, supplier pricing, warehouse stock and recent transactions in one response.
+// It is a convenience for product pages; GET /products/{id} stays lean.
+func (h *ProductHandler) GetProductDetail(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid product ID")
+		return
+	}
+	
+	// Recent transaction history is capped to keep the response small
+	transactionLimit := 20
+	if limitStr := r.URL.Query().Get("transactions_limit"); limitStr != "" {
+		if limitNum, err := strconv.Atoi(limitStr); err == nil && limitNum > 0 && limitNum <= 100 {
+			transactionLimit = limitNum
+		}
+	}
+	
+	detail, err := h.repo.GetDetail(uint(id), transactionLimit)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Product not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve product detail: "+err.Error())
+		}
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(detail)
+}
+
+// GetDuplicateProducts handles GET requests to find likely duplicate products.
+// Products are grouped by name ignoring case and whitespace; with ?barcode=true products
+// sharing a barcode are grouped too. Only groups with more than one SKU are returned.
+func (h *ProductHandler) GetDuplicateProducts(w http.ResponseWriter, r *http.Request) {
+	type DuplicateCandidate struct {
+		ID       uint   `json:"id"`
+		SKU      string `json:"sku"`
+		Name     string `json:"name"`
+		Barcode  string `json:"barcode"`
+		Quantity int    `json:"quantity"`
+		Status   string `json:"status"`
+		MatchKey string `json:"-"`
+	}
+	
+	type DuplicateGroup struct {
+		MatchedOn string               `json:"matched_on"`
+		Key       string               `json:"key"`
+		Products  []DuplicateCandidate `json:"products"`
+	}
+	
+	const normalizedName = `LOWER(REGEXP_REPLACE(name, '\s+', '', 'g'))`
+	
+	type matchKey struct {
+		matchedOn string
+		expr      string
+		where     string
+	}
+	
+	keys := []matchKey{{"name", normalizedName, "TRUE"}}
+	if r.URL.Query().Get("barcode") == "true" {
+		keys = append(keys, matchKey{"barcode", "barcode", "barcode IS NOT NULL AND barcode <> ''"})
+	}
+	
+	groups := []DuplicateGroup{}
+	for _, key := range keys {
+		var candidates []DuplicateCandidate
+		if err := h.db.Table("products").
+			Select("id, sku, name, barcode, quantity, status, "+key.expr+" as match_key").
+			Where("deleted_at IS NULL").
+			Where(key.where).
+			Where(key.expr+" IN (?)", h.db.Table("products").
+				Select(key.expr).
+				Where("deleted_at IS NULL").
+				Where(key.where).
+				Group(key.expr).
+				Having("COUNT(*) > 1")).
+			Order("match_key, sku").
+			Scan(&candidates).Error; err != nil {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to find duplicate products: "+err.Error())
+			return
+		}
+		
+		// Rows are ordered by key, so each run of equal keys is one group
+		for _, candidate := range candidates {
+			if n := len(groups); n == 0 || groups[n-1].MatchedOn != key.matchedOn || groups[n-1].Key != candidate.MatchKey {
+				groups = append(groups, DuplicateGroup{MatchedOn: key.matchedOn, Key: candidate.MatchKey})
+			}
+			groups[len(groups)-1].Products = append(groups[len(groups)-1].Products, candidate)
+		}
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(groups)
+}
+
+// AdjustProductQuantity handles PATCH requests that edit a product's stock directly. The
+// client sends the quantity it last read along with the change; if another edit landed in
+// between, the request fails with 409 and the current quantity so the client can retry.
+// The change is recorded as an adjustment transaction, like any other stock correction.
+func (h *ProductHandler) AdjustProductQuantity(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid product ID")
+		return
+	}
+	
+	var request struct {
+		ExpectedQuantity *int   `json:"expected_quantity"`
+		Delta            int    `json:"delta"`
+		WarehouseID      uint   `json:"warehouse_id"`
+		ReasonCode       string `json:"reason_code"`
+		Reason           string `json:"reason"` // Free text, kept as the transaction's notes
+	}
+	
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	
+	if request.ExpectedQuantity == nil {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Expected quantity is required")
+		return
+	}
+	
+	if request.Delta == 0 {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Delta must not be zero")
+		return
+	}
+	
+	if request.WarehouseID == 0 {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Warehouse ID is required")
+		return
+	}
+	
+	if !models.AdjustmentReasonCodes[request.ReasonCode] {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Invalid reason code: must be damage, shrinkage, cycle_count, or correction")
+		return
+	}
+	
+	newQuantity := *request.ExpectedQuantity + request.Delta
+	if newQuantity < 0 {
+		writeError(w, http.StatusBadRequest, errCodeInsufficientStock, "Quantity cannot go below zero")
+		return
+	}
+	
+	// Get user ID from context (set by auth middleware)
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
+		return
+	}
+	
+	var warehouse models.Warehouse
+	if err := h.db.First(&warehouse, request.WarehouseID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Warehouse not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve warehouse: "+err.Error())
+		}
+		return
+	}
+	
+	transaction := models.InventoryTransaction{
+		ProductID:   uint(id),
+		WarehouseID: warehouse.ID,
+		Type:        "adjustment",
+		Quantity:    request.Delta,
+		ReasonCode:  request.ReasonCode,
+		UserID:      userID,
+		Notes:       request.Reason,
+	}
+	if err := repository.NewTransactionRepository(h.db).AdjustFrom(&transaction, *request.ExpectedQuantity); err != nil {
+		switch {
+		case err == gorm.ErrRecordNotFound:
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Product not found")
+		case errors.Is(err, repository.ErrNegativeStock):
+			writeError(w, http.StatusBadRequest, errCodeInsufficientStock, "Quantity cannot go below zero")
+		case errors.Is(err, repository.ErrQuantityConflict):
+			current, err := h.repo.GetByID(uint(id))
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve product: "+err.Error())
+				return
+			}
+			
+			writeErrorDetails(w, http.StatusConflict, errCodeConflict, repository.ErrQuantityConflict.Error(), map[string]interface{}{
+				"current_quantity": current.Quantity,
+			})
+		default:
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to adjust product quantity: "+err.Error())
+		}
+		return
+	}
+	
+	oldValues, _ := json.Marshal(map[string]interface{}{"quantity": *request.ExpectedQuantity})
+	newValues, _ := json.Marshal(map[string]interface{}{"quantity": newQuantity, "reason_code": request.ReasonCode, "reason": request.Reason})
+	if err := models.CreateAuditLog(h.db, userID, "adjust_quantity", "product", uint(id), string(oldValues), string(newValues), clientIP(r)); err != nil {
+		log.Printf("Failed to write audit log for product %d quantity adjustment: %v", id, err)
+	}
+	
+	product, err := h.repo.GetByID(uint(id))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve product: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
+
+// productCommitment is an open order line that will move a product's stock in the future
+type productCommitment struct {
+	Direction         string    `json:"direction"` // "incoming" or "outgoing"
+	OrderID           uint      `json:"order_id"`
+	OrderNumber       string    `json:"order_number"`
+	ItemID            uint      `json:"item_id"`
+	Date              time.Time `json:"date"`
+	Quantity          int       `json:"quantity"`
+	ProjectedQuantity int       `json:"projected_quantity"`
+}
+
+// GetProductCommitments handles GET requests for a product's supply and demand book: the
+// outstanding quantities on open purchase orders (incoming, dated by the line's expected
+// date) and open sales orders (outgoing, dated by the order date), netted against current
+// stock in date order to project availability.
+func (h *ProductHandler) GetProductCommitments(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid product ID")
+		return
+	}
+	
+	product, err := h.repo.GetByID(uint(id))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Product not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve product: "+err.Error())
+		}
+		return
+	}
+	
+	var incoming []productCommitment
+	if err := h.db.Table("purchase_order_items").
+		Select(`
+			'incoming' as direction,
+			purchase_orders.id as order_id,
+			purchase_orders.po_number as order_number,
+			purchase_order_items.id as item_id,
+			purchase_order_items.expected_date as date,
+			purchase_order_items.quantity - purchase_order_items.quantity_received as quantity
+		`).
+		Joins("JOIN purchase_orders ON purchase_order_items.purchase_order_id = purchase_orders.id").
+		Where("purchase_order_items.product_id = ? AND purchase_orders.status IN ?", id, []string{"approved", "partial"}).
+		Where("purchase_order_items.quantity > purchase_order_items.quantity_received").
+		Scan(&incoming).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve purchase order commitments: "+err.Error())
+		return
+	}
+	
+	var outgoing []productCommitment
+	if err := h.db.Table("sales_order_items").
+		Select(`
+			'outgoing' as direction,
+			sales_orders.id as order_id,
+			sales_orders.so_number as order_number,
+			sales_order_items.id as item_id,
+			sales_orders.order_date as date,
+			sales_order_items.quantity - sales_order_items.quantity_fulfilled as quantity
+		`).
+		Joins("JOIN sales_orders ON sales_order_items.sales_order_id = sales_orders.id").
+		Where("sales_order_items.product_id = ? AND sales_orders.status IN ?", id, []string{"confirmed", "partial"}).
+		Where("sales_order_items.quantity > sales_order_items.quantity_fulfilled").
+		Scan(&outgoing).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve sales order commitments: "+err.Error())
+		return
+	}
+	
+	// Walk both books in date order; on the same day supply lands before demand ships
+	timeline := append(append([]productCommitment{}, incoming...), outgoing...)
+	sort.SliceStable(timeline, func(i, j int) bool {
+		if !timeline[i].Date.Equal(timeline[j].Date) {
+			return timeline[i].Date.Before(timeline[j].Date)
+		}
+		return timeline[i].Direction == "incoming" && timeline[j].Direction == "outgoing"
+	})
+	
+	totalIncoming := 0
+	totalOutgoing := 0
+	projected := product.Quantity
+	var shortfallDate *time.Time
+	for i := range timeline {
+		if timeline[i].Direction == "incoming" {
+			projected += timeline[i].Quantity
+			totalIncoming += timeline[i].Quantity
+		} else {
+			projected -= timeline[i].Quantity
+			totalOutgoing += timeline[i].Quantity
+		}
+		timeline[i].ProjectedQuantity = projected
+		
+		if projected < 0 && shortfallDate == nil {
+			date := timeline[i].Date
+			shortfallDate = &date
+		}
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"product_id":         product.ID,
+		"sku":                product.SKU,
+		"current_quantity":   product.Quantity,
+		"total_incoming":     totalIncoming,
+		"total_outgoing":     totalOutgoing,
+		"projected_quantity": projected,
+		"shortfall_date":     shortfallDate,
+		"commitments":        timeline,
+	})
+}
+
+// GetProductAvailability handles GET requests for what can be promised of a product: stock
+// on hand, the part held by reservations, the outstanding quantity on approved purchase orders
+// and available-to-promise (on hand less reserved). ?warehouse_id= scopes the figures to one
+// warehouse's stock, reservations and incoming orders.
+func (h *ProductHandler) GetProductAvailability(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid product ID")
+		return
+	}
+	
+	product, err := h.repo.GetByID(uint(id))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Product not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve product: "+err.Error())
+		}
+		return
+	}
+	
+	var warehouseID uint
+	if param := r.URL.Query().Get("warehouse_id"); param != "" {
+		parsed, err := strconv.ParseUint(param, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid warehouse_id")
+			return
+		}
+		warehouseID = uint(parsed)
+		
+		var warehouse models.Warehouse
+		if err := h.db.First(&warehouse, warehouseID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				writeError(w, http.StatusNotFound, errCodeNotFound, "Warehouse not found")
+			} else {
+				writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve warehouse: "+err.Error())
+			}
+			return
+		}
+	}
+	
+	response := map[string]interface{}{
+		"product_id": product.ID,
+		"sku":        product.SKU,
+		"name":       product.Name,
+	}
+	
+	onHand := product.Quantity
+	var reserved, available int
+	tracked := false
+	if warehouseID != 0 {
+		response["warehouse_id"] = warehouseID
+		
+		available, tracked, err = models.WarehouseAvailableQuantity(h.db, product.ID, warehouseID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to check warehouse stock: "+err.Error())
+			return
+		}
+		response["warehouse_tracked"] = tracked
+	}
+	
+	if tracked {
+		if err := h.db.Model(&models.ProductWarehouse{}).
+			Where("product_id = ? AND warehouse_id = ?", product.ID, warehouseID).
+			Select("COALESCE(SUM(quantity), 0)").
+			Scan(&onHand).Error; err != nil {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve warehouse stock: "+err.Error())
+			return
+		}
+		reserved = onHand - available
+	} else {
+		// Products without per-warehouse records fall back to their overall stock
+		if reserved, err = models.ReservedQuantity(h.db, product.ID); err != nil {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve reserved stock: "+err.Error())
+			return
+		}
+		if available, err = models.AvailableQuantity(h.db, product.ID); err != nil {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to check available stock: "+err.Error())
+			return
+		}
+	}
+	
+	onOrderQuery := h.db.Table("purchase_order_items").
+		Joins("JOIN purchase_orders ON purchase_order_items.purchase_order_id = purchase_orders.id").
+		Where("purchase_order_items.product_id = ? AND purchase_orders.status IN ?", product.ID, []string{"approved", "partial"}).
+		Where("purchase_order_items.quantity > purchase_order_items.quantity_received")
+	if warehouseID != 0 {
+		onOrderQuery = onOrderQuery.Where("purchase_orders.warehouse_id = ?", warehouseID)
+	}
+	
+	var onOrder int
+	if err := onOrderQuery.
+		Select("COALESCE(SUM(purchase_order_items.quantity - purchase_order_items.quantity_received), 0)").
+		Scan(&onOrder).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve purchase order quantities: "+err.Error())
+		return
+	}
+	
+	response["on_hand"] = onHand
+	response["reserved"] = reserved
+	response["on_order"] = onOrder
+	response["available_to_promise"] = available
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// MergeProducts handles POST requests to fold duplicate products into a primary product.
+// Everything that references the duplicates moves to the primary and their stock is added
+// to it; the duplicates are then deactivated.
+func (h *ProductHandler) MergeProducts(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		PrimaryID    uint   `json:"primary_id"`
+		DuplicateIDs []uint `json:"duplicate_ids"`
+	}
+	
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	
+	if request.PrimaryID == 0 || len(request.DuplicateIDs) == 0 {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Primary product ID and at least one duplicate ID are required")
+		return
+	}
+	
+	seen := map[uint]bool{request.PrimaryID: true}
+	for _, duplicateID := range request.DuplicateIDs {
+		if seen[duplicateID] {
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, fmt.Sprintf("Product %d is listed more than once", duplicateID))
+			return
+		}
+		seen[duplicateID] = true
+	}
+	
+	// Get user ID from context (set by auth middleware)
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
+		return
+	}
+	
+	product, err := h.repo.MergeProducts(request.PrimaryID, request.DuplicateIDs)
+	if err != nil {
+		switch {
+		case err == gorm.ErrRecordNotFound:
+			writeError(w, http.StatusNotFound, errCodeNotFound, "One or more products not found")
+		case errors.Is(err, repository.ErrMergeConflict):
+			writeError(w, http.StatusConflict, errCodeConflict, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to merge products: "+err.Error())
+		}
+		return
+	}
+	
+	newValues, _ := json.Marshal(map[string]interface{}{"merged_ids": request.DuplicateIDs, "quantity": product.Quantity})
+	if err := models.CreateAuditLog(h.db, userID, "merge", "product", product.ID, "{}", string(newValues), clientIP(r)); err != nil {
+		log.Printf("Failed to write audit log for product %d merge: %v", product.ID, err)
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
+
+// CreateProductHold handles POST requests to place a manual hold on a product's stock.
+// The hold counts against availability like an order reservation until it is released
+// or its expiry passes.
+func (h *ProductHandler) CreateProductHold(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid product ID")
+		return
+	}
+	
+	var request struct {
+		Quantity    int        `json:"quantity"`
+		Reason      string     `json:"reason"`
+		ExpiresAt   *time.Time `json:"expires_at"`
+		OwnerUserID *uint      `json:"owner_user_id"`
+		WarehouseID uint       `json:"warehouse_id"`
+	}
+	
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	
+	if request.Quantity <= 0 {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Quantity must be greater than zero")
+		return
+	}
+	
+	if request.Reason == "" {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Reason is required")
+		return
+	}
+	
+	if request.ExpiresAt == nil || !request.ExpiresAt.After(time.Now()) {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Expiry must be in the future")
+		return
+	}
+	
+	// Get user ID from context (set by auth middleware)
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
+		return
+	}
+	
+	// The hold belongs to the caller unless it is placed on someone else's behalf
+	ownerID := userID
+	if request.OwnerUserID != nil {
+		var owner models.User
+		if err := h.db.First(&owner, *request.OwnerUserID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				writeError(w, http.StatusBadRequest, errCodeInvalidReference, "Owner user not found")
+			} else {
+				writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve owner user: "+err.Error())
+			}
+			return
+		}
+		ownerID = owner.ID
+	}
+	
+	hold := models.StockReservation{
+		Type:        "manual",
+		ProductID:   uint(id),
+		WarehouseID: request.WarehouseID,
+		Quantity:    request.Quantity,
+		Status:      "active",
+		Reason:      request.Reason,
+		OwnerUserID: &ownerID,
+		ExpiresAt:   request.ExpiresAt,
+	}
+	
+	available := 0
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the product so concurrent holds and reservations see each other
+		var product models.Product
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, id).Error; err != nil {
+			return err
+		}
+		
+		available, err = models.AvailableQuantity(tx, product.ID)
+		if err != nil {
+			return err
+		}
+		
+		if request.Quantity > available {
+			return errInsufficientStock
+		}
+		
+		return tx.Create(&hold).Error
+	})
+	if err != nil {
+		switch {
+		case err == gorm.ErrRecordNotFound:
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Product not found")
+		case errors.Is(err, errInsufficientStock):
+			writeErrorDetails(w, http.StatusConflict, errCodeInsufficientStock, "Hold exceeds available stock", map[string]interface{}{
+				"available": available,
+			})
+		default:
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to create hold: "+err.Error())
+		}
+		return
+	}
+	
+	newValues, _ := json.Marshal(hold)
+	if err := models.CreateAuditLog(h.db, userID, "create_hold", "stock_reservation", hold.ID, "{}", string(newValues), clientIP(r)); err != nil {
+		log.Printf("Failed to write audit log for hold %d: %v", hold.ID, err)
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hold)
+}
+
+// GetProductHolds handles GET requests to list a product's active manual holds
+func (h *ProductHandler) GetProductHolds(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid product ID")
+		return
+	}
+	
+	if err := models.ExpireStockHolds(h.db); err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to expire holds: "+err.Error())
+		return
+	}
+	
+	var holds []models.StockReservation
+	if err := h.db.Preload("OwnerUser").
+		Where("product_id = ? AND type = ? AND status = ?", id, "manual", "active").
+		Order("expires_at").Find(&holds).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve holds: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(holds)
+}
+
+// ReleaseProductHold handles DELETE requests to release a manual hold before it expires
+func (h *ProductHandler) ReleaseProductHold(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid product ID")
+		return
+	}
+	
+	holdID, err := strconv.ParseUint(vars["holdId"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid hold ID")
+		return
+	}
+	
+	// Get user ID from context (set by auth middleware)
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
+		return
+	}
+	
+	var hold models.StockReservation
+	if err := h.db.Where("id = ? AND product_id = ? AND type = ?", holdID, id, "manual").First(&hold).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Hold not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve hold: "+err.Error())
+		}
+		return
+	}
+	
+	if hold.Status != "active" {
+		writeError(w, http.StatusBadRequest, errCodeInvalidState, "Hold is already "+hold.Status)
+		return
+	}
+	
+	hold.Status = "released"
+	if err := h.db.Model(&hold).Update("status", hold.Status).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to release hold: "+err.Error())
+		return
+	}
+	
+	oldValues, _ := json.Marshal(map[string]interface{}{"status": "active"})
+	newValues, _ := json.Marshal(map[string]interface{}{"status": "released"})
+	if err := models.CreateAuditLog(h.db, userID, "release_hold", "stock_reservation", hold.ID, string(oldValues), string(newValues), clientIP(r)); err != nil {
+		log.Printf("Failed to write audit log for hold %d: %v", hold.ID, err)
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hold)
+}
+
+// negativeStockEvent is a transaction after which a product's running stock was below zero
+type negativeStockEvent struct {
+	TransactionID    uint      `json:"transaction_id"`
+	Type             string    `json:"type"`
+	Quantity         int       `json:"quantity"`
+	Change           int       `json:"change"`
+	ReferenceNumber  string    `json:"reference_number"`
+	UserID           uint      `json:"user_id"`
+	CreatedAt        time.Time `json:"created_at"`
+	Balance          int       `json:"balance"`
+	CrossedBelowZero bool      `json:"crossed_below_zero"` // This transaction took the balance from zero or more to below zero
+}
+
+// GetProductNegativeEvents handles GET requests to find where a product's stock went
+// negative. It replays the product's whole transaction history as a running balance and
+// returns each transaction that left the balance below zero, optionally limited to those
+// between start_date and end_date. Earlier transactions still count towards the balance.
+func (h *ProductHandler) GetProductNegativeEvents(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid product ID")
+		return
+	}
+	
+	if _, err := h.repo.GetByID(uint(id)); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Product not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve product: "+err.Error())
+		}
+		return
+	}
+	
+	history := h.db.Table("inventory_transactions").
+		Select(`inventory_transactions.id as transaction_id,
+			inventory_transactions.type,
+			inventory_transactions.quantity,
+			(`+signedQuantitySQL+`) as change,
+			inventory_transactions.reference_number,
+			inventory_transactions.user_id,
+			inventory_transactions.created_at,
+			SUM(`+signedQuantitySQL+`) OVER (ORDER BY inventory_transactions.created_at, inventory_transactions.id) as balance`).
+		Where("inventory_transactions.product_id = ?", id)
+	
+	query := h.db.Table("(?) as history", history).
+		Select("history.*, history.balance - history.change >= 0 as crossed_below_zero").
+		Where("history.balance < 0")
+	
+	if startStr := r.URL.Query().Get("start_date"); startStr != "" {
+		startDate, err := parseDateParam(startStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid start_date")
+			return
+		}
+		query = query.Where("history.created_at >= ?", startDate)
+	}
+	
+	if endStr := r.URL.Query().Get("end_date"); endStr != "" {
+		endDate, err := parseDateParam(endStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid end_date")
+			return
+		}
+		// A bare date includes the whole day
+		if len(endStr) == len("2006-01-02") {
+			endDate = endDate.Add(24 * time.Hour)
+		}
+		query = query.Where("history.created_at < ?", endDate)
+	}
+	
+	events := []negativeStockEvent{}
+	if err := query.Order("history.created_at, history.transaction_id").Scan(&events).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to replay transaction history: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"product_id": id,
+		"events":     events,
+	})
+}
+
+var (
+	errVariantSKUTaken      = errors.New("SKU is already in use")
+	errVariantExceedsParent = errors.New("Variant quantities would exceed the product's quantity")
+)
+
+// variantRequest is the body accepted when creating or replacing a product variant.
+// Attributes is an arbitrary JSON object such as {"color": "red", "size": "M"}.
+type variantRequest struct {
+	SKU        string          `json:"sku"`
+	Attributes json.RawMessage `json:"attributes"`
+	Quantity   int             `json:"quantity"`
+	Price      float64         `json:"price"`
+	CostPrice  float64         `json:"cost_price"`
+	Barcode    string          `json:"barcode"`
+}
+
+// apply validates the request and copies it onto variant
+func (req *variantRequest) apply(variant *models.ProductVariant) error {
+	if req.SKU == "" || req.Price <= 0 {
+		return errors.New("SKU and a positive price are required")
+	}
+	if req.Quantity < 0 || req.CostPrice < 0 {
+		return errors.New("Quantity and cost price must not be negative")
+	}
+	
+	attributes := map[string]interface{}{}
+	if len(req.Attributes) > 0 && string(req.Attributes) != "null" {
+		if err := json.Unmarshal(req.Attributes, &attributes); err != nil {
+			return errors.New("Attributes must be a JSON object of key/value pairs")
+		}
+	}
+	encoded, err := json.Marshal(attributes)
+	if err != nil {
+		return err
+	}
+	
+	variant.SKU = req.SKU
+	variant.Attributes = string(encoded)
+	variant.Quantity = req.Quantity
+	variant.Price = models.RoundCurrency(req.Price)
+	variant.CostPrice = models.RoundCurrency(req.CostPrice)
+	variant.Barcode = req.Barcode
+	return nil
+}
+
+// saveVariant creates or updates a variant once its SKU and quantity are checked. Variant
+// quantities break down the parent product's stock rather than adding to it, so together
+// they may not exceed the parent's quantity; the parent row is locked while they are summed.
+func saveVariant(db *gorm.DB, variant *models.ProductVariant) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, variant.ProductID).Error; err != nil {
+			return err
+		}
+		
+		// Variant SKUs share the product SKU namespace
+		var taken int64
+		if err := tx.Model(&models.ProductVariant{}).Where("sku = ? AND id <> ?", variant.SKU, variant.ID).Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken == 0 {
+			if err := tx.Model(&models.Product{}).Where("sku = ?", variant.SKU).Count(&taken).Error; err != nil {
+				return err
+			}
+		}
+		if taken > 0 {
+			return errVariantSKUTaken
+		}
+		
+		var siblings int
+		if err := tx.Model(&models.ProductVariant{}).
+			Where("product_id = ? AND id <> ?", variant.ProductID, variant.ID).
+			Select("COALESCE(SUM(quantity), 0)").
+			Scan(&siblings).Error; err != nil {
+			return err
+		}
+		if siblings+variant.Quantity > product.Quantity {
+			return fmt.Errorf("%w (%d of %d already allocated to other variants)", errVariantExceedsParent, siblings, product.Quantity)
+		}
+		
+		return tx.Save(variant).Error
+	})
+}
+
+// writeVariantError maps a saveVariant error to a response
+func writeVariantError(w http.ResponseWriter, err error) {
+	switch {
+	case err == gorm.ErrRecordNotFound:
+		writeError(w, http.StatusNotFound, errCodeNotFound, "Product not found")
+	case errors.Is(err, errVariantSKUTaken):
+		writeError(w, http.StatusConflict, errCodeDuplicate, err.Error())
+	case errors.Is(err, errVariantExceedsParent):
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to save variant: "+err.Error())
+	}
+}
+
+// GetProductVariants handles GET requests to list a product's variants
+func (h *ProductHandler) GetProductVariants(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid product ID")
+		return
+	}
+	
+	if _, err := h.repo.GetByID(uint(id)); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Product not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve product: "+err.Error())
+		}
+		return
+	}
+	
+	variants, err := h.repo.GetProductVariants(uint(id))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve variants: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(variants)
+}
+
+// CreateProductVariant handles POST requests to add a variant to a product
+func (h *ProductHandler) CreateProductVariant(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid product ID")
+		return
+	}
+	
+	var req variantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	
+	variant := models.ProductVariant{ProductID: uint(id)}
+	if err := req.apply(&variant); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, err.Error())
+		return
+	}
+	
+	if err := saveVariant(h.db, &variant); err != nil {
+		writeVariantError(w, err)
+		return
+	}
+	
+	recordAudit(h.db, r, "create", "product_variant", variant.ID, nil, variant)
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(variant)
+}
+
+// UpdateProductVariant handles PUT requests to replace a variant's details
+func (h *ProductHandler) UpdateProductVariant(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid variant ID")
+		return
+	}
+	
+	var variant models.ProductVariant
+	if err := h.db.First(&variant, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Variant not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve variant: "+err.Error())
+		}
+		return
+	}
+	oldVariant := variant
+	
+	var req variantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	
+	if err := req.apply(&variant); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, err.Error())
+		return
+	}
+	
+	if err := saveVariant(h.db, &variant); err != nil {
+		writeVariantError(w, err)
+		return
+	}
+	
+	recordAudit(h.db, r, "update", "product_variant", variant.ID, oldVariant, variant)
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(variant)
+}
+
+// DeleteProductVariant handles DELETE requests to remove a variant
+func (h *ProductHandler) DeleteProductVariant(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid variant ID")
+		return
+	}
+	
+	var variant models.ProductVariant
+	if err := h.db.First(&variant, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Variant not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve variant: "+err.Error())
+		}
+		return
+	}
+	
+	if err := h.db.Delete(&variant).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to delete variant: "+err.Error())
+		return
+	}
+	
+	recordAudit(h.db, r, "delete", "product_variant", variant.ID, variant, nil)
+	
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GenerateProductBarcode handles POST requests to assign an internal EAN-13 barcode, built
+// from the configured prefix and the product ID, to a product without one. An existing
+// barcode is only replaced with ?overwrite=true.
+func (h *ProductHandler) GenerateProductBarcode(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid product ID")
+		return
+	}
+	
+	product, err := h.repo.GetByID(uint(id))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Product not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve product: "+err.Error())
+		}
+		return
+	}
+	
+	if product.Barcode != "" && r.URL.Query().Get("overwrite") != "true" {
+		writeError(w, http.StatusConflict, errCodeDuplicate, "Product already has barcode "+product.Barcode+"; use ?overwrite=true to replace it")
+		return
+	}
+	
+	barcode, err := models.GenerateEAN13(product.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to generate barcode: "+err.Error())
+		return
+	}
+	
+	// A manually entered barcode elsewhere could already use the generated number
+	var taken int64
+	if err := h.db.Model(&models.Product{}).Where("barcode = ? AND id <> ?", barcode, product.ID).Count(&taken).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to check barcode: "+err.Error())
+		return
+	}
+	if taken > 0 {
+		writeError(w, http.StatusConflict, errCodeDuplicate, "Generated barcode "+barcode+" is already assigned to another product")
+		return
+	}
+	
+	oldValues := map[string]interface{}{"barcode": product.Barcode}
+	if err := h.db.Model(product).Update("barcode", barcode).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to assign barcode: "+err.Error())
+		return
+	}
+	
+	recordAudit(h.db, r, "generate_barcode", "product", product.ID, oldValues, map[string]interface{}{"barcode": barcode})
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
+
+// Barcode images are drawn at this many pixels per module, with a quiet zone on each side
+const (
+	barcodeModuleWidth = 2
+	barcodeQuietZone   = 11
+	barcodeHeight      = 80
+)
+
+// GetProductBarcodeImage handles GET requests to render a product's EAN-13 barcode as a PNG
+// for label printing
+func (h *ProductHandler) GetProductBarcodeImage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid product ID")
+		return
+	}
+	
+	product, err := h.repo.GetByID(uint(id))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Product not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve product: "+err.Error())
+		}
+		return
+	}
+	
+	if product.Barcode == "" {
+		writeError(w, http.StatusNotFound, errCodeNotFound, "Product has no barcode")
+		return
+	}
+	
+	modules, err := models.EAN13Modules(product.Barcode)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Only EAN-13 barcodes can be rendered: "+err.Error())
+		return
+	}
+	
+	width := (len(modules) + 2*barcodeQuietZone) * barcodeModuleWidth
+	img := image.NewGray(image.Rect(0, 0, width, barcodeHeight))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	for i, bar := range modules {
+		if !bar {
+			continue
+		}
+		x := (barcodeQuietZone + i) * barcodeModuleWidth
+		draw.Draw(img, image.Rect(x, 0, x+barcodeModuleWidth, barcodeHeight), image.Black, image.Point{}, draw.Src)
+	}
+	
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Disposition", `inline; filename="`+product.Barcode+`.png"`)
+	if err := png.Encode(w, img); err != nil {
+		log.Printf("Failed to encode barcode image for product %d: %v", product.ID, err)
+	}
+}
+var (
+	errBundleCycle       = errors.New("A product can't be a component of itself or of its own components")
+	errInvalidBundleItem = errors.New("Invalid bundle item")
+)
+
+// bundleItem is one component line of a bundle definition
+type bundleItem struct {
+	ProductID uint `json:"product_id"`
+	Quantity  int  `json:"quantity"`
+}
+
+// bundleResponse describes a bundle's components and how many complete bundles they can make
+type bundleResponse struct {
+	ProductID uint                   `json:"product_id"`
+	Items     []models.ProductBundle `json:"items"`
+	Available int                    `json:"available"`
+}
+
+// writeBundle encodes a product's bundle definition with its current availability
+func (h *ProductHandler) writeBundle(w http.ResponseWriter, productID uint, status int) {
+	components, err := models.BundleComponents(h.db, productID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve bundle items: "+err.Error())
+		return
+	}
+	
+	available, err := models.AvailableQuantity(h.db, productID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to check available stock: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(bundleResponse{ProductID: productID, Items: components, Available: available})
+}
+
+// GetBundleItems handles GET requests to list the components of a bundle product
+func (h *ProductHandler) GetBundleItems(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid product ID")
+		return
+	}
+	
+	if _, err := h.repo.GetByID(uint(id)); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Product not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve product: "+err.Error())
+		}
+		return
+	}
+	
+	h.writeBundle(w, uint(id), http.StatusOK)
+}
+
+// SetBundleItems handles POST requests to define a product as a bundle of other products,
+// replacing any existing components; an empty list makes it an ordinary product again.
+// Selling and fulfilling a bundle issues its components' stock, so a component may not
+// itself contain the bundle.
+func (h *ProductHandler) SetBundleItems(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid product ID")
+		return
+	}
+	
+	var request struct {
+		Items []bundleItem `json:"items"`
+	}
+	
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	
+	seen := make(map[uint]bool)
+	for _, item := range request.Items {
+		if item.ProductID == 0 || item.Quantity <= 0 {
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Each bundle item needs a product ID and a quantity > 0")
+			return
+		}
+		if seen[item.ProductID] {
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, fmt.Sprintf("Product %d is listed more than once", item.ProductID))
+			return
+		}
+		seen[item.ProductID] = true
+	}
+	
+	var oldComponents []models.ProductBundle
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		var bundle models.Product
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&bundle, id).Error; err != nil {
+			return err
+		}
+		
+		components, err := models.BundleComponents(tx, bundle.ID)
+		if err != nil {
+			return err
+		}
+		oldComponents = components
+		
+		if err := tx.Where("parent_product_id = ?", bundle.ID).Delete(&models.ProductBundle{}).Error; err != nil {
+			return err
+		}
+		
+		for _, item := range request.Items {
+			var count int64
+			if err := tx.Model(&models.Product{}).Where("id = ?", item.ProductID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return fmt.Errorf("%w: product %d not found", errInvalidBundleItem, item.ProductID)
+			}
+			
+			// Checked against the components added so far, so cycles through this bundle are caught too
+			cycle, err := models.BundleContains(tx, item.ProductID, bundle.ID)
+			if err != nil {
+				return err
+			}
+			if cycle {
+				return fmt.Errorf("%w (product %d)", errBundleCycle, item.ProductID)
+			}
+			
+			component := models.ProductBundle{
+				ParentProductID: bundle.ID,
+				ChildProductID:  item.ProductID,
+				Quantity:        item.Quantity,
+			}
+			if err := tx.Create(&component).Error; err != nil {
+				return err
+			}
+		}
+		
+		return nil
+	})
+	if err != nil {
+		switch {
+		case err == gorm.ErrRecordNotFound:
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Product not found")
+		case errors.Is(err, errInvalidBundleItem), errors.Is(err, errBundleCycle):
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to save bundle items: "+err.Error())
+		}
+		return
+	}
+	
+	recordAudit(h.db, r, "set_bundle_items", "product", uint(id), oldComponents, request.Items)
+	
+	h.writeBundle(w, uint(id), http.StatusOK)
+}
+
+// reconcileBatchSize is how many products are locked and corrected per database transaction
+const reconcileBatchSize = 500
+
+// quantityDiscrepancy is a product whose recorded quantity differs from its transaction history
+type quantityDiscrepancy struct {
+	ProductID        uint   `json:"product_id"`
+	SKU              string `json:"sku"`
+	RecordedQuantity int    `json:"recorded_quantity"`
+	LedgerQuantity   int    `json:"ledger_quantity"`
+	Difference       int    `json:"difference"`
+}
+
+// ReconcileAllProducts handles POST requests to recompute every active product's quantity
+// from its transaction history and correct any that differ, for use after migrations or
+// bug fixes. Products are processed in ID order in batches, each in its own transaction,
+// so only one batch of rows is locked at a time. With ?dry_run=true the discrepancies are
+// reported but nothing is changed.
+func (h *ProductHandler) ReconcileAllProducts(w http.ResponseWriter, r *http.Request) {
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+	
+	checked := 0
+	corrected := 0
+	discrepancies := []quantityDiscrepancy{}
+	
+	var lastID uint
+	for {
+		var batch []quantityDiscrepancy
+		batchSize := 0
+		
+		err := h.db.Transaction(func(tx *gorm.DB) error {
+			var products []models.Product
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Select("id", "sku", "quantity").
+				Where("status = ? AND id > ?", "active", lastID).
+				Order("id").Limit(reconcileBatchSize).
+				Find(&products).Error; err != nil {
+				return err
+			}
+			batchSize = len(products)
+			if batchSize == 0 {
+				return nil
+			}
+			lastID = products[batchSize-1].ID
+			
+			ids := make([]uint, batchSize)
+			for i, product := range products {
+				ids[i] = product.ID
+			}
+			
+			var ledger []struct {
+				ProductID uint
+				Quantity  int
+			}
+			if err := tx.Table("inventory_transactions").
+				Select("inventory_transactions.product_id, COALESCE(SUM("+signedQuantitySQL+"), 0) as quantity").
+				Where("inventory_transactions.product_id IN ?", ids).
+				Group("inventory_transactions.product_id").
+				Scan(&ledger).Error; err != nil {
+				return err
+			}
+			
+			ledgerQuantities := make(map[uint]int, len(ledger))
+			for _, row := range ledger {
+				ledgerQuantities[row.ProductID] = row.Quantity
+			}
+			
+			for _, product := range products {
+				ledgerQuantity := ledgerQuantities[product.ID]
+				if ledgerQuantity == product.Quantity {
+					continue
+				}
+				
+				batch = append(batch, quantityDiscrepancy{
+					ProductID:        product.ID,
+					SKU:              product.SKU,
+					RecordedQuantity: product.Quantity,
+					LedgerQuantity:   ledgerQuantity,
+					Difference:       ledgerQuantity - product.Quantity,
+				})
+				
+				if !dryRun {
+					if err := tx.Model(&models.Product{}).Where("id = ?", product.ID).
+						UpdateColumn("quantity", ledgerQuantity).Error; err != nil {
+						return err
+					}
+				}
+			}
+			
+			return nil
+		})
+		if err != nil {
+			// Batches already committed stay corrected; report how far the run got
+			writeError(w, http.StatusInternalServerError, errCodeInternal, fmt.Sprintf("Failed to reconcile products after %d checked and %d corrected: %v", checked, corrected, err))
+			return
+		}
+		
+		if batchSize == 0 {
+			break
+		}
+		
+		checked += batchSize
+		discrepancies = append(discrepancies, batch...)
+		if !dryRun {
+			corrected += len(batch)
+			for _, discrepancy := range batch {
+				recordAudit(h.db, r, "reconcile_quantity", "product", discrepancy.ProductID,
+					map[string]interface{}{"quantity": discrepancy.RecordedQuantity},
+					map[string]interface{}{"quantity": discrepancy.LedgerQuantity})
+			}
+		}
+		
+		if batchSize < reconcileBatchSize {
+			break
+		}
+	}
+	
+	response := map[string]interface{}{
+		"dry_run":             dryRun,
+		"products_checked":    checked,
+		"discrepancies_found": len(discrepancies),
+		"corrections_applied": corrected,
+		"discrepancies":       discrepancies,
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// RestoreProduct handles POST requests to undo a product's soft delete
+func (h *ProductHandler) RestoreProduct(w http.ResponseWriter, r *http.Request) {
+	restoreDeleted(w, r, h.db, &models.Product{}, "product", "product")
+}
+
+// productSupplierRequest is the body accepted when linking a supplier to a product or
+// replacing the link's pricing
+type productSupplierRequest struct {
+	UnitCost         float64 `json:"unit_cost"`
+	MinOrderQuantity int     `json:"min_order_quantity"`
+	LeadTimeDays     int     `json:"lead_time_days"`
+	SupplierSKU      string  `json:"supplier_sku"`
+}
+
+// apply validates the request and copies it onto link
+func (req *productSupplierRequest) apply(link *models.ProductSupplier) error {
+	if req.UnitCost < 0 || req.LeadTimeDays < 0 || req.MinOrderQuantity < 0 {
+		return errors.New("Unit cost, minimum order quantity and lead time must not be negative")
+	}
+	if req.MinOrderQuantity == 0 {
+		req.MinOrderQuantity = 1
+	}
+	
+	link.UnitCost = models.RoundCurrency(req.UnitCost)
+	link.MinOrderQuantity = req.MinOrderQuantity
+	link.LeadTimeDays = req.LeadTimeDays
+	link.SupplierSKU = req.SupplierSKU
+	return nil
+}
+
+// productSupplierIDs parses the product and supplier IDs from a supplier pricing route
+func productSupplierIDs(w http.ResponseWriter, r *http.Request) (uint, uint, bool) {
+	vars := mux.Vars(r)
+	productID, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid product ID")
+		return 0, 0, false
+	}
+	
+	supplierID, err := strconv.ParseUint(vars["supplierId"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid supplier ID")
+		return 0, 0, false
+	}
+	
+	return uint(productID), uint(supplierID), true
+}
+
+// GetProductSuppliers handles GET requests to list a product's supplier pricing, cheapest first
+func (h *ProductHandler) GetProductSuppliers(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid product ID")
+		return
+	}
+	
+	if _, err := h.repo.GetByID(uint(id)); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Product not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve product: "+err.Error())
+		}
+		return
+	}
+	
+	links := []models.ProductSupplier{}
+	if err := h.db.Preload("Supplier").Where("product_id = ?", id).
+		Order("unit_cost ASC, supplier_id ASC").Find(&links).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve supplier pricing: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(links)
+}
+
+// CreateProductSupplier handles POST requests to link a supplier to a product with its pricing
+func (h *ProductHandler) CreateProductSupplier(w http.ResponseWriter, r *http.Request) {
+	productID, supplierID, ok := productSupplierIDs(w, r)
+	if !ok {
+		return
+	}
+	
+	var req productSupplierRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	
+	link := models.ProductSupplier{ProductID: productID, SupplierID: supplierID}
+	if err := req.apply(&link); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, err.Error())
+		return
+	}
+	
+	if _, err := h.repo.GetByID(productID); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Product not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve product: "+err.Error())
+		}
+		return
+	}
+	
+	if !requireActiveReference(w, h.db, &models.Supplier{}, supplierID, "supplier_id", "supplier") {
+		return
+	}
+	
+	var existing int64
+	if err := h.db.Model(&models.ProductSupplier{}).
+		Where("product_id = ? AND supplier_id = ?", productID, supplierID).Count(&existing).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to check supplier pricing: "+err.Error())
+		return
+	}
+	if existing > 0 {
+		writeError(w, http.StatusConflict, errCodeDuplicate, "Supplier is already linked to this product")
+		return
+	}
+	
+	if err := h.db.Create(&link).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to create supplier pricing: "+err.Error())
+		return
+	}
+	
+	recordAudit(h.db, r, "create", "product_supplier", productID, nil, link)
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(link)
+}
+
+// UpdateProductSupplier handles PUT requests to replace a supplier's pricing for a product
+func (h *ProductHandler) UpdateProductSupplier(w http.ResponseWriter, r *http.Request) {
+	productID, supplierID, ok := productSupplierIDs(w, r)
+	if !ok {
+		return
+	}
+	
+	var link models.ProductSupplier
+	if err := h.db.Where("product_id = ? AND supplier_id = ?", productID, supplierID).First(&link).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Supplier is not linked to this product")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve supplier pricing: "+err.Error())
+		}
+		return
+	}
+	oldLink := link
+	
+	var req productSupplierRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	
+	if err := req.apply(&link); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, err.Error())
+		return
+	}
+	
+	if err := h.db.Save(&link).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update supplier pricing: "+err.Error())
+		return
+	}
+	
+	recordAudit(h.db, r, "update", "product_supplier", productID, oldLink, link)
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(link)
+}
+
+// DeleteProductSupplier handles DELETE requests to unlink a supplier from a product
+func (h *ProductHandler) DeleteProductSupplier(w http.ResponseWriter, r *http.Request) {
+	productID, supplierID, ok := productSupplierIDs(w, r)
+	if !ok {
+		return
+	}
+	
+	var link models.ProductSupplier
+	if err := h.db.Where("product_id = ? AND supplier_id = ?", productID, supplierID).First(&link).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Supplier is not linked to this product")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve supplier pricing: "+err.Error())
+		}
+		return
+	}
+	
+	if err := h.db.Where("product_id = ? AND supplier_id = ?", productID, supplierID).
+		Delete(&models.ProductSupplier{}).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to delete supplier pricing: "+err.Error())
+		return
+	}
+	
+	recordAudit(h.db, r, "delete", "product_supplier", productID, link, nil)
+	
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validateCustomFields checks product custom field values against their definitions,
+// answering with 400 when they don't match. It reports whether the values are valid.
+func (h *ProductHandler) validateCustomFields(w http.ResponseWriter, values models.CustomFieldValues) bool {
+	if err := models.ValidateCustomFields(h.db, values); err != nil {
+		if errors.Is(err, models.ErrInvalidCustomField) {
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, err.Error())
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to validate custom fields: "+err.Error())
+		}
+		return false
+	}
+	return true
+}
+
+// SetProductCustomFields handles PUT requests to set some of a product's custom field
+// values. Fields left out keep their values and a null value clears a field.
+func (h *ProductHandler) SetProductCustomFields(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid product ID")
+		return
+	}
+	
+	var changes map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	
+	var product models.Product
+	var oldValues models.CustomFieldValues
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, id).Error; err != nil {
+			return err
+		}
+		
+		oldValues = product.CustomFields
+		values := models.CustomFieldValues{}
+		for name, value := range product.CustomFields {
+			values[name] = value
+		}
+		for name, value := range changes {
+			if value == nil {
+				delete(values, name)
+			} else {
+				values[name] = value
+			}
+		}
+		
+		if err := models.ValidateCustomFields(tx, values); err != nil {
+			return err
+		}
+		
+		product.CustomFields = values
+		product.Version++
+		return tx.Model(&product).UpdateColumns(map[string]interface{}{
+			"custom_fields": values,
+			"version":       product.Version,
+		}).Error
+	})
+	if err != nil {
+		switch {
+		case err == gorm.ErrRecordNotFound:
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Product not found")
+		case errors.Is(err, models.ErrInvalidCustomField):
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update custom fields: "+err.Error())
+		}
+		return
+	}
+	recordAudit(h.db, r, "update", "product", product.ID,
+		map[string]interface{}{"custom_fields": oldValues},
+		map[string]interface{}{"custom_fields": product.CustomFields})
+	
+	setVersionETag(w, product.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product.CustomFields)
+}
+
+// productImportRow is one product in an import, from a JSON object or a CSV line. Price and
+// reorder level are pointers so a missing value can be told apart from zero.
+type productImportRow struct {
+	Row          int      `json:"-"` // Line number in a CSV upload; JSON rows use their index
+	SKU          string   `json:"sku"`
+	Name         string   `json:"name"`
+	Description  string   `json:"description"`
+	Price        *float64 `json:"price"`
+	CostPrice    float64  `json:"cost_price"`
+	Quantity     int      `json:"quantity"`
+	ReorderLevel *int     `json:"reorder_level"`
+	Barcode      string   `json:"barcode"`
+	Status       string   `json:"status"`
+}
+
+// productImportError explains why one row of an import was skipped
+type productImportError struct {
+	Row    int    `json:"row"`
+	SKU    string `json:"sku"`
+	Reason string `json:"reason"`
+}
+
+// productImportColumns are the CSV columns an import understands; sku, name and price are required
+var productImportColumns = map[string]bool{
+	"sku": true, "name": true, "description": true, "price": true, "cost_price": true,
+	"quantity": true, "reorder_level": true, "barcode": true, "status": true,
+}
+
+// ImportProducts handles POST requests to create products in bulk, from a JSON array or a
+// CSV file uploaded as the multipart "file" field. Each row is validated on its own: valid
+// rows are inserted in one transaction and invalid ones reported with their row number.
+// With ?upsert=true a row whose SKU exists updates that product instead of failing; stock
+// quantity is only taken for new products, as existing stock changes through transactions.
+func (h *ProductHandler) ImportProducts(w http.ResponseWriter, r *http.Request) {
+	upsert := r.URL.Query().Get("upsert") == "true"
+	
+	var rows []productImportRow
+	var errs []productImportError
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(10 << 20); err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid multipart upload: "+err.Error())
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidBody, "A CSV file is required in the \"file\" field")
+			return
+		}
+		defer file.Close()
+		
+		rows, errs, err = parseProductImportCSV(csv.NewReader(file))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid CSV: "+err.Error())
+			return
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&rows); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	
+	// Look up which SKUs already exist, including soft-deleted products that still hold theirs
+	skus := make([]string, 0, len(rows))
+	for _, row := range rows {
+		skus = append(skus, strings.TrimSpace(row.SKU))
+	}
+	existing := make(map[string]models.Product)
+	if len(skus) > 0 {
+		var products []models.Product
+		if err := h.db.Unscoped().Where("sku IN ?", skus).Find(&products).Error; err != nil {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to check existing SKUs: "+err.Error())
+			return
+		}
+		for _, product := range products {
+			existing[product.SKU] = product
+		}
+	}
+	
+	var created, updated []models.Product
+	var previous []models.Product
+	seen := make(map[string]int)
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		for i, row := range rows {
+			rowNumber := i + 1
+			if row.Row > 0 {
+				rowNumber = row.Row
+			}
+			row.SKU = strings.TrimSpace(row.SKU)
+			row.Name = strings.TrimSpace(row.Name)
+			
+			reason := validateProductImportRow(row)
+			if reason == "" {
+				if first, ok := seen[row.SKU]; ok {
+					reason = fmt.Sprintf("SKU is repeated from row %d", first)
+				} else if current, ok := existing[row.SKU]; ok && current.DeletedAt.Valid {
+					reason = "SKU belongs to a deleted product; restore it instead"
+				} else if ok && !upsert {
+					reason = "Product with this SKU already exists"
+				}
+			}
+			if reason != "" {
+				errs = append(errs, productImportError{Row: rowNumber, SKU: row.SKU, Reason: reason})
+				continue
+			}
+			seen[row.SKU] = rowNumber
+			
+			// A savepoint per row keeps one failed insert from aborting the whole transaction
+			tx.SavePoint("import_row")
+			if current, ok := existing[row.SKU]; ok {
+				product := current
+				applyProductImportRow(&product, row)
+				product.Version = current.Version + 1
+				
+				// The product was read before the transaction, so only update the version seen then
+				err := models.CheckVersion(tx.Model(&product).Where("version = ?", current.Version).
+					Select("name", "description", "price", "cost_price", "reorder_level", "barcode", "status", "version").
+					Updates(&product))
+				if err != nil {
+					tx.RollbackTo("import_row")
+					reason := err.Error()
+					if errors.Is(err, models.ErrVersionConflict) {
+						reason = "Product was modified during the import; retry this row"
+					}
+					errs = append(errs, productImportError{Row: rowNumber, SKU: row.SKU, Reason: reason})
+					continue
+				}
+				previous = append(previous, current)
+				updated = append(updated, product)
+				continue
+			}
+			
+			product := models.Product{SKU: row.SKU, Quantity: row.Quantity}
+			applyProductImportRow(&product, row)
+			if err := tx.Create(&product).Error; err != nil {
+				tx.RollbackTo("import_row")
+				errs = append(errs, productImportError{Row: rowNumber, SKU: row.SKU, Reason: err.Error()})
+				continue
+			}
+			created = append(created, product)
+		}
+		return nil
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to import products: "+err.Error())
+		return
+	}
+	
+	for _, product := range created {
+		recordAudit(h.db, r, "create", "product", product.ID, nil, product)
+	}
+	for i, product := range updated {
+		recordAudit(h.db, r, "update", "product", product.ID, previous[i], product)
+	}
+	
+	if errs == nil {
+		errs = []productImportError{}
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Row < errs[j].Row })
+	
+	response := map[string]interface{}{
+		"created": len(created),
+		"failed":  len(errs),
+		"errors":  errs,
+	}
+	if upsert {
+		response["updated"] = len(updated)
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// validateProductImportRow returns why a row can't be imported, or "" if it can
+func validateProductImportRow(row productImportRow) string {
+	switch {
+	case row.SKU == "":
+		return "SKU is required"
+	case row.Name == "":
+		return "Name is required"
+	case row.Price == nil:
+		return "Price is required"
+	case *row.Price < 0 || row.CostPrice < 0:
+		return "Prices cannot be negative"
+	case row.Quantity < 0:
+		return "Quantity cannot be negative"
+	case row.ReorderLevel != nil && *row.ReorderLevel < 0:
+		return "Reorder level cannot be negative"
+	}
+	return ""
+}
+
+// applyProductImportRow copies a row's descriptive fields onto a product. Optional fields
+// left empty keep the product's value, or the column default for a new product.
+func applyProductImportRow(product *models.Product, row productImportRow) {
+	product.Name = row.Name
+	product.Description = row.Description
+	product.Price = *row.Price
+	product.CostPrice = row.CostPrice
+	product.Barcode = row.Barcode
+	if row.ReorderLevel != nil {
+		product.ReorderLevel = *row.ReorderLevel
+	}
+	if row.Status != "" {
+		product.Status = row.Status
+	}
+}
+
+// parseProductImportCSV reads import rows from a CSV file whose first line names the
+// columns. Lines with unparseable numbers are returned as row errors rather than rows;
+// an unreadable file or a missing or unknown column fails the whole import.
+func parseProductImportCSV(reader *csv.Reader) ([]productImportRow, []productImportError, error) {
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading header: %w", err)
+	}
+	
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !productImportColumns[name] {
+			return nil, nil, fmt.Errorf("unknown column %q", name)
+		}
+		columns[name] = i
+	}
+	for _, required := range []string{"sku", "name", "price"} {
+		if _, ok := columns[required]; !ok {
+			return nil, nil, fmt.Errorf("missing %q column", required)
+		}
+	}
+	
+	var rows []productImportRow
+	var errs []productImportError
+	for rowNumber := 1; ; rowNumber++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		
+		value := func(column string) string {
+			if i, ok := columns[column]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		row := productImportRow{
+			Row:         rowNumber,
+			SKU:         value("sku"),
+			Name:        value("name"),
+			Description: value("description"),
+			Barcode:     value("barcode"),
+			Status:      value("status"),
+		}
+		
+		var parseErr error
+		if s := value("price"); s != "" {
+			price, err := strconv.ParseFloat(s, 64)
+			row.Price, parseErr = &price, err
+		}
+		if s := value("cost_price"); s != "" && parseErr == nil {
+			row.CostPrice, parseErr = strconv.ParseFloat(s, 64)
+		}
+		if s := value("quantity"); s != "" && parseErr == nil {
+			row.Quantity, parseErr = strconv.Atoi(s)
+		}
+		if s := value("reorder_level"); s != "" && parseErr == nil {
+			level, err := strconv.Atoi(s)
+			row.ReorderLevel, parseErr = &level, err
+		}
+		if parseErr != nil {
+			errs = append(errs, productImportError{Row: rowNumber, SKU: row.SKU, Reason: "Invalid number: " + parseErr.Error()})
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, errs, nil
 }
\ No newline at end of file
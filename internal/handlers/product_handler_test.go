@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/yourusername/inventory-management-system/internal/models"
+	"github.com/yourusername/inventory-management-system/internal/repository"
+	"github.com/yourusername/inventory-management-system/internal/testutil"
+	"gorm.io/gorm"
+)
+
+// disassemble posts a disassembly request for a bundle to DisassembleBundle
+func disassemble(h *ProductHandler, bundleID, userID uint, request map[string]interface{}) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(request)
+	r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/products/%d/disassemble", bundleID), bytes.NewReader(body))
+	r = mux.SetURLVars(r, map[string]string{"id": fmt.Sprint(bundleID)})
+	r = r.WithContext(context.WithValue(r.Context(), "userID", userID))
+
+	w := httptest.NewRecorder()
+	h.DisassembleBundle(w, r)
+	return w
+}
+
+// stockAt reads a product's stock at a location, or 0 when it has no record there
+func stockAt(t *testing.T, db *gorm.DB, productID, warehouseID, locationID uint) int {
+	t.Helper()
+	var stock models.ProductWarehouse
+	err := db.Scopes(models.StockAt(productID, warehouseID, &locationID)).First(&stock).Error
+	if err == gorm.ErrRecordNotFound {
+		return 0
+	}
+	if err != nil {
+		t.Fatalf("reading location stock: %v", err)
+	}
+	return stock.Quantity
+}
+
+func TestDisassembleBundleMovesLocationStock(t *testing.T) {
+	db := testutil.Tx(t)
+	user := testutil.CreateUser(t, db, "staff")
+	warehouse := testutil.CreateWarehouse(t, db)
+	shelf := testutil.CreateLocation(t, db, warehouse.ID)
+	bench := testutil.CreateLocation(t, db, warehouse.ID)
+	bundle := testutil.CreateProduct(t, db, 0)
+	first := testutil.CreateProduct(t, db, 0)
+	second := testutil.CreateProduct(t, db, 0)
+	for _, component := range []models.ProductBundle{
+		{ParentProductID: bundle.ID, ChildProductID: first.ID, Quantity: 2},
+		{ParentProductID: bundle.ID, ChildProductID: second.ID, Quantity: 1},
+	} {
+		if err := db.Create(&component).Error; err != nil {
+			t.Fatalf("creating bundle component: %v", err)
+		}
+	}
+
+	receipt := models.InventoryTransaction{
+		ProductID:             bundle.ID,
+		WarehouseID:           warehouse.ID,
+		DestinationLocationID: &shelf.ID,
+		Type:                  "receive",
+		Quantity:              5,
+		UserID:                user.ID,
+	}
+	if err := repository.NewTransactionRepository(db).Create(&receipt); err != nil {
+		t.Fatalf("receiving bundles: %v", err)
+	}
+	h := NewProductHandler(db)
+
+	// Without locations the warehouse can't say where the stock moves
+	w := disassemble(h, bundle.ID, user.ID, map[string]interface{}{"quantity": 1, "warehouse_id": warehouse.ID})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("disassembling without locations: status %d, want 400: %s", w.Code, w.Body)
+	}
+
+	w = disassemble(h, bundle.ID, user.ID, map[string]interface{}{
+		"quantity":                3,
+		"warehouse_id":            warehouse.ID,
+		"source_location_id":      shelf.ID,
+		"destination_location_id": bench.ID,
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("disassembling: status %d: %s", w.Code, w.Body)
+	}
+
+	// Only 2 bundles are left
+	w = disassemble(h, bundle.ID, user.ID, map[string]interface{}{
+		"quantity":                3,
+		"warehouse_id":            warehouse.ID,
+		"source_location_id":      shelf.ID,
+		"destination_location_id": bench.ID,
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("disassembling more than is held: status %d, want 400: %s", w.Code, w.Body)
+	}
+
+	tests := []struct {
+		name                   string
+		product                models.Product
+		location               models.WarehouseLocation
+		wantTotal, wantAtPlace int
+	}{
+		{"bundle", bundle, shelf, 2, 2},
+		{"first component", first, bench, 6, 6},
+		{"second component", second, bench, 3, 3},
+	}
+	for _, tt := range tests {
+		if got := productQuantity(t, db, tt.product.ID); got != tt.wantTotal {
+			t.Errorf("%s quantity = %d, want %d", tt.name, got, tt.wantTotal)
+		}
+		if got := stockAt(t, db, tt.product.ID, warehouse.ID, tt.location.ID); got != tt.wantAtPlace {
+			t.Errorf("%s stock at its location = %d, want %d", tt.name, got, tt.wantAtPlace)
+		}
+	}
+}
+
+// adjustQuantity sends a compare-and-set quantity edit to AdjustProductQuantity
+func adjustQuantity(h *ProductHandler, productID, userID uint, request map[string]interface{}) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(request)
+	r := httptest.NewRequest(http.MethodPatch, fmt.Sprintf("/products/%d/quantity", productID), bytes.NewReader(body))
+	r = mux.SetURLVars(r, map[string]string{"id": fmt.Sprint(productID)})
+	r = r.WithContext(context.WithValue(r.Context(), "userID", userID))
+
+	w := httptest.NewRecorder()
+	h.AdjustProductQuantity(w, r)
+	return w
+}
+
+func TestAdjustProductQuantityRecordsAdjustment(t *testing.T) {
+	db := testutil.Tx(t)
+	user := testutil.CreateUser(t, db, "staff")
+	warehouse := testutil.CreateWarehouse(t, db)
+	product := testutil.CreateProduct(t, db, 10)
+	h := NewProductHandler(db)
+
+	w := adjustQuantity(h, product.ID, user.ID, map[string]interface{}{
+		"expected_quantity": 10,
+		"delta":             -3,
+		"warehouse_id":      warehouse.ID,
+		"reason_code":       "damage",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("adjusting quantity: status %d: %s", w.Code, w.Body)
+	}
+
+	var transaction models.InventoryTransaction
+	if err := db.Where("product_id = ? AND type = ?", product.ID, "adjustment").First(&transaction).Error; err != nil {
+		t.Fatalf("reading adjustment transaction: %v", err)
+	}
+	if transaction.Quantity != -3 || transaction.ReasonCode != "damage" {
+		t.Errorf("adjustment = %d (%q), want -3 (\"damage\")", transaction.Quantity, transaction.ReasonCode)
+	}
+
+	// The client's read of 10 is now stale
+	w = adjustQuantity(h, product.ID, user.ID, map[string]interface{}{
+		"expected_quantity": 10,
+		"delta":             -3,
+		"warehouse_id":      warehouse.ID,
+		"reason_code":       "damage",
+	})
+	if w.Code != http.StatusConflict {
+		t.Errorf("adjusting from a stale quantity: status %d, want 409: %s", w.Code, w.Body)
+	}
+	if got := productQuantity(t, db, product.ID); got != 7 {
+		t.Errorf("quantity = %d, want 7", got)
+	}
+
+	var count int64
+	db.Model(&models.InventoryTransaction{}).Where("product_id = ?", product.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("transactions = %d, want 1", count)
+	}
+}
@@ -2,13 +2,18 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/yourusername/inventory-management-system/internal/models"
+	"github.com/yourusername/inventory-management-system/internal/repository"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // PurchaseOrderHandler handles HTTP requests for purchase order endpoints
@@ -21,12 +26,51 @@ func NewPurchaseOrderHandler(db *gorm.DB) *PurchaseOrderHandler {
 	return &PurchaseOrderHandler{db: db}
 }
 
+// applySupplierPricing defaults a purchase order line's unit price from the supplier's
+// pricing for the product when none was given, and returns a warning when the line orders
+// less than the supplier's minimum order quantity. Unlinked products are left as they are.
+func applySupplierPricing(db *gorm.DB, item *models.PurchaseOrderItem, supplierID uint) (*confirmationIssue, error) {
+	var link models.ProductSupplier
+	if err := db.Where("product_id = ? AND supplier_id = ?", item.ProductID, supplierID).First(&link).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	
+	if item.UnitPrice == 0 {
+		item.UnitPrice = link.UnitCost
+	}
+	
+	if item.Quantity < link.MinOrderQuantity {
+		return &confirmationIssue{
+			Code:    "BELOW_MIN_ORDER_QUANTITY",
+			Message: fmt.Sprintf("Product %d is ordered in %d units but the supplier's minimum order quantity is %d", item.ProductID, item.Quantity, link.MinOrderQuantity),
+			ItemID:  item.ID,
+		}, nil
+	}
+	return nil, nil
+}
+
+// rejectUnacknowledgedWarnings answers with 409 and the warnings until the request is
+// retried with ?acknowledge_warnings=true. It reports whether it wrote a response.
+func rejectUnacknowledgedWarnings(w http.ResponseWriter, r *http.Request, warnings []confirmationIssue) bool {
+	if len(warnings) == 0 || r.URL.Query().Get("acknowledge_warnings") == "true" {
+		return false
+	}
+	
+	writeErrorDetails(w, http.StatusConflict, errCodeUnacknowledgedWarnings, "Request has warnings; retry with acknowledge_warnings=true to proceed", map[string]interface{}{
+		"warnings": warnings,
+	})
+	return true
+}
+
 // GetPurchaseOrders handles GET requests to retrieve all purchase orders
 func (h *PurchaseOrderHandler) GetPurchaseOrders(w http.ResponseWriter, r *http.Request) {
 	var orders []models.PurchaseOrder
 	
 	// Apply filters if any
-	query := h.db.Preload("Supplier").Preload("Warehouse").Preload("User")
+	query := h.db.Model(&models.PurchaseOrder{})
 	
 	if status := r.URL.Query().Get("status"); status != "" {
 		query = query.Where("status = ?", status)
@@ -48,32 +92,32 @@ func (h *PurchaseOrderHandler) GetPurchaseOrders(w http.ResponseWriter, r *http.
 		query = query.Where("order_date <= ?", endDate)
 	}
 	
-	// Apply pagination
-	page := 1
-	limit := 10
-	
-	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
-		if pageNum, err := strconv.Atoi(pageStr); err == nil && pageNum > 0 {
-			page = pageNum
-		}
-	}
-	
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-		if limitNum, err := strconv.Atoi(limitStr); err == nil && limitNum > 0 {
-			limit = limitNum
-		}
+	timestamps, err := parseTimestampFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidParameter, err.Error())
+		return
 	}
+	query = timestamps.apply(query, "purchase_orders")
 	
+	// Apply pagination; the total is counted with the same filters
+	page, limit := parsePagination(r)
 	offset := (page - 1) * limit
 	
+	var total int64
+	if err := query.Session(&gorm.Session{}).Model(&models.PurchaseOrder{}).Count(&total).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to count purchase orders: "+err.Error())
+		return
+	}
+	
 	// Execute query
-	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&orders).Error; err != nil {
-		http.Error(w, "Failed to retrieve purchase orders: "+err.Error(), http.StatusInternalServerError)
+	if err := query.Preload("Supplier", includeDeleted).Preload("Warehouse", includeDeleted).Preload("User", includeDeleted).
+		Order("created_at DESC").Limit(limit).Offset(offset).Find(&orders).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve purchase orders: "+err.Error())
 		return
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(orders)
+	json.NewEncoder(w).Encode(newPaginatedResponse(orders, page, limit, total))
 }
 
 // GetPurchaseOrder handles GET requests to retrieve a single purchase order
@@ -81,21 +125,22 @@ func (h *PurchaseOrderHandler) GetPurchaseOrder(w http.ResponseWriter, r *http.R
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid purchase order ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid purchase order ID")
 		return
 	}
 	
 	var order models.PurchaseOrder
-	if err := h.db.Preload("Supplier").Preload("Warehouse").Preload("User").Preload("Items").
-		Preload("Items.Product").First(&order, id).Error; err != nil {
+	if err := h.db.Preload("Supplier", includeDeleted).Preload("Warehouse", includeDeleted).Preload("User", includeDeleted).Preload("Approver", includeDeleted).Preload("Receiver", includeDeleted).Preload("Items").
+		Preload("Items.Product", includeDeleted).First(&order, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Purchase order not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Purchase order not found")
 		} else {
-			http.Error(w, "Failed to retrieve purchase order: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve purchase order: "+err.Error())
 		}
 		return
 	}
 	
+	setVersionETag(w, order.Version)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(order)
 }
@@ -105,13 +150,34 @@ func (h *PurchaseOrderHandler) CreatePurchaseOrder(w http.ResponseWriter, r *htt
 	var order models.PurchaseOrder
 	
 	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
 		return
 	}
 	
 	// Validate required fields
 	if order.SupplierID == 0 || order.WarehouseID == 0 {
-		http.Error(w, "Supplier ID and Warehouse ID are required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Supplier ID and Warehouse ID are required")
+		return
+	}
+	
+	if !requireActiveReference(w, h.db, &models.Supplier{}, order.SupplierID, "supplier_id", "supplier") ||
+		!requireActiveReference(w, h.db, &models.Warehouse{}, order.WarehouseID, "warehouse_id", "warehouse") {
+		return
+	}
+	
+	// Lines without a price take the supplier's unit cost
+	warnings := []confirmationIssue{}
+	for i := range order.Items {
+		issue, err := applySupplierPricing(h.db, &order.Items[i], order.SupplierID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve supplier pricing: "+err.Error())
+			return
+		}
+		if issue != nil {
+			warnings = append(warnings, *issue)
+		}
+	}
+	if rejectUnacknowledgedWarnings(w, r, warnings) {
 		return
 	}
 	
@@ -120,14 +186,17 @@ func (h *PurchaseOrderHandler) CreatePurchaseOrder(w http.ResponseWriter, r *htt
 		order.OrderDate = time.Now()
 	}
 	
-	if order.Status == "" {
-		order.Status = "draft"
-	}
+	// New orders always start as drafts and reach approved only through submit and approve
+	order.Status = "draft"
+	order.ApprovedBy = nil
+	order.ApprovedAt = nil
+	order.ReceivedDate = nil
+	order.ReceivedBy = nil
 	
 	// Get user ID from context (set by auth middleware)
 	userID, ok := r.Context().Value("userID").(uint)
 	if !ok {
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
 		return
 	}
 	order.UserID = userID
@@ -145,9 +214,10 @@ func (h *PurchaseOrderHandler) CreatePurchaseOrder(w http.ResponseWriter, r *htt
 	
 	// Create purchase order in database
 	if err := h.db.Create(&order).Error; err != nil {
-		http.Error(w, "Failed to create purchase order: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to create purchase order: "+err.Error())
 		return
 	}
+	recordAudit(h.db, r, "create", "purchase_order", order.ID, nil, order)
 	
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -159,7 +229,7 @@ func (h *PurchaseOrderHandler) UpdatePurchaseOrder(w http.ResponseWriter, r *htt
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid purchase order ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid purchase order ID")
 		return
 	}
 	
@@ -167,45 +237,63 @@ func (h *PurchaseOrderHandler) UpdatePurchaseOrder(w http.ResponseWriter, r *htt
 	var existingOrder models.PurchaseOrder
 	if err := h.db.First(&existingOrder, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Purchase order not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Purchase order not found")
 		} else {
-			http.Error(w, "Failed to retrieve purchase order: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve purchase order: "+err.Error())
 		}
 		return
 	}
 	
 	// Only draft orders can be updated
 	if existingOrder.Status != "draft" {
-		http.Error(w, "Only draft purchase orders can be updated", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidState, "Only draft purchase orders can be updated")
 		return
 	}
 	
 	// Parse request body
 	var updatedOrder models.PurchaseOrder
 	if err := json.NewDecoder(r.Body).Decode(&updatedOrder); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
 		return
 	}
 	
 	// Set the ID to ensure we're updating the correct record
 	updatedOrder.ID = uint(id)
 	
-	// Keep the original PO number
+	// Keep the original PO number; status, approval and receipt only change through their endpoints
 	updatedOrder.PONumber = existingOrder.PONumber
+	updatedOrder.Status = ""
+	updatedOrder.ApprovedBy = nil
+	updatedOrder.ApprovedAt = nil
+	updatedOrder.ReceivedDate = nil
+	updatedOrder.ReceivedBy = nil
+	
+	expected, ok := expectedVersion(w, r, updatedOrder.Version, existingOrder.Version)
+	if !ok {
+		return
+	}
+	updatedOrder.Version = expected + 1
 	
-	// Update in database
-	if err := h.db.Model(&updatedOrder).Updates(updatedOrder).Error; err != nil {
-		http.Error(w, "Failed to update purchase order: "+err.Error(), http.StatusInternalServerError)
+	// Update in database, unless someone else has since changed the order
+	err = models.CheckVersion(h.db.Model(&updatedOrder).Where("version = ?", expected).Updates(updatedOrder))
+	if errors.Is(err, models.ErrVersionConflict) {
+		writeVersionConflict(w, h.db, &models.PurchaseOrder{}, updatedOrder.ID)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update purchase order: "+err.Error())
 		return
 	}
 	
 	// Retrieve updated purchase order with relationships
 	var finalOrder models.PurchaseOrder
-	if err := h.db.Preload("Supplier").Preload("Warehouse").Preload("User").First(&finalOrder, id).Error; err != nil {
-		http.Error(w, "Failed to retrieve updated purchase order: "+err.Error(), http.StatusInternalServerError)
+	if err := h.db.Preload("Supplier", includeDeleted).Preload("Warehouse", includeDeleted).Preload("User", includeDeleted).First(&finalOrder, id).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve updated purchase order: "+err.Error())
 		return
 	}
+	recordAudit(h.db, r, "update", "purchase_order", finalOrder.ID, existingOrder, finalOrder)
 	
+	setVersionETag(w, finalOrder.Version)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(finalOrder)
 }
@@ -215,7 +303,7 @@ func (h *PurchaseOrderHandler) DeletePurchaseOrder(w http.ResponseWriter, r *htt
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid purchase order ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid purchase order ID")
 		return
 	}
 	
@@ -223,30 +311,30 @@ func (h *PurchaseOrderHandler) DeletePurchaseOrder(w http.ResponseWriter, r *htt
 	var order models.PurchaseOrder
 	if err := h.db.First(&order, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Purchase order not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Purchase order not found")
 		} else {
-			http.Error(w, "Failed to retrieve purchase order: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve purchase order: "+err.Error())
 		}
 		return
 	}
 	
 	// Only draft orders can be deleted
 	if order.Status != "draft" {
-		http.Error(w, "Only draft purchase orders can be deleted", http.StatusBadRequest)
-		return
-	}
-	
-	// Delete the order items first
-	if err := h.db.Where("purchase_order_id = ?", id).Delete(&models.PurchaseOrderItem{}).Error; err != nil {
-		http.Error(w, "Failed to delete purchase order items: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusBadRequest, errCodeInvalidState, "Only draft purchase orders can be deleted")
 		return
 	}
 	
-	// Delete the order
-	if err := h.db.Delete(&order).Error; err != nil {
-		http.Error(w, "Failed to delete purchase order: "+err.Error(), http.StatusInternalServerError)
+	// Delete the order items and the order together
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("purchase_order_id = ?", id).Delete(&models.PurchaseOrderItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&order).Error
+	}); err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to delete purchase order: "+err.Error())
 		return
 	}
+	recordAudit(h.db, r, "delete", "purchase_order", order.ID, order, nil)
 	
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -256,7 +344,7 @@ func (h *PurchaseOrderHandler) GetPurchaseOrderItems(w http.ResponseWriter, r *h
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid purchase order ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid purchase order ID")
 		return
 	}
 	
@@ -264,9 +352,9 @@ func (h *PurchaseOrderHandler) GetPurchaseOrderItems(w http.ResponseWriter, r *h
 	var order models.PurchaseOrder
 	if err := h.db.First(&order, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Purchase order not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Purchase order not found")
 		} else {
-			http.Error(w, "Failed to retrieve purchase order: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve purchase order: "+err.Error())
 		}
 		return
 	}
@@ -274,7 +362,7 @@ func (h *PurchaseOrderHandler) GetPurchaseOrderItems(w http.ResponseWriter, r *h
 	// Get items
 	var items []models.PurchaseOrderItem
 	if err := h.db.Preload("Product").Where("purchase_order_id = ?", id).Find(&items).Error; err != nil {
-		http.Error(w, "Failed to retrieve items: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve items: "+err.Error())
 		return
 	}
 	
@@ -287,7 +375,7 @@ func (h *PurchaseOrderHandler) AddPurchaseOrderItem(w http.ResponseWriter, r *ht
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid purchase order ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid purchase order ID")
 		return
 	}
 	
@@ -295,29 +383,28 @@ func (h *PurchaseOrderHandler) AddPurchaseOrderItem(w http.ResponseWriter, r *ht
 	var order models.PurchaseOrder
 	if err := h.db.First(&order, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Purchase order not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Purchase order not found")
 		} else {
-			http.Error(w, "Failed to retrieve purchase order: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve purchase order: "+err.Error())
 		}
 		return
 	}
 	
 	// Only draft orders can be modified
 	if order.Status != "draft" {
-		http.Error(w, "Only draft purchase orders can be modified", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidState, "Only draft purchase orders can be modified")
 		return
 	}
 	
 	// Parse request body
 	var item models.PurchaseOrderItem
 	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
 		return
 	}
 	
-	// Validate item
-	if item.ProductID == 0 || item.Quantity <= 0 || item.UnitPrice <= 0 {
-		http.Error(w, "Product ID, quantity, and unit price are required and must be positive", http.StatusBadRequest)
+	if item.ProductID == 0 || item.Quantity <= 0 {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Product ID and a positive quantity are required")
 		return
 	}
 	
@@ -325,29 +412,41 @@ func (h *PurchaseOrderHandler) AddPurchaseOrderItem(w http.ResponseWriter, r *ht
 	var product models.Product
 	if err := h.db.First(&product, item.ProductID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Product not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Product not found")
 		} else {
-			http.Error(w, "Failed to retrieve product: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve product: "+err.Error())
 		}
 		return
 	}
 	
-	// Set purchase order ID and calculate total price
-	item.PurchaseOrderID = uint(id)
-	item.TotalPrice = float64(item.Quantity) * item.UnitPrice
+	// An omitted unit price defaults to the supplier's unit cost for the product
+	issue, err := applySupplierPricing(h.db, &item, order.SupplierID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve supplier pricing: "+err.Error())
+		return
+	}
 	
-	// Create item in database
-	if err := h.db.Create(&item).Error; err != nil {
-		http.Error(w, "Failed to add item: "+err.Error(), http.StatusInternalServerError)
+	// Validate item
+	if item.UnitPrice <= 0 {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Unit price is required and must be positive when the supplier has no pricing for the product")
 		return
 	}
 	
-	// Update the purchase order's total amount
-	var totalAmount float64
-	h.db.Model(&models.PurchaseOrderItem{}).Where("purchase_order_id = ?", id).
-		Select("SUM(total_price)").Scan(&totalAmount)
+	if issue != nil && rejectUnacknowledgedWarnings(w, r, []confirmationIssue{*issue}) {
+		return
+	}
 	
-	h.db.Model(&order).Update("total_amount", totalAmount)
+	// Set purchase order ID; the line total is calculated by the item hooks
+	item.PurchaseOrderID = uint(id)
+	
+	// Create the item and recompute the order total in one transaction,
+	// so the order can never be left out of step with its items
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		return tx.Create(&item).Error
+	}); err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to add item: "+err.Error())
+		return
+	}
 	
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -359,144 +458,947 @@ func (h *PurchaseOrderHandler) ReceivePurchaseOrder(w http.ResponseWriter, r *ht
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid purchase order ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid purchase order ID")
 		return
 	}
 	
 	// Check if purchase order exists
 	var order models.PurchaseOrder
-	if err := h.db.Preload("Items").Preload("Items.Product").Preload("Warehouse").
-		First(&order, id).Error; err != nil {
+	if err := h.db.First(&order, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Purchase order not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Purchase order not found")
 		} else {
-			http.Error(w, "Failed to retrieve purchase order: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve purchase order: "+err.Error())
 		}
 		return
 	}
 	
-	// Only pending or partially received orders can be received
-	if order.Status != "pending" && order.Status != "partial" && order.Status != "approved" {
-		http.Error(w, "Only pending, approved, or partially received purchase orders can be received", http.StatusBadRequest)
+	// Only approved or partially received orders can be received
+	if order.Status != "approved" && order.Status != "partial" {
+		writeError(w, http.StatusBadRequest, errCodeInvalidState, "Only approved or partially received purchase orders can be received")
+		return
+	}
+	
+	// Orders on hold must be released before receiving
+	if order.OnHold {
+		writeError(w, http.StatusBadRequest, errCodeInvalidState, "Purchase order is on hold and cannot be received: "+order.HoldReason)
 		return
 	}
 	
 	// Parse request body
 	var request struct {
-		Items []struct {
-			ItemID           uint `json:"item_id"`
-			QuantityReceived int  `json:"quantity_received"`
-		} `json:"items"`
-		Notes string `json:"notes"`
+		Items []purchaseOrderReceiptItem `json:"items"`
+		Notes string                     `json:"notes"`
 	}
 	
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
 		return
 	}
 	
 	// Get user ID from context (set by auth middleware)
 	userID, ok := r.Context().Value("userID").(uint)
 	if !ok {
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
+		return
+	}
+	
+	// Lock the order so concurrent receipts are serialised, then re-check it against the
+	// locked row rather than the copy read above
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, id).Error; err != nil {
+			return err
+		}
+		
+		if order.Status != "approved" && order.Status != "partial" {
+			return errPurchaseOrderNotReceivable
+		}
+		
+		if order.OnHold {
+			return fmt.Errorf("%w: %s", errPurchaseOrderOnHold, order.HoldReason)
+		}
+		
+		_, err := receivePurchaseOrderLines(tx, &order, request.Items, userID, request.Notes)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errPurchaseOrderNotReceivable), errors.Is(err, errPurchaseOrderOnHold):
+			writeError(w, http.StatusBadRequest, errCodeInvalidState, err.Error())
+		case errors.Is(err, errReceiptItemNotFound):
+			writeError(w, http.StatusBadRequest, errCodeInvalidReference, err.Error())
+		case errors.Is(err, errInvalidReceipt):
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, err.Error())
+		default:
+			writeLocationStockError(w, err, "Failed to receive purchase order")
+		}
+		return
+	}
+	
+	// Return updated purchase order
+	var updatedOrder models.PurchaseOrder
+	if err := h.db.Preload("Items").Preload("Items.Product", includeDeleted).Preload("Supplier", includeDeleted).
+		Preload("Warehouse", includeDeleted).Preload("User", includeDeleted).Preload("Receiver", includeDeleted).First(&updatedOrder, id).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve updated purchase order: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updatedOrder)
+}
+
+var (
+	// errInvalidReceipt marks receipt failures caused by the request rather than the database
+	errInvalidReceipt = errors.New("invalid receipt")
+	// errReceiptItemNotFound is wrapped with errInvalidReceipt when a line isn't on the order
+	errReceiptItemNotFound = errors.New("item not found in purchase order")
+	
+	errPurchaseOrderNotReceivable = errors.New("Only approved or partially received purchase orders can be received")
+	errPurchaseOrderOnHold        = errors.New("Purchase order is on hold and cannot be received")
+)
+
+// purchaseOrderReceiptItem is one line of a receipt request
+type purchaseOrderReceiptItem struct {
+	ItemID           uint  `json:"item_id"`
+	QuantityReceived int   `json:"quantity_received"`
+	LocationID       *uint `json:"location_id"` // Required when the warehouse has locations
+}
+
+// purchaseOrderReceiptLine is one received line in a receipt summary
+type purchaseOrderReceiptLine struct {
+	ItemID              uint `json:"item_id"`
+	ProductID           uint `json:"product_id"`
+	QuantityReceived    int  `json:"quantity_received"`
+	QuantityOutstanding int  `json:"quantity_outstanding"`
+}
+
+// purchaseOrderReceipt summarises what a receipt did to one purchase order
+type purchaseOrderReceipt struct {
+	PurchaseOrderID uint                       `json:"purchase_order_id"`
+	PONumber        string                     `json:"po_number"`
+	Status          string                     `json:"status"`
+	TotalReceived   int                        `json:"total_received"`
+	Lines           []purchaseOrderReceiptLine `json:"lines"`
+}
+
+// BulkReceivePurchaseOrders handles POST requests to receive a consolidated delivery
+// covering several of a supplier's purchase orders. Every order must belong to the
+// supplier and be receivable; the whole delivery is applied in one transaction, so a
+// single bad line rejects it all.
+func (h *PurchaseOrderHandler) BulkReceivePurchaseOrders(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	supplierID, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid supplier ID")
+		return
+	}
+	
+	var supplier models.Supplier
+	if err := h.db.First(&supplier, supplierID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Supplier not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve supplier: "+err.Error())
+		}
+		return
+	}
+	
+	// Parse request body
+	var request struct {
+		Orders []struct {
+			PurchaseOrderID uint `json:"purchase_order_id"`
+			Items           []purchaseOrderReceiptItem `json:"items"`
+		} `json:"orders"`
+		Notes string `json:"notes"`
+	}
+	
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
 		return
 	}
 	
-	// Start a transaction for database operations
-	tx := h.db.Begin()
+	if len(request.Orders) == 0 {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "At least one purchase order is required")
+		return
+	}
 	
-	if tx.Error != nil {
-		http.Error(w, "Failed to start database transaction: "+tx.Error.Error(), http.StatusInternalServerError)
+	// Get user ID from context (set by auth middleware)
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
 		return
 	}
 	
-	// Process each item
-	totalReceived := 0
-	totalOrdered := 0
+	// Lock orders in ID order so concurrent receipts can't deadlock
+	sort.Slice(request.Orders, func(i, j int) bool {
+		return request.Orders[i].PurchaseOrderID < request.Orders[j].PurchaseOrderID
+	})
 	
-	for _, requestItem := range request.Items {
-		// Find the item in the purchase order
-		var item models.PurchaseOrderItem
-		found := false
+	receipts := make([]purchaseOrderReceipt, 0, len(request.Orders))
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		for i, requestOrder := range request.Orders {
+			if i > 0 && requestOrder.PurchaseOrderID == request.Orders[i-1].PurchaseOrderID {
+				return fmt.Errorf("%w: purchase order %d is listed more than once", errInvalidReceipt, requestOrder.PurchaseOrderID)
+			}
+			
+			var order models.PurchaseOrder
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, requestOrder.PurchaseOrderID).Error; err != nil {
+				if err == gorm.ErrRecordNotFound {
+					return fmt.Errorf("%w: purchase order %d not found", errInvalidReceipt, requestOrder.PurchaseOrderID)
+				}
+				return err
+			}
+			
+			if order.SupplierID != uint(supplierID) {
+				return fmt.Errorf("%w: purchase order %s does not belong to this supplier", errInvalidReceipt, order.PONumber)
+			}
+			
+			if order.Status != "approved" && order.Status != "partial" {
+				return fmt.Errorf("%w: purchase order %s is %s and cannot be received", errInvalidReceipt, order.PONumber, order.Status)
+			}
+			
+			if order.OnHold {
+				return fmt.Errorf("%w: purchase order %s is on hold: %s", errInvalidReceipt, order.PONumber, order.HoldReason)
+			}
+			
+			receipt, err := receivePurchaseOrderLines(tx, &order, requestOrder.Items, userID, request.Notes)
+			if err != nil {
+				return err
+			}
+			
+			receipts = append(receipts, *receipt)
+		}
 		
-		for _, orderItem := range order.Items {
-			if orderItem.ID == requestItem.ItemID {
-				item = orderItem
-				found = true
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidReceipt) {
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, err.Error())
+		} else {
+			writeLocationStockError(w, err, "Failed to receive purchase orders")
+		}
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"supplier_id": supplier.ID,
+		"receipts":    receipts,
+	})
+}
+
+// receivePurchaseOrderLines receives lines of a purchase order that the caller has locked
+// and found receivable, inside the caller's transaction. Each line adds to its received
+// quantity, the product's stock and its location's stock, and records a receive transaction;
+// the order's status follows. A line that isn't on the order, has a bad quantity or exceeds
+// what is outstanding fails the whole receipt with errInvalidReceipt, and location problems
+// come back as repository.ApplyLocationStock's errors.
+func receivePurchaseOrderLines(tx *gorm.DB, order *models.PurchaseOrder, items []purchaseOrderReceiptItem, userID uint, notes string) (*purchaseOrderReceipt, error) {
+	// Lock the items so concurrent receipts check against what is really outstanding
+	var lockedItems []models.PurchaseOrderItem
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("purchase_order_id = ?", order.ID).Order("id").Find(&lockedItems).Error; err != nil {
+		return nil, err
+	}
+	
+	transactionNotes := "Received from purchase order: " + order.PONumber
+	if notes != "" {
+		transactionNotes += " (" + notes + ")"
+	}
+	
+	receipt := &purchaseOrderReceipt{
+		PurchaseOrderID: order.ID,
+		PONumber:        order.PONumber,
+	}
+	
+	for _, requestItem := range items {
+		var item *models.PurchaseOrderItem
+		for i := range lockedItems {
+			if lockedItems[i].ID == requestItem.ItemID {
+				item = &lockedItems[i]
 				break
 			}
 		}
 		
-		if !found {
-			tx.Rollback()
-			http.Error(w, "Item not found in purchase order", http.StatusBadRequest)
-			return
+		if item == nil {
+			return nil, fmt.Errorf("%w: %w: item %d, purchase order %s", errInvalidReceipt, errReceiptItemNotFound, requestItem.ItemID, order.PONumber)
 		}
 		
-		if requestItem.QuantityReceived <= 0 || requestItem.QuantityReceived > item.Quantity {
-			tx.Rollback()
-			http.Error(w, "Invalid quantity received", http.StatusBadRequest)
-			return
+		// Never receive more than is still outstanding on the line, so repeating a receipt
+		// can't inflate stock
+		if requestItem.QuantityReceived <= 0 {
+			return nil, fmt.Errorf("%w: invalid quantity received for item %d in purchase order %s", errInvalidReceipt, item.ID, order.PONumber)
+		}
+		if outstanding := item.Quantity - item.QuantityReceived; requestItem.QuantityReceived > outstanding {
+			return nil, fmt.Errorf("%w: cannot receive %d of item %d in purchase order %s: only %d outstanding",
+				errInvalidReceipt, requestItem.QuantityReceived, item.ID, order.PONumber, outstanding)
 		}
 		
+		if err := tx.Model(item).
+			UpdateColumn("quantity_received", gorm.Expr("quantity_received + ?", requestItem.QuantityReceived)).Error; err != nil {
+			return nil, err
+		}
+		item.QuantityReceived += requestItem.QuantityReceived
+		
 		// Update product quantity
 		if err := tx.Model(&models.Product{}).Where("id = ?", item.ProductID).
 			UpdateColumn("quantity", gorm.Expr("quantity + ?", requestItem.QuantityReceived)).Error; err != nil {
-			tx.Rollback()
-			http.Error(w, "Failed to update product quantity: "+err.Error(), http.StatusInternalServerError)
-			return
+			return nil, err
 		}
 		
-		// Create inventory transaction
-		transaction := models.InventoryTransaction{
-			ProductID:         item.ProductID,
-			WarehouseID:       order.WarehouseID,
-			Type:              "receive",
-			Quantity:          requestItem.QuantityReceived,
-			ReferenceNumber:   order.PONumber,
-			UserID:            userID,
-			Notes:             "Received from purchase order: " + order.PONumber,
+		if err := models.ResolveRestockedAlerts(tx, item.ProductID); err != nil {
+			return nil, err
 		}
 		
+		// The line's price is the receipt's cost, even when it is zero for free goods
+		unitCost := item.UnitPrice
+		transaction := models.InventoryTransaction{
+			ProductID:             item.ProductID,
+			WarehouseID:           order.WarehouseID,
+			DestinationLocationID: requestItem.LocationID,
+			Type:                  "receive",
+			Quantity:              requestItem.QuantityReceived,
+			UnitCost:              &unitCost,
+			ReferenceNumber:       order.PONumber,
+			UserID:                userID,
+			Notes:                 transactionNotes,
+		}
 		if err := tx.Create(&transaction).Error; err != nil {
-			tx.Rollback()
-			http.Error(w, "Failed to create inventory transaction: "+err.Error(), http.StatusInternalServerError)
-			return
+			return nil, err
+		}
+		if err := repository.ApplyLocationStock(tx, &transaction); err != nil {
+			return nil, fmt.Errorf("item %d in purchase order %s: %w", item.ID, order.PONumber, err)
+		}
+		
+		receipt.TotalReceived += requestItem.QuantityReceived
+		receipt.Lines = append(receipt.Lines, purchaseOrderReceiptLine{
+			ItemID:              item.ID,
+			ProductID:           item.ProductID,
+			QuantityReceived:    requestItem.QuantityReceived,
+			QuantityOutstanding: item.Quantity - item.QuantityReceived,
+		})
+	}
+	
+	if receipt.TotalReceived == 0 {
+		return nil, fmt.Errorf("%w: no items received for purchase order %s", errInvalidReceipt, order.PONumber)
+	}
+	
+	// Update purchase order status and, on the first receipt, when and by whom it arrived
+	if err := order.RecordReceipt(tx, lockedItems, userID); err != nil {
+		return nil, err
+	}
+	receipt.Status = order.Status
+	
+	return receipt, nil
+}
+
+// DuplicatePurchaseOrder handles POST requests to create a new draft purchase order from an existing one
+func (h *PurchaseOrderHandler) DuplicatePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid purchase order ID")
+		return
+	}
+	
+	// Load the source order with its line items
+	var source models.PurchaseOrder
+	if err := h.db.Preload("Items").First(&source, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Purchase order not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve purchase order: "+err.Error())
+		}
+		return
+	}
+	
+	// Get user ID from context (set by auth middleware)
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
+		return
+	}
+	
+	// Copy the header; the PO number is left empty so a fresh one is generated
+	order := models.PurchaseOrder{
+		SupplierID:    source.SupplierID,
+		WarehouseID:   source.WarehouseID,
+		OrderDate:     time.Now(),
+		Status:        "draft",
+		PaymentTerms:  source.PaymentTerms,
+		ShippingTerms: source.ShippingTerms,
+		UserID:        userID,
+	}
+	
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&order).Error; err != nil {
+			return err
+		}
+		
+		// Copy line items; the item hooks keep the order total in sync
+		for _, sourceItem := range source.Items {
+			item := models.PurchaseOrderItem{
+				PurchaseOrderID: order.ID,
+				ProductID:       sourceItem.ProductID,
+				Quantity:        sourceItem.Quantity,
+				UnitPrice:       sourceItem.UnitPrice,
+			}
+			if err := tx.Create(&item).Error; err != nil {
+				return err
+			}
 		}
 		
-		totalReceived += requestItem.QuantityReceived
-		totalOrdered += item.Quantity
+		return nil
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to duplicate purchase order: "+err.Error())
+		return
+	}
+	
+	// Return the new purchase order with relationships
+	var newOrder models.PurchaseOrder
+	if err := h.db.Preload("Items").Preload("Items.Product", includeDeleted).Preload("Supplier", includeDeleted).
+		Preload("Warehouse", includeDeleted).Preload("User", includeDeleted).First(&newOrder, order.ID).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve new purchase order: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newOrder)
+}
+
+// errInvalidSplit marks split failures caused by the request rather than the database
+var errInvalidSplit = errors.New("invalid split")
+
+// SplitPurchaseOrder handles POST requests to move some of a purchase order's outstanding
+// quantities onto a new draft order, for example when part of it ships to another warehouse
+// or later. Lines moved in full are removed from the original; received quantities can't be
+// moved. Both orders' totals are recomputed by the item hooks.
+func (h *PurchaseOrderHandler) SplitPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid purchase order ID")
+		return
+	}
+	
+	var request struct {
+		Items []struct {
+			ItemID   uint `json:"item_id"`
+			Quantity int  `json:"quantity"`
+		} `json:"items"`
+		WarehouseID  uint       `json:"warehouse_id"`  // Defaults to the original order's warehouse
+		ExpectedDate *time.Time `json:"expected_date"` // Defaults to each line's expected date
+	}
+	
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
 	}
 	
-	// Update purchase order status
-	if totalReceived == totalOrdered {
-		if err := tx.Model(&order).Update("status", "received").Error; err != nil {
-			tx.Rollback()
-			http.Error(w, "Failed to update purchase order status: "+err.Error(), http.StatusInternalServerError)
+	if len(request.Items) == 0 {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "At least one item to move is required")
+		return
+	}
+	
+	if request.WarehouseID != 0 &&
+		!requireActiveReference(w, h.db, &models.Warehouse{}, request.WarehouseID, "warehouse_id", "warehouse") {
+		return
+	}
+	
+	// Get user ID from context (set by auth middleware)
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
+		return
+	}
+	
+	var newOrder models.PurchaseOrder
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		var order models.PurchaseOrder
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, id).Error; err != nil {
+			return err
+		}
+		
+		if order.Status == "received" || order.Status == "cancelled" {
+			return fmt.Errorf("%w: %s purchase orders cannot be split", errInvalidSplit, order.Status)
+		}
+		
+		var items []models.PurchaseOrderItem
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("purchase_order_id = ?", order.ID).Order("id").Find(&items).Error; err != nil {
+			return err
+		}
+		
+		itemsByID := make(map[uint]*models.PurchaseOrderItem, len(items))
+		for i := range items {
+			itemsByID[items[i].ID] = &items[i]
+		}
+		
+		moved := make(map[uint]bool)
+		movedAll := true
+		for _, requestItem := range request.Items {
+			item, ok := itemsByID[requestItem.ItemID]
+			if !ok {
+				return fmt.Errorf("%w: item %d is not on this purchase order", errInvalidSplit, requestItem.ItemID)
+			}
+			if moved[item.ID] {
+				return fmt.Errorf("%w: item %d is listed more than once", errInvalidSplit, item.ID)
+			}
+			moved[item.ID] = true
+			
+			outstanding := item.Quantity - item.QuantityReceived
+			if requestItem.Quantity <= 0 || requestItem.Quantity > outstanding {
+				return fmt.Errorf("%w: item %d can move between 1 and %d units", errInvalidSplit, item.ID, outstanding)
+			}
+			if requestItem.Quantity < item.Quantity {
+				movedAll = false
+			}
+		}
+		if movedAll && len(moved) == len(items) {
+			return fmt.Errorf("%w: a split must leave something on the original order", errInvalidSplit)
+		}
+		
+		// The new order is a draft, so it goes through approval on its own
+		newOrder = models.PurchaseOrder{
+			SupplierID:    order.SupplierID,
+			WarehouseID:   order.WarehouseID,
+			OrderDate:     time.Now(),
+			Status:        "draft",
+			PaymentTerms:  order.PaymentTerms,
+			ShippingTerms: order.ShippingTerms,
+			UserID:        userID,
+		}
+		if request.WarehouseID != 0 {
+			newOrder.WarehouseID = request.WarehouseID
+		}
+		if err := tx.Create(&newOrder).Error; err != nil {
+			return err
+		}
+		
+		for _, requestItem := range request.Items {
+			item := itemsByID[requestItem.ItemID]
+			
+			newItem := models.PurchaseOrderItem{
+				PurchaseOrderID: newOrder.ID,
+				ProductID:       item.ProductID,
+				Quantity:        requestItem.Quantity,
+				UnitPrice:       item.UnitPrice,
+				ExpectedDate:    item.ExpectedDate,
+			}
+			if request.ExpectedDate != nil {
+				newItem.ExpectedDate = *request.ExpectedDate
+			}
+			if err := tx.Create(&newItem).Error; err != nil {
+				return err
+			}
+			
+			// Lines moved in full leave the original order; the hooks recompute its total either way
+			item.Quantity -= requestItem.Quantity
+			if item.Quantity == 0 {
+				if err := tx.Delete(item).Error; err != nil {
+					return err
+				}
+			} else if err := tx.Save(item).Error; err != nil {
+				return err
+			}
+		}
+		
+		// Moving a partial order's outstanding remainder leaves it fully received
+		if order.Status == "partial" {
+			var outstanding int64
+			if err := tx.Model(&models.PurchaseOrderItem{}).
+				Where("purchase_order_id = ? AND quantity_received < quantity", order.ID).
+				Count(&outstanding).Error; err != nil {
+				return err
+			}
+			if outstanding == 0 {
+				if err := tx.Model(&order).Update("status", "received").Error; err != nil {
+					return err
+				}
+			}
+		}
+		
+		newValues, _ := json.Marshal(map[string]interface{}{"split_into": newOrder.ID, "items": request.Items})
+		return models.CreateAuditLog(tx, userID, "split", "purchase_order", order.ID, "", string(newValues), clientIP(r))
+	})
+	if err != nil {
+		switch {
+		case err == gorm.ErrRecordNotFound:
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Purchase order not found")
+		case errors.Is(err, errInvalidSplit):
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to split purchase order: "+err.Error())
+		}
+		return
+	}
+	
+	// Return both orders with relationships
+	var original, split models.PurchaseOrder
+	if err := h.db.Preload("Items").Preload("Items.Product", includeDeleted).Preload("Supplier", includeDeleted).
+		Preload("Warehouse", includeDeleted).Preload("User", includeDeleted).First(&original, id).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve purchase order: "+err.Error())
+		return
+	}
+	if err := h.db.Preload("Items").Preload("Items.Product", includeDeleted).Preload("Supplier", includeDeleted).
+		Preload("Warehouse", includeDeleted).Preload("User", includeDeleted).First(&split, newOrder.ID).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve new purchase order: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"original_order": original,
+		"new_order":      split,
+	})
+}
+
+// HoldPurchaseOrder handles POST requests to put a purchase order on hold
+func (h *PurchaseOrderHandler) HoldPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	h.setPurchaseOrderHold(w, r, true)
+}
+
+// UnholdPurchaseOrder handles POST requests to release a purchase order from hold
+func (h *PurchaseOrderHandler) UnholdPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	h.setPurchaseOrderHold(w, r, false)
+}
+
+// setPurchaseOrderHold places or releases a hold without changing the order's status
+func (h *PurchaseOrderHandler) setPurchaseOrderHold(w http.ResponseWriter, r *http.Request, hold bool) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid purchase order ID")
+		return
+	}
+	
+	// Get user ID from context (set by auth middleware)
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
+		return
+	}
+	
+	// Check if purchase order exists
+	var order models.PurchaseOrder
+	if err := h.db.First(&order, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Purchase order not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve purchase order: "+err.Error())
+		}
+		return
+	}
+	
+	var request struct {
+		Reason string `json:"reason"`
+	}
+	
+	if hold {
+		// Closed orders have nothing left to hold
+		if order.Status == "received" || order.Status == "cancelled" {
+			writeError(w, http.StatusBadRequest, errCodeInvalidState, "Received or cancelled purchase orders cannot be put on hold")
+			return
+		}
+		
+		if order.OnHold {
+			writeError(w, http.StatusBadRequest, errCodeInvalidState, "Purchase order is already on hold")
 			return
 		}
-	} else {
-		if err := tx.Model(&order).Update("status", "partial").Error; err != nil {
-			tx.Rollback()
-			http.Error(w, "Failed to update purchase order status: "+err.Error(), http.StatusInternalServerError)
+		
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
 			return
 		}
+		
+		if request.Reason == "" {
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Hold reason is required")
+			return
+		}
+	} else if !order.OnHold {
+		writeError(w, http.StatusBadRequest, errCodeInvalidState, "Purchase order is not on hold")
+		return
 	}
 	
-	// Commit the transaction
-	if err := tx.Commit().Error; err != nil {
-		http.Error(w, "Failed to commit transaction: "+err.Error(), http.StatusInternalServerError)
+	action := "hold"
+	if !hold {
+		action = "unhold"
+	}
+	oldValues, _ := json.Marshal(map[string]interface{}{"on_hold": order.OnHold, "hold_reason": order.HoldReason})
+	newValues, _ := json.Marshal(map[string]interface{}{"on_hold": hold, "hold_reason": request.Reason})
+	
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&order).Updates(map[string]interface{}{
+			"on_hold":     hold,
+			"hold_reason": request.Reason,
+		}).Error; err != nil {
+			return err
+		}
+		
+		return models.CreateAuditLog(tx, userID, action, "purchase_order", order.ID, string(oldValues), string(newValues), clientIP(r))
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update purchase order hold: "+err.Error())
 		return
 	}
 	
 	// Return updated purchase order
 	var updatedOrder models.PurchaseOrder
-	if err := h.db.Preload("Items").Preload("Items.Product").Preload("Supplier").
-		Preload("Warehouse").Preload("User").First(&updatedOrder, id).Error; err != nil {
-		http.Error(w, "Failed to retrieve updated purchase order: "+err.Error(), http.StatusInternalServerError)
+	if err := h.db.Preload("Items").Preload("Items.Product", includeDeleted).Preload("Supplier", includeDeleted).
+		Preload("Warehouse", includeDeleted).Preload("User", includeDeleted).First(&updatedOrder, id).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve updated purchase order: "+err.Error())
 		return
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(updatedOrder)
+}
+
+// errInvalidTransition marks a status change the purchase order's current status doesn't allow
+var errInvalidTransition = errors.New("invalid status change")
+
+// SubmitPurchaseOrder handles POST requests to send a draft purchase order for approval
+func (h *PurchaseOrderHandler) SubmitPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	h.transitionPurchaseOrder(w, r, "submit", "draft", "pending_approval")
+}
+
+// ApprovePurchaseOrder handles POST requests to approve a purchase order awaiting approval,
+// recording who approved it and when. Only approved orders can be received.
+func (h *PurchaseOrderHandler) ApprovePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	h.transitionPurchaseOrder(w, r, "approve", "pending_approval", "approved")
+}
+
+// transitionPurchaseOrder moves a purchase order from one approval status to the next,
+// locking the order so two requests can't both make the same change
+func (h *PurchaseOrderHandler) transitionPurchaseOrder(w http.ResponseWriter, r *http.Request, action, from, to string) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid purchase order ID")
+		return
+	}
+	
+	// Get user ID from context (set by auth middleware)
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
+		return
+	}
+	
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		var order models.PurchaseOrder
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, id).Error; err != nil {
+			return err
+		}
+		
+		if order.Status != from {
+			return fmt.Errorf("%w: cannot %s a purchase order that is %s (it must be %s)", errInvalidTransition, action, order.Status, from)
+		}
+		
+		updates := map[string]interface{}{"status": to}
+		
+		switch action {
+		case "submit":
+			var items int64
+			if err := tx.Model(&models.PurchaseOrderItem{}).Where("purchase_order_id = ?", order.ID).Count(&items).Error; err != nil {
+				return err
+			}
+			if items == 0 {
+				return fmt.Errorf("%w: a purchase order needs at least one item before it is submitted", errInvalidTransition)
+			}
+		case "approve":
+			updates["approved_by"] = userID
+			updates["approved_at"] = time.Now()
+		}
+		
+		oldValues, _ := json.Marshal(map[string]interface{}{"status": order.Status})
+		newValues, _ := json.Marshal(updates)
+		
+		if err := tx.Model(&order).Updates(updates).Error; err != nil {
+			return err
+		}
+		
+		return models.CreateAuditLog(tx, userID, action, "purchase_order", order.ID, string(oldValues), string(newValues), clientIP(r))
+	})
+	if err != nil {
+		switch {
+		case err == gorm.ErrRecordNotFound:
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Purchase order not found")
+		case errors.Is(err, errInvalidTransition):
+			writeError(w, http.StatusBadRequest, errCodeInvalidState, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update purchase order: "+err.Error())
+		}
+		return
+	}
+	
+	// Return updated purchase order
+	var updatedOrder models.PurchaseOrder
+	if err := h.db.Preload("Items").Preload("Items.Product", includeDeleted).Preload("Supplier", includeDeleted).
+		Preload("Warehouse", includeDeleted).Preload("User", includeDeleted).Preload("Approver", includeDeleted).First(&updatedOrder, id).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve updated purchase order: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updatedOrder)
+}
+
+// DeletePurchaseOrderItem handles DELETE requests to remove an item from a draft purchase order
+func (h *PurchaseOrderHandler) DeletePurchaseOrderItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid purchase order ID")
+		return
+	}
+	
+	itemID, err := strconv.ParseUint(vars["itemId"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid item ID")
+		return
+	}
+	
+	// Check if purchase order exists
+	var order models.PurchaseOrder
+	if err := h.db.First(&order, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Purchase order not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve purchase order: "+err.Error())
+		}
+		return
+	}
+	
+	// Only draft orders can be modified
+	if order.Status != "draft" {
+		writeError(w, http.StatusBadRequest, errCodeInvalidState, "Only draft purchase orders can be modified")
+		return
+	}
+	
+	// The item must belong to this order
+	var item models.PurchaseOrderItem
+	if err := h.db.Where("id = ? AND purchase_order_id = ?", itemID, id).First(&item).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Item not found in purchase order")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve item: "+err.Error())
+		}
+		return
+	}
+	
+	// Deleting the loaded item lets the hooks recompute the order totals in the same transaction
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		return tx.Delete(&item).Error
+	}); err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to delete item: "+err.Error())
+		return
+	}
+	
+	if err := h.db.First(&order, id).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve updated purchase order: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(purchaseOrderTotals(order))
+}
+
+// purchaseOrderTotals returns the money fields of a purchase order for endpoints that change them
+func purchaseOrderTotals(order models.PurchaseOrder) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            order.ID,
+		"po_number":     order.PONumber,
+		"total_amount":  order.TotalAmount,
+		"expected_date": order.ExpectedDate,
+	}
+}
+
+// UpdatePurchaseOrderItem handles PUT requests to change an item on a draft purchase order
+func (h *PurchaseOrderHandler) UpdatePurchaseOrderItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid purchase order ID")
+		return
+	}
+	
+	itemID, err := strconv.ParseUint(vars["itemId"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid item ID")
+		return
+	}
+	
+	// Check if purchase order exists
+	var order models.PurchaseOrder
+	if err := h.db.First(&order, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Purchase order not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve purchase order: "+err.Error())
+		}
+		return
+	}
+	
+	// Only draft orders can be modified
+	if order.Status != "draft" {
+		writeError(w, http.StatusBadRequest, errCodeInvalidState, "Only draft purchase orders can be modified")
+		return
+	}
+	
+	// The item must belong to this order
+	var item models.PurchaseOrderItem
+	if err := h.db.Where("id = ? AND purchase_order_id = ?", itemID, id).First(&item).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Item not found in purchase order")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve item: "+err.Error())
+		}
+		return
+	}
+	
+	// Parse request body; omitted fields keep their current values
+	var request struct {
+		Quantity  *int     `json:"quantity"`
+		UnitPrice *float64 `json:"unit_price"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	
+	if request.Quantity != nil {
+		item.Quantity = *request.Quantity
+	}
+	if request.UnitPrice != nil {
+		item.UnitPrice = *request.UnitPrice
+	}
+	
+	// Validate item
+	if item.Quantity <= 0 || item.UnitPrice <= 0 {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Quantity and unit price must be positive")
+		return
+	}
+	
+	// Saving recalculates the line total and, through the hooks, the order totals in one transaction
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		return tx.Save(&item).Error
+	}); err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update item: "+err.Error())
+		return
+	}
+	
+	if err := h.db.First(&order, id).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve updated purchase order: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"item":  item,
+		"order": purchaseOrderTotals(order),
+	})
 }
\ No newline at end of file
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/yourusername/inventory-management-system/internal/models"
+	"github.com/yourusername/inventory-management-system/internal/testutil"
+	"gorm.io/gorm"
+)
+
+// receive posts a receipt of quantity units of a purchase order's item to ReceivePurchaseOrder
+func receive(h *PurchaseOrderHandler, order models.PurchaseOrder, locationID, userID uint, quantity int) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]interface{}{
+		"items": []purchaseOrderReceiptItem{{
+			ItemID:           order.Items[0].ID,
+			QuantityReceived: quantity,
+			LocationID:       &locationID,
+		}},
+	})
+	r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/purchase-orders/%d/receive", order.ID), bytes.NewReader(body))
+	r = mux.SetURLVars(r, map[string]string{"id": fmt.Sprint(order.ID)})
+	r = r.WithContext(context.WithValue(r.Context(), "userID", userID))
+
+	w := httptest.NewRecorder()
+	h.ReceivePurchaseOrder(w, r)
+	return w
+}
+
+// receivedState reads back an order's received quantity, its status and the product's stock
+func receivedState(t *testing.T, db *gorm.DB, order models.PurchaseOrder) (received int, status string, stock int) {
+	t.Helper()
+	var item models.PurchaseOrderItem
+	if err := db.First(&item, order.Items[0].ID).Error; err != nil {
+		t.Fatalf("reading purchase order item: %v", err)
+	}
+	var current models.PurchaseOrder
+	if err := db.First(&current, order.ID).Error; err != nil {
+		t.Fatalf("reading purchase order: %v", err)
+	}
+	var product models.Product
+	if err := db.First(&product, item.ProductID).Error; err != nil {
+		t.Fatalf("reading product: %v", err)
+	}
+	return item.QuantityReceived, current.Status, product.Quantity
+}
+
+func TestReceivePurchaseOrderConcurrentReceiptsNeverOverReceive(t *testing.T) {
+	// Concurrent receipts need their own connections, so the data is committed
+	db := testutil.DB(t)
+	user := testutil.CreateUser(t, db, "staff")
+	product := testutil.CreateProduct(t, db, 0)
+	warehouse := testutil.CreateWarehouse(t, db)
+	location := testutil.CreateLocation(t, db, warehouse.ID)
+	supplier := testutil.CreateSupplier(t, db)
+	order := testutil.CreatePurchaseOrder(t, db, supplier.ID, warehouse.ID, user.ID, product.ID, 10)
+	h := NewPurchaseOrderHandler(db)
+
+	// Eight receipts of 4 race for 10 ordered units; only two can fit
+	const receipts = 8
+	statuses := make(chan int, receipts)
+	var wg sync.WaitGroup
+	for i := 0; i < receipts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses <- receive(h, order, location.ID, user.ID, 4).Code
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	accepted := 0
+	for status := range statuses {
+		switch status {
+		case http.StatusOK:
+			accepted++
+		case http.StatusBadRequest:
+		default:
+			t.Errorf("receipt returned status %d, want 200 or 400", status)
+		}
+	}
+
+	received, status, stock := receivedState(t, db, order)
+	if received > 10 {
+		t.Fatalf("received %d of 10 ordered", received)
+	}
+	if accepted != 2 || received != 8 {
+		t.Errorf("accepted %d receipts totalling %d, want 2 totalling 8", accepted, received)
+	}
+	if stock != received {
+		t.Errorf("product stock = %d, want the %d received", stock, received)
+	}
+	if status != "partial" {
+		t.Errorf("status = %q, want partial", status)
+	}
+}
+
+func TestReceivePurchaseOrderRejectsRepeatedReceipt(t *testing.T) {
+	db := testutil.Tx(t)
+	user := testutil.CreateUser(t, db, "staff")
+	product := testutil.CreateProduct(t, db, 0)
+	warehouse := testutil.CreateWarehouse(t, db)
+	location := testutil.CreateLocation(t, db, warehouse.ID)
+	supplier := testutil.CreateSupplier(t, db)
+	order := testutil.CreatePurchaseOrder(t, db, supplier.ID, warehouse.ID, user.ID, product.ID, 10)
+	h := NewPurchaseOrderHandler(db)
+
+	if w := receive(h, order, location.ID, user.ID, 6); w.Code != http.StatusOK {
+		t.Fatalf("first receipt: status %d: %s", w.Code, w.Body)
+	}
+
+	// Sending the same receipt again must not add the stock a second time
+	w := receive(h, order, location.ID, user.ID, 6)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("repeated receipt: status %d, want 400", w.Code)
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte("only 4 outstanding")) {
+		t.Errorf("repeated receipt error %q doesn't report the outstanding quantity", w.Body)
+	}
+
+	received, status, stock := receivedState(t, db, order)
+	if received != 6 || stock != 6 {
+		t.Errorf("received %d and stock %d after a repeated receipt, want 6 and 6", received, stock)
+	}
+	if status != "partial" {
+		t.Errorf("status = %q, want partial", status)
+	}
+}
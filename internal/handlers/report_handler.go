@@ -1,14 +1,29 @@
 package handlers
 
 import (
+	"database/sql"
+	"encoding/csv"
 	"encoding/json"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/yourusername/inventory-management-system/internal/models"
 	"gorm.io/gorm"
 )
 
+// signedQuantitySQL is a transaction's effect on stock on hand: receipts add, issues
+// subtract, adjustments carry their own sign and transfers leave the total unchanged
+const signedQuantitySQL = `CASE 
+	WHEN inventory_transactions.type = 'receive' THEN inventory_transactions.quantity 
+	WHEN inventory_transactions.type = 'issue' THEN -inventory_transactions.quantity 
+	WHEN inventory_transactions.type = 'adjustment' THEN inventory_transactions.quantity 
+	ELSE 0 END`
+
 // ReportHandler handles HTTP requests for generating reports
 type ReportHandler struct {
 	db *gorm.DB
@@ -19,50 +34,118 @@ func NewReportHandler(db *gorm.DB) *ReportHandler {
 	return &ReportHandler{db: db}
 }
 
-// GetInventoryValueReport generates a report of current inventory value
-func (h *ReportHandler) GetInventoryValueReport(w http.ResponseWriter, r *http.Request) {
-	type ProductValue struct {
-		ID          uint    `json:"id"`
-		SKU         string  `json:"sku"`
-		Name        string  `json:"name"`
-		Category    string  `json:"category"`
-		Quantity    int     `json:"quantity"`
-		CostPrice   float64 `json:"cost_price"`
-		TotalValue  float64 `json:"total_value"`
-		LastUpdated time.Time `json:"last_updated"`
-	}
+// productCategoriesColumn lists a product's categories by name, comma separated, for reports;
+// categories are linked through product_category rather than held on the product
+const productCategoriesColumn = `COALESCE((
+	SELECT string_agg(categories.name, ', ' ORDER BY categories.name) FROM product_category
+	JOIN categories ON product_category.category_id = categories.id AND categories.deleted_at IS NULL
+	WHERE product_category.product_id = products.id
+), '')`
 
-	var products []ProductValue
-	
-	// Get filter parameters
-	category := r.URL.Query().Get("category")
-	warehouseID := r.URL.Query().Get("warehouse_id")
+// whereProductInCategory limits a products query to those in the named category, matching
+// the product list's category filter
+func whereProductInCategory(query *gorm.DB, category string) *gorm.DB {
+	return query.Where(`EXISTS (
+		SELECT 1 FROM product_category
+		JOIN categories ON product_category.category_id = categories.id AND categories.deleted_at IS NULL
+		WHERE product_category.product_id = products.id AND categories.name = ?
+	)`, category)
+}
+
+// inventoryValueItem is one product's stock valued at cost
+type inventoryValueItem struct {
+	ID          uint      `json:"id"`
+	SKU         string    `json:"sku"`
+	Name        string    `json:"name"`
+	Category    string    `json:"category"`
+	Quantity    int       `json:"quantity"`
+	CostPrice   float64   `json:"cost_price"`
+	TotalValue  float64   `json:"total_value"`
+	LastUpdated time.Time `json:"last_updated"`
+}
 
+// inventoryValueQuery selects active products' stock valued at cost. With a warehouse ID only
+// the stock held in that warehouse is valued; otherwise each product's total quantity is.
+func inventoryValueQuery(db *gorm.DB, category, warehouseID string) *gorm.DB {
+	quantityColumn := "products.quantity"
+	if warehouseID != "" {
+		quantityColumn = "warehouse_stock.quantity"
+	}
+	
 	// Build query
-	query := h.db.Table("products").
-		Select("products.id, products.sku, products.name, products.category, products.quantity, products.cost_price, (products.quantity * products.cost_price) as total_value, products.updated_at as last_updated").
-		Where("products.status = ?", "active")
+	query := db.Table("products").
+		Select("products.id, products.sku, products.name, "+productCategoriesColumn+" as category, "+quantityColumn+" as quantity, products.cost_price, ("+quantityColumn+" * products.cost_price) as total_value, products.updated_at as last_updated").
+		Where("products.status = ? AND products.deleted_at IS NULL", "active")
 		
 	// Apply filters
 	if category != "" {
-		query = query.Where("products.category = ?", category)
+		query = whereProductInCategory(query, category)
 	}
 	
 	if warehouseID != "" {
-		query = query.Joins("JOIN product_warehouse ON products.id = product_warehouse.product_id").
-			Where("product_warehouse.warehouse_id = ?", warehouseID)
+		query = query.Joins(`JOIN (
+			SELECT product_id, SUM(quantity) as quantity FROM product_warehouses
+			WHERE warehouse_id = ? GROUP BY product_id
+		) warehouse_stock ON products.id = warehouse_stock.product_id`, warehouseID)
 	}
 	
+	return query
+}
+
+// queryInventoryValue values active products' stock at cost and totals it
+func queryInventoryValue(db *gorm.DB, category, warehouseID string) ([]inventoryValueItem, float64, error) {
+	var products []inventoryValueItem
+	
 	// Execute query
-	if err := query.Find(&products).Error; err != nil {
-		http.Error(w, "Failed to generate inventory value report: "+err.Error(), http.StatusInternalServerError)
-		return
+	if err := inventoryValueQuery(db, category, warehouseID).Find(&products).Error; err != nil {
+		return nil, 0, err
 	}
 	
 	// Calculate total inventory value
 	var totalValue float64
-	for _, p := range products {
-		totalValue += p.TotalValue
+	for i := range products {
+		products[i].TotalValue = models.RoundCurrency(products[i].TotalValue)
+		totalValue += products[i].TotalValue
+	}
+	
+	return products, models.RoundCurrency(totalValue), nil
+}
+
+// GetInventoryValueReport generates a report of current inventory value.
+// The report is streamed as CSV when the client asks for it.
+func (h *ReportHandler) GetInventoryValueReport(w http.ResponseWriter, r *http.Request) {
+	if wantsCSV(r) {
+		rows, err := inventoryValueQuery(h.db, r.URL.Query().Get("category"), r.URL.Query().Get("warehouse_id")).Rows()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to generate inventory value report: "+err.Error())
+			return
+		}
+		defer rows.Close()
+		
+		header := []string{"id", "sku", "name", "category", "quantity", "cost_price", "total_value", "last_updated"}
+		streamCSVReport(w, "inventory-value.csv", header, rows, func(rows *sql.Rows) ([]string, error) {
+			var item inventoryValueItem
+			if err := h.db.ScanRows(rows, &item); err != nil {
+				return nil, err
+			}
+			return []string{
+				strconv.FormatUint(uint64(item.ID), 10),
+				item.SKU,
+				item.Name,
+				item.Category,
+				strconv.Itoa(item.Quantity),
+				formatMoney(item.CostPrice),
+				formatMoney(item.TotalValue),
+				item.LastUpdated.Format(time.RFC3339),
+			}, nil
+		})
+		return
+	}
+	
+	products, totalValue, err := queryInventoryValue(h.db, r.URL.Query().Get("category"), r.URL.Query().Get("warehouse_id"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to generate inventory value report: "+err.Error())
+		return
 	}
 	
 	// Prepare report response
@@ -77,6 +160,249 @@ func (h *ReportHandler) GetInventoryValueReport(w http.ResponseWriter, r *http.R
 	json.NewEncoder(w).Encode(report)
 }
 
+// GetInventoryValueTrend reports total inventory value at each interval boundary over a period.
+// Values are reconstructed backwards from the current stock value by undoing the
+// value of later movements, so the transaction history is read only once.
+func (h *ReportHandler) GetInventoryValueTrend(w http.ResponseWriter, r *http.Request) {
+	endDate := time.Now()
+	startDate := endDate.AddDate(0, -3, 0) // Default to the last three months
+	
+	if startStr := r.URL.Query().Get("start"); startStr != "" {
+		parsedDate, err := parseDateParam(startStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid start date")
+			return
+		}
+		startDate = parsedDate
+	}
+	
+	if endStr := r.URL.Query().Get("end"); endStr != "" {
+		parsedDate, err := parseDateParam(endStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid end date")
+			return
+		}
+		endDate = parsedDate
+	}
+	
+	if endDate.Before(startDate) {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "End date must not be before start date")
+		return
+	}
+	
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "week"
+	}
+	
+	var next func(time.Time) time.Time
+	switch interval {
+	case "day":
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	case "week":
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+	case "month":
+		next = func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+	default:
+		writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid interval: must be day, week, or month")
+		return
+	}
+	
+	var boundaries []time.Time
+	for t := startDate; !t.After(endDate); t = next(t) {
+		boundaries = append(boundaries, t)
+	}
+	
+	// Current value of all active stock
+	var currentValue float64
+	if err := h.db.Table("products").
+		Select("COALESCE(SUM(products.quantity * products.cost_price), 0)").
+		Where("products.status = ? AND products.deleted_at IS NULL", "active").
+		Scan(&currentValue).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to generate inventory value trend: "+err.Error())
+		return
+	}
+	
+	// Value change of all movements since the start date, newest first
+	type valueChange struct {
+		CreatedAt time.Time
+		Change    float64
+	}
+	
+	var changes []valueChange
+	if err := h.db.Table("inventory_transactions").
+		Select(`
+			inventory_transactions.created_at,
+			(`+signedQuantitySQL+`) * products.cost_price as change
+		`).
+		Joins("JOIN products ON products.id = inventory_transactions.product_id").
+		Where("products.status = ? AND products.deleted_at IS NULL AND inventory_transactions.created_at >= ?", "active", startDate).
+		Order("inventory_transactions.created_at DESC").
+		Scan(&changes).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to generate inventory value trend: "+err.Error())
+		return
+	}
+	
+	type TrendPoint struct {
+		Date  string  `json:"date"`
+		Value float64 `json:"value"`
+	}
+	
+	// Walk the boundaries backwards, undoing every movement made at or after each one
+	points := make([]TrendPoint, len(boundaries))
+	value := currentValue
+	i := 0
+	for b := len(boundaries) - 1; b >= 0; b-- {
+		for i < len(changes) && !changes[i].CreatedAt.Before(boundaries[b]) {
+			value -= changes[i].Change
+			i++
+		}
+		points[b] = TrendPoint{Date: boundaries[b].Format("2006-01-02"), Value: value}
+	}
+	
+	report := map[string]interface{}{
+		"generated_at": time.Now(),
+		"start_date":   startDate.Format("2006-01-02"),
+		"end_date":     endDate.Format("2006-01-02"),
+		"interval":     interval,
+		"points":       points,
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// agingBuckets are the inventory aging ranges, in days since stock was last received
+var agingBuckets = []struct {
+	Label   string
+	MaxDays int
+}{
+	{"0-30", 30},
+	{"31-60", 60},
+	{"61-90", 90},
+	{"90+", math.MaxInt32},
+}
+
+// GetInventoryAgingReport buckets on-hand stock by how long ago it was last received, valued
+// at cost. Without a warehouse each active product's total quantity is aged by its latest
+// receipt anywhere; with warehouse_id each stock row in that warehouse is aged by the latest
+// receipt into its location. Stock with no receipt on record goes in an "unknown" bucket.
+func (h *ReportHandler) GetInventoryAgingReport(w http.ResponseWriter, r *http.Request) {
+	category := r.URL.Query().Get("category")
+	warehouseID := r.URL.Query().Get("warehouse_id")
+	if warehouseID != "" {
+		if _, err := strconv.ParseUint(warehouseID, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid warehouse ID")
+			return
+		}
+	}
+	
+	type AgingItem struct {
+		ProductID      uint       `json:"product_id"`
+		SKU            string     `json:"sku"`
+		Name           string     `json:"name"`
+		WarehouseID    *uint      `json:"warehouse_id,omitempty"`
+		LocationID     *uint      `json:"location_id,omitempty"`
+		Quantity       int        `json:"quantity"`
+		CostPrice      float64    `json:"cost_price"`
+		Value          float64    `json:"value"`
+		LastReceivedAt *time.Time `json:"last_received_at"`
+		AgeDays        *int       `json:"age_days"`
+		Bucket         string     `json:"bucket"`
+	}
+	
+	type AgingBucket struct {
+		Range    string  `json:"range"`
+		Quantity int     `json:"quantity"`
+		Value    float64 `json:"value"`
+	}
+	
+	query := h.db.Table("products").Where("products.status = ? AND products.deleted_at IS NULL", "active")
+	if warehouseID != "" {
+		query = query.Select(`products.id as product_id, products.sku, products.name,
+				product_warehouses.warehouse_id, product_warehouses.location_id,
+				product_warehouses.quantity, products.cost_price, last_receipt.received_at as last_received_at`).
+			Joins("JOIN product_warehouses ON products.id = product_warehouses.product_id AND product_warehouses.warehouse_id = ?", warehouseID).
+			Joins(`LEFT JOIN LATERAL (
+				SELECT MAX(created_at) as received_at FROM inventory_transactions
+				WHERE inventory_transactions.product_id = products.id
+					AND inventory_transactions.type = 'receive'
+					AND inventory_transactions.warehouse_id = product_warehouses.warehouse_id
+					AND (COALESCE(product_warehouses.location_id, 0) = 0
+						OR inventory_transactions.destination_location_id = product_warehouses.location_id)
+			) last_receipt ON true`).
+			Where("product_warehouses.quantity > 0")
+	} else {
+		query = query.Select(`products.id as product_id, products.sku, products.name,
+				products.quantity, products.cost_price, last_receipt.received_at as last_received_at`).
+			Joins(`LEFT JOIN LATERAL (
+				SELECT MAX(created_at) as received_at FROM inventory_transactions
+				WHERE inventory_transactions.product_id = products.id AND inventory_transactions.type = 'receive'
+			) last_receipt ON true`).
+			Where("products.quantity > 0")
+	}
+	
+	if category != "" {
+		query = whereProductInCategory(query, category)
+	}
+	
+	var items []AgingItem
+	if err := query.Order("last_received_at ASC NULLS FIRST, products.sku").Scan(&items).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to generate inventory aging report: "+err.Error())
+		return
+	}
+	
+	buckets := make([]AgingBucket, len(agingBuckets)+1)
+	for i, bucket := range agingBuckets {
+		buckets[i].Range = bucket.Label
+	}
+	unknown := &buckets[len(agingBuckets)]
+	unknown.Range = "unknown"
+	
+	now := time.Now()
+	var totalQuantity int
+	var totalValue float64
+	for i := range items {
+		item := &items[i]
+		item.Value = models.RoundCurrency(float64(item.Quantity) * item.CostPrice)
+		
+		bucket := unknown
+		if item.LastReceivedAt != nil {
+			age := int(now.Sub(*item.LastReceivedAt).Hours() / 24)
+			item.AgeDays = &age
+			for b := range agingBuckets {
+				if age <= agingBuckets[b].MaxDays {
+					bucket = &buckets[b]
+					break
+				}
+			}
+		}
+		item.Bucket = bucket.Range
+		bucket.Quantity += item.Quantity
+		bucket.Value += item.Value
+		
+		totalQuantity += item.Quantity
+		totalValue += item.Value
+	}
+	for i := range buckets {
+		buckets[i].Value = models.RoundCurrency(buckets[i].Value)
+	}
+	if items == nil {
+		items = []AgingItem{}
+	}
+	
+	report := map[string]interface{}{
+		"generated_at":   now,
+		"buckets":        buckets,
+		"total_quantity": totalQuantity,
+		"total_value":    models.RoundCurrency(totalValue),
+		"items":          items,
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
 // GetLowStockReport generates a report of products with stock below reorder level
 func (h *ReportHandler) GetLowStockReport(w http.ResponseWriter, r *http.Request) {
 	type LowStockProduct struct {
@@ -94,16 +420,44 @@ func (h *ReportHandler) GetLowStockReport(w http.ResponseWriter, r *http.Request
 	
 	// Build query
 	query := h.db.Table("products").
-		Select("products.id, products.sku, products.name, products.category, products.quantity, products.reorder_level, (products.reorder_level - products.quantity) as shortage, suppliers.name as supplier").
-		Joins("LEFT JOIN product_supplier ON products.id = product_supplier.product_id").
-		Joins("LEFT JOIN suppliers ON product_supplier.supplier_id = suppliers.id").
-		Where("products.status = ? AND products.quantity <= products.reorder_level", "active").
+		Select("products.id, products.sku, products.name, "+productCategoriesColumn+" as category, products.quantity, products.reorder_level, (products.reorder_level - products.quantity) as shortage, suppliers.name as supplier").
+		Joins("LEFT JOIN product_suppliers ON products.id = product_suppliers.product_id AND product_suppliers.is_primary = ?", true).
+		Joins("LEFT JOIN suppliers ON product_suppliers.supplier_id = suppliers.id").
+		Where("products.status = ? AND products.deleted_at IS NULL AND products.quantity <= products.reorder_level", "active").
 		Group("products.id, suppliers.name").
 		Order("shortage DESC")
 	
+	if wantsCSV(r) {
+		rows, err := query.Rows()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to generate low stock report: "+err.Error())
+			return
+		}
+		defer rows.Close()
+		
+		header := []string{"id", "sku", "name", "category", "quantity", "reorder_level", "shortage", "supplier"}
+		streamCSVReport(w, "low-stock.csv", header, rows, func(rows *sql.Rows) ([]string, error) {
+			var product LowStockProduct
+			if err := h.db.ScanRows(rows, &product); err != nil {
+				return nil, err
+			}
+			return []string{
+				strconv.FormatUint(uint64(product.ID), 10),
+				product.SKU,
+				product.Name,
+				product.Category,
+				strconv.Itoa(product.Quantity),
+				strconv.Itoa(product.ReorderLevel),
+				strconv.Itoa(product.Shortage),
+				product.Supplier,
+			}, nil
+		})
+		return
+	}
+	
 	// Execute query
 	if err := query.Find(&products).Error; err != nil {
-		http.Error(w, "Failed to generate low stock report: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to generate low stock report: "+err.Error())
 		return
 	}
 	
@@ -149,7 +503,16 @@ func (h *ReportHandler) GetProductMovementReport(w http.ResponseWriter, r *http.
 		NetChange    int     `json:"net_change"`
 	}
 	
-	var movements []ProductMovement
+	// Summary: count the products in the report with a lightweight query first
+	var totalProducts int64
+	countQuery := h.db.Table("products")
+	if productID != "" {
+		countQuery = countQuery.Where("products.id = ?", productID)
+	}
+	if err := countQuery.Count(&totalProducts).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to generate product movement report: "+err.Error())
+		return
+	}
 	
 	// Build base query
 	query := h.db.Table("products").
@@ -174,23 +537,261 @@ func (h *ReportHandler) GetProductMovementReport(w http.ResponseWriter, r *http.
 		query = query.Where("products.id = ?", productID)
 	}
 	
-	// Execute query
-	if err := query.Find(&movements).Error; err != nil {
-		http.Error(w, "Failed to generate product movement report: "+err.Error(), http.StatusInternalServerError)
+	// Execute query and stream the detail rows
+	rows, err := query.Rows()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to generate product movement report: "+err.Error())
 		return
 	}
+	defer rows.Close()
 	
-	// Prepare report response
-	report := map[string]interface{}{
-		"generated_at": time.Now(),
-		"start_date":   startDate.Format("2006-01-02"),
-		"end_date":     endDate.Add(-24 * time.Hour).Format("2006-01-02"),
-		"total_products": len(movements),
-		"movements":    movements,
+	summary := map[string]interface{}{
+		"generated_at":   time.Now(),
+		"start_date":     startDate.Format("2006-01-02"),
+		"end_date":       endDate.Add(-24 * time.Hour).Format("2006-01-02"),
+		"total_products": totalProducts,
+	}
+	
+	streamJSONReport(w, summary, "movements", rows, func(rows *sql.Rows) (interface{}, error) {
+		var movement ProductMovement
+		err := h.db.ScanRows(rows, &movement)
+		return movement, err
+	})
+}
+
+// GetTransactionExport streams inventory transactions over a period for export
+func (h *ReportHandler) GetTransactionExport(w http.ResponseWriter, r *http.Request) {
+	// Parse date range parameters
+	startDate := time.Now().AddDate(0, -1, 0) // Default to last month
+	endDate := time.Now()
+	
+	if startDateStr := r.URL.Query().Get("start_date"); startDateStr != "" {
+		if parsedDate, err := time.Parse("2006-01-02", startDateStr); err == nil {
+			startDate = parsedDate
+		}
+	}
+	
+	if endDateStr := r.URL.Query().Get("end_date"); endDateStr != "" {
+		if parsedDate, err := time.Parse("2006-01-02", endDateStr); err == nil {
+			endDate = parsedDate.Add(24 * time.Hour) // Include the end date fully
+		}
+	}
+	
+	type TransactionRow struct {
+		ID              uint      `json:"id"`
+		CreatedAt       time.Time `json:"created_at"`
+		Type            string    `json:"type"`
+		ProductID       uint      `json:"product_id"`
+		ProductSKU      string    `json:"product_sku"`
+		ProductName     string    `json:"product_name"`
+		WarehouseID     uint      `json:"warehouse_id"`
+		WarehouseName   string    `json:"warehouse_name"`
+		Quantity        int       `json:"quantity"`
+		UnitCost        float64   `json:"unit_cost"`
+		Value           float64   `json:"value"`
+		ReferenceNumber string    `json:"reference_number"`
+		UserID          uint      `json:"user_id"`
+		Notes           string    `json:"notes"`
+	}
+	
+	// Build base query with optional filters
+	query := h.db.Table("inventory_transactions").
+		Where("inventory_transactions.created_at BETWEEN ? AND ?", startDate, endDate)
+	
+	if txType := r.URL.Query().Get("type"); txType != "" {
+		query = query.Where("inventory_transactions.type = ?", txType)
+	}
+	
+	if productID := r.URL.Query().Get("product_id"); productID != "" {
+		query = query.Where("inventory_transactions.product_id = ?", productID)
+	}
+	
+	if warehouseID := r.URL.Query().Get("warehouse_id"); warehouseID != "" {
+		query = query.Where("inventory_transactions.warehouse_id = ?", warehouseID)
+	}
+	
+	// Summary: count matching transactions before streaming the rows
+	var totalTransactions int64
+	if err := query.Session(&gorm.Session{}).Count(&totalTransactions).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to generate transaction export: "+err.Error())
+		return
+	}
+	
+	rows, err := query.
+		Select(`
+			inventory_transactions.id,
+			inventory_transactions.created_at,
+			inventory_transactions.type,
+			inventory_transactions.product_id,
+			products.sku as product_sku,
+			products.name as product_name,
+			inventory_transactions.warehouse_id,
+			warehouses.name as warehouse_name,
+			inventory_transactions.quantity,
+			inventory_transactions.unit_cost,
+			(inventory_transactions.quantity * inventory_transactions.unit_cost) as value,
+			inventory_transactions.reference_number,
+			inventory_transactions.user_id,
+			inventory_transactions.notes
+		`).
+		Joins("JOIN products ON inventory_transactions.product_id = products.id").
+		Joins("JOIN warehouses ON inventory_transactions.warehouse_id = warehouses.id").
+		Order("inventory_transactions.created_at ASC, inventory_transactions.id ASC").
+		Rows()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to generate transaction export: "+err.Error())
+		return
+	}
+	defer rows.Close()
+	
+	summary := map[string]interface{}{
+		"generated_at":       time.Now(),
+		"start_date":         startDate.Format("2006-01-02"),
+		"end_date":           endDate.Add(-24 * time.Hour).Format("2006-01-02"),
+		"total_transactions": totalTransactions,
+	}
+	
+	streamJSONReport(w, summary, "transactions", rows, func(rows *sql.Rows) (interface{}, error) {
+		var row TransactionRow
+		err := h.db.ScanRows(rows, &row)
+		return row, err
+	})
+}
+
+// streamWriteTimeout is how long a streamed report or export may take to send. The server's
+// WriteTimeout is sized for ordinary responses and would cut large exports off.
+const streamWriteTimeout = 10 * time.Minute
+
+// extendWriteDeadline gives a streamed response streamWriteTimeout to finish
+func extendWriteDeadline(w http.ResponseWriter) {
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil {
+		log.Printf("Failed to extend write deadline for streamed response: %v", err)
 	}
+}
+
+// streamJSONReport writes the summary fields followed by a JSON array under
+// arrayKey, encoding one row at a time so memory stays flat for large results.
+// Once streaming has started the status code can no longer change, so a row or
+// query error ends the array early and the object with an "error" member, which
+// clients must check for before trusting the array as complete.
+func streamJSONReport(w http.ResponseWriter, summary map[string]interface{}, arrayKey string, rows *sql.Rows, scan func(*sql.Rows) (interface{}, error)) {
+	header, err := json.Marshal(summary)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to encode report: "+err.Error())
+		return
+	}
+	key, _ := json.Marshal(arrayKey)
 	
+	extendWriteDeadline(w)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(report)
+	
+	// Reopen the summary object and append the array field
+	w.Write(header[:len(header)-1])
+	if len(summary) > 0 {
+		w.Write([]byte(","))
+	}
+	w.Write(key)
+	w.Write([]byte(":["))
+	
+	flusher, _ := w.(http.Flusher)
+	count := 0
+	var streamErr error
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			streamErr = fmt.Errorf("scanning row: %w", err)
+			break
+		}
+		
+		data, err := json.Marshal(item)
+		if err != nil {
+			streamErr = fmt.Errorf("encoding row: %w", err)
+			break
+		}
+		
+		if count > 0 {
+			w.Write([]byte(","))
+		}
+		w.Write(data)
+		count++
+		
+		// Push buffered rows to the client periodically
+		if flusher != nil && count%500 == 0 {
+			flusher.Flush()
+		}
+	}
+	if streamErr == nil {
+		streamErr = rows.Err()
+	}
+	
+	w.Write([]byte("]"))
+	if streamErr != nil {
+		log.Printf("Streaming %s stopped after %d rows: %v", arrayKey, count, streamErr)
+		trailer, _ := json.Marshal(errorBody{
+			Code:    errCodeInternal,
+			Message: fmt.Sprintf("Report ended early after %d rows: %v", count, streamErr),
+		})
+		w.Write([]byte(`,"error":`))
+		w.Write(trailer)
+	}
+	w.Write([]byte("}\n"))
+}
+
+// wantsCSV reports whether the client asked for CSV, with ?format=csv or an Accept header
+func wantsCSV(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format == "csv"
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/csv")
+}
+
+// formatMoney formats a money value with two decimals for CSV output
+func formatMoney(value float64) string {
+	return strconv.FormatFloat(models.RoundCurrency(value), 'f', 2, 64)
+}
+
+// streamCSVReport writes a CSV attachment with the given header, converting and
+// flushing one row at a time so memory stays flat for large results. CSV has no
+// room for an error marker, so a row or query error after the header is sent is
+// logged and the connection aborted, leaving the client with a failed download
+// rather than a file that looks complete.
+func streamCSVReport(w http.ResponseWriter, filename string, header []string, rows *sql.Rows, record func(*sql.Rows) ([]string, error)) {
+	extendWriteDeadline(w)
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	
+	writer := csv.NewWriter(w)
+	writer.Write(header)
+	
+	flusher, _ := w.(http.Flusher)
+	count := 0
+	var streamErr error
+	for rows.Next() {
+		fields, err := record(rows)
+		if err != nil {
+			streamErr = fmt.Errorf("scanning row: %w", err)
+			break
+		}
+		writer.Write(fields)
+		count++
+		
+		// Push buffered rows to the client periodically
+		if count%500 == 0 {
+			writer.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+	if streamErr == nil {
+		streamErr = rows.Err()
+	}
+	
+	writer.Flush()
+	if streamErr != nil {
+		log.Printf("Streaming %s stopped after %d rows: %v", filename, count, streamErr)
+		panic(http.ErrAbortHandler)
+	}
 }
 
 // GetSalesReport generates a sales report over a period
@@ -215,6 +816,22 @@ func (h *ReportHandler) GetSalesReport(w http.ResponseWriter, r *http.Request) {
 	customerID := r.URL.Query().Get("customer_id")
 	productID := r.URL.Query().Get("product_id")
 	
+	// Optional time series grouping, bucketed in the requested timezone
+	groupBy := r.URL.Query().Get("group_by")
+	if groupBy != "" && groupBy != "day" && groupBy != "week" && groupBy != "month" {
+		writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid group_by: must be day, week, or month")
+		return
+	}
+	
+	timezone := r.URL.Query().Get("tz")
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid timezone: "+timezone)
+		return
+	}
+	
 	// Summary statistics
 	var totalSales float64
 	var totalOrders int64
@@ -229,12 +846,12 @@ func (h *ReportHandler) GetSalesReport(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	if err := query.Count(&totalOrders).Error; err != nil {
-		http.Error(w, "Failed to count orders: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to count orders: "+err.Error())
 		return
 	}
 	
 	if err := query.Select("COALESCE(SUM(total_amount), 0)").Scan(&totalSales).Error; err != nil {
-		http.Error(w, "Failed to calculate total sales: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to calculate total sales: "+err.Error())
 		return
 	}
 	
@@ -276,7 +893,7 @@ func (h *ReportHandler) GetSalesReport(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	if err := productQuery.Find(&productSales).Error; err != nil {
-		http.Error(w, "Failed to retrieve product sales: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve product sales: "+err.Error())
 		return
 	}
 	
@@ -313,7 +930,7 @@ func (h *ReportHandler) GetSalesReport(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	if err := customerQuery.Find(&customerSales).Error; err != nil {
-		http.Error(w, "Failed to retrieve customer sales: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve customer sales: "+err.Error())
 		return
 	}
 	
@@ -329,6 +946,156 @@ func (h *ReportHandler) GetSalesReport(w http.ResponseWriter, r *http.Request) {
 		"customer_sales":  customerSales,
 	}
 	
+	if groupBy != "" {
+		type SalesBucket struct {
+			Period     string  `json:"period"`
+			OrderCount int     `json:"order_count"`
+			Revenue    float64 `json:"revenue"`
+		}
+		
+		// generate_series lays out every period in the range so empty ones chart as zero, and
+		// orders join the period their local date truncates to. Postgres truncates weeks to
+		// Monday, matching ISO weeks.
+		customerFilter := ""
+		args := []interface{}{
+			groupBy, startDate, timezone, groupBy, endDate.Add(-time.Microsecond), timezone, "1 " + groupBy,
+			groupBy, timezone, startDate, endDate,
+		}
+		if customerID != "" {
+			customerFilter = "AND so.customer_id = ?"
+			args = append(args, customerID)
+		}
+		
+		series := []SalesBucket{}
+		if err := h.db.Raw(`
+			SELECT to_char(p.period, 'YYYY-MM-DD') as period,
+				COUNT(so.id) as order_count,
+				COALESCE(SUM(so.total_amount), 0) as revenue
+			FROM generate_series(
+				date_trunc(?, ?::timestamptz AT TIME ZONE ?),
+				date_trunc(?, ?::timestamptz AT TIME ZONE ?),
+				?::interval
+			) AS p(period)
+			LEFT JOIN sales_orders so ON date_trunc(?, so.order_date AT TIME ZONE ?) = p.period
+				AND so.order_date BETWEEN ? AND ?
+				AND so.status NOT IN ('draft', 'cancelled')
+				`+customerFilter+`
+			GROUP BY p.period
+			ORDER BY p.period
+		`, args...).Scan(&series).Error; err != nil {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve sales series: "+err.Error())
+			return
+		}
+		
+		report["group_by"] = groupBy
+		report["timezone"] = timezone
+		report["sales_series"] = series
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// GetProfitMarginReport generates a report of gross and net sales margin over a period.
+// Gross margin is item revenue less cost of goods at current cost prices; net margin also
+// subtracts shipping the business absorbed (orders with shipping_billed_to_customer = false).
+// Shipping billed to customers is a pass-through and doesn't affect either margin.
+func (h *ReportHandler) GetProfitMarginReport(w http.ResponseWriter, r *http.Request) {
+	// Parse date range parameters
+	startDate := time.Now().AddDate(0, -1, 0) // Default to last month
+	endDate := time.Now()
+	
+	if startDateStr := r.URL.Query().Get("start_date"); startDateStr != "" {
+		if parsedDate, err := time.Parse("2006-01-02", startDateStr); err == nil {
+			startDate = parsedDate
+		}
+	}
+	
+	if endDateStr := r.URL.Query().Get("end_date"); endDateStr != "" {
+		if parsedDate, err := time.Parse("2006-01-02", endDateStr); err == nil {
+			endDate = parsedDate.Add(24 * time.Hour) // Include the end date fully
+		}
+	}
+	
+	// Order-level figures
+	var orderTotals struct {
+		Revenue          float64
+		AbsorbedShipping float64
+	}
+	
+	if err := h.db.Table("sales_orders").
+		Select("COALESCE(SUM(subtotal), 0) as revenue, COALESCE(SUM(CASE WHEN shipping_billed_to_customer = false THEN shipping_cost ELSE 0 END), 0) as absorbed_shipping").
+		Where("order_date BETWEEN ? AND ? AND status NOT IN ('draft', 'cancelled')", startDate, endDate).
+		Scan(&orderTotals).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to generate profit margin report: "+err.Error())
+		return
+	}
+	
+	// Margin by product
+	type ProductMargin struct {
+		ProductID   uint    `json:"product_id"`
+		ProductSKU  string  `json:"product_sku"`
+		ProductName string  `json:"product_name"`
+		Quantity    int     `json:"quantity"`
+		Revenue     float64 `json:"revenue"`
+		Cost        float64 `json:"cost"`
+		GrossMargin float64 `json:"gross_margin"`
+	}
+	
+	var productMargins []ProductMargin
+	
+	if err := h.db.Table("sales_order_items").
+		Select(`
+			products.id as product_id,
+			products.sku as product_sku,
+			products.name as product_name,
+			SUM(sales_order_items.quantity) as quantity,
+			SUM(sales_order_items.total_price) as revenue,
+			SUM(sales_order_items.quantity * products.cost_price) as cost,
+			SUM(sales_order_items.total_price) - SUM(sales_order_items.quantity * products.cost_price) as gross_margin
+		`).
+		Joins("JOIN products ON sales_order_items.product_id = products.id").
+		Joins("JOIN sales_orders ON sales_order_items.sales_order_id = sales_orders.id").
+		Where("sales_orders.order_date BETWEEN ? AND ? AND sales_orders.status NOT IN ('draft', 'cancelled')", startDate, endDate).
+		Group("products.id, products.sku, products.name").
+		Order("gross_margin DESC").
+		Find(&productMargins).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve product margins: "+err.Error())
+		return
+	}
+	
+	var totalCost float64
+	for i := range productMargins {
+		productMargins[i].Cost = models.RoundCurrency(productMargins[i].Cost)
+		productMargins[i].GrossMargin = models.RoundCurrency(productMargins[i].GrossMargin)
+		totalCost += productMargins[i].Cost
+	}
+	totalCost = models.RoundCurrency(totalCost)
+	
+	grossMargin := models.RoundCurrency(orderTotals.Revenue - totalCost)
+	netMargin := models.RoundCurrency(grossMargin - orderTotals.AbsorbedShipping)
+	
+	var grossMarginPercent, netMarginPercent float64
+	if orderTotals.Revenue > 0 {
+		grossMarginPercent = grossMargin / orderTotals.Revenue * 100
+		netMarginPercent = netMargin / orderTotals.Revenue * 100
+	}
+	
+	// Prepare report response
+	report := map[string]interface{}{
+		"generated_at":         time.Now(),
+		"start_date":           startDate.Format("2006-01-02"),
+		"end_date":             endDate.Add(-24 * time.Hour).Format("2006-01-02"),
+		"revenue":              orderTotals.Revenue,
+		"cost_of_goods":        totalCost,
+		"absorbed_shipping":    orderTotals.AbsorbedShipping,
+		"gross_margin":         grossMargin,
+		"gross_margin_percent": grossMarginPercent,
+		"net_margin":           netMargin,
+		"net_margin_percent":   netMarginPercent,
+		"products":             productMargins,
+	}
+	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(report)
 }
@@ -369,12 +1136,12 @@ func (h *ReportHandler) GetPurchasesReport(w http.ResponseWriter, r *http.Reques
 	}
 	
 	if err := query.Count(&totalOrders).Error; err != nil {
-		http.Error(w, "Failed to count orders: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to count orders: "+err.Error())
 		return
 	}
 	
 	if err := query.Select("COALESCE(SUM(total_amount), 0)").Scan(&totalPurchases).Error; err != nil {
-		http.Error(w, "Failed to calculate total purchases: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to calculate total purchases: "+err.Error())
 		return
 	}
 	
@@ -416,7 +1183,7 @@ func (h *ReportHandler) GetPurchasesReport(w http.ResponseWriter, r *http.Reques
 	}
 	
 	if err := productQuery.Find(&productPurchases).Error; err != nil {
-		http.Error(w, "Failed to retrieve product purchases: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve product purchases: "+err.Error())
 		return
 	}
 	
@@ -453,7 +1220,7 @@ func (h *ReportHandler) GetPurchasesReport(w http.ResponseWriter, r *http.Reques
 	}
 	
 	if err := supplierQuery.Find(&supplierPurchases).Error; err != nil {
-		http.Error(w, "Failed to retrieve supplier purchases: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve supplier purchases: "+err.Error())
 		return
 	}
 	
@@ -469,6 +1236,205 @@ func (h *ReportHandler) GetPurchasesReport(w http.ResponseWriter, r *http.Reques
 		"supplier_purchases": supplierPurchases,
 	}
 	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// GetReorderRecommendations generates a purchasing worksheet for every active product at or
+// below its reorder level. The target stock level is the reorder level times target_multiplier
+// (default 2) plus expected demand over the primary supplier's lead time, based on the last
+// 30 days of issues. Quantity already on open purchase orders is subtracted, and the supplier's
+// minimum order quantity is respected. Results are grouped by primary supplier.
+func (h *ReportHandler) GetReorderRecommendations(w http.ResponseWriter, r *http.Request) {
+	const demandWindowDays = 30
+	
+	targetMultiplier := 2.0
+	if multiplierStr := r.URL.Query().Get("target_multiplier"); multiplierStr != "" {
+		multiplier, err := strconv.ParseFloat(multiplierStr, 64)
+		if err != nil || multiplier < 1 {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid target_multiplier: must be a number of at least 1")
+			return
+		}
+		targetMultiplier = multiplier
+	}
+	
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid format: must be json or csv")
+		return
+	}
+	
+	var warehouseID uint64
+	if warehouseIDStr := r.URL.Query().Get("warehouse_id"); warehouseIDStr != "" {
+		var err error
+		warehouseID, err = strconv.ParseUint(warehouseIDStr, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid warehouse ID")
+			return
+		}
+	}
+	
+	type ReorderLine struct {
+		ProductID           uint    `json:"product_id"`
+		SKU                 string  `json:"sku"`
+		Name                string  `json:"name"`
+		Quantity            int     `json:"quantity"`
+		ReorderLevel        int     `json:"reorder_level"`
+		OnOrder             int     `json:"on_order"`
+		RecentDemand        int     `json:"recent_demand"`
+		TargetLevel         int     `json:"target_level"`
+		RecommendedQuantity int     `json:"recommended_quantity"`
+		SupplierID          uint    `json:"supplier_id"`
+		SupplierName        string  `json:"supplier_name"`
+		UnitCost            float64 `json:"unit_cost"`
+		MinOrderQuantity    int     `json:"min_order_quantity"`
+		LeadTimeDays        int     `json:"lead_time_days"`
+		EstimatedCost       float64 `json:"estimated_cost"`
+	}
+	
+	demandSince := time.Now().AddDate(0, 0, -demandWindowDays)
+	
+	// Stock, demand and open orders are scoped to the warehouse when one is given
+	stockColumn := "products.quantity"
+	demandFilter := ""
+	onOrderFilter := ""
+	demandArgs := []interface{}{demandSince}
+	onOrderArgs := []interface{}{}
+	if warehouseID != 0 {
+		stockColumn = "COALESCE(warehouse_stock.quantity, 0)"
+		demandFilter = " AND inventory_transactions.warehouse_id = ?"
+		onOrderFilter = " AND purchase_orders.warehouse_id = ?"
+		demandArgs = append(demandArgs, warehouseID)
+		onOrderArgs = append(onOrderArgs, warehouseID)
+	}
+	
+	args := append(demandArgs, onOrderArgs...)
+	query := h.db.Table("products").
+		Select(`
+			products.id as product_id,
+			products.sku,
+			products.name,
+			`+stockColumn+` as quantity,
+			products.reorder_level,
+			COALESCE((
+				SELECT SUM(inventory_transactions.quantity) FROM inventory_transactions
+				WHERE inventory_transactions.product_id = products.id
+				AND inventory_transactions.type = 'issue'
+				AND inventory_transactions.created_at >= ?`+demandFilter+`
+			), 0) as recent_demand,
+			COALESCE((
+				SELECT SUM(purchase_order_items.quantity - purchase_order_items.quantity_received) FROM purchase_order_items
+				JOIN purchase_orders ON purchase_order_items.purchase_order_id = purchase_orders.id
+				WHERE purchase_order_items.product_id = products.id
+				AND purchase_orders.status IN ('approved', 'partial')`+onOrderFilter+`
+			), 0) as on_order,
+			COALESCE(suppliers.id, 0) as supplier_id,
+			COALESCE(suppliers.name, '') as supplier_name,
+			COALESCE(product_suppliers.unit_cost, products.cost_price, 0) as unit_cost,
+			COALESCE(product_suppliers.min_order_quantity, 1) as min_order_quantity,
+			COALESCE(product_suppliers.lead_time_days, 0) as lead_time_days
+		`, args...).
+		Joins("LEFT JOIN product_suppliers ON products.id = product_suppliers.product_id AND product_suppliers.is_primary = ?", true).
+		Joins("LEFT JOIN suppliers ON product_suppliers.supplier_id = suppliers.id").
+		Where("products.status = ? AND products.deleted_at IS NULL", "active").
+		Order("supplier_name, products.sku")
+	
+	if warehouseID != 0 {
+		query = query.
+			Joins(`JOIN (
+				SELECT product_id, SUM(quantity) as quantity FROM product_warehouses
+				WHERE warehouse_id = ? GROUP BY product_id
+			) warehouse_stock ON warehouse_stock.product_id = products.id`, warehouseID).
+			Where("warehouse_stock.quantity <= products.reorder_level")
+	} else {
+		query = query.Where("products.quantity <= products.reorder_level")
+	}
+	
+	var candidates []ReorderLine
+	if err := query.Scan(&candidates).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to generate reorder recommendations: "+err.Error())
+		return
+	}
+	
+	type SupplierGroup struct {
+		SupplierID    uint          `json:"supplier_id"`
+		SupplierName  string        `json:"supplier_name"`
+		TotalQuantity int           `json:"total_quantity"`
+		EstimatedCost float64       `json:"estimated_cost"`
+		Items         []ReorderLine `json:"items"`
+	}
+	
+	var lines []ReorderLine
+	groups := []*SupplierGroup{}
+	groupIndex := make(map[uint]*SupplierGroup)
+	totalCost := 0.0
+	
+	for _, line := range candidates {
+		dailyDemand := float64(line.RecentDemand) / demandWindowDays
+		line.TargetLevel = int(math.Ceil(float64(line.ReorderLevel)*targetMultiplier + dailyDemand*float64(line.LeadTimeDays)))
+		
+		needed := line.TargetLevel - line.Quantity - line.OnOrder
+		if needed <= 0 {
+			// Already covered by open purchase orders
+			continue
+		}
+		if needed < line.MinOrderQuantity {
+			needed = line.MinOrderQuantity
+		}
+		line.RecommendedQuantity = needed
+		line.EstimatedCost = models.RoundCurrency(float64(needed) * line.UnitCost)
+		lines = append(lines, line)
+		
+		group, ok := groupIndex[line.SupplierID]
+		if !ok {
+			group = &SupplierGroup{SupplierID: line.SupplierID, SupplierName: line.SupplierName}
+			groupIndex[line.SupplierID] = group
+			groups = append(groups, group)
+		}
+		group.Items = append(group.Items, line)
+		group.TotalQuantity += needed
+		group.EstimatedCost = models.RoundCurrency(group.EstimatedCost + line.EstimatedCost)
+		totalCost += line.EstimatedCost
+	}
+	
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="reorder-recommendations.csv"`)
+		
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"supplier_id", "supplier_name", "product_id", "sku", "name", "quantity", "reorder_level",
+			"on_order", "target_level", "recommended_quantity", "unit_cost", "lead_time_days", "estimated_cost"})
+		for _, line := range lines {
+			writer.Write([]string{
+				strconv.FormatUint(uint64(line.SupplierID), 10),
+				line.SupplierName,
+				strconv.FormatUint(uint64(line.ProductID), 10),
+				line.SKU,
+				line.Name,
+				strconv.Itoa(line.Quantity),
+				strconv.Itoa(line.ReorderLevel),
+				strconv.Itoa(line.OnOrder),
+				strconv.Itoa(line.TargetLevel),
+				strconv.Itoa(line.RecommendedQuantity),
+				strconv.FormatFloat(line.UnitCost, 'f', 2, 64),
+				strconv.Itoa(line.LeadTimeDays),
+				strconv.FormatFloat(line.EstimatedCost, 'f', 2, 64),
+			})
+		}
+		writer.Flush()
+		return
+	}
+	
+	// Prepare report response
+	report := map[string]interface{}{
+		"generated_at":         time.Now(),
+		"warehouse_id":         warehouseID,
+		"target_multiplier":    targetMultiplier,
+		"total_items":          len(lines),
+		"total_estimated_cost": models.RoundCurrency(totalCost),
+		"suppliers":            groups,
+	}
+	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(report)
 }
\ No newline at end of file
@@ -1,41 +1,107 @@
 package handlers
 
 import (
+	"time"
+
 	"github.com/gorilla/mux"
+	"github.com/yourusername/inventory-management-system/internal/alerts"
+	"github.com/yourusername/inventory-management-system/internal/middleware"
+	"github.com/yourusername/inventory-management-system/internal/models"
 	"gorm.io/gorm"
 )
 
-// RegisterPublicRoutes registers all routes that don't require authentication
-func RegisterPublicRoutes(router *mux.Router, db *gorm.DB) {
+// RegisterPublicRoutes registers all routes that don't require authentication.
+// jwtSecret signs the access tokens issued at login; it must match the one the
+// Authenticate middleware validates with.
+func RegisterPublicRoutes(router *mux.Router, db *gorm.DB, jwtSecret string) {
 	// Auth handler for login/register
-	authHandler := NewAuthHandler(db)
+	authHandler := NewAuthHandler(db, jwtSecret)
 	router.HandleFunc("/auth/login", authHandler.Login).Methods("POST")
 	router.HandleFunc("/auth/register", authHandler.Register).Methods("POST")
+	router.HandleFunc("/auth/refresh", authHandler.Refresh).Methods("POST")
+	router.HandleFunc("/auth/logout", authHandler.Logout).Methods("POST")
+	
+	// Customer order tracking, rate limited since it needs no login
+	trackingHandler := NewTrackingHandler(db)
+	tracking := router.PathPrefix("/track").Subrouter()
+	tracking.Use(middleware.RateLimit(10, time.Minute))
+	tracking.HandleFunc("/{so_number}", trackingHandler.TrackOrder).Methods("GET")
 }
 
-// RegisterProtectedRoutes registers all routes that require authentication
-func RegisterProtectedRoutes(router *mux.Router, db *gorm.DB) {
+// RegisterProtectedRoutes registers all routes that require authentication. alerter
+// receives low stock alerts from issues, adjustments and sales order fulfillment.
+func RegisterProtectedRoutes(router *mux.Router, db *gorm.DB, alerter alerts.StockAlerter) {
+	// Destructive operations are limited to managers and user management to admins.
+	// Admins pass every role check, so admin-only routes are also closed to managers.
+	// The capabilities in models/role.go describe these same guards to clients.
+	managerOnly := router.NewRoute().Subrouter()
+	managerOnly.Use(middleware.RequireRole(models.RoleManager))
+	adminOnly := router.NewRoute().Subrouter()
+	adminOnly.Use(middleware.RequireRole(models.RoleAdmin))
+	
 	// Products
 	productHandler := NewProductHandler(db)
 	router.HandleFunc("/products", productHandler.GetProducts).Methods("GET")
 	router.HandleFunc("/products", productHandler.CreateProduct).Methods("POST")
 	router.HandleFunc("/products/{id:[0-9]+}", productHandler.GetProduct).Methods("GET")
+	router.HandleFunc("/products/{id:[0-9]+}/detail", productHandler.GetProductDetail).Methods("GET")
 	router.HandleFunc("/products/{id:[0-9]+}", productHandler.UpdateProduct).Methods("PUT")
-	router.HandleFunc("/products/{id:[0-9]+}", productHandler.DeleteProduct).Methods("DELETE")
+	router.HandleFunc("/products/{id:[0-9]+}/quantity", productHandler.AdjustProductQuantity).Methods("PATCH")
+	managerOnly.HandleFunc("/products/{id:[0-9]+}", productHandler.DeleteProduct).Methods("DELETE")
+	managerOnly.HandleFunc("/products/{id:[0-9]+}/restore", productHandler.RestoreProduct).Methods("POST")
 	router.HandleFunc("/products/sku/{sku}", productHandler.GetProductBySKU).Methods("GET")
 	router.HandleFunc("/products/{id:[0-9]+}/categories", productHandler.GetProductCategories).Methods("GET")
+	router.HandleFunc("/products/{id:[0-9]+}/primary-supplier", productHandler.SetPrimarySupplier).Methods("PUT")
+	router.HandleFunc("/products/{id:[0-9]+}/custom-fields", productHandler.SetProductCustomFields).Methods("PUT")
+	router.HandleFunc("/products/{id:[0-9]+}/suppliers", productHandler.GetProductSuppliers).Methods("GET")
+	router.HandleFunc("/products/{id:[0-9]+}/suppliers/{supplierId:[0-9]+}", productHandler.CreateProductSupplier).Methods("POST")
+	router.HandleFunc("/products/{id:[0-9]+}/suppliers/{supplierId:[0-9]+}", productHandler.UpdateProductSupplier).Methods("PUT")
+	managerOnly.HandleFunc("/products/{id:[0-9]+}/suppliers/{supplierId:[0-9]+}", productHandler.DeleteProductSupplier).Methods("DELETE")
+	router.HandleFunc("/products/{id:[0-9]+}/demand-forecast", productHandler.GetDemandForecast).Methods("GET")
+	router.HandleFunc("/products/{id:[0-9]+}/sales-orders", productHandler.GetProductSalesOrders).Methods("GET")
+	router.HandleFunc("/products/{id:[0-9]+}/commitments", productHandler.GetProductCommitments).Methods("GET")
+	router.HandleFunc("/products/{id:[0-9]+}/availability", productHandler.GetProductAvailability).Methods("GET")
+	router.HandleFunc("/products/{id:[0-9]+}/negative-events", productHandler.GetProductNegativeEvents).Methods("GET")
+	router.HandleFunc("/products/{id:[0-9]+}/hold", productHandler.CreateProductHold).Methods("POST")
+	router.HandleFunc("/products/{id:[0-9]+}/holds", productHandler.GetProductHolds).Methods("GET")
+	router.HandleFunc("/products/{id:[0-9]+}/holds/{holdId:[0-9]+}", productHandler.ReleaseProductHold).Methods("DELETE")
+	router.HandleFunc("/products/{id:[0-9]+}/purchase-orders", productHandler.GetProductPurchaseOrders).Methods("GET")
+	router.HandleFunc("/products/{id:[0-9]+}/disassemble", productHandler.DisassembleBundle).Methods("POST")
+	router.HandleFunc("/products/{id:[0-9]+}/bundle-items", productHandler.GetBundleItems).Methods("GET")
+	router.HandleFunc("/products/{id:[0-9]+}/bundle-items", productHandler.SetBundleItems).Methods("POST")
+	router.HandleFunc("/products/{id:[0-9]+}/generate-barcode", productHandler.GenerateProductBarcode).Methods("POST")
+	router.HandleFunc("/products/{id:[0-9]+}/barcode-image", productHandler.GetProductBarcodeImage).Methods("GET")
+	router.HandleFunc("/products/{id:[0-9]+}/variants", productHandler.GetProductVariants).Methods("GET")
+	router.HandleFunc("/products/{id:[0-9]+}/variants", productHandler.CreateProductVariant).Methods("POST")
+	router.HandleFunc("/variants/{id:[0-9]+}", productHandler.UpdateProductVariant).Methods("PUT")
+	managerOnly.HandleFunc("/variants/{id:[0-9]+}", productHandler.DeleteProductVariant).Methods("DELETE")
 	router.HandleFunc("/products/low-stock", productHandler.GetLowStockProducts).Methods("GET")
+	router.HandleFunc("/products/duplicates", productHandler.GetDuplicateProducts).Methods("GET")
+	managerOnly.HandleFunc("/products/merge", productHandler.MergeProducts).Methods("POST")
+	router.HandleFunc("/products/import", productHandler.ImportProducts).Methods("POST")
+	adminOnly.HandleFunc("/products/reconcile-all", productHandler.ReconcileAllProducts).Methods("POST")
 	router.HandleFunc("/products/warehouse/{warehouseId:[0-9]+}", productHandler.GetProductsByWarehouse).Methods("GET")
 	
+	// Custom fields
+	customFieldHandler := NewCustomFieldHandler(db)
+	router.HandleFunc("/custom-fields", customFieldHandler.GetCustomFields).Methods("GET")
+	router.HandleFunc("/custom-fields", customFieldHandler.CreateCustomField).Methods("POST")
+	router.HandleFunc("/custom-fields/{id:[0-9]+}", customFieldHandler.UpdateCustomField).Methods("PUT")
+	managerOnly.HandleFunc("/custom-fields/{id:[0-9]+}", customFieldHandler.DeleteCustomField).Methods("DELETE")
+	
 	// Categories
 	categoryHandler := NewCategoryHandler(db)
 	router.HandleFunc("/categories", categoryHandler.GetCategories).Methods("GET")
 	router.HandleFunc("/categories", categoryHandler.CreateCategory).Methods("POST")
+	router.HandleFunc("/categories/tree", categoryHandler.GetCategoryForest).Methods("GET")
 	router.HandleFunc("/categories/{id:[0-9]+}", categoryHandler.GetCategory).Methods("GET")
 	router.HandleFunc("/categories/{id:[0-9]+}", categoryHandler.UpdateCategory).Methods("PUT")
-	router.HandleFunc("/categories/{id:[0-9]+}", categoryHandler.DeleteCategory).Methods("DELETE")
+	managerOnly.HandleFunc("/categories/{id:[0-9]+}", categoryHandler.DeleteCategory).Methods("DELETE")
+	managerOnly.HandleFunc("/categories/{id:[0-9]+}/restore", categoryHandler.RestoreCategory).Methods("POST")
 	router.HandleFunc("/categories/{id:[0-9]+}/products", categoryHandler.GetCategoryProducts).Methods("GET")
 	router.HandleFunc("/categories/{id:[0-9]+}/subcategories", categoryHandler.GetSubcategories).Methods("GET")
+	router.HandleFunc("/categories/{id:[0-9]+}/tree", categoryHandler.GetCategoryTree).Methods("GET")
+	router.HandleFunc("/categories/{id:[0-9]+}/path", categoryHandler.GetCategoryPath).Methods("GET")
 	
 	// Suppliers
 	supplierHandler := NewSupplierHandler(db)
@@ -43,8 +109,10 @@ func RegisterProtectedRoutes(router *mux.Router, db *gorm.DB) {
 	router.HandleFunc("/suppliers", supplierHandler.CreateSupplier).Methods("POST")
 	router.HandleFunc("/suppliers/{id:[0-9]+}", supplierHandler.GetSupplier).Methods("GET")
 	router.HandleFunc("/suppliers/{id:[0-9]+}", supplierHandler.UpdateSupplier).Methods("PUT")
-	router.HandleFunc("/suppliers/{id:[0-9]+}", supplierHandler.DeleteSupplier).Methods("DELETE")
+	managerOnly.HandleFunc("/suppliers/{id:[0-9]+}", supplierHandler.DeleteSupplier).Methods("DELETE")
+	managerOnly.HandleFunc("/suppliers/{id:[0-9]+}/restore", supplierHandler.RestoreSupplier).Methods("POST")
 	router.HandleFunc("/suppliers/{id:[0-9]+}/products", supplierHandler.GetSupplierProducts).Methods("GET")
+	router.HandleFunc("/suppliers/{id:[0-9]+}/low-stock", supplierHandler.GetSupplierLowStockProducts).Methods("GET")
 	
 	// Warehouses
 	warehouseHandler := NewWarehouseHandler(db)
@@ -52,48 +120,102 @@ func RegisterProtectedRoutes(router *mux.Router, db *gorm.DB) {
 	router.HandleFunc("/warehouses", warehouseHandler.CreateWarehouse).Methods("POST")
 	router.HandleFunc("/warehouses/{id:[0-9]+}", warehouseHandler.GetWarehouse).Methods("GET")
 	router.HandleFunc("/warehouses/{id:[0-9]+}", warehouseHandler.UpdateWarehouse).Methods("PUT")
-	router.HandleFunc("/warehouses/{id:[0-9]+}", warehouseHandler.DeleteWarehouse).Methods("DELETE")
+	managerOnly.HandleFunc("/warehouses/{id:[0-9]+}", warehouseHandler.DeleteWarehouse).Methods("DELETE")
+	managerOnly.HandleFunc("/warehouses/{id:[0-9]+}/restore", warehouseHandler.RestoreWarehouse).Methods("POST")
 	router.HandleFunc("/warehouses/{id:[0-9]+}/locations", warehouseHandler.GetWarehouseLocations).Methods("GET")
+	router.HandleFunc("/warehouses/{id:[0-9]+}/locations/generate", warehouseHandler.GenerateWarehouseLocations).Methods("POST")
+	router.HandleFunc("/warehouses/{id:[0-9]+}/stock-take", warehouseHandler.CreateStockTake).Methods("POST")
 	router.HandleFunc("/warehouses/{id:[0-9]+}/products", warehouseHandler.GetWarehouseProducts).Methods("GET")
+	router.HandleFunc("/warehouses/{id:[0-9]+}/products/{productId:[0-9]+}", warehouseHandler.UpdateWarehouseProductLevels).Methods("PUT")
+	router.HandleFunc("/warehouses/{id:[0-9]+}/snapshot", warehouseHandler.GetWarehouseSnapshot).Methods("GET")
+	router.HandleFunc("/warehouses/{id:[0-9]+}/movement-summary", warehouseHandler.GetWarehouseMovementSummary).Methods("GET")
+	router.HandleFunc("/warehouses/{id:[0-9]+}/inventory-value", warehouseHandler.GetWarehouseInventoryValue).Methods("GET")
+	router.HandleFunc("/warehouses/{id:[0-9]+}/attention-stock", warehouseHandler.GetWarehouseAttentionStock).Methods("GET")
 	
 	// Warehouse Locations
 	router.HandleFunc("/locations", warehouseHandler.GetAllLocations).Methods("GET")
 	router.HandleFunc("/locations", warehouseHandler.CreateLocation).Methods("POST")
 	router.HandleFunc("/locations/{id:[0-9]+}", warehouseHandler.GetLocation).Methods("GET")
 	router.HandleFunc("/locations/{id:[0-9]+}", warehouseHandler.UpdateLocation).Methods("PUT")
-	router.HandleFunc("/locations/{id:[0-9]+}", warehouseHandler.DeleteLocation).Methods("DELETE")
+	managerOnly.HandleFunc("/locations/{id:[0-9]+}", warehouseHandler.DeleteLocation).Methods("DELETE")
+	managerOnly.HandleFunc("/locations/{id:[0-9]+}/restore", warehouseHandler.RestoreLocation).Methods("POST")
 	
 	// Inventory Transactions
-	transactionHandler := NewTransactionHandler(db)
+	transactionHandler := NewTransactionHandler(db, alerter)
 	router.HandleFunc("/transactions", transactionHandler.GetTransactions).Methods("GET")
 	router.HandleFunc("/transactions", transactionHandler.CreateTransaction).Methods("POST")
 	router.HandleFunc("/transactions/{id:[0-9]+}", transactionHandler.GetTransaction).Methods("GET")
+	router.HandleFunc("/transactions/stats", transactionHandler.GetTransactionStats).Methods("GET")
+	router.HandleFunc("/transactions/by-reference", transactionHandler.GetTransactionsByReference).Methods("GET")
 	router.HandleFunc("/transactions/product/{productId:[0-9]+}", transactionHandler.GetProductTransactions).Methods("GET")
 	router.HandleFunc("/transactions/receive", transactionHandler.CreateReceiveTransaction).Methods("POST")
 	router.HandleFunc("/transactions/issue", transactionHandler.CreateIssueTransaction).Methods("POST")
 	router.HandleFunc("/transactions/transfer", transactionHandler.CreateTransferTransaction).Methods("POST")
+	router.HandleFunc("/transactions/adjust", transactionHandler.CreateAdjustmentTransaction).Methods("POST")
+	
+	// Stock Alerts
+	stockAlertHandler := NewStockAlertHandler(db)
+	router.HandleFunc("/stock-alerts", stockAlertHandler.GetStockAlerts).Methods("GET")
+	router.HandleFunc("/stock-alerts/{id:[0-9]+}/acknowledge", stockAlertHandler.AcknowledgeStockAlert).Methods("POST")
+	
+	// Stock Count Sessions
+	stockCountHandler := NewStockCountHandler(db)
+	router.HandleFunc("/stock-count-sessions", stockCountHandler.GetStockCountSessions).Methods("GET")
+	router.HandleFunc("/stock-count-sessions", stockCountHandler.CreateStockCountSession).Methods("POST")
+	router.HandleFunc("/stock-count-sessions/{id:[0-9]+}", stockCountHandler.GetStockCountSession).Methods("GET")
+	router.HandleFunc("/stock-count-sessions/{id:[0-9]+}/counts", stockCountHandler.RecordStockCounts).Methods("POST")
+	managerOnly.HandleFunc("/stock-count-sessions/{id:[0-9]+}/close", stockCountHandler.CloseStockCountSession).Methods("POST")
 	
 	// Purchase Orders
 	purchaseHandler := NewPurchaseOrderHandler(db)
 	router.HandleFunc("/purchase-orders", purchaseHandler.GetPurchaseOrders).Methods("GET")
-	router.HandleFunc("/purchase-orders", purchaseHandler.CreatePurchaseOrder).Methods("POST")
+	router.HandleFunc("/purchase-orders", idempotent(db, "create_purchase_order", purchaseHandler.CreatePurchaseOrder)).Methods("POST")
 	router.HandleFunc("/purchase-orders/{id:[0-9]+}", purchaseHandler.GetPurchaseOrder).Methods("GET")
 	router.HandleFunc("/purchase-orders/{id:[0-9]+}", purchaseHandler.UpdatePurchaseOrder).Methods("PUT")
 	router.HandleFunc("/purchase-orders/{id:[0-9]+}", purchaseHandler.DeletePurchaseOrder).Methods("DELETE")
 	router.HandleFunc("/purchase-orders/{id:[0-9]+}/items", purchaseHandler.GetPurchaseOrderItems).Methods("GET")
 	router.HandleFunc("/purchase-orders/{id:[0-9]+}/items", purchaseHandler.AddPurchaseOrderItem).Methods("POST")
+	router.HandleFunc("/purchase-orders/{id:[0-9]+}/items/{itemId:[0-9]+}", purchaseHandler.UpdatePurchaseOrderItem).Methods("PUT")
+	router.HandleFunc("/purchase-orders/{id:[0-9]+}/items/{itemId:[0-9]+}", purchaseHandler.DeletePurchaseOrderItem).Methods("DELETE")
+	router.HandleFunc("/purchase-orders/{id:[0-9]+}/submit", purchaseHandler.SubmitPurchaseOrder).Methods("POST")
+	managerOnly.HandleFunc("/purchase-orders/{id:[0-9]+}/approve", purchaseHandler.ApprovePurchaseOrder).Methods("POST")
 	router.HandleFunc("/purchase-orders/{id:[0-9]+}/receive", purchaseHandler.ReceivePurchaseOrder).Methods("POST")
+	router.HandleFunc("/purchase-orders/{id:[0-9]+}/duplicate", purchaseHandler.DuplicatePurchaseOrder).Methods("POST")
+	router.HandleFunc("/purchase-orders/{id:[0-9]+}/split", purchaseHandler.SplitPurchaseOrder).Methods("POST")
+	router.HandleFunc("/purchase-orders/{id:[0-9]+}/hold", purchaseHandler.HoldPurchaseOrder).Methods("POST")
+	router.HandleFunc("/purchase-orders/{id:[0-9]+}/unhold", purchaseHandler.UnholdPurchaseOrder).Methods("POST")
+	router.HandleFunc("/suppliers/{id:[0-9]+}/bulk-receive", purchaseHandler.BulkReceivePurchaseOrders).Methods("POST")
 	
 	// Sales Orders
-	salesHandler := NewSalesOrderHandler(db)
+	salesHandler := NewSalesOrderHandler(db, alerter)
 	router.HandleFunc("/sales-orders", salesHandler.GetSalesOrders).Methods("GET")
-	router.HandleFunc("/sales-orders", salesHandler.CreateSalesOrder).Methods("POST")
+	router.HandleFunc("/sales-orders", idempotent(db, "create_sales_order", salesHandler.CreateSalesOrder)).Methods("POST")
+	router.HandleFunc("/sales-orders/bulk-status", salesHandler.BulkUpdateSalesOrderStatus).Methods("POST")
 	router.HandleFunc("/sales-orders/{id:[0-9]+}", salesHandler.GetSalesOrder).Methods("GET")
 	router.HandleFunc("/sales-orders/{id:[0-9]+}", salesHandler.UpdateSalesOrder).Methods("PUT")
 	router.HandleFunc("/sales-orders/{id:[0-9]+}", salesHandler.DeleteSalesOrder).Methods("DELETE")
 	router.HandleFunc("/sales-orders/{id:[0-9]+}/items", salesHandler.GetSalesOrderItems).Methods("GET")
 	router.HandleFunc("/sales-orders/{id:[0-9]+}/items", salesHandler.AddSalesOrderItem).Methods("POST")
+	router.HandleFunc("/sales-orders/{id:[0-9]+}/items/{itemId:[0-9]+}", salesHandler.UpdateSalesOrderItem).Methods("PUT")
+	router.HandleFunc("/sales-orders/{id:[0-9]+}/items/{itemId:[0-9]+}", salesHandler.DeleteSalesOrderItem).Methods("DELETE")
 	router.HandleFunc("/sales-orders/{id:[0-9]+}/fulfill", salesHandler.FulfillSalesOrder).Methods("POST")
+	router.HandleFunc("/sales-orders/{id:[0-9]+}/packing-slip", salesHandler.GetPackingSlip).Methods("GET")
+	router.HandleFunc("/sales-orders/{id:[0-9]+}/remaining", salesHandler.GetSalesOrderRemaining).Methods("GET")
+	router.HandleFunc("/sales-orders/{id:[0-9]+}/confirm", salesHandler.ConfirmSalesOrder).Methods("POST")
+	router.HandleFunc("/sales-orders/{id:[0-9]+}/reserve", salesHandler.ReserveSalesOrder).Methods("POST")
+	router.HandleFunc("/sales-orders/{id:[0-9]+}/duplicate", salesHandler.DuplicateSalesOrder).Methods("POST")
+	router.HandleFunc("/sales-orders/{id:[0-9]+}/hold", salesHandler.HoldSalesOrder).Methods("POST")
+	router.HandleFunc("/sales-orders/{id:[0-9]+}/unhold", salesHandler.UnholdSalesOrder).Methods("POST")
+	router.HandleFunc("/sales-orders/{id:[0-9]+}/shipping", salesHandler.UpdateSalesOrderShipping).Methods("PATCH")
+	
+	// Sales Order Templates
+	templateHandler := NewSalesOrderTemplateHandler(db)
+	router.HandleFunc("/sales-order-templates", templateHandler.GetSalesOrderTemplates).Methods("GET")
+	router.HandleFunc("/sales-order-templates", templateHandler.CreateSalesOrderTemplate).Methods("POST")
+	router.HandleFunc("/sales-order-templates/{id:[0-9]+}", templateHandler.GetSalesOrderTemplate).Methods("GET")
+	router.HandleFunc("/sales-order-templates/{id:[0-9]+}", templateHandler.UpdateSalesOrderTemplate).Methods("PUT")
+	router.HandleFunc("/sales-order-templates/{id:[0-9]+}", templateHandler.DeleteSalesOrderTemplate).Methods("DELETE")
+	router.HandleFunc("/sales-order-templates/{id:[0-9]+}/instantiate", templateHandler.InstantiateSalesOrderTemplate).Methods("POST")
 	
 	// Customers
 	customerHandler := NewCustomerHandler(db)
@@ -101,23 +223,37 @@ func RegisterProtectedRoutes(router *mux.Router, db *gorm.DB) {
 	router.HandleFunc("/customers", customerHandler.CreateCustomer).Methods("POST")
 	router.HandleFunc("/customers/{id:[0-9]+}", customerHandler.GetCustomer).Methods("GET")
 	router.HandleFunc("/customers/{id:[0-9]+}", customerHandler.UpdateCustomer).Methods("PUT")
-	router.HandleFunc("/customers/{id:[0-9]+}", customerHandler.DeleteCustomer).Methods("DELETE")
+	managerOnly.HandleFunc("/customers/{id:[0-9]+}", customerHandler.DeleteCustomer).Methods("DELETE")
+	managerOnly.HandleFunc("/customers/{id:[0-9]+}/restore", customerHandler.RestoreCustomer).Methods("POST")
 	router.HandleFunc("/customers/{id:[0-9]+}/sales-orders", customerHandler.GetCustomerSalesOrders).Methods("GET")
 	
 	// Users
 	userHandler := NewUserHandler(db)
 	router.HandleFunc("/users", userHandler.GetUsers).Methods("GET")
+	adminOnly.HandleFunc("/users", userHandler.CreateUser).Methods("POST")
 	router.HandleFunc("/users/{id:[0-9]+}", userHandler.GetUser).Methods("GET")
-	router.HandleFunc("/users/{id:[0-9]+}", userHandler.UpdateUser).Methods("PUT")
-	router.HandleFunc("/users/{id:[0-9]+}", userHandler.DeleteUser).Methods("DELETE")
+	adminOnly.HandleFunc("/users/{id:[0-9]+}", userHandler.UpdateUser).Methods("PUT")
+	adminOnly.HandleFunc("/users/{id:[0-9]+}", userHandler.DeleteUser).Methods("DELETE")
+	adminOnly.HandleFunc("/users/{id:[0-9]+}/restore", userHandler.RestoreUser).Methods("POST")
 	router.HandleFunc("/users/current", userHandler.GetCurrentUser).Methods("GET")
+	router.HandleFunc("/users/current/permissions", userHandler.GetCurrentUserPermissions).Methods("GET")
 	router.HandleFunc("/users/change-password", userHandler.ChangePassword).Methods("POST")
 	
 	// Reports
 	reportHandler := NewReportHandler(db)
 	router.HandleFunc("/reports/inventory-value", reportHandler.GetInventoryValueReport).Methods("GET")
+	router.HandleFunc("/reports/inventory-value-trend", reportHandler.GetInventoryValueTrend).Methods("GET")
+	router.HandleFunc("/reports/inventory-aging", reportHandler.GetInventoryAgingReport).Methods("GET")
 	router.HandleFunc("/reports/product-movement", reportHandler.GetProductMovementReport).Methods("GET")
 	router.HandleFunc("/reports/low-stock", reportHandler.GetLowStockReport).Methods("GET")
+	router.HandleFunc("/reports/reorder-recommendations", reportHandler.GetReorderRecommendations).Methods("GET")
 	router.HandleFunc("/reports/sales", reportHandler.GetSalesReport).Methods("GET")
+	router.HandleFunc("/reports/profit-margin", reportHandler.GetProfitMarginReport).Methods("GET")
 	router.HandleFunc("/reports/purchases", reportHandler.GetPurchasesReport).Methods("GET")
+	router.HandleFunc("/reports/transactions", reportHandler.GetTransactionExport).Methods("GET")
+	
+	// Audit logs
+	auditLogHandler := NewAuditLogHandler(db)
+	adminOnly.HandleFunc("/audit-logs", auditLogHandler.GetAuditLogs).Methods("GET")
+	adminOnly.HandleFunc("/audit-logs/export", auditLogHandler.ExportAuditLogs).Methods("GET")
 }
\ No newline at end of file
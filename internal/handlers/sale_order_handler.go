@@ -2,23 +2,31 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/yourusername/inventory-management-system/internal/alerts"
 	"github.com/yourusername/inventory-management-system/internal/models"
+	"github.com/yourusername/inventory-management-system/internal/repository"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // SalesOrderHandler handles HTTP requests for sales order endpoints
 type SalesOrderHandler struct {
-	db *gorm.DB
+	db      *gorm.DB
+	alerter alerts.StockAlerter
 }
 
-// NewSalesOrderHandler creates a new sales order handler
-func NewSalesOrderHandler(db *gorm.DB) *SalesOrderHandler {
-	return &SalesOrderHandler{db: db}
+// NewSalesOrderHandler creates a new sales order handler. alerter is notified when
+// fulfillment takes a product to or below its reorder level.
+func NewSalesOrderHandler(db *gorm.DB, alerter alerts.StockAlerter) *SalesOrderHandler {
+	return &SalesOrderHandler{db: db, alerter: alerter}
 }
 
 // GetSalesOrders handles GET requests to retrieve all sales orders
@@ -26,7 +34,7 @@ func (h *SalesOrderHandler) GetSalesOrders(w http.ResponseWriter, r *http.Reques
 	var orders []models.SalesOrder
 	
 	// Apply filters if any
-	query := h.db.Preload("Customer").Preload("Warehouse").Preload("User")
+	query := h.db.Model(&models.SalesOrder{})
 	
 	if status := r.URL.Query().Get("status"); status != "" {
 		query = query.Where("status = ?", status)
@@ -48,32 +56,32 @@ func (h *SalesOrderHandler) GetSalesOrders(w http.ResponseWriter, r *http.Reques
 		query = query.Where("order_date <= ?", endDate)
 	}
 	
-	// Apply pagination
-	page := 1
-	limit := 10
-	
-	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
-		if pageNum, err := strconv.Atoi(pageStr); err == nil && pageNum > 0 {
-			page = pageNum
-		}
-	}
-	
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-		if limitNum, err := strconv.Atoi(limitStr); err == nil && limitNum > 0 {
-			limit = limitNum
-		}
+	timestamps, err := parseTimestampFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidParameter, err.Error())
+		return
 	}
+	query = timestamps.apply(query, "sales_orders")
 	
+	// Apply pagination; the total is counted with the same filters
+	page, limit := parsePagination(r)
 	offset := (page - 1) * limit
 	
+	var total int64
+	if err := query.Session(&gorm.Session{}).Model(&models.SalesOrder{}).Count(&total).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to count sales orders: "+err.Error())
+		return
+	}
+	
 	// Execute query
-	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&orders).Error; err != nil {
-		http.Error(w, "Failed to retrieve sales orders: "+err.Error(), http.StatusInternalServerError)
+	if err := query.Preload("Customer", includeDeleted).Preload("Warehouse", includeDeleted).Preload("User", includeDeleted).
+		Order("created_at DESC").Limit(limit).Offset(offset).Find(&orders).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve sales orders: "+err.Error())
 		return
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(orders)
+	json.NewEncoder(w).Encode(newPaginatedResponse(orders, page, limit, total))
 }
 
 // GetSalesOrder handles GET requests to retrieve a single sales order
@@ -81,21 +89,22 @@ func (h *SalesOrderHandler) GetSalesOrder(w http.ResponseWriter, r *http.Request
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid sales order ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid sales order ID")
 		return
 	}
 	
 	var order models.SalesOrder
-	if err := h.db.Preload("Customer").Preload("Warehouse").Preload("User").Preload("Items").
-		Preload("Items.Product").First(&order, id).Error; err != nil {
+	if err := h.db.Preload("Customer", includeDeleted).Preload("Warehouse", includeDeleted).Preload("User", includeDeleted).Preload("Items").
+		Preload("Items.Product", includeDeleted).First(&order, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Sales order not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Sales order not found")
 		} else {
-			http.Error(w, "Failed to retrieve sales order: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve sales order: "+err.Error())
 		}
 		return
 	}
 	
+	setVersionETag(w, order.Version)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(order)
 }
@@ -105,13 +114,18 @@ func (h *SalesOrderHandler) CreateSalesOrder(w http.ResponseWriter, r *http.Requ
 	var order models.SalesOrder
 	
 	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
 		return
 	}
 	
 	// Validate required fields
 	if order.CustomerID == 0 || order.WarehouseID == 0 {
-		http.Error(w, "Customer ID and Warehouse ID are required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Customer ID and Warehouse ID are required")
+		return
+	}
+	
+	if !requireActiveReference(w, h.db, &models.Customer{}, order.CustomerID, "customer_id", "customer") ||
+		!requireActiveReference(w, h.db, &models.Warehouse{}, order.WarehouseID, "warehouse_id", "warehouse") {
 		return
 	}
 	
@@ -128,10 +142,34 @@ func (h *SalesOrderHandler) CreateSalesOrder(w http.ResponseWriter, r *http.Requ
 		order.PaymentStatus = "unpaid"
 	}
 	
+	// Default payment terms from the customer, then derive the due date
+	if order.PaymentTerms == "" {
+		var customer models.Customer
+		if err := h.db.First(&customer, order.CustomerID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				writeError(w, http.StatusBadRequest, errCodeInvalidReference, "Customer not found")
+			} else {
+				writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve customer: "+err.Error())
+			}
+			return
+		}
+		
+		order.PaymentTerms = customer.PaymentTerms
+		if order.PaymentTerms == "" {
+			order.PaymentTerms = models.DefaultPaymentTerms
+		}
+	}
+	
+	if !models.IsValidPaymentTerms(order.PaymentTerms) {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Invalid payment terms: "+order.PaymentTerms)
+		return
+	}
+	order.DueDate = models.PaymentDueDate(order.OrderDate, order.PaymentTerms)
+	
 	// Get user ID from context (set by auth middleware)
 	userID, ok := r.Context().Value("userID").(uint)
 	if !ok {
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
 		return
 	}
 	order.UserID = userID
@@ -149,9 +187,10 @@ func (h *SalesOrderHandler) CreateSalesOrder(w http.ResponseWriter, r *http.Requ
 	
 	// Create sales order in database
 	if err := h.db.Create(&order).Error; err != nil {
-		http.Error(w, "Failed to create sales order: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to create sales order: "+err.Error())
 		return
 	}
+	recordAudit(h.db, r, "create", "sales_order", order.ID, nil, order)
 	
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -163,7 +202,7 @@ func (h *SalesOrderHandler) UpdateSalesOrder(w http.ResponseWriter, r *http.Requ
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid sales order ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid sales order ID")
 		return
 	}
 	
@@ -171,45 +210,87 @@ func (h *SalesOrderHandler) UpdateSalesOrder(w http.ResponseWriter, r *http.Requ
 	var existingOrder models.SalesOrder
 	if err := h.db.First(&existingOrder, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Sales order not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Sales order not found")
 		} else {
-			http.Error(w, "Failed to retrieve sales order: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve sales order: "+err.Error())
 		}
 		return
 	}
 	
 	// Only draft orders can be updated
 	if existingOrder.Status != "draft" {
-		http.Error(w, "Only draft sales orders can be updated", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidState, "Only draft sales orders can be updated")
 		return
 	}
 	
 	// Parse request body
 	var updatedOrder models.SalesOrder
 	if err := json.NewDecoder(r.Body).Decode(&updatedOrder); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
 		return
 	}
 	
 	// Set the ID to ensure we're updating the correct record
 	updatedOrder.ID = uint(id)
 	
-	// Keep the original SO number
+	// Keep the original SO number; status and holds change only through their own endpoints
 	updatedOrder.SONumber = existingOrder.SONumber
+	updatedOrder.Status = ""
+	updatedOrder.HoldReason = ""
+	
+	expected, ok := expectedVersion(w, r, updatedOrder.Version, existingOrder.Version)
+	if !ok {
+		return
+	}
+	updatedOrder.Version = expected + 1
+	
+	// Recompute the due date when the terms or order date change
+	if updatedOrder.PaymentTerms != "" || !updatedOrder.OrderDate.IsZero() {
+		terms := existingOrder.PaymentTerms
+		if updatedOrder.PaymentTerms != "" {
+			if !models.IsValidPaymentTerms(updatedOrder.PaymentTerms) {
+				writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Invalid payment terms: "+updatedOrder.PaymentTerms)
+				return
+			}
+			terms = updatedOrder.PaymentTerms
+		}
+		
+		orderDate := existingOrder.OrderDate
+		if !updatedOrder.OrderDate.IsZero() {
+			orderDate = updatedOrder.OrderDate
+		}
+		
+		if terms != "" {
+			updatedOrder.DueDate = models.PaymentDueDate(orderDate, terms)
+		}
+	}
 	
-	// Update in database
-	if err := h.db.Model(&updatedOrder).Updates(updatedOrder).Error; err != nil {
-		http.Error(w, "Failed to update sales order: "+err.Error(), http.StatusInternalServerError)
+	// Totals are derived from the items; client-supplied values are ignored and the
+	// totals recomputed in case the shipping cost or billing changed
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&updatedOrder).Where("version = ?", expected).Omit("subtotal", "tax", "total_amount").Updates(updatedOrder)
+		if err := models.CheckVersion(result); err != nil {
+			return err
+		}
+		return models.UpdateSalesOrderTotals(tx, updatedOrder.ID)
+	}); err != nil {
+		if errors.Is(err, models.ErrVersionConflict) {
+			writeVersionConflict(w, h.db, &models.SalesOrder{}, updatedOrder.ID)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update sales order: "+err.Error())
 		return
 	}
 	
 	// Retrieve updated sales order with relationships
 	var finalOrder models.SalesOrder
-	if err := h.db.Preload("Customer").Preload("Warehouse").Preload("User").First(&finalOrder, id).Error; err != nil {
-		http.Error(w, "Failed to retrieve updated sales order: "+err.Error(), http.StatusInternalServerError)
+	if err := h.db.Preload("Customer", includeDeleted).Preload("Warehouse", includeDeleted).Preload("User", includeDeleted).First(&finalOrder, id).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve updated sales order: "+err.Error())
 		return
 	}
+	recordAudit(h.db, r, "update", "sales_order", finalOrder.ID, existingOrder, finalOrder)
 	
+	setVersionETag(w, finalOrder.Version)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(finalOrder)
 }
@@ -219,7 +300,7 @@ func (h *SalesOrderHandler) DeleteSalesOrder(w http.ResponseWriter, r *http.Requ
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid sales order ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid sales order ID")
 		return
 	}
 	
@@ -227,30 +308,30 @@ func (h *SalesOrderHandler) DeleteSalesOrder(w http.ResponseWriter, r *http.Requ
 	var order models.SalesOrder
 	if err := h.db.First(&order, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Sales order not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Sales order not found")
 		} else {
-			http.Error(w, "Failed to retrieve sales order: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve sales order: "+err.Error())
 		}
 		return
 	}
 	
 	// Only draft orders can be deleted
 	if order.Status != "draft" {
-		http.Error(w, "Only draft sales orders can be deleted", http.StatusBadRequest)
-		return
-	}
-	
-	// Delete the order items first
-	if err := h.db.Where("sales_order_id = ?", id).Delete(&models.SalesOrderItem{}).Error; err != nil {
-		http.Error(w, "Failed to delete sales order items: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusBadRequest, errCodeInvalidState, "Only draft sales orders can be deleted")
 		return
 	}
 	
-	// Delete the order
-	if err := h.db.Delete(&order).Error; err != nil {
-		http.Error(w, "Failed to delete sales order: "+err.Error(), http.StatusInternalServerError)
+	// Delete the order items and the order together
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("sales_order_id = ?", id).Delete(&models.SalesOrderItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&order).Error
+	}); err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to delete sales order: "+err.Error())
 		return
 	}
+	recordAudit(h.db, r, "delete", "sales_order", order.ID, order, nil)
 	
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -260,7 +341,7 @@ func (h *SalesOrderHandler) GetSalesOrderItems(w http.ResponseWriter, r *http.Re
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid sales order ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid sales order ID")
 		return
 	}
 	
@@ -268,9 +349,9 @@ func (h *SalesOrderHandler) GetSalesOrderItems(w http.ResponseWriter, r *http.Re
 	var order models.SalesOrder
 	if err := h.db.First(&order, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Sales order not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Sales order not found")
 		} else {
-			http.Error(w, "Failed to retrieve sales order: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve sales order: "+err.Error())
 		}
 		return
 	}
@@ -278,7 +359,7 @@ func (h *SalesOrderHandler) GetSalesOrderItems(w http.ResponseWriter, r *http.Re
 	// Get items
 	var items []models.SalesOrderItem
 	if err := h.db.Preload("Product").Where("sales_order_id = ?", id).Find(&items).Error; err != nil {
-		http.Error(w, "Failed to retrieve items: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve items: "+err.Error())
 		return
 	}
 	
@@ -291,7 +372,7 @@ func (h *SalesOrderHandler) AddSalesOrderItem(w http.ResponseWriter, r *http.Req
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid sales order ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid sales order ID")
 		return
 	}
 	
@@ -299,29 +380,29 @@ func (h *SalesOrderHandler) AddSalesOrderItem(w http.ResponseWriter, r *http.Req
 	var order models.SalesOrder
 	if err := h.db.First(&order, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Sales order not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Sales order not found")
 		} else {
-			http.Error(w, "Failed to retrieve sales order: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve sales order: "+err.Error())
 		}
 		return
 	}
 	
 	// Only draft orders can be modified
 	if order.Status != "draft" {
-		http.Error(w, "Only draft sales orders can be modified", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidState, "Only draft sales orders can be modified")
 		return
 	}
 	
 	// Parse request body
 	var item models.SalesOrderItem
 	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
 		return
 	}
 	
 	// Validate item
 	if item.ProductID == 0 || item.Quantity <= 0 || item.UnitPrice <= 0 {
-		http.Error(w, "Product ID, quantity, and unit price are required and must be positive", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Product ID, quantity, and unit price are required and must be positive")
 		return
 	}
 	
@@ -329,42 +410,51 @@ func (h *SalesOrderHandler) AddSalesOrderItem(w http.ResponseWriter, r *http.Req
 	var product models.Product
 	if err := h.db.First(&product, item.ProductID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Product not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Product not found")
 		} else {
-			http.Error(w, "Failed to retrieve product: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve product: "+err.Error())
 		}
 		return
 	}
 	
-	if product.Quantity < item.Quantity {
-		http.Error(w, "Insufficient stock available", http.StatusBadRequest)
+	available, err := models.AvailableQuantity(h.db, product.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to check available stock: "+err.Error())
 		return
 	}
 	
-	// Set sales order ID and calculate total price
-	item.SalesOrderID = uint(id)
-	item.TotalPrice = float64(item.Quantity) * item.UnitPrice * (1 - item.Discount/100)
+	if available < item.Quantity {
+		writeError(w, http.StatusBadRequest, errCodeInsufficientStock, "Insufficient stock available in any warehouse")
+		return
+	}
+	
+	// The order ships from a single warehouse, so stock held elsewhere can't fill it
+	warehouseAvailable, tracked, err := models.WarehouseAvailableQuantity(h.db, product.ID, order.WarehouseID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to check warehouse stock: "+err.Error())
+		return
+	}
 	
-	// Create item in database
-	if err := h.db.Create(&item).Error; err != nil {
-		http.Error(w, "Failed to add item: "+err.Error(), http.StatusInternalServerError)
+	if tracked && warehouseAvailable < item.Quantity {
+		writeError(w, http.StatusBadRequest, errCodeInsufficientStock, fmt.Sprintf("Insufficient stock at this order's warehouse (%d available there)", warehouseAvailable))
 		return
 	}
 	
-	// Update the sales order's total amount
-	var subtotal float64
-	h.db.Model(&models.SalesOrderItem{}).Where("sales_order_id = ?", id).
-		Select("SUM(total_price)").Scan(&subtotal)
+	if rejectMarginIssue(w, r, marginIssue(&item, &product)) {
+		return
+	}
 	
-	// Calculate tax and shipping cost
-	tax := subtotal * 0.1 // Assuming 10% tax rate
+	// Set sales order ID; the line total is calculated by the item hooks
+	item.SalesOrderID = uint(id)
 	
-	// Update sales order
-	h.db.Model(&order).Updates(map[string]interface{}{
-		"subtotal": subtotal,
-		"tax": tax,
-		"total_amount": subtotal + tax + order.ShippingCost,
-	})
+	// Create the item and recompute the order totals in one transaction,
+	// so the order can never be left out of step with its items
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		return tx.Create(&item).Error
+	}); err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to add item: "+err.Error())
+		return
+	}
 	
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -376,25 +466,31 @@ func (h *SalesOrderHandler) FulfillSalesOrder(w http.ResponseWriter, r *http.Req
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid sales order ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid sales order ID")
 		return
 	}
 	
 	// Check if sales order exists
 	var order models.SalesOrder
-	if err := h.db.Preload("Items").Preload("Items.Product").Preload("Warehouse").
+	if err := h.db.Preload("Items").Preload("Items.Product", includeDeleted).Preload("Warehouse", includeDeleted).
 		First(&order, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Sales order not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Sales order not found")
 		} else {
-			http.Error(w, "Failed to retrieve sales order: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve sales order: "+err.Error())
 		}
 		return
 	}
 	
 	// Only confirmed orders can be fulfilled
 	if order.Status != "confirmed" && order.Status != "partial" {
-		http.Error(w, "Only confirmed or partially fulfilled sales orders can be fulfilled", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidState, "Only confirmed or partially fulfilled sales orders can be fulfilled")
+		return
+	}
+	
+	// Orders on hold must be released before fulfillment
+	if order.OnHold {
+		writeError(w, http.StatusBadRequest, errCodeInvalidState, "Sales order is on hold and cannot be fulfilled: "+order.HoldReason)
 		return
 	}
 	
@@ -403,20 +499,21 @@ func (h *SalesOrderHandler) FulfillSalesOrder(w http.ResponseWriter, r *http.Req
 		Items []struct {
 			ItemID         uint `json:"item_id"`
 			QuantityFulfilled int  `json:"quantity_fulfilled"`
+			LocationID     *uint `json:"location_id"` // Where the line is picked from; required when the warehouse has locations
 		} `json:"items"`
 		ShippingDate *time.Time `json:"shipping_date,omitempty"`
 		Notes        string     `json:"notes"`
 	}
 	
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
 		return
 	}
 	
 	// Get user ID from context (set by auth middleware)
 	userID, ok := r.Context().Value("userID").(uint)
 	if !ok {
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
 		return
 	}
 	
@@ -424,7 +521,35 @@ func (h *SalesOrderHandler) FulfillSalesOrder(w http.ResponseWriter, r *http.Req
 	tx := h.db.Begin()
 	
 	if tx.Error != nil {
-		http.Error(w, "Failed to start database transaction: "+tx.Error.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to start database transaction: "+tx.Error.Error())
+		return
+	}
+	
+	// Lock the order and its items so concurrent fulfillments can't both ship the same
+	// outstanding quantity, then re-check against the locked rows
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, id).Error; err != nil {
+		tx.Rollback()
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to lock sales order: "+err.Error())
+		return
+	}
+	
+	if order.Status != "confirmed" && order.Status != "partial" {
+		tx.Rollback()
+		writeError(w, http.StatusBadRequest, errCodeInvalidState, "Only confirmed or partially fulfilled sales orders can be fulfilled")
+		return
+	}
+	
+	if order.OnHold {
+		tx.Rollback()
+		writeError(w, http.StatusBadRequest, errCodeInvalidState, "Sales order is on hold and cannot be fulfilled: "+order.HoldReason)
+		return
+	}
+	
+	order.Items = nil
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("sales_order_id = ?", id).Order("id").Find(&order.Items).Error; err != nil {
+		tx.Rollback()
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to lock sales order items: "+err.Error())
 		return
 	}
 	
@@ -432,74 +557,159 @@ func (h *SalesOrderHandler) FulfillSalesOrder(w http.ResponseWriter, r *http.Req
 	totalFulfilled := 0
 	totalOrdered := 0
 	
+	// Products this fulfillment takes to their reorder level, alerted once it commits
+	var lowStock []models.Product
+	
 	for _, requestItem := range request.Items {
 		// Find the item in the sales order
-		var item models.SalesOrderItem
-		found := false
+		var item *models.SalesOrderItem
 		
-		for _, orderItem := range order.Items {
-			if orderItem.ID == requestItem.ItemID {
-				item = orderItem
-				found = true
+		for i := range order.Items {
+			if order.Items[i].ID == requestItem.ItemID {
+				item = &order.Items[i]
 				break
 			}
 		}
 		
-		if !found {
+		if item == nil {
 			tx.Rollback()
-			http.Error(w, "Item not found in sales order", http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, errCodeInvalidReference, "Item not found in sales order")
 			return
 		}
 		
-		if requestItem.QuantityFulfilled <= 0 || requestItem.QuantityFulfilled > item.Quantity {
+		// Never fulfill more than is still outstanding on the line
+		if requestItem.QuantityFulfilled <= 0 || requestItem.QuantityFulfilled > item.Quantity-item.QuantityFulfilled {
 			tx.Rollback()
-			http.Error(w, "Invalid quantity fulfilled", http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Invalid quantity fulfilled")
 			return
 		}
 		
-		// Check if enough stock is available
-		var product models.Product
-		if err := tx.First(&product, item.ProductID).Error; err != nil {
+		if err := tx.Model(item).
+			UpdateColumn("quantity_fulfilled", gorm.Expr("quantity_fulfilled + ?", requestItem.QuantityFulfilled)).Error; err != nil {
 			tx.Rollback()
-			http.Error(w, "Failed to retrieve product: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update fulfilled quantity: "+err.Error())
 			return
 		}
+		item.QuantityFulfilled += requestItem.QuantityFulfilled
 		
-		if product.Quantity < requestItem.QuantityFulfilled {
+		var product models.Product
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, item.ProductID).Error; err != nil {
 			tx.Rollback()
-			http.Error(w, "Insufficient stock for product: "+product.Name, http.StatusBadRequest)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve product: "+err.Error())
 			return
 		}
 		
-		// Update product quantity
-		if err := tx.Model(&product).Update("quantity", product.Quantity-requestItem.QuantityFulfilled).Error; err != nil {
+		// Consume the stock reserved at confirmation for this line
+		var reservation models.StockReservation
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("sales_order_item_id = ? AND status = ?", item.ID, "active").
+			First(&reservation).Error
+		if err == nil {
+			if reservation.Quantity < requestItem.QuantityFulfilled {
+				tx.Rollback()
+				writeError(w, http.StatusBadRequest, errCodeInsufficientStock, "Quantity fulfilled exceeds reserved stock for product: "+product.Name)
+				return
+			}
+			
+			reservationUpdates := map[string]interface{}{"quantity": reservation.Quantity - requestItem.QuantityFulfilled}
+			if reservation.Quantity == requestItem.QuantityFulfilled {
+				reservationUpdates["status"] = "consumed"
+			}
+			if err := tx.Model(&reservation).Updates(reservationUpdates).Error; err != nil {
+				tx.Rollback()
+				writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update stock reservation: "+err.Error())
+				return
+			}
+		} else if err == gorm.ErrRecordNotFound {
+			// Orders confirmed before reservations existed draw on unreserved stock
+			available, err := models.AvailableQuantity(tx, product.ID)
+			if err != nil {
+				tx.Rollback()
+				writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to check available stock: "+err.Error())
+				return
+			}
+			
+			if available < requestItem.QuantityFulfilled {
+				tx.Rollback()
+				writeError(w, http.StatusBadRequest, errCodeInsufficientStock, "Insufficient stock for product: "+product.Name)
+				return
+			}
+		} else {
 			tx.Rollback()
-			http.Error(w, "Failed to update product quantity: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve stock reservation: "+err.Error())
 			return
 		}
 		
-		// Create inventory transaction
-		transaction := models.InventoryTransaction{
-			ProductID:         item.ProductID,
-			WarehouseID:       order.WarehouseID,
-			Type:              "issue",
-			Quantity:          requestItem.QuantityFulfilled,
-			ReferenceNumber:   order.SONumber,
-			UserID:            userID,
-			Notes:             "Fulfilled from sales order: " + order.SONumber,
-		}
-		
-		if err := tx.Create(&transaction).Error; err != nil {
+		// A bundle ships as its components, so their stock is issued rather than the bundle's
+		issued, err := models.ExpandBundle(tx, product.ID, requestItem.QuantityFulfilled)
+		if err != nil {
 			tx.Rollback()
-			http.Error(w, "Failed to create inventory transaction: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to expand bundle: "+err.Error())
 			return
 		}
 		
-		totalFulfilled += requestItem.QuantityFulfilled
+		issuedIDs := make([]uint, 0, len(issued))
+		for productID := range issued {
+			issuedIDs = append(issuedIDs, productID)
+		}
+		sort.Slice(issuedIDs, func(i, j int) bool { return issuedIDs[i] < issuedIDs[j] })
+		
+		for _, productID := range issuedIDs {
+			notes := "Fulfilled from sales order: " + order.SONumber
+			if productID != product.ID {
+				notes = "Fulfilled as part of bundle " + product.SKU + " from sales order: " + order.SONumber
+			}
+			
+			// Update product quantity
+			if err := tx.Model(&models.Product{}).Where("id = ?", productID).
+				UpdateColumn("quantity", gorm.Expr("quantity - ?", issued[productID])).Error; err != nil {
+				tx.Rollback()
+				writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update product quantity: "+err.Error())
+				return
+			}
+			
+			crossed, err := repository.LowStockCrossing(tx, productID, issued[productID])
+			if err != nil {
+				tx.Rollback()
+				writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to check reorder level: "+err.Error())
+				return
+			}
+			if crossed != nil {
+				lowStock = append(lowStock, *crossed)
+			}
+			
+			// Create inventory transaction
+			transaction := models.InventoryTransaction{
+				ProductID:         productID,
+				WarehouseID:       order.WarehouseID,
+				SourceLocationID:  requestItem.LocationID,
+				Type:              "issue",
+				Quantity:          issued[productID],
+				ReferenceNumber:   order.SONumber,
+				UserID:            userID,
+				Notes:             notes,
+			}
+			
+			if err := tx.Create(&transaction).Error; err != nil {
+				tx.Rollback()
+				writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to create inventory transaction: "+err.Error())
+				return
+			}
+			
+			if err := repository.ApplyLocationStock(tx, &transaction); err != nil {
+				tx.Rollback()
+				writeLocationStockError(w, fmt.Errorf("item %d: %w", item.ID, err), "Failed to update location stock")
+				return
+			}
+		}
+	}
+	
+	// Update sales order status and shipping date; the order is fulfilled once every line is
+	for _, item := range order.Items {
+		totalFulfilled += item.QuantityFulfilled
 		totalOrdered += item.Quantity
 	}
 	
-	// Update sales order status and shipping date
 	updates := map[string]interface{}{}
 	
 	if totalFulfilled == totalOrdered {
@@ -516,24 +726,1134 @@ func (h *SalesOrderHandler) FulfillSalesOrder(w http.ResponseWriter, r *http.Req
 	
 	if err := tx.Model(&order).Updates(updates).Error; err != nil {
 		tx.Rollback()
-		http.Error(w, "Failed to update sales order: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update sales order: "+err.Error())
 		return
 	}
 	
 	// Commit the transaction
 	if err := tx.Commit().Error; err != nil {
-		http.Error(w, "Failed to commit transaction: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to commit transaction: "+err.Error())
+		return
+	}
+	
+	for _, product := range lowStock {
+		h.alerter.Notify(product, product.Quantity)
+	}
+	
+	// Return updated sales order
+	var updatedOrder models.SalesOrder
+	if err := h.db.Preload("Items").Preload("Items.Product", includeDeleted).Preload("Customer", includeDeleted).
+		Preload("Warehouse", includeDeleted).Preload("User", includeDeleted).First(&updatedOrder, id).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve updated sales order: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updatedOrder)
+}
+
+// DuplicateSalesOrder handles POST requests to create a new draft sales order from an existing one
+func (h *SalesOrderHandler) DuplicateSalesOrder(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid sales order ID")
+		return
+	}
+	
+	// Load the source order with its line items
+	var source models.SalesOrder
+	if err := h.db.Preload("Items").First(&source, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Sales order not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve sales order: "+err.Error())
+		}
+		return
+	}
+	
+	// Get user ID from context (set by auth middleware)
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
+		return
+	}
+	
+	// Copy the header; the SO number is left empty so a fresh one is generated
+	order := models.SalesOrder{
+		CustomerID:    source.CustomerID,
+		WarehouseID:   source.WarehouseID,
+		OrderDate:     time.Now(),
+		Status:        "draft",
+		ShippingCost:  source.ShippingCost,
+		ShippingCarrier: source.ShippingCarrier,
+		ShippingMethod:  source.ShippingMethod,
+		ShippingBilledToCustomer: source.ShippingBilledToCustomer,
+		PaymentStatus: "unpaid",
+		PaymentTerms:  source.PaymentTerms,
+		UserID:        userID,
+	}
+	if order.PaymentTerms != "" {
+		order.DueDate = models.PaymentDueDate(order.OrderDate, order.PaymentTerms)
+	}
+	
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&order).Error; err != nil {
+			return err
+		}
+		
+		// Copy line items; the item hooks keep the order totals in sync
+		for _, sourceItem := range source.Items {
+			item := models.SalesOrderItem{
+				SalesOrderID: order.ID,
+				ProductID:    sourceItem.ProductID,
+				Quantity:     sourceItem.Quantity,
+				UnitPrice:    sourceItem.UnitPrice,
+				Discount:     sourceItem.Discount,
+			}
+			if err := tx.Create(&item).Error; err != nil {
+				return err
+			}
+		}
+		
+		return nil
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to duplicate sales order: "+err.Error())
+		return
+	}
+	
+	// Return the new sales order with relationships
+	var newOrder models.SalesOrder
+	if err := h.db.Preload("Items").Preload("Items.Product", includeDeleted).Preload("Customer", includeDeleted).
+		Preload("Warehouse", includeDeleted).Preload("User", includeDeleted).First(&newOrder, order.ID).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve new sales order: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newOrder)
+}
+
+// HoldSalesOrder handles POST requests to put a sales order on hold
+func (h *SalesOrderHandler) HoldSalesOrder(w http.ResponseWriter, r *http.Request) {
+	h.setSalesOrderHold(w, r, true)
+}
+
+// UnholdSalesOrder handles POST requests to release a sales order from hold
+func (h *SalesOrderHandler) UnholdSalesOrder(w http.ResponseWriter, r *http.Request) {
+	h.setSalesOrderHold(w, r, false)
+}
+
+// setSalesOrderHold places or releases a hold without changing the order's status
+func (h *SalesOrderHandler) setSalesOrderHold(w http.ResponseWriter, r *http.Request, hold bool) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid sales order ID")
+		return
+	}
+	
+	// Get user ID from context (set by auth middleware)
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
+		return
+	}
+	
+	// Check if sales order exists
+	var order models.SalesOrder
+	if err := h.db.First(&order, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Sales order not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve sales order: "+err.Error())
+		}
+		return
+	}
+	
+	var request struct {
+		Reason string `json:"reason"`
+	}
+	
+	if hold {
+		// Closed orders have nothing left to hold
+		if order.Status == "fulfilled" || order.Status == "cancelled" {
+			writeError(w, http.StatusBadRequest, errCodeInvalidState, "Fulfilled or cancelled sales orders cannot be put on hold")
+			return
+		}
+		
+		if order.OnHold {
+			writeError(w, http.StatusBadRequest, errCodeInvalidState, "Sales order is already on hold")
+			return
+		}
+		
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+			return
+		}
+		
+		if request.Reason == "" {
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Hold reason is required")
+			return
+		}
+	} else if !order.OnHold {
+		writeError(w, http.StatusBadRequest, errCodeInvalidState, "Sales order is not on hold")
+		return
+	}
+	
+	action := "hold"
+	if !hold {
+		action = "unhold"
+	}
+	oldValues, _ := json.Marshal(map[string]interface{}{"on_hold": order.OnHold, "hold_reason": order.HoldReason})
+	newValues, _ := json.Marshal(map[string]interface{}{"on_hold": hold, "hold_reason": request.Reason})
+	
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&order).Updates(map[string]interface{}{
+			"on_hold":     hold,
+			"hold_reason": request.Reason,
+		}).Error; err != nil {
+			return err
+		}
+		
+		return models.CreateAuditLog(tx, userID, action, "sales_order", order.ID, string(oldValues), string(newValues), clientIP(r))
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update sales order hold: "+err.Error())
 		return
 	}
 	
 	// Return updated sales order
 	var updatedOrder models.SalesOrder
-	if err := h.db.Preload("Items").Preload("Items.Product").Preload("Customer").
-		Preload("Warehouse").Preload("User").First(&updatedOrder, id).Error; err != nil {
-		http.Error(w, "Failed to retrieve updated sales order: "+err.Error(), http.StatusInternalServerError)
+	if err := h.db.Preload("Items").Preload("Items.Product", includeDeleted).Preload("Customer", includeDeleted).
+		Preload("Warehouse", includeDeleted).Preload("User", includeDeleted).First(&updatedOrder, id).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve updated sales order: "+err.Error())
 		return
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(updatedOrder)
+}
+
+// UpdateSalesOrderShipping handles PATCH requests to change a sales order's shipping details
+func (h *SalesOrderHandler) UpdateSalesOrderShipping(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid sales order ID")
+		return
+	}
+	
+	// Check if sales order exists
+	var order models.SalesOrder
+	if err := h.db.First(&order, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Sales order not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve sales order: "+err.Error())
+		}
+		return
+	}
+	
+	// Shipping can change until the order starts being fulfilled
+	if order.Status != "draft" && order.Status != "confirmed" {
+		writeError(w, http.StatusBadRequest, errCodeInvalidState, "Shipping can only be changed on draft or confirmed sales orders")
+		return
+	}
+	
+	// Parse request body; pointers tell an explicit zero apart from an omitted field
+	var request struct {
+		ShippingCost    *float64 `json:"shipping_cost"`
+		ShippingCarrier *string  `json:"shipping_carrier"`
+		ShippingMethod  *string  `json:"shipping_method"`
+		ShippingBilledToCustomer *bool `json:"shipping_billed_to_customer"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	
+	if request.ShippingCost == nil {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Shipping cost is required")
+		return
+	}
+	
+	if *request.ShippingCost < 0 {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Shipping cost cannot be negative")
+		return
+	}
+	
+	// A map is used so a zero shipping cost is written rather than skipped
+	updates := map[string]interface{}{
+		"shipping_cost": *request.ShippingCost,
+	}
+	if request.ShippingCarrier != nil {
+		updates["shipping_carrier"] = *request.ShippingCarrier
+	}
+	if request.ShippingMethod != nil {
+		updates["shipping_method"] = *request.ShippingMethod
+	}
+	if request.ShippingBilledToCustomer != nil {
+		updates["shipping_billed_to_customer"] = *request.ShippingBilledToCustomer
+	}
+	
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&order).Updates(updates).Error; err != nil {
+			return err
+		}
+		return models.UpdateSalesOrderTotals(tx, order.ID)
+	}); err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update shipping: "+err.Error())
+		return
+	}
+	
+	if err := h.db.First(&order, id).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve updated sales order: "+err.Error())
+		return
+	}
+	
+	response := salesOrderTotals(order)
+	response["shipping_carrier"] = order.ShippingCarrier
+	response["shipping_method"] = order.ShippingMethod
+	response["shipping_billed_to_customer"] = order.IsShippingBilledToCustomer()
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// confirmationIssue is a problem found while confirming a sales order.
+// Errors block confirmation; warnings only need to be acknowledged.
+type confirmationIssue struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	ItemID  uint   `json:"item_id,omitempty"`
+}
+
+// marginIssue checks a line's net price against the product's minimum margin over cost.
+// It returns nil when the line is priced high enough or the product has no cost price.
+func marginIssue(item *models.SalesOrderItem, product *models.Product) *confirmationIssue {
+	minimum := models.MinimumNetPrice(product)
+	netPrice := item.NetUnitPrice()
+	if minimum == 0 || netPrice >= minimum {
+		return nil
+	}
+	
+	return &confirmationIssue{
+		Code:    "THIN_MARGIN",
+		Message: fmt.Sprintf("%s sells at %.2f against a cost of %.2f; the minimum margin needs at least %.2f", product.SKU, netPrice, product.CostPrice, minimum),
+		ItemID:  item.ID,
+	}
+}
+
+// rejectMarginIssue answers a line edit that breaks the minimum margin: with 400 when the
+// guardrail blocks, or 409 until the warning is acknowledged. It reports whether it wrote
+// a response; acknowledged warnings let the edit through.
+func rejectMarginIssue(w http.ResponseWriter, r *http.Request, issue *confirmationIssue) bool {
+	if issue == nil {
+		return false
+	}
+	
+	if models.CurrentMarginEnforcement() == models.MarginBlock {
+		writeErrorDetails(w, http.StatusBadRequest, errCodeValidationFailed, issue.Message, map[string]interface{}{
+			"errors": []confirmationIssue{*issue},
+		})
+		return true
+	}
+	
+	if r.URL.Query().Get("acknowledge_warnings") == "true" || r.URL.Query().Get("force") == "true" {
+		return false
+	}
+	
+	writeErrorDetails(w, http.StatusConflict, errCodeUnacknowledgedWarnings, "Line is below the minimum margin; retry with acknowledge_warnings=true to proceed", map[string]interface{}{
+		"warnings": []confirmationIssue{*issue},
+	})
+	return true
+}
+
+// ConfirmSalesOrder handles POST requests to confirm a draft sales order.
+// Missing items and insufficient stock block confirmation. Lines below the minimum
+// margin and exceeding the customer's credit limit are returned as warnings, and the
+// order is only confirmed past them with ?acknowledge_warnings=true (or ?force=true).
+// When margin enforcement is "block", margin violations are errors instead.
+func (h *SalesOrderHandler) ConfirmSalesOrder(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid sales order ID")
+		return
+	}
+	
+	// Check if sales order exists
+	var order models.SalesOrder
+	if err := h.db.Preload("Items").Preload("Items.Product").Preload("Customer", includeDeleted).First(&order, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Sales order not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve sales order: "+err.Error())
+		}
+		return
+	}
+	
+	// Only draft orders can be confirmed
+	if order.Status != "draft" {
+		writeError(w, http.StatusBadRequest, errCodeInvalidState, "Only draft sales orders can be confirmed")
+		return
+	}
+	
+	if order.OnHold {
+		writeError(w, http.StatusBadRequest, errCodeInvalidState, "Sales order is on hold and cannot be confirmed: "+order.HoldReason)
+		return
+	}
+	
+	acknowledged := r.URL.Query().Get("acknowledge_warnings") == "true" || r.URL.Query().Get("force") == "true"
+	
+	errs := []confirmationIssue{}
+	warnings := []confirmationIssue{}
+	
+	if len(order.Items) == 0 {
+		errs = append(errs, confirmationIssue{Code: "NO_ITEMS", Message: "Sales order has no items"})
+	}
+	
+	for _, item := range order.Items {
+		if item.Product == nil {
+			continue
+		}
+		
+		available, err := models.AvailableQuantity(h.db, item.ProductID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to check available stock: "+err.Error())
+			return
+		}
+		
+		if available < item.Quantity {
+			errs = append(errs, confirmationIssue{
+				Code:    "INSUFFICIENT_STOCK",
+				Message: fmt.Sprintf("Only %d of %d units of %s available", available, item.Quantity, item.Product.SKU),
+				ItemID:  item.ID,
+			})
+		}
+		
+		if issue := marginIssue(&item, item.Product); issue != nil {
+			if models.CurrentMarginEnforcement() == models.MarginBlock {
+				errs = append(errs, *issue)
+			} else {
+				warnings = append(warnings, *issue)
+			}
+		}
+	}
+	
+	// Credit check: unpaid open orders plus this one against the customer's limit
+	if order.Customer != nil && order.Customer.CreditLimit > 0 {
+		var outstanding float64
+		if err := h.db.Model(&models.SalesOrder{}).
+			Where("customer_id = ? AND id <> ? AND status NOT IN ? AND payment_status <> ?", order.CustomerID, order.ID, []string{"draft", "cancelled"}, "paid").
+			Select("COALESCE(SUM(total_amount), 0)").
+			Scan(&outstanding).Error; err != nil {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to check customer credit: "+err.Error())
+			return
+		}
+		
+		if outstanding+order.TotalAmount > order.Customer.CreditLimit {
+			warnings = append(warnings, confirmationIssue{
+				Code:    "CREDIT_LIMIT_EXCEEDED",
+				Message: fmt.Sprintf("Customer exposure of %.2f would exceed the credit limit of %.2f", outstanding+order.TotalAmount, order.Customer.CreditLimit),
+			})
+		}
+	}
+	
+	if len(errs) > 0 {
+		writeErrorDetails(w, http.StatusBadRequest, errCodeValidationFailed, "Sales order cannot be confirmed", map[string]interface{}{
+			"confirmed": false,
+			"errors":    errs,
+			"warnings":  warnings,
+		})
+		return
+	}
+	
+	if len(warnings) > 0 && !acknowledged {
+		writeErrorDetails(w, http.StatusConflict, errCodeUnacknowledgedWarnings, "Confirmation has warnings; retry with acknowledge_warnings=true to proceed", map[string]interface{}{
+			"confirmed": false,
+			"warnings":  warnings,
+		})
+		return
+	}
+	
+	// Stock may have been taken since the checks above; reserving re-checks it under lock
+	short, err := h.reserveSalesOrder(&order)
+	if errors.Is(err, errSalesOrderNotReservable) {
+		writeError(w, http.StatusConflict, errCodeInvalidState, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to confirm sales order: "+err.Error())
+		return
+	}
+	
+	if len(short) > 0 {
+		writeErrorDetails(w, http.StatusConflict, errCodeInsufficientStock, "Insufficient available stock to reserve", map[string]interface{}{
+			"confirmed":      false,
+			"short_products": short,
+		})
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"confirmed": true,
+		"warnings":  warnings,
+		"order":     order,
+	})
+}
+
+// shortProduct is a product without enough available stock to reserve for an order
+type shortProduct struct {
+	ProductID uint   `json:"product_id"`
+	SKU       string `json:"sku"`
+	Required  int    `json:"required"`
+	Available int    `json:"available"`
+}
+
+// ReserveSalesOrder handles POST requests to move a draft sales order to confirmed, reserving
+// stock for each line. Reserved stock stays in Product.Quantity but no longer counts as
+// available to other orders. Returns 409 with the short products if any line can't be
+// reserved. Unlike ConfirmSalesOrder it does not raise margin or credit warnings, though a
+// blocking minimum margin still rejects the order.
+func (h *SalesOrderHandler) ReserveSalesOrder(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid sales order ID")
+		return
+	}
+	
+	// Check if sales order exists
+	var order models.SalesOrder
+	if err := h.db.Preload("Items").Preload("Items.Product").First(&order, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Sales order not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve sales order: "+err.Error())
+		}
+		return
+	}
+	
+	if order.Status != "draft" {
+		writeError(w, http.StatusBadRequest, errCodeInvalidState, "Only draft sales orders can be reserved")
+		return
+	}
+	
+	if order.OnHold {
+		writeError(w, http.StatusBadRequest, errCodeInvalidState, "Sales order is on hold and cannot be confirmed: "+order.HoldReason)
+		return
+	}
+	
+	if len(order.Items) == 0 {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Sales order has no items")
+		return
+	}
+	
+	if models.CurrentMarginEnforcement() == models.MarginBlock {
+		errs := []confirmationIssue{}
+		for _, item := range order.Items {
+			if item.Product == nil {
+				continue
+			}
+			if issue := marginIssue(&item, item.Product); issue != nil {
+				errs = append(errs, *issue)
+			}
+		}
+		
+		if len(errs) > 0 {
+			writeErrorDetails(w, http.StatusBadRequest, errCodeValidationFailed, "Sales order cannot be reserved", map[string]interface{}{
+				"confirmed": false,
+				"errors":    errs,
+			})
+			return
+		}
+	}
+	
+	short, err := h.reserveSalesOrder(&order)
+	if errors.Is(err, errSalesOrderNotReservable) {
+		writeError(w, http.StatusConflict, errCodeInvalidState, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to reserve sales order: "+err.Error())
+		return
+	}
+	
+	if len(short) > 0 {
+		writeErrorDetails(w, http.StatusConflict, errCodeInsufficientStock, "Insufficient available stock to reserve", map[string]interface{}{
+			"confirmed":      false,
+			"short_products": short,
+		})
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
+// errSalesOrderNotReservable is returned by reserveSalesOrder when the order stopped being an
+// unheld draft after the caller checked it
+var errSalesOrderNotReservable = errors.New("Sales order is no longer a draft that can be confirmed")
+
+// reserveSalesOrder reserves stock for every line of a draft order and marks it confirmed,
+// all in one transaction. The order row is locked and its status re-checked so two
+// confirmations can't both reserve it, and product rows are locked so concurrent
+// confirmations can't both claim the same stock. A bundle's stock is its components', so
+// their rows are locked too. If any product is short, nothing is written and the
+// shortfalls are returned.
+func (h *SalesOrderHandler) reserveSalesOrder(order *models.SalesOrder) ([]shortProduct, error) {
+	var short []shortProduct
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var locked models.SalesOrder
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, order.ID).Error; err != nil {
+			return err
+		}
+		if locked.Status != "draft" || locked.OnHold {
+			return errSalesOrderNotReservable
+		}
+		
+		// Reserve the lines as they are now, not as they were read before the lock
+		var items []models.SalesOrderItem
+		if err := tx.Where("sales_order_id = ?", order.ID).Order("id").Find(&items).Error; err != nil {
+			return err
+		}
+		
+		// Lines for the same product draw on the same stock
+		required := make(map[uint]int)
+		productIDs := []uint{}
+		for _, item := range items {
+			if _, ok := required[item.ProductID]; !ok {
+				productIDs = append(productIDs, item.ProductID)
+			}
+			required[item.ProductID] += item.Quantity
+		}
+		
+		lockIDs := append([]uint{}, productIDs...)
+		for _, productID := range productIDs {
+			components, err := models.BundleComponents(tx, productID)
+			if err != nil {
+				return err
+			}
+			for _, component := range components {
+				lockIDs = append(lockIDs, component.ChildProductID)
+			}
+		}
+		
+		// Lock in ID order so concurrent reservations can't deadlock
+		var products []models.Product
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ?", lockIDs).Order("id").Find(&products).Error; err != nil {
+			return err
+		}
+		
+		for _, product := range products {
+			if _, ordered := required[product.ID]; !ordered {
+				continue
+			}
+			
+			available, err := models.AvailableQuantity(tx, product.ID)
+			if err != nil {
+				return err
+			}
+			
+			if available < required[product.ID] {
+				short = append(short, shortProduct{
+					ProductID: product.ID,
+					SKU:       product.SKU,
+					Required:  required[product.ID],
+					Available: available,
+				})
+			}
+		}
+		
+		if len(short) > 0 {
+			return nil
+		}
+		
+		for _, item := range items {
+			reservation := models.StockReservation{
+				Type:             "order",
+				SalesOrderID:     &order.ID,
+				SalesOrderItemID: &item.ID,
+				ProductID:        item.ProductID,
+				WarehouseID:      order.WarehouseID,
+				Quantity:         item.Quantity,
+				Status:           "active",
+			}
+			if err := tx.Create(&reservation).Error; err != nil {
+				return err
+			}
+		}
+		
+		// Bump the version so clients holding the draft's ETag see the change
+		return tx.Model(order).Updates(map[string]interface{}{
+			"status":  "confirmed",
+			"version": locked.Version + 1,
+		}).Error
+	})
+	
+	return short, err
+}
+
+// DeleteSalesOrderItem handles DELETE requests to remove an item from a draft sales order
+func (h *SalesOrderHandler) DeleteSalesOrderItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid sales order ID")
+		return
+	}
+	
+	itemID, err := strconv.ParseUint(vars["itemId"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid item ID")
+		return
+	}
+	
+	// Check if sales order exists
+	var order models.SalesOrder
+	if err := h.db.First(&order, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Sales order not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve sales order: "+err.Error())
+		}
+		return
+	}
+	
+	// Only draft orders can be modified
+	if order.Status != "draft" {
+		writeError(w, http.StatusBadRequest, errCodeInvalidState, "Only draft sales orders can be modified")
+		return
+	}
+	
+	// The item must belong to this order
+	var item models.SalesOrderItem
+	if err := h.db.Where("id = ? AND sales_order_id = ?", itemID, id).First(&item).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Item not found in sales order")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve item: "+err.Error())
+		}
+		return
+	}
+	
+	// Deleting the loaded item lets the hooks recompute the order totals in the same transaction
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		return tx.Delete(&item).Error
+	}); err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to delete item: "+err.Error())
+		return
+	}
+	
+	if err := h.db.First(&order, id).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve updated sales order: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(salesOrderTotals(order))
+}
+
+// salesOrderTotals returns the money fields of a sales order for endpoints that change them
+func salesOrderTotals(order models.SalesOrder) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            order.ID,
+		"so_number":     order.SONumber,
+		"subtotal":      order.Subtotal,
+		"tax":           order.Tax,
+		"shipping_cost": order.ShippingCost,
+		"total_amount":  order.TotalAmount,
+	}
+}
+
+// UpdateSalesOrderItem handles PUT requests to change an item on a draft sales order
+func (h *SalesOrderHandler) UpdateSalesOrderItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid sales order ID")
+		return
+	}
+	
+	itemID, err := strconv.ParseUint(vars["itemId"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid item ID")
+		return
+	}
+	
+	// Check if sales order exists
+	var order models.SalesOrder
+	if err := h.db.First(&order, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Sales order not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve sales order: "+err.Error())
+		}
+		return
+	}
+	
+	// Only draft orders can be modified
+	if order.Status != "draft" {
+		writeError(w, http.StatusBadRequest, errCodeInvalidState, "Only draft sales orders can be modified")
+		return
+	}
+	
+	// The item must belong to this order
+	var item models.SalesOrderItem
+	if err := h.db.Where("id = ? AND sales_order_id = ?", itemID, id).First(&item).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Item not found in sales order")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve item: "+err.Error())
+		}
+		return
+	}
+	
+	// Parse request body; omitted fields keep their current values
+	var request struct {
+		Quantity  *int     `json:"quantity"`
+		UnitPrice *float64 `json:"unit_price"`
+		Discount  *float64 `json:"discount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	
+	previousQuantity := item.Quantity
+	if request.Quantity != nil {
+		item.Quantity = *request.Quantity
+	}
+	if request.UnitPrice != nil {
+		item.UnitPrice = *request.UnitPrice
+	}
+	if request.Discount != nil {
+		item.Discount = *request.Discount
+	}
+	
+	// Validate item
+	if item.Quantity <= 0 || item.UnitPrice <= 0 {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Quantity and unit price must be positive")
+		return
+	}
+	
+	if item.Discount < 0 || item.Discount > 100 {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Discount must be between 0 and 100")
+		return
+	}
+	
+	// Re-check stock when the quantity goes up
+	if item.Quantity > previousQuantity {
+		available, err := models.AvailableQuantity(h.db, item.ProductID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to check available stock: "+err.Error())
+			return
+		}
+		
+		if available < item.Quantity {
+			writeError(w, http.StatusBadRequest, errCodeInsufficientStock, "Insufficient stock available")
+			return
+		}
+		
+		// As when adding the line, only stock at the order's warehouse can fill it
+		warehouseAvailable, tracked, err := models.WarehouseAvailableQuantity(h.db, item.ProductID, order.WarehouseID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to check warehouse stock: "+err.Error())
+			return
+		}
+		
+		if tracked && warehouseAvailable < item.Quantity {
+			writeError(w, http.StatusBadRequest, errCodeInsufficientStock, fmt.Sprintf("Insufficient stock at this order's warehouse (%d available there)", warehouseAvailable))
+			return
+		}
+	}
+	
+	// Re-check the margin when the price or discount changes
+	if request.UnitPrice != nil || request.Discount != nil {
+		var product models.Product
+		if err := h.db.First(&product, item.ProductID).Error; err != nil {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve product: "+err.Error())
+			return
+		}
+		
+		if rejectMarginIssue(w, r, marginIssue(&item, &product)) {
+			return
+		}
+	}
+	
+	// Saving recalculates the line total and, through the hooks, the order totals in one transaction
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		return tx.Save(&item).Error
+	}); err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update item: "+err.Error())
+		return
+	}
+	
+	if err := h.db.First(&order, id).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve updated sales order: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"item":  item,
+		"order": salesOrderTotals(order),
+	})
+}
+
+// bulkStatusResult reports the outcome of a status change for a single order
+type bulkStatusResult struct {
+	OrderID uint   `json:"order_id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BulkUpdateSalesOrderStatus handles POST requests to move many sales orders to one status.
+// Each order is validated and applied on its own savepoint, so a rejected order doesn't
+// undo the others.
+func (h *SalesOrderHandler) BulkUpdateSalesOrderStatus(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		OrderIDs []uint `json:"order_ids"`
+		Status   string `json:"status"`
+	}
+	
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	
+	if len(request.OrderIDs) == 0 {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "At least one order ID is required")
+		return
+	}
+	
+	if request.Status == "" {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Target status is required")
+		return
+	}
+	
+	// Get user ID from context (set by auth middleware)
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "Unauthorized")
+		return
+	}
+	
+	results := make([]bulkStatusResult, 0, len(request.OrderIDs))
+	succeeded := 0
+	
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		for _, orderID := range request.OrderIDs {
+			result := bulkStatusResult{OrderID: orderID}
+			
+			err := tx.Transaction(func(tx *gorm.DB) error {
+				var order models.SalesOrder
+				if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error; err != nil {
+					if err == gorm.ErrRecordNotFound {
+						return errors.New("sales order not found")
+					}
+					return err
+				}
+				
+				if order.OnHold {
+					return errors.New("sales order is on hold")
+				}
+				
+				if !models.CanTransitionSalesOrder(order.Status, request.Status) {
+					return fmt.Errorf("cannot change status from %s to %s", order.Status, request.Status)
+				}
+				
+				oldValues, _ := json.Marshal(map[string]interface{}{"status": order.Status})
+				newValues, _ := json.Marshal(map[string]interface{}{"status": request.Status})
+				
+				if err := tx.Model(&order).Update("status", request.Status).Error; err != nil {
+					return err
+				}
+				
+				// Cancelled orders give their reserved stock back
+				if request.Status == "cancelled" {
+					if err := models.ReleaseSalesOrderReservations(tx, order.ID); err != nil {
+						return err
+					}
+				}
+				
+				return models.CreateAuditLog(tx, userID, "status_change", "sales_order", order.ID, string(oldValues), string(newValues), clientIP(r))
+			})
+			
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Success = true
+				succeeded++
+			}
+			results = append(results, result)
+		}
+		return nil
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update sales order statuses: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    request.Status,
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+		"results":   results,
+	})
+}
+
+// packingSlipLine is a single pick on a packing slip
+type packingSlipLine struct {
+	ItemID         uint   `json:"item_id"`
+	ProductID      uint   `json:"product_id"`
+	SKU            string `json:"sku"`
+	Name           string `json:"name"`
+	Barcode        string `json:"barcode"`
+	LocationCode   string `json:"location_code"`
+	QuantityToPick int    `json:"quantity_to_pick"`
+}
+
+// GetPackingSlip handles GET requests for a sales order's pick/pack list. Lines still
+// awaiting fulfillment are ordered by their location in the order's warehouse so staff
+// can pick in a single pass; lines with no location come last.
+func (h *SalesOrderHandler) GetPackingSlip(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid sales order ID")
+		return
+	}
+	
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	
+	// There is no PDF rendering in the API yet
+	if format == "pdf" {
+		writeError(w, http.StatusNotImplemented, errCodeNotImplemented, "PDF packing slips are not supported yet")
+		return
+	}
+	
+	if format != "json" {
+		writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid format: must be json or pdf")
+		return
+	}
+	
+	var order models.SalesOrder
+	if err := h.db.Preload("Customer", includeDeleted).Preload("Warehouse", includeDeleted).First(&order, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Sales order not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve sales order: "+err.Error())
+		}
+		return
+	}
+	
+	if order.Status == "draft" || order.Status == "cancelled" {
+		writeError(w, http.StatusBadRequest, errCodeInvalidState, "Packing slips are only available for confirmed orders")
+		return
+	}
+	
+	var lines []packingSlipLine
+	if err := h.db.Table("sales_order_items").
+		Select(`
+			sales_order_items.id as item_id,
+			products.id as product_id,
+			products.sku as sku,
+			products.name as name,
+			products.barcode as barcode,
+			COALESCE(concat_ws('-', warehouse_locations.zone, warehouse_locations.aisle, warehouse_locations.rack,
+				warehouse_locations.shelf, warehouse_locations.bin), '') as location_code,
+			sales_order_items.quantity - sales_order_items.quantity_fulfilled as quantity_to_pick
+		`).
+		Joins("JOIN products ON sales_order_items.product_id = products.id").
+		// Pick each line from the location holding the most of the product
+		Joins(`LEFT JOIN LATERAL (
+			SELECT location_id FROM product_warehouses
+			WHERE product_warehouses.product_id = products.id AND product_warehouses.warehouse_id = ?
+			ORDER BY quantity DESC LIMIT 1
+		) pick_location ON true`, order.WarehouseID).
+		Joins("LEFT JOIN warehouse_locations ON pick_location.location_id = warehouse_locations.id").
+		Where("sales_order_items.sales_order_id = ? AND sales_order_items.quantity > sales_order_items.quantity_fulfilled", order.ID).
+		Order("warehouse_locations.id IS NULL, location_code, products.sku").
+		Scan(&lines).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to build packing slip: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sales_order_id": order.ID,
+		"so_number":      order.SONumber,
+		"customer":       order.Customer,
+		"warehouse":      order.Warehouse,
+		"generated_at":   time.Now(),
+		"lines":          lines,
+	})
+}
+
+// GetSalesOrderRemaining handles GET requests for how much of each sales order line is still to ship
+func (h *SalesOrderHandler) GetSalesOrderRemaining(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid sales order ID")
+		return
+	}
+	
+	var order models.SalesOrder
+	if err := h.db.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Preload("Items.Product", includeDeleted).First(&order, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Sales order not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve sales order: "+err.Error())
+		}
+		return
+	}
+	
+	type RemainingItem struct {
+		ItemID            uint   `json:"item_id"`
+		ProductID         uint   `json:"product_id"`
+		SKU               string `json:"sku"`
+		Quantity          int    `json:"quantity"`
+		QuantityFulfilled int    `json:"quantity_fulfilled"`
+		QuantityRemaining int    `json:"quantity_remaining"`
+	}
+	
+	items := []RemainingItem{}
+	totalRemaining := 0
+	for _, item := range order.Items {
+		remaining := RemainingItem{
+			ItemID:            item.ID,
+			ProductID:         item.ProductID,
+			Quantity:          item.Quantity,
+			QuantityFulfilled: item.QuantityFulfilled,
+			QuantityRemaining: item.Quantity - item.QuantityFulfilled,
+		}
+		if item.Product != nil {
+			remaining.SKU = item.Product.SKU
+		}
+		items = append(items, remaining)
+		totalRemaining += remaining.QuantityRemaining
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sales_order_id":  order.ID,
+		"so_number":       order.SONumber,
+		"status":          order.Status,
+		"total_remaining": totalRemaining,
+		"items":           items,
+	})
 }
\ No newline at end of file
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/yourusername/inventory-management-system/internal/models"
+	"github.com/yourusername/inventory-management-system/internal/testutil"
+)
+
+func TestReserveSalesOrderBumpsVersion(t *testing.T) {
+	db := testutil.Tx(t)
+	user := testutil.CreateUser(t, db, "staff")
+	warehouse := testutil.CreateWarehouse(t, db)
+	customer := testutil.CreateCustomer(t, db)
+	product := testutil.CreateProduct(t, db, 5)
+	order := testutil.CreateSalesOrder(t, db, customer.ID, warehouse.ID, user.ID)
+	item := models.SalesOrderItem{SalesOrderID: order.ID, ProductID: product.ID, Quantity: 2, UnitPrice: 10, TotalPrice: 20}
+	if err := db.Create(&item).Error; err != nil {
+		t.Fatalf("creating sales order item: %v", err)
+	}
+
+	h := NewSalesOrderHandler(db, nil)
+	short, err := h.reserveSalesOrder(&order)
+	if err != nil || len(short) > 0 {
+		t.Fatalf("reserving: short %v, err %v", short, err)
+	}
+
+	var stored models.SalesOrder
+	if err := db.First(&stored, order.ID).Error; err != nil {
+		t.Fatalf("reading sales order: %v", err)
+	}
+	if stored.Status != "confirmed" || stored.Version != 2 {
+		t.Errorf("order = %s v%d, want confirmed v2", stored.Status, stored.Version)
+	}
+	if order.Version != stored.Version {
+		t.Errorf("returned order version = %d, want %d", order.Version, stored.Version)
+	}
+}
@@ -0,0 +1,448 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/yourusername/inventory-management-system/internal/models"
+	"gorm.io/gorm"
+)
+
+// errInvalidTemplate marks template requests that can't be applied
+var errInvalidTemplate = errors.New("invalid sales order template")
+
+// SalesOrderTemplateHandler handles HTTP requests for standing order templates
+type SalesOrderTemplateHandler struct {
+	db *gorm.DB
+}
+
+// NewSalesOrderTemplateHandler creates a new sales order template handler
+func NewSalesOrderTemplateHandler(db *gorm.DB) *SalesOrderTemplateHandler {
+	return &SalesOrderTemplateHandler{db: db}
+}
+
+// salesOrderTemplateRequest is the body for creating or updating a template. When
+// SalesOrderID is set on create, the header and lines are copied from that order and
+// only Name is required.
+type salesOrderTemplateRequest struct {
+	Name            string                          `json:"name"`
+	SalesOrderID    *uint                           `json:"sales_order_id"`
+	CustomerID      uint                            `json:"customer_id"`
+	WarehouseID     uint                            `json:"warehouse_id"`
+	PaymentTerms    string                          `json:"payment_terms"`
+	ShippingCarrier string                          `json:"shipping_carrier"`
+	ShippingMethod  string                          `json:"shipping_method"`
+	Items           []models.SalesOrderTemplateItem `json:"items"`
+}
+
+// templatePriceChange flags a line whose product price differs from the template's
+type templatePriceChange struct {
+	ProductID     uint    `json:"product_id"`
+	SKU           string  `json:"sku"`
+	TemplatePrice float64 `json:"template_price"`
+	CurrentPrice  float64 `json:"current_price"`
+}
+
+// GetSalesOrderTemplates handles GET requests to list templates, optionally for one customer
+func (h *SalesOrderTemplateHandler) GetSalesOrderTemplates(w http.ResponseWriter, r *http.Request) {
+	query := h.db.Model(&models.SalesOrderTemplate{})
+	
+	if customerID := r.URL.Query().Get("customer_id"); customerID != "" {
+		id, err := strconv.ParseUint(customerID, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid customer_id")
+			return
+		}
+		query = query.Where("customer_id = ?", id)
+	}
+	
+	templates := []models.SalesOrderTemplate{}
+	if err := query.Preload("Customer", includeDeleted).Preload("Items").Order("name").Find(&templates).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve sales order templates: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(templates)
+}
+
+// GetSalesOrderTemplate handles GET requests to retrieve a single template
+func (h *SalesOrderTemplateHandler) GetSalesOrderTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := h.loadTemplate(w, r)
+	if !ok {
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(template)
+}
+
+// CreateSalesOrderTemplate handles POST requests to create a template, either from an
+// existing sales order or from explicit lines
+func (h *SalesOrderTemplateHandler) CreateSalesOrderTemplate(w http.ResponseWriter, r *http.Request) {
+	var request salesOrderTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	
+	if request.Name == "" {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Name is required")
+		return
+	}
+	
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
+		return
+	}
+	
+	template := models.SalesOrderTemplate{
+		Name:            request.Name,
+		CustomerID:      request.CustomerID,
+		WarehouseID:     request.WarehouseID,
+		PaymentTerms:    request.PaymentTerms,
+		ShippingCarrier: request.ShippingCarrier,
+		ShippingMethod:  request.ShippingMethod,
+		UserID:          userID,
+		Items:           request.Items,
+	}
+	
+	// Derive the template from an existing order
+	if request.SalesOrderID != nil {
+		var source models.SalesOrder
+		if err := h.db.Preload("Items").First(&source, *request.SalesOrderID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				writeError(w, http.StatusBadRequest, errCodeInvalidReference, "Sales order not found")
+			} else {
+				writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve sales order: "+err.Error())
+			}
+			return
+		}
+		
+		template.SourceOrderID = &source.ID
+		template.CustomerID = source.CustomerID
+		template.WarehouseID = source.WarehouseID
+		template.PaymentTerms = source.PaymentTerms
+		template.ShippingCarrier = source.ShippingCarrier
+		template.ShippingMethod = source.ShippingMethod
+		template.Items = make([]models.SalesOrderTemplateItem, 0, len(source.Items))
+		for _, item := range source.Items {
+			template.Items = append(template.Items, models.SalesOrderTemplateItem{
+				ProductID: item.ProductID,
+				Quantity:  item.Quantity,
+				UnitPrice: item.UnitPrice,
+				Discount:  item.Discount,
+			})
+		}
+	}
+	
+	if template.CustomerID == 0 || template.WarehouseID == 0 {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Customer ID and Warehouse ID are required")
+		return
+	}
+	
+	if !requireActiveReference(w, h.db, &models.Customer{}, template.CustomerID, "customer_id", "customer") ||
+		!requireActiveReference(w, h.db, &models.Warehouse{}, template.WarehouseID, "warehouse_id", "warehouse") {
+		return
+	}
+	
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := validateTemplate(tx, &template); err != nil {
+			return err
+		}
+		return tx.Create(&template).Error
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidTemplate) {
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, err.Error())
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to create sales order template: "+err.Error())
+		}
+		return
+	}
+	recordAudit(h.db, r, "create", "sales_order_template", template.ID, nil, template)
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(template)
+}
+
+// UpdateSalesOrderTemplate handles PUT requests to update a template. When items are
+// given they replace the template's lines.
+func (h *SalesOrderTemplateHandler) UpdateSalesOrderTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := h.loadTemplate(w, r)
+	if !ok {
+		return
+	}
+	oldTemplate := template
+	
+	var request salesOrderTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	
+	if request.Name != "" {
+		template.Name = request.Name
+	}
+	if request.CustomerID != 0 {
+		template.CustomerID = request.CustomerID
+	}
+	if request.WarehouseID != 0 {
+		template.WarehouseID = request.WarehouseID
+	}
+	template.PaymentTerms = request.PaymentTerms
+	template.ShippingCarrier = request.ShippingCarrier
+	template.ShippingMethod = request.ShippingMethod
+	
+	if !requireActiveReference(w, h.db, &models.Customer{}, template.CustomerID, "customer_id", "customer") ||
+		!requireActiveReference(w, h.db, &models.Warehouse{}, template.WarehouseID, "warehouse_id", "warehouse") {
+		return
+	}
+	
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if request.Items != nil {
+			template.Items = request.Items
+		}
+		if err := validateTemplate(tx, &template); err != nil {
+			return err
+		}
+		
+		if err := tx.Model(&template).Select("name", "customer_id", "warehouse_id", "payment_terms",
+			"shipping_carrier", "shipping_method").Updates(&template).Error; err != nil {
+			return err
+		}
+		
+		if request.Items == nil {
+			return nil
+		}
+		if err := tx.Where("template_id = ?", template.ID).Delete(&models.SalesOrderTemplateItem{}).Error; err != nil {
+			return err
+		}
+		for i := range template.Items {
+			template.Items[i].ID = 0
+			template.Items[i].TemplateID = template.ID
+		}
+		if len(template.Items) == 0 {
+			return nil
+		}
+		return tx.Create(&template.Items).Error
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidTemplate) {
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, err.Error())
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update sales order template: "+err.Error())
+		}
+		return
+	}
+	recordAudit(h.db, r, "update", "sales_order_template", template.ID, oldTemplate, template)
+	
+	// Reload so the customer, warehouse and item products reflect the update
+	if template, ok = h.loadTemplate(w, r); !ok {
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(template)
+}
+
+// DeleteSalesOrderTemplate handles DELETE requests to remove a template. Orders already
+// created from it are unaffected.
+func (h *SalesOrderTemplateHandler) DeleteSalesOrderTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := h.loadTemplate(w, r)
+	if !ok {
+		return
+	}
+	
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("template_id = ?", template.ID).Delete(&models.SalesOrderTemplateItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.SalesOrderTemplate{}, template.ID).Error
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to delete sales order template: "+err.Error())
+		return
+	}
+	recordAudit(h.db, r, "delete", "sales_order_template", template.ID, template, nil)
+	
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// InstantiateSalesOrderTemplate handles POST requests to create a draft sales order from a
+// template. Lines are priced at the current product price, and any line whose price has
+// changed since the template was saved is listed in price_changes.
+func (h *SalesOrderTemplateHandler) InstantiateSalesOrderTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := h.loadTemplate(w, r)
+	if !ok {
+		return
+	}
+	
+	if len(template.Items) == 0 {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Template has no items")
+		return
+	}
+	
+	if !requireActiveReference(w, h.db, &models.Customer{}, template.CustomerID, "customer_id", "customer") ||
+		!requireActiveReference(w, h.db, &models.Warehouse{}, template.WarehouseID, "warehouse_id", "warehouse") {
+		return
+	}
+	
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
+		return
+	}
+	
+	// Template terms win; otherwise use the customer's current terms
+	terms := template.PaymentTerms
+	if terms == "" && template.Customer != nil {
+		terms = template.Customer.PaymentTerms
+	}
+	if terms == "" {
+		terms = models.DefaultPaymentTerms
+	}
+	
+	order := models.SalesOrder{
+		CustomerID:      template.CustomerID,
+		WarehouseID:     template.WarehouseID,
+		OrderDate:       time.Now(),
+		Status:          "draft",
+		ShippingCarrier: template.ShippingCarrier,
+		ShippingMethod:  template.ShippingMethod,
+		PaymentStatus:   "unpaid",
+		PaymentTerms:    terms,
+		UserID:          userID,
+	}
+	order.DueDate = models.PaymentDueDate(order.OrderDate, order.PaymentTerms)
+	
+	priceChanges := []templatePriceChange{}
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&order).Error; err != nil {
+			return err
+		}
+		
+		// The item hooks keep the order totals in sync
+		for _, line := range template.Items {
+			var product models.Product
+			if err := tx.First(&product, line.ProductID).Error; err != nil {
+				if err == gorm.ErrRecordNotFound {
+					return fmt.Errorf("%w: product %d no longer exists", errInvalidTemplate, line.ProductID)
+				}
+				return err
+			}
+			if product.Status != "active" {
+				return fmt.Errorf("%w: product %s is %s", errInvalidTemplate, product.SKU, product.Status)
+			}
+			
+			if models.RoundCurrency(product.Price) != models.RoundCurrency(line.UnitPrice) {
+				priceChanges = append(priceChanges, templatePriceChange{
+					ProductID:     product.ID,
+					SKU:           product.SKU,
+					TemplatePrice: line.UnitPrice,
+					CurrentPrice:  product.Price,
+				})
+			}
+			
+			item := models.SalesOrderItem{
+				SalesOrderID: order.ID,
+				ProductID:    product.ID,
+				Quantity:     line.Quantity,
+				UnitPrice:    product.Price,
+				Discount:     line.Discount,
+			}
+			if err := tx.Create(&item).Error; err != nil {
+				return err
+			}
+		}
+		
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidTemplate) {
+			writeError(w, http.StatusConflict, errCodeConflict, err.Error())
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to instantiate sales order template: "+err.Error())
+		}
+		return
+	}
+	
+	var newOrder models.SalesOrder
+	if err := h.db.Preload("Items").Preload("Items.Product", includeDeleted).Preload("Customer", includeDeleted).
+		Preload("Warehouse", includeDeleted).Preload("User", includeDeleted).First(&newOrder, order.ID).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve new sales order: "+err.Error())
+		return
+	}
+	recordAudit(h.db, r, "create", "sales_order", newOrder.ID, nil, newOrder)
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sales_order":   newOrder,
+		"template_id":   template.ID,
+		"price_changes": priceChanges,
+	})
+}
+
+// loadTemplate fetches the template named by the {id} route variable with its lines.
+// On failure it writes the response and returns false.
+func (h *SalesOrderTemplateHandler) loadTemplate(w http.ResponseWriter, r *http.Request) (models.SalesOrderTemplate, bool) {
+	var template models.SalesOrderTemplate
+	
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid sales order template ID")
+		return template, false
+	}
+	
+	if err := h.db.Preload("Customer", includeDeleted).Preload("Warehouse", includeDeleted).Preload("Items").Preload("Items.Product", includeDeleted).
+		First(&template, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Sales order template not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve sales order template: "+err.Error())
+		}
+		return template, false
+	}
+	
+	return template, true
+}
+
+// validateTemplate checks the template's payment terms and lines. Lines without a price
+// are stamped with the product's current price so later price changes can be flagged.
+func validateTemplate(tx *gorm.DB, template *models.SalesOrderTemplate) error {
+	if template.PaymentTerms != "" && !models.IsValidPaymentTerms(template.PaymentTerms) {
+		return fmt.Errorf("%w: invalid payment terms %s", errInvalidTemplate, template.PaymentTerms)
+	}
+	
+	for i := range template.Items {
+		line := &template.Items[i]
+		if line.ProductID == 0 || line.Quantity <= 0 {
+			return fmt.Errorf("%w: each item needs a product_id and a positive quantity", errInvalidTemplate)
+		}
+		if line.Discount < 0 || line.Discount > 100 {
+			return fmt.Errorf("%w: discount must be between 0 and 100", errInvalidTemplate)
+		}
+		
+		var product models.Product
+		if err := tx.First(&product, line.ProductID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fmt.Errorf("%w: product %d not found", errInvalidTemplate, line.ProductID)
+			}
+			return err
+		}
+		if line.UnitPrice <= 0 {
+			line.UnitPrice = product.Price
+		}
+		line.Product = nil
+	}
+	
+	return nil
+}
\ No newline at end of file
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/yourusername/inventory-management-system/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StockAlertHandler handles HTTP requests for low stock alert endpoints
+type StockAlertHandler struct {
+	db *gorm.DB
+}
+
+// NewStockAlertHandler creates a new stock alert handler
+func NewStockAlertHandler(db *gorm.DB) *StockAlertHandler {
+	return &StockAlertHandler{db: db}
+}
+
+// GetStockAlerts handles GET requests to list stock alerts. Open (new and acknowledged)
+// alerts are listed by default; ?status= picks one status. Alerts for products that have
+// since been restocked are resolved first.
+func (h *StockAlertHandler) GetStockAlerts(w http.ResponseWriter, r *http.Request) {
+	// Catch restocks that didn't go through a stock movement, such as a lowered reorder level
+	if err := models.ResolveRestockedAlerts(h.db); err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to resolve restocked alerts: "+err.Error())
+		return
+	}
+	
+	query := h.db.Preload("Product")
+	
+	switch status := r.URL.Query().Get("status"); status {
+	case "":
+		query = query.Where("status <> ?", models.StockAlertResolved)
+	case models.StockAlertNew, models.StockAlertAcknowledged, models.StockAlertResolved:
+		query = query.Where("status = ?", status)
+	default:
+		writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid status: must be new, acknowledged or resolved")
+		return
+	}
+	
+	if productID := r.URL.Query().Get("product_id"); productID != "" {
+		productIDInt, err := strconv.ParseUint(productID, 10, 64)
+		if err == nil {
+			query = query.Where("product_id = ?", productIDInt)
+		}
+	}
+	
+	alerts := []models.StockAlert{}
+	if err := query.Order("created_at DESC").Find(&alerts).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve stock alerts: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alerts)
+}
+
+// AcknowledgeStockAlert handles POST requests to acknowledge a new stock alert. The alert
+// stays open until the product is restocked.
+func (h *StockAlertHandler) AcknowledgeStockAlert(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid stock alert ID")
+		return
+	}
+	
+	// Get user ID from context (set by auth middleware)
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
+		return
+	}
+	
+	var alert models.StockAlert
+	var oldAlert models.StockAlert
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&alert, id).Error; err != nil {
+			return err
+		}
+		if alert.Status != models.StockAlertNew {
+			return nil
+		}
+		oldAlert = alert
+		
+		now := time.Now()
+		alert.Status = models.StockAlertAcknowledged
+		alert.AcknowledgedBy = &userID
+		alert.AcknowledgedAt = &now
+		return tx.Save(&alert).Error
+	})
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Stock alert not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to acknowledge stock alert: "+err.Error())
+		}
+		return
+	}
+	
+	if oldAlert.ID == 0 {
+		writeError(w, http.StatusBadRequest, errCodeInvalidState, "Only new stock alerts can be acknowledged; this one is "+alert.Status)
+		return
+	}
+	recordAudit(h.db, r, "acknowledge", "stock_alert", alert.ID, oldAlert, alert)
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alert)
+}
\ No newline at end of file
@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/yourusername/inventory-management-system/internal/models"
+	"github.com/yourusername/inventory-management-system/internal/repository"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errInvalidStockCount = errors.New("Invalid stock count")
+	errStockCountClosed  = errors.New("Stock count session is closed")
+)
+
+// StockCountHandler handles HTTP requests for physical inventory count sessions
+type StockCountHandler struct {
+	db *gorm.DB
+}
+
+// NewStockCountHandler creates a new stock count handler
+func NewStockCountHandler(db *gorm.DB) *StockCountHandler {
+	return &StockCountHandler{db: db}
+}
+
+// GetStockCountSessions handles GET requests to list count sessions, filtered by
+// warehouse_id and status
+func (h *StockCountHandler) GetStockCountSessions(w http.ResponseWriter, r *http.Request) {
+	query := h.db.Preload("Warehouse")
+	
+	if warehouseID := r.URL.Query().Get("warehouse_id"); warehouseID != "" {
+		id, err := strconv.ParseUint(warehouseID, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid warehouse_id")
+			return
+		}
+		query = query.Where("warehouse_id = ?", id)
+	}
+	
+	switch status := r.URL.Query().Get("status"); status {
+	case "":
+	case models.StockCountOpen, models.StockCountCounting, models.StockCountClosed:
+		query = query.Where("status = ?", status)
+	default:
+		writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid status: must be open, counting or closed")
+		return
+	}
+	
+	sessions := []models.StockCountSession{}
+	if err := query.Order("created_at DESC").Find(&sessions).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve stock count sessions: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// GetStockCountSession handles GET requests to retrieve a count session with its counts
+func (h *StockCountHandler) GetStockCountSession(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid stock count session ID")
+		return
+	}
+	
+	var session models.StockCountSession
+	if err := h.db.Preload("Warehouse").Preload("Lines", func(db *gorm.DB) *gorm.DB {
+		return db.Order("product_id, location_id")
+	}).First(&session, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Stock count session not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve stock count session: "+err.Error())
+		}
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+// CreateStockCountSession handles POST requests to open a count session for a warehouse,
+// optionally limited to one zone
+func (h *StockCountHandler) CreateStockCountSession(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		WarehouseID uint   `json:"warehouse_id"`
+		Zone        string `json:"zone"`
+		Notes       string `json:"notes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	
+	if request.WarehouseID == 0 {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Warehouse ID is required")
+		return
+	}
+	
+	if !requireActiveReference(w, h.db, &models.Warehouse{}, request.WarehouseID, "warehouse_id", "warehouse") {
+		return
+	}
+	
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
+		return
+	}
+	
+	session := models.StockCountSession{
+		WarehouseID: request.WarehouseID,
+		Zone:        request.Zone,
+		Status:      models.StockCountOpen,
+		Notes:       request.Notes,
+		StartedBy:   userID,
+		Lines:       []models.StockCountLine{},
+	}
+	if err := h.db.Create(&session).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to create stock count session: "+err.Error())
+		return
+	}
+	recordAudit(h.db, r, "create", "stock_count_session", session.ID, nil, session)
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(session)
+}
+
+// RecordStockCounts handles POST requests to record counts in a session. Counts don't change
+// stock until the session is closed; counting a product at a location again replaces the
+// earlier count, so several counters can work through a session and recounts win.
+func (h *StockCountHandler) RecordStockCounts(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid stock count session ID")
+		return
+	}
+	
+	var request struct {
+		Counts []stockTakeCount `json:"counts"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	
+	if len(request.Counts) == 0 {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "At least one count is required")
+		return
+	}
+	
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
+		return
+	}
+	
+	var session models.StockCountSession
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the session so a close can't interleave with new counts
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&session, id).Error; err != nil {
+			return err
+		}
+		if session.Status == models.StockCountClosed {
+			return errStockCountClosed
+		}
+		
+		for _, count := range request.Counts {
+			if count.ProductID == 0 || count.CountedQuantity < 0 {
+				return fmt.Errorf("%w: each count needs a product ID and a counted quantity >= 0", errInvalidStockCount)
+			}
+			
+			var product models.Product
+			if err := tx.Select("id").First(&product, count.ProductID).Error; err != nil {
+				if err == gorm.ErrRecordNotFound {
+					return fmt.Errorf("%w: product %d not found", errInvalidStockCount, count.ProductID)
+				}
+				return err
+			}
+			
+			line := models.StockCountLine{
+				SessionID:       session.ID,
+				ProductID:       count.ProductID,
+				CountedQuantity: count.CountedQuantity,
+				CountedBy:       userID,
+			}
+			
+			if count.LocationID != nil {
+				line.LocationID = *count.LocationID
+				
+				var location models.WarehouseLocation
+				if err := tx.Where("id = ? AND warehouse_id = ?", line.LocationID, session.WarehouseID).First(&location).Error; err != nil {
+					if err == gorm.ErrRecordNotFound {
+						return fmt.Errorf("%w: location %d is not in this warehouse", errInvalidStockCount, line.LocationID)
+					}
+					return err
+				}
+				if session.Zone != "" && location.Zone != session.Zone {
+					return fmt.Errorf("%w: location %d is not in zone %s", errInvalidStockCount, line.LocationID, session.Zone)
+				}
+			} else if session.Zone != "" {
+				return fmt.Errorf("%w: counts in a zone session need a location_id", errInvalidStockCount)
+			} else if err := repository.CheckLocation(tx, session.WarehouseID, nil); err != nil {
+				if errors.Is(err, repository.ErrLocationRequired) {
+					return fmt.Errorf("%w: product %d: %w", errInvalidStockCount, count.ProductID, err)
+				}
+				return err
+			}
+			
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "session_id"}, {Name: "product_id"}, {Name: "location_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"counted_quantity", "counted_by", "updated_at"}),
+			}).Create(&line).Error; err != nil {
+				return err
+			}
+		}
+		
+		if session.Status == models.StockCountOpen {
+			session.Status = models.StockCountCounting
+			return tx.Model(&session).Update("status", session.Status).Error
+		}
+		return nil
+	})
+	if err != nil {
+		switch {
+		case err == gorm.ErrRecordNotFound:
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Stock count session not found")
+		case errors.Is(err, errStockCountClosed):
+			writeError(w, http.StatusConflict, errCodeInvalidState, err.Error())
+		case errors.Is(err, errInvalidStockCount):
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to record counts: "+err.Error())
+		}
+		return
+	}
+	
+	if err := h.db.Preload("Lines", func(db *gorm.DB) *gorm.DB {
+		return db.Order("product_id, location_id")
+	}).First(&session, session.ID).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve stock count session: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+// CloseStockCountSession handles POST requests to close a count session. Every recorded
+// count is applied as a stock take in one transaction, so each variance gets a cycle_count
+// adjustment, and the response is the variance report.
+func (h *StockCountHandler) CloseStockCountSession(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid stock count session ID")
+		return
+	}
+	
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
+		return
+	}
+	
+	var session models.StockCountSession
+	var stockTake models.StockTake
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&session, id).Error; err != nil {
+			return err
+		}
+		if session.Status == models.StockCountClosed {
+			return errStockCountClosed
+		}
+		
+		if err := tx.Where("session_id = ?", session.ID).Order("product_id, location_id").Find(&session.Lines).Error; err != nil {
+			return err
+		}
+		if len(session.Lines) == 0 {
+			return fmt.Errorf("%w: the session has no counts", errInvalidStockCount)
+		}
+		
+		counts := make([]stockTakeCount, 0, len(session.Lines))
+		for _, line := range session.Lines {
+			count := stockTakeCount{ProductID: line.ProductID, CountedQuantity: line.CountedQuantity}
+			if line.LocationID != 0 {
+				locationID := line.LocationID
+				count.LocationID = &locationID
+			}
+			counts = append(counts, count)
+		}
+		
+		stockTake = models.StockTake{
+			WarehouseID: session.WarehouseID,
+			UserID:      userID,
+			Notes:       fmt.Sprintf("Stock count session %d", session.ID),
+		}
+		if err := applyStockTake(tx, &stockTake, counts); err != nil {
+			return err
+		}
+		
+		now := time.Now()
+		session.Status = models.StockCountClosed
+		session.ClosedBy = &userID
+		session.ClosedAt = &now
+		session.StockTakeID = &stockTake.ID
+		return tx.Model(&session).Updates(map[string]interface{}{
+			"status":        session.Status,
+			"closed_by":     session.ClosedBy,
+			"closed_at":     session.ClosedAt,
+			"stock_take_id": session.StockTakeID,
+		}).Error
+	})
+	if err != nil {
+		switch {
+		case err == gorm.ErrRecordNotFound:
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Stock count session not found")
+		case errors.Is(err, errStockCountClosed):
+			writeError(w, http.StatusConflict, errCodeInvalidState, err.Error())
+		case errors.Is(err, errInvalidStockCount), errors.Is(err, errInvalidStockTake):
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to close stock count session: "+err.Error())
+		}
+		return
+	}
+	recordAudit(h.db, r, "close", "stock_count_session", session.ID, nil, session)
+	
+	response := stockTakeSummary(stockTake)
+	response["session"] = session
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
\ No newline at end of file
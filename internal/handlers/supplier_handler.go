@@ -15,6 +15,14 @@ type SupplierHandler struct {
 	db *gorm.DB
 }
 
+// supplierSortFields maps the sort keys accepted by GetSuppliers to their columns
+var supplierSortFields = map[string]string{
+	"name":       "name",
+	"status":     "status",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
 // NewSupplierHandler creates a new supplier handler
 func NewSupplierHandler(db *gorm.DB) *SupplierHandler {
 	return &SupplierHandler{db: db}
@@ -25,7 +33,7 @@ func (h *SupplierHandler) GetSuppliers(w http.ResponseWriter, r *http.Request) {
 	var suppliers []models.Supplier
 	
 	// Apply filters if any
-	query := h.db
+	query := withDeleted(r, h.db)
 	
 	if status := r.URL.Query().Get("status"); status != "" {
 		query = query.Where("status = ?", status)
@@ -35,13 +43,41 @@ func (h *SupplierHandler) GetSuppliers(w http.ResponseWriter, r *http.Request) {
 		query = query.Where("name LIKE ?", "%"+name+"%")
 	}
 	
-	if err := query.Find(&suppliers).Error; err != nil {
-		http.Error(w, "Failed to retrieve suppliers: "+err.Error(), http.StatusInternalServerError)
+	timestamps, err := parseTimestampFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidParameter, err.Error())
+		return
+	}
+	query = timestamps.apply(query, "suppliers")
+	
+	// Sorting
+	order := "name ASC"
+	if sort := r.URL.Query().Get("sort"); sort != "" {
+		var err error
+		order, err = parseSort(sort, supplierSortFields)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid sort parameter: "+err.Error())
+			return
+		}
+	}
+	
+	// Apply pagination; the total is counted with the same filters
+	page, limit := parsePagination(r)
+	offset := (page - 1) * limit
+	
+	var total int64
+	if err := query.Session(&gorm.Session{}).Model(&models.Supplier{}).Count(&total).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to count suppliers: "+err.Error())
+		return
+	}
+	
+	if err := query.Order(order).Limit(limit).Offset(offset).Find(&suppliers).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve suppliers: "+err.Error())
 		return
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(suppliers)
+	json.NewEncoder(w).Encode(newPaginatedResponse(suppliers, page, limit, total))
 }
 
 // GetSupplier handles GET requests to retrieve a single supplier
@@ -49,16 +85,16 @@ func (h *SupplierHandler) GetSupplier(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid supplier ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid supplier ID")
 		return
 	}
 	
 	var supplier models.Supplier
 	if err := h.db.First(&supplier, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Supplier not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Supplier not found")
 		} else {
-			http.Error(w, "Failed to retrieve supplier: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve supplier: "+err.Error())
 		}
 		return
 	}
@@ -72,17 +108,22 @@ func (h *SupplierHandler) CreateSupplier(w http.ResponseWriter, r *http.Request)
 	var supplier models.Supplier
 	
 	if err := json.NewDecoder(r.Body).Decode(&supplier); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
 		return
 	}
 	
 	if supplier.Name == "" {
-		http.Error(w, "Supplier name is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Supplier name is required")
+		return
+	}
+	
+	if err := normalizeContact(&supplier.Email, &supplier.Phone); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, err.Error())
 		return
 	}
 	
 	if err := h.db.Create(&supplier).Error; err != nil {
-		http.Error(w, "Failed to create supplier: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to create supplier: "+err.Error())
 		return
 	}
 	
@@ -96,7 +137,7 @@ func (h *SupplierHandler) UpdateSupplier(w http.ResponseWriter, r *http.Request)
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid supplier ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid supplier ID")
 		return
 	}
 	
@@ -104,9 +145,9 @@ func (h *SupplierHandler) UpdateSupplier(w http.ResponseWriter, r *http.Request)
 	var existingSupplier models.Supplier
 	if err := h.db.First(&existingSupplier, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Supplier not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Supplier not found")
 		} else {
-			http.Error(w, "Failed to retrieve supplier: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve supplier: "+err.Error())
 		}
 		return
 	}
@@ -114,7 +155,12 @@ func (h *SupplierHandler) UpdateSupplier(w http.ResponseWriter, r *http.Request)
 	// Decode the request body
 	var updatedSupplier models.Supplier
 	if err := json.NewDecoder(r.Body).Decode(&updatedSupplier); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	
+	if err := normalizeContact(&updatedSupplier.Email, &updatedSupplier.Phone); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, err.Error())
 		return
 	}
 	
@@ -123,7 +169,7 @@ func (h *SupplierHandler) UpdateSupplier(w http.ResponseWriter, r *http.Request)
 	
 	// Update the supplier
 	if err := h.db.Save(&updatedSupplier).Error; err != nil {
-		http.Error(w, "Failed to update supplier: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update supplier: "+err.Error())
 		return
 	}
 	
@@ -136,7 +182,7 @@ func (h *SupplierHandler) DeleteSupplier(w http.ResponseWriter, r *http.Request)
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid supplier ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid supplier ID")
 		return
 	}
 	
@@ -144,16 +190,16 @@ func (h *SupplierHandler) DeleteSupplier(w http.ResponseWriter, r *http.Request)
 	var supplier models.Supplier
 	if err := h.db.First(&supplier, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Supplier not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Supplier not found")
 		} else {
-			http.Error(w, "Failed to retrieve supplier: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve supplier: "+err.Error())
 		}
 		return
 	}
 	
-	// Soft delete by updating status instead of actually deleting
-	if err := h.db.Model(&supplier).Update("status", "inactive").Error; err != nil {
-		http.Error(w, "Failed to delete supplier: "+err.Error(), http.StatusInternalServerError)
+	// Soft delete; the supplier stays linked to its purchase orders and can be restored
+	if err := h.db.Delete(&supplier).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to delete supplier: "+err.Error())
 		return
 	}
 	
@@ -165,7 +211,7 @@ func (h *SupplierHandler) GetSupplierProducts(w http.ResponseWriter, r *http.Req
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid supplier ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid supplier ID")
 		return
 	}
 	
@@ -173,22 +219,75 @@ func (h *SupplierHandler) GetSupplierProducts(w http.ResponseWriter, r *http.Req
 	var supplier models.Supplier
 	if err := h.db.First(&supplier, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Supplier not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Supplier not found")
 		} else {
-			http.Error(w, "Failed to retrieve supplier: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve supplier: "+err.Error())
 		}
 		return
 	}
 	
 	// Get products from the supplier
 	var products []models.Product
-	if err := h.db.Joins("JOIN product_supplier ON products.id = product_supplier.product_id").
-		Where("product_supplier.supplier_id = ?", id).
+	if err := h.db.Joins("JOIN product_suppliers ON products.id = product_suppliers.product_id").
+		Where("product_suppliers.supplier_id = ?", id).
+		Find(&products).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve products: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(products)
+}
+
+// GetSupplierLowStockProducts handles GET requests to retrieve a supplier's products that need reordering
+func (h *SupplierHandler) GetSupplierLowStockProducts(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid supplier ID")
+		return
+	}
+	
+	// Check if supplier exists
+	var supplier models.Supplier
+	if err := h.db.First(&supplier, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Supplier not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve supplier: "+err.Error())
+		}
+		return
+	}
+	
+	type LowStockProduct struct {
+		ID               uint    `json:"id"`
+		SKU              string  `json:"sku"`
+		Name             string  `json:"name"`
+		Quantity         int     `json:"quantity"`
+		ReorderLevel     int     `json:"reorder_level"`
+		Shortage         int     `json:"shortage"`
+		UnitCost         float64 `json:"unit_cost"`
+		MinOrderQuantity int     `json:"min_order_quantity"`
+	}
+	
+	// Get active products from the supplier at or below their reorder level
+	var products []LowStockProduct
+	if err := h.db.Table("products").
+		Select("products.id, products.sku, products.name, products.quantity, products.reorder_level, (products.reorder_level - products.quantity) as shortage, product_suppliers.unit_cost, product_suppliers.min_order_quantity").
+		Joins("JOIN product_suppliers ON products.id = product_suppliers.product_id").
+		Where("product_suppliers.supplier_id = ?", id).
+		Where("products.status = ? AND products.deleted_at IS NULL AND products.quantity <= products.reorder_level", "active").
+		Order("shortage DESC").
 		Find(&products).Error; err != nil {
-		http.Error(w, "Failed to retrieve products: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve low stock products: "+err.Error())
 		return
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(products)
+}
+
+// RestoreSupplier handles POST requests to undo a supplier's soft delete
+func (h *SupplierHandler) RestoreSupplier(w http.ResponseWriter, r *http.Request) {
+	restoreDeleted(w, r, h.db, &models.Supplier{}, "supplier", "supplier")
 }
\ No newline at end of file
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/yourusername/inventory-management-system/internal/models"
+	"gorm.io/gorm"
+)
+
+// TrackingHandler handles public order status lookups for customers
+type TrackingHandler struct {
+	db *gorm.DB
+}
+
+// NewTrackingHandler creates a new tracking handler
+func NewTrackingHandler(db *gorm.DB) *TrackingHandler {
+	return &TrackingHandler{db: db}
+}
+
+// OrderTrackingResponse contains the non-sensitive order fields shown to customers
+type OrderTrackingResponse struct {
+	SONumber     string     `json:"so_number"`
+	Status       string     `json:"status"`
+	OrderDate    time.Time  `json:"order_date"`
+	ShippingDate *time.Time `json:"shipping_date,omitempty"`
+}
+
+// TrackOrder handles GET requests to look up a sales order's status by SO number.
+// The customer's email must be supplied as a verification field; a wrong email
+// gets the same response as an unknown order so SO numbers can't be probed.
+func (h *TrackingHandler) TrackOrder(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	soNumber := vars["so_number"]
+	
+	email := strings.TrimSpace(r.URL.Query().Get("email"))
+	if email == "" {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Email is required")
+		return
+	}
+	
+	var order models.SalesOrder
+	if err := h.db.Preload("Customer", includeDeleted).Where("so_number = ?", soNumber).First(&order).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Order not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve order")
+		}
+		return
+	}
+	
+	if order.Customer == nil || order.Customer.Email == "" || !strings.EqualFold(order.Customer.Email, email) {
+		writeError(w, http.StatusNotFound, errCodeNotFound, "Order not found")
+		return
+	}
+	
+	response := OrderTrackingResponse{
+		SONumber:  order.SONumber,
+		Status:    order.Status,
+		OrderDate: order.OrderDate,
+	}
+	if !order.ShippingDate.IsZero() {
+		response.ShippingDate = &order.ShippingDate
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
\ No newline at end of file
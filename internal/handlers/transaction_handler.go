@@ -2,10 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/yourusername/inventory-management-system/internal/alerts"
 	"github.com/yourusername/inventory-management-system/internal/models"
 	"github.com/yourusername/inventory-management-system/internal/repository"
 	"gorm.io/gorm"
@@ -18,9 +21,12 @@ type TransactionHandler struct {
 }
 
 // NewTransactionHandler creates a new transaction handler
-func NewTransactionHandler(db *gorm.DB) *TransactionHandler {
+func NewTransactionHandler(db *gorm.DB, alerter alerts.StockAlerter) *TransactionHandler {
+	repo := repository.NewTransactionRepository(db)
+	repo.SetAlerter(alerter)
+	
 	return &TransactionHandler{
-		repo: repository.NewTransactionRepository(db),
+		repo: repo,
 		db:   db,
 	}
 }
@@ -60,6 +66,14 @@ func (h *TransactionHandler) GetTransactions(w http.ResponseWriter, r *http.Requ
 		}
 	}
 	
+	// User filter, for reviewing everything one person moved
+	if userID := r.URL.Query().Get("user_id"); userID != "" {
+		userIDInt, err := strconv.ParseUint(userID, 10, 64)
+		if err == nil {
+			params["user_id"] = uint(userIDInt)
+		}
+	}
+	
 	// Pagination
 	if page := r.URL.Query().Get("page"); page != "" {
 		pageNum, err := strconv.Atoi(page)
@@ -78,7 +92,7 @@ func (h *TransactionHandler) GetTransactions(w http.ResponseWriter, r *http.Requ
 	// Get transactions
 	transactions, err := h.repo.GetAll(params)
 	if err != nil {
-		http.Error(w, "Failed to retrieve transactions: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve transactions: "+err.Error())
 		return
 	}
 	
@@ -92,16 +106,16 @@ func (h *TransactionHandler) GetTransaction(w http.ResponseWriter, r *http.Reque
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid transaction ID")
 		return
 	}
 	
 	transaction, err := h.repo.GetByID(uint(id))
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Transaction not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Transaction not found")
 		} else {
-			http.Error(w, "Failed to retrieve transaction: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve transaction: "+err.Error())
 		}
 		return
 	}
@@ -117,20 +131,20 @@ func (h *TransactionHandler) CreateTransaction(w http.ResponseWriter, r *http.Re
 	// Decode request body
 	err := json.NewDecoder(r.Body).Decode(&transaction)
 	if err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
 		return
 	}
 	
 	// Validate transaction
 	if transaction.ProductID == 0 || transaction.WarehouseID == 0 || transaction.Quantity == 0 {
-		http.Error(w, "Product ID, warehouse ID, and quantity are required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Product ID, warehouse ID, and quantity are required")
 		return
 	}
 	
 	// Set user ID from context (would be set by auth middleware)
 	userID, ok := r.Context().Value("userID").(uint)
 	if !ok {
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
 		return
 	}
 	transaction.UserID = userID
@@ -138,7 +152,18 @@ func (h *TransactionHandler) CreateTransaction(w http.ResponseWriter, r *http.Re
 	// Create transaction
 	err = h.repo.Create(&transaction)
 	if err != nil {
-		http.Error(w, "Failed to create transaction: "+err.Error(), http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, repository.ErrLocationRequired):
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, "A location is required for this warehouse")
+		case errors.Is(err, repository.ErrLocationNotInWarehouse):
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, "The location does not belong to this warehouse")
+		case errors.Is(err, repository.ErrInsufficientLocationStock):
+			writeError(w, http.StatusBadRequest, errCodeInsufficientStock, "Insufficient stock at the source location")
+		case errors.Is(err, repository.ErrNegativeStock):
+			writeError(w, http.StatusBadRequest, errCodeInsufficientStock, "Insufficient stock available")
+		default:
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to create transaction: "+err.Error())
+		}
 		return
 	}
 	
@@ -153,7 +178,7 @@ func (h *TransactionHandler) GetProductTransactions(w http.ResponseWriter, r *ht
 	vars := mux.Vars(r)
 	productID, err := strconv.ParseUint(vars["productId"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid product ID")
 		return
 	}
 	
@@ -192,7 +217,7 @@ func (h *TransactionHandler) GetProductTransactions(w http.ResponseWriter, r *ht
 	
 	transactions, err := h.repo.GetAll(params)
 	if err != nil {
-		http.Error(w, "Failed to retrieve transactions: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve transactions: "+err.Error())
 		return
 	}
 	
@@ -214,20 +239,20 @@ func (h *TransactionHandler) CreateReceiveTransaction(w http.ResponseWriter, r *
 	// Decode request body
 	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
 		return
 	}
 	
 	// Validate request
 	if request.ProductID == 0 || request.WarehouseID == 0 || request.Quantity <= 0 {
-		http.Error(w, "Product ID, warehouse ID, and quantity > 0 are required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Product ID, warehouse ID, and quantity > 0 are required")
 		return
 	}
 	
 	// Set user ID from context (would be set by auth middleware)
 	userID, ok := r.Context().Value("userID").(uint)
 	if !ok {
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
 		return
 	}
 	
@@ -245,7 +270,16 @@ func (h *TransactionHandler) CreateReceiveTransaction(w http.ResponseWriter, r *
 	
 	err = h.repo.Create(&transaction)
 	if err != nil {
-		http.Error(w, "Failed to create transaction: "+err.Error(), http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, repository.ErrLocationRequired):
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, "A location_id is required for this warehouse")
+		case errors.Is(err, repository.ErrLocationNotInWarehouse):
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, "The location_id does not belong to this warehouse")
+		case errors.Is(err, repository.ErrInsufficientLocationStock):
+			writeError(w, http.StatusBadRequest, errCodeInsufficientStock, "Insufficient stock at this location")
+		default:
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to create transaction: "+err.Error())
+		}
 		return
 	}
 	
@@ -269,13 +303,13 @@ func (h *TransactionHandler) CreateIssueTransaction(w http.ResponseWriter, r *ht
 	// Decode request body
 	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
 		return
 	}
 	
 	// Validate request
 	if request.ProductID == 0 || request.WarehouseID == 0 || request.Quantity <= 0 {
-		http.Error(w, "Product ID, warehouse ID, and quantity > 0 are required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Product ID, warehouse ID, and quantity > 0 are required")
 		return
 	}
 	
@@ -283,19 +317,19 @@ func (h *TransactionHandler) CreateIssueTransaction(w http.ResponseWriter, r *ht
 	productRepo := repository.NewProductRepository(h.db)
 	product, err := productRepo.GetByID(request.ProductID)
 	if err != nil {
-		http.Error(w, "Failed to retrieve product: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve product: "+err.Error())
 		return
 	}
 	
 	if product.Quantity < request.Quantity {
-		http.Error(w, "Insufficient stock available", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInsufficientStock, "Insufficient stock available")
 		return
 	}
 	
 	// Set user ID from context (would be set by auth middleware)
 	userID, ok := r.Context().Value("userID").(uint)
 	if !ok {
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
 		return
 	}
 	
@@ -313,7 +347,18 @@ func (h *TransactionHandler) CreateIssueTransaction(w http.ResponseWriter, r *ht
 	
 	err = h.repo.Create(&transaction)
 	if err != nil {
-		http.Error(w, "Failed to create transaction: "+err.Error(), http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, repository.ErrLocationRequired):
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, "A location_id is required for this warehouse")
+		case errors.Is(err, repository.ErrLocationNotInWarehouse):
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, "The location_id does not belong to this warehouse")
+		case errors.Is(err, repository.ErrInsufficientLocationStock):
+			writeError(w, http.StatusBadRequest, errCodeInsufficientStock, "Insufficient stock at this location")
+		case errors.Is(err, repository.ErrNegativeStock):
+			writeError(w, http.StatusBadRequest, errCodeInsufficientStock, "Insufficient stock available")
+		default:
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to create transaction: "+err.Error())
+		}
 		return
 	}
 	
@@ -338,21 +383,21 @@ func (h *TransactionHandler) CreateTransferTransaction(w http.ResponseWriter, r
 	// Decode request body
 	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
 		return
 	}
 	
 	// Validate request
 	if request.ProductID == 0 || request.WarehouseID == 0 || request.Quantity <= 0 ||
 		request.SourceLocationID == 0 || request.DestinationLocationID == 0 {
-		http.Error(w, "Product ID, warehouse ID, source location, destination location, and quantity > 0 are required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Product ID, warehouse ID, source location, destination location, and quantity > 0 are required")
 		return
 	}
 	
 	// Set user ID from context (would be set by auth middleware)
 	userID, ok := r.Context().Value("userID").(uint)
 	if !ok {
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
 		return
 	}
 	
@@ -371,7 +416,74 @@ func (h *TransactionHandler) CreateTransferTransaction(w http.ResponseWriter, r
 	
 	err = h.repo.Create(&transaction)
 	if err != nil {
-		http.Error(w, "Failed to create transaction: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to create transaction: "+err.Error())
+		return
+	}
+	
+	// Return response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(transaction)
+}
+
+// CreateAdjustmentTransaction handles POST requests to correct a product's stock by a
+// signed quantity, for example after damage or a cycle count. A reason code is required,
+// and the adjustment may only take stock below zero when allow_negative is set.
+func (h *TransactionHandler) CreateAdjustmentTransaction(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		ProductID       uint   `json:"product_id"`
+		WarehouseID     uint   `json:"warehouse_id"`
+		Quantity        int    `json:"quantity"` // Signed: positive adds stock, negative removes it
+		ReasonCode      string `json:"reason_code"`
+		AllowNegative   bool   `json:"allow_negative"`
+		ReferenceNumber string `json:"reference_number"`
+		Notes           string `json:"notes"`
+	}
+	
+	// Decode request body
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	
+	// Validate request
+	if request.ProductID == 0 || request.WarehouseID == 0 || request.Quantity == 0 {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Product ID, warehouse ID, and a non-zero quantity are required")
+		return
+	}
+	
+	if !models.AdjustmentReasonCodes[request.ReasonCode] {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Invalid reason code: must be damage, shrinkage, cycle_count, or correction")
+		return
+	}
+	
+	// Set user ID from context (would be set by auth middleware)
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
+		return
+	}
+	
+	transaction := models.InventoryTransaction{
+		ProductID:       request.ProductID,
+		WarehouseID:     request.WarehouseID,
+		Type:            "adjustment",
+		Quantity:        request.Quantity,
+		ReasonCode:      request.ReasonCode,
+		ReferenceNumber: request.ReferenceNumber,
+		Notes:           request.Notes,
+		UserID:          userID,
+	}
+	
+	if err := h.repo.Adjust(&transaction, request.AllowNegative); err != nil {
+		switch {
+		case err == gorm.ErrRecordNotFound:
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Product not found")
+		case errors.Is(err, repository.ErrNegativeStock):
+			writeError(w, http.StatusBadRequest, errCodeInsufficientStock, "Adjustment would take stock below zero; set allow_negative to permit it")
+		default:
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to create transaction: "+err.Error())
+		}
 		return
 	}
 	
@@ -379,4 +491,182 @@ func (h *TransactionHandler) CreateTransferTransaction(w http.ResponseWriter, r
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(transaction)
+}
+
+// GetTransactionStats handles GET requests to summarise transaction counts, quantities and values by type
+func (h *TransactionHandler) GetTransactionStats(w http.ResponseWriter, r *http.Request) {
+	type TypeStats struct {
+		Type          string  `json:"type"`
+		Count         int64   `json:"count"`
+		TotalQuantity int     `json:"total_quantity"`
+		TotalValue    float64 `json:"total_value"`
+	}
+	
+	query := h.db.Table("inventory_transactions").
+		Select("type, COUNT(*) as count, COALESCE(SUM(quantity), 0) as total_quantity, COALESCE(SUM(quantity * unit_cost), 0) as total_value").
+		Group("type").
+		Order("type")
+	
+	// Date range filter
+	if startDate := r.URL.Query().Get("start_date"); startDate != "" {
+		query = query.Where("created_at >= ?", startDate)
+	}
+	
+	if endDate := r.URL.Query().Get("end_date"); endDate != "" {
+		query = query.Where("created_at <= ?", endDate)
+	}
+	
+	// Product and warehouse filters
+	if productID := r.URL.Query().Get("product_id"); productID != "" {
+		query = query.Where("product_id = ?", productID)
+	}
+	
+	if warehouseID := r.URL.Query().Get("warehouse_id"); warehouseID != "" {
+		query = query.Where("warehouse_id = ?", warehouseID)
+	}
+	
+	var byType []TypeStats
+	if err := query.Scan(&byType).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve transaction stats: "+err.Error())
+		return
+	}
+	
+	var totalCount int64
+	var totalValue float64
+	for _, stats := range byType {
+		totalCount += stats.Count
+		totalValue += stats.TotalValue
+	}
+	
+	response := map[string]interface{}{
+		"total_transactions": totalCount,
+		"total_value":        totalValue,
+		"by_type":            byType,
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetTransactionsByReference handles GET requests for transactions grouped by their reference
+// document (e.g. a PO or SO number), newest document first. Transactions without a reference
+// number are left out. Net quantity and value use the same signs as the stock reports.
+func (h *TransactionHandler) GetTransactionsByReference(w http.ResponseWriter, r *http.Request) {
+	type ReferenceDocument struct {
+		ReferenceNumber  string                        `json:"reference_number"`
+		TransactionCount int64                         `json:"transaction_count"`
+		NetQuantity      int                           `json:"net_quantity"`
+		NetValue         float64                       `json:"net_value"`
+		FirstAt          time.Time                     `json:"first_at"`
+		LastAt           time.Time                     `json:"last_at"`
+		Transactions     []models.InventoryTransaction `json:"transactions" gorm:"-"`
+	}
+	
+	var startDate, endDate time.Time
+	if startStr := r.URL.Query().Get("start_date"); startStr != "" {
+		parsedDate, err := parseDateParam(startStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid start_date")
+			return
+		}
+		startDate = parsedDate
+	}
+	
+	if endStr := r.URL.Query().Get("end_date"); endStr != "" {
+		parsedDate, err := parseDateParam(endStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid end_date")
+			return
+		}
+		endDate = parsedDate
+	}
+	
+	// Filters shared by the document and transaction queries
+	filter := func(query *gorm.DB) *gorm.DB {
+		query = query.Where("inventory_transactions.reference_number <> ''")
+		
+		if !startDate.IsZero() {
+			query = query.Where("inventory_transactions.created_at >= ?", startDate)
+		}
+		
+		if !endDate.IsZero() {
+			query = query.Where("inventory_transactions.created_at <= ?", endDate)
+		}
+		
+		if txType := r.URL.Query().Get("type"); txType != "" {
+			query = query.Where("inventory_transactions.type = ?", txType)
+		}
+		
+		if reference := r.URL.Query().Get("reference"); reference != "" {
+			query = query.Where("inventory_transactions.reference_number LIKE ?", "%"+reference+"%")
+		}
+		
+		return query
+	}
+	
+	// Apply pagination to documents rather than transactions
+	page := 1
+	limit := 20
+	
+	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+		if pageNum, err := strconv.Atoi(pageStr); err == nil && pageNum > 0 {
+			page = pageNum
+		}
+	}
+	
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if limitNum, err := strconv.Atoi(limitStr); err == nil && limitNum > 0 {
+			limit = limitNum
+		}
+	}
+	
+	var documents []ReferenceDocument
+	if err := filter(h.db.Table("inventory_transactions")).
+		Select(`
+			inventory_transactions.reference_number,
+			COUNT(*) as transaction_count,
+			COALESCE(SUM(` + signedQuantitySQL + `), 0) as net_quantity,
+			COALESCE(SUM((` + signedQuantitySQL + `) * inventory_transactions.unit_cost), 0) as net_value,
+			MIN(inventory_transactions.created_at) as first_at,
+			MAX(inventory_transactions.created_at) as last_at
+		`).
+		Group("inventory_transactions.reference_number").
+		Order("last_at DESC, inventory_transactions.reference_number").
+		Limit(limit).Offset((page - 1) * limit).
+		Scan(&documents).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve reference documents: "+err.Error())
+		return
+	}
+	
+	if len(documents) > 0 {
+		references := make([]string, len(documents))
+		index := make(map[string]int, len(documents))
+		for i, document := range documents {
+			references[i] = document.ReferenceNumber
+			index[document.ReferenceNumber] = i
+		}
+		
+		var transactions []models.InventoryTransaction
+		if err := filter(h.db.Model(&models.InventoryTransaction{})).
+			Where("inventory_transactions.reference_number IN ?", references).
+			Preload("Product").
+			Preload("Warehouse").
+			Order("inventory_transactions.created_at ASC, inventory_transactions.id ASC").
+			Find(&transactions).Error; err != nil {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve transactions: "+err.Error())
+			return
+		}
+		
+		for _, transaction := range transactions {
+			i := index[transaction.ReferenceNumber]
+			documents[i].Transactions = append(documents[i].Transactions, transaction)
+		}
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"page":      page,
+		"limit":     limit,
+		"documents": documents,
+	})
 }
\ No newline at end of file
@@ -16,6 +16,14 @@ type UserHandler struct {
 	db *gorm.DB
 }
 
+// userSortFields maps the sortable user list fields to their columns
+var userSortFields = map[string]string{
+	"username":   "username",
+	"last_login": "last_login",
+	"created_at": "created_at",
+	"role":       "role",
+}
+
 // NewUserHandler creates a new user handler
 func NewUserHandler(db *gorm.DB) *UserHandler {
 	return &UserHandler{db: db}
@@ -26,7 +34,7 @@ func (h *UserHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
 	var users []models.User
 	
 	// Apply filters if any
-	query := h.db
+	query := withDeleted(r, h.db.Model(&models.User{}))
 	
 	if status := r.URL.Query().Get("status"); status != "" {
 		query = query.Where("status = ?", status)
@@ -42,33 +50,46 @@ func (h *UserHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
 			searchPattern, searchPattern, searchPattern)
 	}
 	
-	// Apply pagination
-	page := 1
-	limit := 10
-	
-	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
-		if pageNum, err := strconv.Atoi(pageStr); err == nil && pageNum > 0 {
-			page = pageNum
+	// Users who have not logged in since the given date (or never)
+	if inactiveSince := r.URL.Query().Get("inactive_since"); inactiveSince != "" {
+		since, err := parseDateParam(inactiveSince)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid inactive_since date, expected YYYY-MM-DD or RFC 3339")
+			return
 		}
+		query = query.Where("last_login < ? OR last_login IS NULL", since)
 	}
 	
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-		if limitNum, err := strconv.Atoi(limitStr); err == nil && limitNum > 0 {
-			limit = limitNum
+	// Sorting
+	order := "username ASC"
+	if sort := r.URL.Query().Get("sort"); sort != "" {
+		var err error
+		order, err = parseSort(sort, userSortFields)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid sort parameter: "+err.Error())
+			return
 		}
 	}
 	
+	// Apply pagination; the total is counted with the same filters
+	page, limit := parsePagination(r)
 	offset := (page - 1) * limit
 	
+	var total int64
+	if err := query.Session(&gorm.Session{}).Model(&models.User{}).Count(&total).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to count users: "+err.Error())
+		return
+	}
+	
 	// Execute query and omit password hash
 	if err := query.Select("id, username, email, full_name, role, status, last_login, created_at, updated_at").
-		Order("username ASC").Limit(limit).Offset(offset).Find(&users).Error; err != nil {
-		http.Error(w, "Failed to retrieve users: "+err.Error(), http.StatusInternalServerError)
+		Order(order).Limit(limit).Offset(offset).Find(&users).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve users: "+err.Error())
 		return
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(users)
+	json.NewEncoder(w).Encode(newPaginatedResponse(users, page, limit, total))
 }
 
 // GetUser handles GET requests to retrieve a single user
@@ -76,7 +97,7 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid user ID")
 		return
 	}
 	
@@ -84,9 +105,9 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 	if err := h.db.Select("id, username, email, full_name, role, status, last_login, created_at, updated_at").
 		First(&user, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "User not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "User not found")
 		} else {
-			http.Error(w, "Failed to retrieve user: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve user: "+err.Error())
 		}
 		return
 	}
@@ -100,26 +121,26 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	var user models.User
 	
 	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
 		return
 	}
 	
 	// Validate required fields
 	if user.Username == "" || user.Email == "" || user.FullName == "" || user.PasswordHash == "" {
-		http.Error(w, "Username, email, full name, and password are required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Username, email, full name, and password are required")
 		return
 	}
 	
 	// Check if username already exists
 	var existingUser models.User
 	if err := h.db.Where("username = ?", user.Username).First(&existingUser).Error; err == nil {
-		http.Error(w, "Username already taken", http.StatusConflict)
+		writeError(w, http.StatusConflict, errCodeDuplicate, "Username already taken")
 		return
 	}
 	
 	// Check if email already exists
 	if err := h.db.Where("email = ?", user.Email).First(&existingUser).Error; err == nil {
-		http.Error(w, "Email already in use", http.StatusConflict)
+		writeError(w, http.StatusConflict, errCodeDuplicate, "Email already in use")
 		return
 	}
 	
@@ -135,16 +156,17 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	// Hash the password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.PasswordHash), bcrypt.DefaultCost)
 	if err != nil {
-		http.Error(w, "Failed to hash password: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to hash password: "+err.Error())
 		return
 	}
 	user.PasswordHash = string(hashedPassword)
 	
 	// Create user in database
 	if err := h.db.Create(&user).Error; err != nil {
-		http.Error(w, "Failed to create user: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to create user: "+err.Error())
 		return
 	}
+	recordAudit(h.db, r, "create", "user", user.ID, nil, user)
 	
 	// Remove password hash from response
 	user.PasswordHash = ""
@@ -159,7 +181,7 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid user ID")
 		return
 	}
 	
@@ -167,9 +189,9 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	var existingUser models.User
 	if err := h.db.First(&existingUser, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "User not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "User not found")
 		} else {
-			http.Error(w, "Failed to retrieve user: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve user: "+err.Error())
 		}
 		return
 	}
@@ -177,7 +199,7 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	// Parse request body
 	var updatedUser models.User
 	if err := json.NewDecoder(r.Body).Decode(&updatedUser); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
 		return
 	}
 	
@@ -188,12 +210,12 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	if updatedUser.Username != "" && updatedUser.Username != existingUser.Username {
 		var count int64
 		if err := h.db.Model(&models.User{}).Where("username = ? AND id != ?", updatedUser.Username, id).Count(&count).Error; err != nil {
-			http.Error(w, "Failed to check username uniqueness: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to check username uniqueness: "+err.Error())
 			return
 		}
 		
 		if count > 0 {
-			http.Error(w, "Username already taken", http.StatusConflict)
+			writeError(w, http.StatusConflict, errCodeDuplicate, "Username already taken")
 			return
 		}
 	}
@@ -202,12 +224,12 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	if updatedUser.Email != "" && updatedUser.Email != existingUser.Email {
 		var count int64
 		if err := h.db.Model(&models.User{}).Where("email = ? AND id != ?", updatedUser.Email, id).Count(&count).Error; err != nil {
-			http.Error(w, "Failed to check email uniqueness: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to check email uniqueness: "+err.Error())
 			return
 		}
 		
 		if count > 0 {
-			http.Error(w, "Email already in use", http.StatusConflict)
+			writeError(w, http.StatusConflict, errCodeDuplicate, "Email already in use")
 			return
 		}
 	}
@@ -217,7 +239,7 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	
 	// Update in database
 	if err := h.db.Model(&updatedUser).Select("username", "email", "full_name", "role", "status").Updates(updatedUser).Error; err != nil {
-		http.Error(w, "Failed to update user: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update user: "+err.Error())
 		return
 	}
 	
@@ -225,9 +247,10 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	var finalUser models.User
 	if err := h.db.Select("id, username, email, full_name, role, status, last_login, created_at, updated_at").
 		First(&finalUser, id).Error; err != nil {
-		http.Error(w, "Failed to retrieve updated user: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve updated user: "+err.Error())
 		return
 	}
+	recordAudit(h.db, r, "update", "user", finalUser.ID, existingUser, finalUser)
 	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(finalUser)
@@ -238,7 +261,7 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid user ID")
 		return
 	}
 	
@@ -246,9 +269,9 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	var user models.User
 	if err := h.db.First(&user, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "User not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "User not found")
 		} else {
-			http.Error(w, "Failed to retrieve user: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve user: "+err.Error())
 		}
 		return
 	}
@@ -257,21 +280,22 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	if user.Role == "admin" {
 		var adminCount int64
 		if err := h.db.Model(&models.User{}).Where("role = ? AND id != ?", "admin", id).Count(&adminCount).Error; err != nil {
-			http.Error(w, "Failed to check admin count: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to check admin count: "+err.Error())
 			return
 		}
 		
 		if adminCount == 0 {
-			http.Error(w, "Cannot delete the last admin user", http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, errCodeInvalidState, "Cannot delete the last admin user")
 			return
 		}
 	}
 	
-	// Soft delete by updating status
-	if err := h.db.Model(&user).Update("status", "inactive").Error; err != nil {
-		http.Error(w, "Failed to deactivate user: "+err.Error(), http.StatusInternalServerError)
+	// Soft delete; a deleted user can no longer log in but can be restored
+	if err := h.db.Delete(&user).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to delete user: "+err.Error())
 		return
 	}
+	recordAudit(h.db, r, "delete", "user", user.ID, user, nil)
 	
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -281,7 +305,7 @@ func (h *UserHandler) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context (set by auth middleware)
 	userID, ok := r.Context().Value("userID").(uint)
 	if !ok {
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
 		return
 	}
 	
@@ -289,9 +313,9 @@ func (h *UserHandler) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
 	if err := h.db.Select("id, username, email, full_name, role, status, last_login, created_at, updated_at").
 		First(&user, userID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "User not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "User not found")
 		} else {
-			http.Error(w, "Failed to retrieve user: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve user: "+err.Error())
 		}
 		return
 	}
@@ -300,12 +324,33 @@ func (h *UserHandler) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(user)
 }
 
+// GetCurrentUserPermissions handles GET requests for the current user's role and the
+// capabilities it grants, so clients can show only the actions the API will allow
+func (h *UserHandler) GetCurrentUserPermissions(w http.ResponseWriter, r *http.Request) {
+	// Get user ID and role from context (set by auth middleware)
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
+		return
+	}
+	
+	// The role in the token is the one RequireRole checks
+	role, _ := r.Context().Value("userRole").(string)
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":      userID,
+		"role":         role,
+		"capabilities": models.RoleCapabilities(role),
+	})
+}
+
 // ChangePassword handles POST requests to change a user's password
 func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context (set by auth middleware)
 	userID, ok := r.Context().Value("userID").(uint)
 	if !ok {
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
 		return
 	}
 	
@@ -316,13 +361,13 @@ func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
 		return
 	}
 	
 	// Validate request
 	if request.CurrentPassword == "" || request.NewPassword == "" {
-		http.Error(w, "Current password and new password are required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Current password and new password are required")
 		return
 	}
 	
@@ -330,31 +375,36 @@ func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	var user models.User
 	if err := h.db.First(&user, userID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "User not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "User not found")
 		} else {
-			http.Error(w, "Failed to retrieve user: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve user: "+err.Error())
 		}
 		return
 	}
 	
 	// Verify current password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(request.CurrentPassword)); err != nil {
-		http.Error(w, "Current password is incorrect", http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, errCodeInvalidCredentials, "Current password is incorrect")
 		return
 	}
 	
 	// Hash the new password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.NewPassword), bcrypt.DefaultCost)
 	if err != nil {
-		http.Error(w, "Failed to hash password: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to hash password: "+err.Error())
 		return
 	}
 	
 	// Update password in database
 	if err := h.db.Model(&user).Update("password_hash", string(hashedPassword)).Error; err != nil {
-		http.Error(w, "Failed to update password: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update password: "+err.Error())
 		return
 	}
 	
 	w.WriteHeader(http.StatusNoContent)
+}
+
+// RestoreUser handles POST requests to undo a user's soft delete, letting them log in again
+func (h *UserHandler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	restoreDeleted(w, r, h.db, &models.User{}, "user", "user")
 }
\ No newline at end of file
@@ -2,12 +2,17 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/yourusername/inventory-management-system/internal/models"
+	"github.com/yourusername/inventory-management-system/internal/repository"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // WarehouseHandler handles HTTP requests for warehouse endpoints
@@ -15,6 +20,14 @@ type WarehouseHandler struct {
 	db *gorm.DB
 }
 
+// warehouseSortFields maps the sort keys accepted by GetWarehouses to their columns
+var warehouseSortFields = map[string]string{
+	"name":       "name",
+	"status":     "status",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
 // NewWarehouseHandler creates a new warehouse handler
 func NewWarehouseHandler(db *gorm.DB) *WarehouseHandler {
 	return &WarehouseHandler{db: db}
@@ -25,7 +38,7 @@ func (h *WarehouseHandler) GetWarehouses(w http.ResponseWriter, r *http.Request)
 	var warehouses []models.Warehouse
 	
 	// Apply filters if any
-	query := h.db
+	query := withDeleted(r, h.db)
 	
 	if status := r.URL.Query().Get("status"); status != "" {
 		query = query.Where("status = ?", status)
@@ -35,13 +48,34 @@ func (h *WarehouseHandler) GetWarehouses(w http.ResponseWriter, r *http.Request)
 		query = query.Where("name LIKE ?", "%"+name+"%")
 	}
 	
-	if err := query.Find(&warehouses).Error; err != nil {
-		http.Error(w, "Failed to retrieve warehouses: "+err.Error(), http.StatusInternalServerError)
+	// Sorting
+	order := "name ASC"
+	if sort := r.URL.Query().Get("sort"); sort != "" {
+		var err error
+		order, err = parseSort(sort, warehouseSortFields)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid sort parameter: "+err.Error())
+			return
+		}
+	}
+	
+	// Apply pagination; the total is counted with the same filters
+	page, limit := parsePagination(r)
+	offset := (page - 1) * limit
+	
+	var total int64
+	if err := query.Session(&gorm.Session{}).Model(&models.Warehouse{}).Count(&total).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to count warehouses: "+err.Error())
+		return
+	}
+	
+	if err := query.Order(order).Limit(limit).Offset(offset).Find(&warehouses).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve warehouses: "+err.Error())
 		return
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(warehouses)
+	json.NewEncoder(w).Encode(newPaginatedResponse(warehouses, page, limit, total))
 }
 
 // GetWarehouse handles GET requests to retrieve a single warehouse
@@ -49,16 +83,16 @@ func (h *WarehouseHandler) GetWarehouse(w http.ResponseWriter, r *http.Request)
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid warehouse ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid warehouse ID")
 		return
 	}
 	
 	var warehouse models.Warehouse
 	if err := h.db.First(&warehouse, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Warehouse not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Warehouse not found")
 		} else {
-			http.Error(w, "Failed to retrieve warehouse: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve warehouse: "+err.Error())
 		}
 		return
 	}
@@ -72,17 +106,17 @@ func (h *WarehouseHandler) CreateWarehouse(w http.ResponseWriter, r *http.Reques
 	var warehouse models.Warehouse
 	
 	if err := json.NewDecoder(r.Body).Decode(&warehouse); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
 		return
 	}
 	
 	if warehouse.Name == "" {
-		http.Error(w, "Warehouse name is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Warehouse name is required")
 		return
 	}
 	
 	if err := h.db.Create(&warehouse).Error; err != nil {
-		http.Error(w, "Failed to create warehouse: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to create warehouse: "+err.Error())
 		return
 	}
 	
@@ -96,23 +130,23 @@ func (h *WarehouseHandler) UpdateWarehouse(w http.ResponseWriter, r *http.Reques
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid warehouse ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid warehouse ID")
 		return
 	}
 	
 	var existingWarehouse models.Warehouse
 	if err := h.db.First(&existingWarehouse, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Warehouse not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Warehouse not found")
 		} else {
-			http.Error(w, "Failed to retrieve warehouse: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve warehouse: "+err.Error())
 		}
 		return
 	}
 	
 	var updatedWarehouse models.Warehouse
 	if err := json.NewDecoder(r.Body).Decode(&updatedWarehouse); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
 		return
 	}
 	
@@ -120,7 +154,7 @@ func (h *WarehouseHandler) UpdateWarehouse(w http.ResponseWriter, r *http.Reques
 	updatedWarehouse.ID = uint(id)
 	
 	if err := h.db.Save(&updatedWarehouse).Error; err != nil {
-		http.Error(w, "Failed to update warehouse: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update warehouse: "+err.Error())
 		return
 	}
 	
@@ -133,62 +167,179 @@ func (h *WarehouseHandler) DeleteWarehouse(w http.ResponseWriter, r *http.Reques
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid warehouse ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid warehouse ID")
 		return
 	}
 	
 	var warehouse models.Warehouse
 	if err := h.db.First(&warehouse, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Warehouse not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Warehouse not found")
 		} else {
-			http.Error(w, "Failed to retrieve warehouse: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve warehouse: "+err.Error())
 		}
 		return
 	}
 	
-	// Soft delete by updating status
-	if err := h.db.Model(&warehouse).Update("status", "inactive").Error; err != nil {
-		http.Error(w, "Failed to delete warehouse: "+err.Error(), http.StatusInternalServerError)
+	// Soft delete; the warehouse can be restored
+	if err := h.db.Delete(&warehouse).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to delete warehouse: "+err.Error())
 		return
 	}
 	
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// GetWarehouseProducts handles GET requests to retrieve products in a warehouse
+// warehouseProduct is a product as stocked in one warehouse. Quantity is the warehouse's
+// stock, not the product's total across warehouses.
+type warehouseProduct struct {
+	ProductID    uint    `json:"product_id"`
+	SKU          string  `json:"sku"`
+	Name         string  `json:"name"`
+	Status       string  `json:"status"`
+	Price        float64 `json:"price"`
+	CostPrice    float64 `json:"cost_price"`
+	Quantity     int     `json:"quantity"`
+	LocationID   *uint   `json:"location_id"`
+	LocationCode string  `json:"location_code"`
+	MinQuantity  int     `json:"min_quantity"`
+	MaxQuantity  int     `json:"max_quantity"`
+	BelowMinimum bool    `json:"below_minimum"`
+}
+
+// GetWarehouseProducts handles GET requests to retrieve the products stocked in a warehouse
+// with their quantity and location there
 func (h *WarehouseHandler) GetWarehouseProducts(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	id, err := strconv.ParseUint(vars["warehouseId"], 10, 64)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid warehouse ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid warehouse ID")
 		return
 	}
 	
-	var products []models.Product
-	if err := h.db.Joins("JOIN product_warehouse ON products.id = product_warehouse.product_id").
-		Where("product_warehouse.warehouse_id = ?", id).
-		Find(&products).Error; err != nil {
-		http.Error(w, "Failed to retrieve products: "+err.Error(), http.StatusInternalServerError)
+	stock, err := repository.NewProductRepository(h.db).GetProductsByWarehouse(uint(id))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve products: "+err.Error())
 		return
 	}
 	
+	belowMinimumOnly := r.URL.Query().Get("below_minimum") == "true"
+	
+	// Minimum levels are set per warehouse, so compare them with the product's warehouse total
+	warehouseTotals := make(map[uint]int)
+	for _, pw := range stock {
+		warehouseTotals[pw.ProductID] += pw.Quantity
+	}
+	
+	products := []warehouseProduct{}
+	for _, pw := range stock {
+		// Soft-deleted products aren't preloaded
+		if pw.Product == nil {
+			continue
+		}
+		
+		product := warehouseProduct{
+			ProductID:    pw.ProductID,
+			SKU:          pw.Product.SKU,
+			Name:         pw.Product.Name,
+			Status:       pw.Product.Status,
+			Price:        pw.Product.Price,
+			CostPrice:    pw.Product.CostPrice,
+			Quantity:     pw.Quantity,
+			LocationID:   pw.LocationID,
+			MinQuantity:  pw.MinQuantity,
+			MaxQuantity:  pw.MaxQuantity,
+			BelowMinimum: pw.MinQuantity > 0 && warehouseTotals[pw.ProductID] < pw.MinQuantity,
+		}
+		if pw.Location != nil {
+			product.LocationCode = pw.Location.GetFullLocationCode()
+		}
+		
+		if belowMinimumOnly && !product.BelowMinimum {
+			continue
+		}
+		products = append(products, product)
+	}
+	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(products)
 }
 
+// UpdateWarehouseProductLevels handles PUT requests to set a product's minimum and maximum
+// stock levels in a warehouse
+func (h *WarehouseHandler) UpdateWarehouseProductLevels(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid warehouse ID")
+		return
+	}
+	
+	productID, err := strconv.ParseUint(vars["productId"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid product ID")
+		return
+	}
+	
+	var request struct {
+		MinQuantity int `json:"min_quantity"`
+		MaxQuantity int `json:"max_quantity"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	
+	if request.MinQuantity < 0 || request.MaxQuantity < 0 {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "min_quantity and max_quantity cannot be negative")
+		return
+	}
+	if request.MaxQuantity > 0 && request.MinQuantity > request.MaxQuantity {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "min_quantity cannot exceed max_quantity")
+		return
+	}
+	
+	var stock models.ProductWarehouse
+	if err := h.db.Where("warehouse_id = ? AND product_id = ?", id, productID).First(&stock).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Product is not stocked in this warehouse")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve warehouse stock: "+err.Error())
+		}
+		return
+	}
+	oldStock := stock
+	
+	// The levels apply to the warehouse as a whole, so every location's record carries them
+	if err := h.db.Model(&models.ProductWarehouse{}).
+		Where("warehouse_id = ? AND product_id = ?", id, productID).
+		Updates(map[string]interface{}{
+			"min_quantity": request.MinQuantity,
+			"max_quantity": request.MaxQuantity,
+		}).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update stock levels: "+err.Error())
+		return
+	}
+	stock.MinQuantity = request.MinQuantity
+	stock.MaxQuantity = request.MaxQuantity
+	recordAudit(h.db, r, "update", "product_warehouse", stock.ProductID, oldStock, stock)
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stock)
+}
+
 // GetWarehouseLocations handles GET requests to retrieve locations within a warehouse
 func (h *WarehouseHandler) GetWarehouseLocations(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid warehouse ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid warehouse ID")
 		return
 	}
 	
 	var locations []models.WarehouseLocation
 	if err := h.db.Where("warehouse_id = ?", id).Find(&locations).Error; err != nil {
-		http.Error(w, "Failed to retrieve locations: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve locations: "+err.Error())
 		return
 	}
 	
@@ -200,7 +351,7 @@ func (h *WarehouseHandler) GetWarehouseLocations(w http.ResponseWriter, r *http.
 func (h *WarehouseHandler) GetAllLocations(w http.ResponseWriter, r *http.Request) {
 	var locations []models.WarehouseLocation
 	
-	query := h.db.Preload("Warehouse")
+	query := withDeleted(r, h.db).Preload("Warehouse")
 	
 	// Apply filters
 	if warehouseID := r.URL.Query().Get("warehouse_id"); warehouseID != "" {
@@ -212,7 +363,7 @@ func (h *WarehouseHandler) GetAllLocations(w http.ResponseWriter, r *http.Reques
 	}
 	
 	if err := query.Find(&locations).Error; err != nil {
-		http.Error(w, "Failed to retrieve locations: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve locations: "+err.Error())
 		return
 	}
 	
@@ -225,16 +376,16 @@ func (h *WarehouseHandler) GetLocation(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid location ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid location ID")
 		return
 	}
 	
 	var location models.WarehouseLocation
 	if err := h.db.Preload("Warehouse").First(&location, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Location not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Location not found")
 		} else {
-			http.Error(w, "Failed to retrieve location: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve location: "+err.Error())
 		}
 		return
 	}
@@ -248,17 +399,17 @@ func (h *WarehouseHandler) CreateLocation(w http.ResponseWriter, r *http.Request
 	var location models.WarehouseLocation
 	
 	if err := json.NewDecoder(r.Body).Decode(&location); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
 		return
 	}
 	
 	if location.WarehouseID == 0 {
-		http.Error(w, "Warehouse ID is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Warehouse ID is required")
 		return
 	}
 	
 	if err := h.db.Create(&location).Error; err != nil {
-		http.Error(w, "Failed to create location: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to create location: "+err.Error())
 		return
 	}
 	
@@ -272,30 +423,30 @@ func (h *WarehouseHandler) UpdateLocation(w http.ResponseWriter, r *http.Request
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid location ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid location ID")
 		return
 	}
 	
 	var existingLocation models.WarehouseLocation
 	if err := h.db.First(&existingLocation, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Location not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Location not found")
 		} else {
-			http.Error(w, "Failed to retrieve location: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve location: "+err.Error())
 		}
 		return
 	}
 	
 	var updatedLocation models.WarehouseLocation
 	if err := json.NewDecoder(r.Body).Decode(&updatedLocation); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
 		return
 	}
 	
 	updatedLocation.ID = uint(id)
 	
 	if err := h.db.Save(&updatedLocation).Error; err != nil {
-		http.Error(w, "Failed to update location: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update location: "+err.Error())
 		return
 	}
 	
@@ -308,24 +459,639 @@ func (h *WarehouseHandler) DeleteLocation(w http.ResponseWriter, r *http.Request
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid location ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid location ID")
 		return
 	}
 	
 	var location models.WarehouseLocation
 	if err := h.db.First(&location, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Location not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Location not found")
 		} else {
-			http.Error(w, "Failed to retrieve location: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve location: "+err.Error())
 		}
 		return
 	}
 	
 	if err := h.db.Delete(&location).Error; err != nil {
-		http.Error(w, "Failed to delete location: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to delete location: "+err.Error())
 		return
 	}
 	
 	w.WriteHeader(http.StatusNoContent)
+}
+
+// maxGeneratedLocations bounds how many locations a single grid spec may produce
+const maxGeneratedLocations = 10000
+
+// GenerateWarehouseLocations handles POST requests to create a warehouse's locations from a grid spec.
+// Every combination of zone, aisle, rack, shelf and bin is created; aisles, racks, shelves and
+// bins are numbered from 01. Locations that already exist are skipped.
+func (h *WarehouseHandler) GenerateWarehouseLocations(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid warehouse ID")
+		return
+	}
+	
+	// Check if warehouse exists
+	var warehouse models.Warehouse
+	if err := h.db.First(&warehouse, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Warehouse not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve warehouse: "+err.Error())
+		}
+		return
+	}
+	
+	var spec struct {
+		Zones   []string `json:"zones"`
+		Aisles  int      `json:"aisles"`
+		Racks   int      `json:"racks"`
+		Shelves int      `json:"shelves"`
+		Bins    int      `json:"bins"`
+	}
+	
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	
+	if len(spec.Zones) == 0 || spec.Aisles <= 0 || spec.Racks <= 0 || spec.Shelves <= 0 || spec.Bins <= 0 {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Zones and positive aisle, rack, shelf and bin counts are required")
+		return
+	}
+	
+	// Check the bound step by step so large counts can't overflow the product
+	total := len(spec.Zones)
+	for _, n := range []int{spec.Aisles, spec.Racks, spec.Shelves, spec.Bins} {
+		if n > maxGeneratedLocations || total*n > maxGeneratedLocations {
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, fmt.Sprintf("Spec would generate more than %d locations", maxGeneratedLocations))
+			return
+		}
+		total *= n
+	}
+	
+	created := 0
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// Index the existing locations so they can be skipped
+		var existing []models.WarehouseLocation
+		if err := tx.Where("warehouse_id = ?", id).Find(&existing).Error; err != nil {
+			return err
+		}
+		
+		existingCodes := make(map[string]bool, len(existing))
+		for _, location := range existing {
+			existingCodes[location.GetFullLocationCode()] = true
+		}
+		
+		var locations []models.WarehouseLocation
+		for _, zone := range spec.Zones {
+			for aisle := 1; aisle <= spec.Aisles; aisle++ {
+				for rack := 1; rack <= spec.Racks; rack++ {
+					for shelf := 1; shelf <= spec.Shelves; shelf++ {
+						for bin := 1; bin <= spec.Bins; bin++ {
+							location := models.WarehouseLocation{
+								WarehouseID: uint(id),
+								Zone:        zone,
+								Aisle:       fmt.Sprintf("%02d", aisle),
+								Rack:        fmt.Sprintf("%02d", rack),
+								Shelf:       fmt.Sprintf("%02d", shelf),
+								Bin:         fmt.Sprintf("%02d", bin),
+							}
+							if existingCodes[location.GetFullLocationCode()] {
+								continue
+							}
+							existingCodes[location.GetFullLocationCode()] = true
+							locations = append(locations, location)
+						}
+					}
+				}
+			}
+		}
+		
+		if len(locations) == 0 {
+			return nil
+		}
+		
+		if err := tx.CreateInBatches(locations, 500).Error; err != nil {
+			return err
+		}
+		created = len(locations)
+		return nil
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to generate locations: "+err.Error())
+		return
+	}
+	
+	response := map[string]interface{}{
+		"warehouse_id": warehouse.ID,
+		"created":      created,
+		"skipped":      total - created,
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetWarehouseSnapshot handles GET requests for a warehouse's stock position as of a past date.
+// Quantities are rebuilt from the warehouse's transactions up to the end of that day; products
+// that have moved through the warehouse but had no movement before the date show as zero.
+func (h *WarehouseHandler) GetWarehouseSnapshot(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid warehouse ID")
+		return
+	}
+	
+	dateStr := r.URL.Query().Get("date")
+	if dateStr == "" {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Date is required")
+		return
+	}
+	
+	date, err := time.Parse("2006-01-02", dateStr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid date: use YYYY-MM-DD")
+		return
+	}
+	asOf := date.Add(24 * time.Hour) // Include the whole day
+	
+	// Check if warehouse exists
+	var warehouse models.Warehouse
+	if err := h.db.First(&warehouse, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Warehouse not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve warehouse: "+err.Error())
+		}
+		return
+	}
+	
+	type SnapshotLine struct {
+		ProductID   uint    `json:"product_id"`
+		ProductSKU  string  `json:"product_sku"`
+		ProductName string  `json:"product_name"`
+		Quantity    int     `json:"quantity"`
+		CostPrice   float64 `json:"cost_price"`
+		Value       float64 `json:"value"`
+	}
+	
+	lines := []SnapshotLine{}
+	if err := h.db.Table("products").
+		Select(`
+			products.id as product_id,
+			products.sku as product_sku,
+			products.name as product_name,
+			COALESCE(SUM(`+signedQuantitySQL+`), 0) as quantity,
+			products.cost_price,
+			COALESCE(SUM(`+signedQuantitySQL+`), 0) * products.cost_price as value
+		`).
+		Joins("LEFT JOIN inventory_transactions ON inventory_transactions.product_id = products.id AND inventory_transactions.warehouse_id = ? AND inventory_transactions.created_at < ?", id, asOf).
+		Where("products.id IN (SELECT product_id FROM inventory_transactions WHERE warehouse_id = ?)", id).
+		// Products deleted since the date were still stocked on it
+		Where("products.deleted_at IS NULL OR products.deleted_at >= ?", asOf).
+		Group("products.id, products.sku, products.name, products.cost_price").
+		Order("products.sku").
+		Scan(&lines).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to build warehouse snapshot: "+err.Error())
+		return
+	}
+	
+	var totalQuantity int
+	var totalValue float64
+	for _, line := range lines {
+		totalQuantity += line.Quantity
+		totalValue += line.Value
+	}
+	
+	snapshot := map[string]interface{}{
+		"warehouse_id":   warehouse.ID,
+		"warehouse_name": warehouse.Name,
+		"as_of":          dateStr,
+		"total_quantity": totalQuantity,
+		"total_value":    totalValue,
+		"items":          lines,
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// GetWarehouseAttentionStock handles GET requests for the stock in a warehouse that needs dealing with.
+// A product is listed when its last receipt into the warehouse (or, if never received, when it was
+// first stocked there) is more than aged_days ago. Lot expiry isn't tracked, so expiring_days is rejected.
+func (h *WarehouseHandler) GetWarehouseAttentionStock(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid warehouse ID")
+		return
+	}
+	
+	if r.URL.Query().Get("expiring_days") != "" {
+		writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Lot expiry is not tracked; expiring_days is not supported")
+		return
+	}
+	
+	agedDays := 90
+	if agedStr := r.URL.Query().Get("aged_days"); agedStr != "" {
+		agedDays, err = strconv.Atoi(agedStr)
+		if err != nil || agedDays < 0 {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid aged_days")
+			return
+		}
+	}
+	cutoff := time.Now().AddDate(0, 0, -agedDays)
+	
+	// Check if warehouse exists
+	var warehouse models.Warehouse
+	if err := h.db.First(&warehouse, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Warehouse not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve warehouse: "+err.Error())
+		}
+		return
+	}
+	
+	type AttentionItem struct {
+		ProductID    uint      `json:"product_id"`
+		ProductSKU   string    `json:"product_sku"`
+		ProductName  string    `json:"product_name"`
+		Quantity     int       `json:"quantity"`
+		Value        float64   `json:"value"`
+		LastReceived time.Time `json:"last_received"`
+		AgeDays      int       `json:"age_days"`
+		Reason       string    `json:"reason"`
+	}
+	
+	// Stock rows are summed per product across the warehouse's locations; the last receipt
+	// comes from a lateral subquery so joining transactions doesn't multiply the sums
+	items := []AttentionItem{}
+	if err := h.db.Table("product_warehouses").
+		Select(`
+			products.id as product_id,
+			products.sku as product_sku,
+			products.name as product_name,
+			SUM(product_warehouses.quantity) as quantity,
+			SUM(product_warehouses.quantity) * products.cost_price as value,
+			COALESCE(last_receipt.received_at, MIN(product_warehouses.created_at)) as last_received
+		`).
+		Joins("JOIN products ON products.id = product_warehouses.product_id AND products.deleted_at IS NULL").
+		Joins(`LEFT JOIN LATERAL (
+			SELECT MAX(created_at) as received_at FROM inventory_transactions
+			WHERE inventory_transactions.product_id = products.id
+				AND inventory_transactions.warehouse_id = ?
+				AND inventory_transactions.type = 'receive'
+		) last_receipt ON true`, id).
+		Where("product_warehouses.warehouse_id = ?", id).
+		Group("products.id, products.sku, products.name, products.cost_price, last_receipt.received_at").
+		Having("SUM(product_warehouses.quantity) > 0 AND COALESCE(last_receipt.received_at, MIN(product_warehouses.created_at)) < ?", cutoff).
+		Order("last_received ASC").
+		Scan(&items).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve attention stock: "+err.Error())
+		return
+	}
+	
+	var totalValue float64
+	for i := range items {
+		items[i].AgeDays = int(time.Since(items[i].LastReceived).Hours() / 24)
+		items[i].Reason = "aged"
+		totalValue += items[i].Value
+	}
+	
+	response := map[string]interface{}{
+		"warehouse_id":   warehouse.ID,
+		"warehouse_name": warehouse.Name,
+		"aged_days":      agedDays,
+		"total_items":    len(items),
+		"total_value":    totalValue,
+		"items":          items,
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetWarehouseInventoryValue handles GET requests for the value at cost of the stock held in a warehouse
+func (h *WarehouseHandler) GetWarehouseInventoryValue(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid warehouse ID")
+		return
+	}
+	
+	// Check if warehouse exists
+	var warehouse models.Warehouse
+	if err := h.db.First(&warehouse, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Warehouse not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve warehouse: "+err.Error())
+		}
+		return
+	}
+	
+	products, totalValue, err := queryInventoryValue(h.db, r.URL.Query().Get("category"), strconv.FormatUint(id, 10))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to calculate warehouse inventory value: "+err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"generated_at":   time.Now(),
+		"warehouse_id":   warehouse.ID,
+		"warehouse_name": warehouse.Name,
+		"total_items":    len(products),
+		"total_value":    totalValue,
+		"items":          products,
+	})
+}
+
+// RestoreWarehouse handles POST requests to undo a warehouse's soft delete
+func (h *WarehouseHandler) RestoreWarehouse(w http.ResponseWriter, r *http.Request) {
+	restoreDeleted(w, r, h.db, &models.Warehouse{}, "warehouse", "warehouse")
+}
+
+// RestoreLocation handles POST requests to undo a warehouse location's soft delete
+func (h *WarehouseHandler) RestoreLocation(w http.ResponseWriter, r *http.Request) {
+	restoreDeleted(w, r, h.db, &models.WarehouseLocation{}, "warehouse_location", "location")
+}
+
+// errInvalidStockTake marks stock take counts that can't be applied
+var errInvalidStockTake = errors.New("invalid stock take")
+
+// stockTakeCount is one counted product at one location in a stock take submission
+type stockTakeCount struct {
+	ProductID       uint  `json:"product_id"`
+	LocationID      *uint `json:"location_id"`
+	CountedQuantity int   `json:"counted_quantity"`
+}
+
+// CreateStockTake handles POST requests to submit a physical count for a warehouse. Each
+// count is compared with the stock the system holds for that product at that location,
+// and every mismatch gets a cycle_count adjustment that brings both the location and the
+// product's total in line with the count. Products and locations not in the submission are
+// left untouched. Everything is written in one database transaction.
+func (h *WarehouseHandler) CreateStockTake(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid warehouse ID")
+		return
+	}
+	
+	var request struct {
+		Counts []stockTakeCount `json:"counts"`
+		Notes  string           `json:"notes"`
+	}
+	
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "Invalid request body: "+err.Error())
+		return
+	}
+	
+	if len(request.Counts) == 0 {
+		writeError(w, http.StatusBadRequest, errCodeValidationFailed, "At least one count is required")
+		return
+	}
+	
+	// Get user ID from context (set by auth middleware)
+	userID, ok := r.Context().Value("userID").(uint)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errCodeUnauthenticated, "User not authenticated")
+		return
+	}
+	
+	type countKey struct{ productID, locationID uint }
+	seen := make(map[countKey]bool)
+	for _, count := range request.Counts {
+		if count.ProductID == 0 || count.CountedQuantity < 0 {
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, "Each count needs a product ID and a counted quantity >= 0")
+			return
+		}
+		key := countKey{productID: count.ProductID}
+		if count.LocationID != nil {
+			key.locationID = *count.LocationID
+		}
+		if seen[key] {
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, fmt.Sprintf("Product %d is counted more than once at location %d", key.productID, key.locationID))
+			return
+		}
+		seen[key] = true
+	}
+	
+	stockTake := models.StockTake{
+		WarehouseID: uint(id),
+		UserID:      userID,
+		Notes:       request.Notes,
+	}
+	
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		var warehouse models.Warehouse
+		if err := tx.First(&warehouse, id).Error; err != nil {
+			return err
+		}
+		return applyStockTake(tx, &stockTake, request.Counts)
+	})
+	if err != nil {
+		switch {
+		case err == gorm.ErrRecordNotFound:
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Warehouse not found")
+		case errors.Is(err, errInvalidStockTake):
+			writeError(w, http.StatusBadRequest, errCodeValidationFailed, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to record stock take: "+err.Error())
+		}
+		return
+	}
+	
+	response := stockTakeSummary(stockTake)
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// applyStockTake saves stockTake and its lines for counts, posting a cycle_count adjustment
+// for every count that differs from the stock recorded at its location. Must be called
+// inside a transaction; stockTake.WarehouseID and UserID must be set.
+func applyStockTake(tx *gorm.DB, stockTake *models.StockTake, counts []stockTakeCount) error {
+	if err := tx.Create(stockTake).Error; err != nil {
+		return err
+	}
+	referenceNumber := fmt.Sprintf("ST-%d", stockTake.ID)
+	
+	for _, count := range counts {
+		line := models.StockTakeLine{
+			StockTakeID:     stockTake.ID,
+			ProductID:       count.ProductID,
+			CountedQuantity: count.CountedQuantity,
+		}
+		if count.LocationID != nil {
+			line.LocationID = *count.LocationID
+		}
+		
+		// Like receipts and issues, counts must name a location wherever the warehouse has them
+		if err := repository.CheckLocation(tx, stockTake.WarehouseID, count.LocationID); err != nil {
+			if errors.Is(err, repository.ErrLocationRequired) || errors.Is(err, repository.ErrLocationNotInWarehouse) {
+				return fmt.Errorf("%w: product %d: %w", errInvalidStockTake, count.ProductID, err)
+			}
+			return err
+		}
+		
+		// Lock the counted stock record so concurrent movements wait for the count
+		var stock models.ProductWarehouse
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Scopes(models.StockAt(line.ProductID, stockTake.WarehouseID, count.LocationID)).
+			First(&stock).Error
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return err
+		}
+		exists := err == nil
+		
+		line.SystemQuantity = stock.Quantity
+		line.Difference = line.CountedQuantity - line.SystemQuantity
+		
+		if line.Difference != 0 {
+			transaction := models.InventoryTransaction{
+				ProductID:       line.ProductID,
+				WarehouseID:     stockTake.WarehouseID,
+				Type:            "adjustment",
+				ReasonCode:      "cycle_count",
+				Quantity:        line.Difference,
+				ReferenceNumber: referenceNumber,
+				UserID:          stockTake.UserID,
+				Notes:           "Stock take " + referenceNumber,
+			}
+			if count.LocationID != nil {
+				if line.Difference > 0 {
+					transaction.DestinationLocationID = count.LocationID
+				} else {
+					transaction.SourceLocationID = count.LocationID
+				}
+			}
+			
+			// The count is authoritative, so the total follows it even below zero
+			if err := repository.NewTransactionRepository(tx).Adjust(&transaction, true); err != nil {
+				if err == gorm.ErrRecordNotFound {
+					return fmt.Errorf("%w: product %d not found", errInvalidStockTake, line.ProductID)
+				}
+				return err
+			}
+			line.TransactionID = &transaction.ID
+			
+			if exists {
+				if err := tx.Model(&models.ProductWarehouse{}).
+					Scopes(models.StockAt(line.ProductID, stockTake.WarehouseID, count.LocationID)).
+					UpdateColumn("quantity", line.CountedQuantity).Error; err != nil {
+					return err
+				}
+			} else {
+				// A receipt may have created the record since it was looked up; the count still wins
+				if err := tx.Clauses(clause.OnConflict{
+					Columns:   []clause.Column{{Name: "product_id"}, {Name: "warehouse_id"}, {Name: "location_id"}},
+					DoUpdates: clause.AssignmentColumns([]string{"quantity", "updated_at"}),
+				}).Create(&models.ProductWarehouse{
+					ProductID:   line.ProductID,
+					WarehouseID: stockTake.WarehouseID,
+					LocationID:  count.LocationID,
+					Quantity:    line.CountedQuantity,
+				}).Error; err != nil {
+					return err
+				}
+			}
+		}
+		
+		if err := tx.Create(&line).Error; err != nil {
+			return err
+		}
+		stockTake.Lines = append(stockTake.Lines, line)
+	}
+	
+	return nil
+}
+
+// stockTakeSummary reports a stock take with its count of lines and net difference
+func stockTakeSummary(stockTake models.StockTake) map[string]interface{} {
+	adjusted := 0
+	netDifference := 0
+	for _, line := range stockTake.Lines {
+		if line.Difference != 0 {
+			adjusted++
+			netDifference += line.Difference
+		}
+	}
+	
+	return map[string]interface{}{
+		"stock_take":     stockTake,
+		"lines_counted":  len(stockTake.Lines),
+		"lines_adjusted": adjusted,
+		"net_difference": netDifference,
+	}
+}
+
+// GetWarehouseMovementSummary handles GET requests for per-product movement totals at one
+// warehouse, optionally between start and end (YYYY-MM-DD or RFC 3339)
+func (h *WarehouseHandler) GetWarehouseMovementSummary(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidID, "Invalid warehouse ID")
+		return
+	}
+	
+	var startDate, endDate time.Time
+	if startStr := r.URL.Query().Get("start"); startStr != "" {
+		if startDate, err = parseDateParam(startStr); err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid start")
+			return
+		}
+	}
+	
+	if endStr := r.URL.Query().Get("end"); endStr != "" {
+		if endDate, err = parseDateParam(endStr); err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid end")
+			return
+		}
+	}
+	
+	var warehouse models.Warehouse
+	if err := h.db.First(&warehouse, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "Warehouse not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to retrieve warehouse: "+err.Error())
+		}
+		return
+	}
+	
+	movements, err := repository.NewTransactionRepository(h.db).GetWarehouseMovementSummary(warehouse.ID, startDate, endDate)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "Failed to summarize movements: "+err.Error())
+		return
+	}
+	
+	response := map[string]interface{}{
+		"warehouse_id":   warehouse.ID,
+		"warehouse_name": warehouse.Name,
+		"products":       movements,
+	}
+	if !startDate.IsZero() {
+		response["start"] = startDate
+	}
+	if !endDate.IsZero() {
+		response["end"] = endDate
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
 }
\ No newline at end of file
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/yourusername/inventory-management-system/internal/models"
+	"github.com/yourusername/inventory-management-system/internal/testutil"
+	"gorm.io/gorm"
+)
+
+// submitStockTake posts counts for a warehouse to CreateStockTake
+func submitStockTake(h *WarehouseHandler, warehouseID, userID uint, counts []stockTakeCount) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]interface{}{"counts": counts})
+	r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/warehouses/%d/stock-take", warehouseID), bytes.NewReader(body))
+	r = mux.SetURLVars(r, map[string]string{"id": fmt.Sprint(warehouseID)})
+	r = r.WithContext(context.WithValue(r.Context(), "userID", userID))
+
+	w := httptest.NewRecorder()
+	h.CreateStockTake(w, r)
+	return w
+}
+
+// productQuantity reads a product's total stock
+func productQuantity(t *testing.T, db *gorm.DB, productID uint) int {
+	t.Helper()
+	var product models.Product
+	if err := db.First(&product, productID).Error; err != nil {
+		t.Fatalf("reading product: %v", err)
+	}
+	return product.Quantity
+}
+
+func TestCreateStockTakeInWarehouseWithoutLocations(t *testing.T) {
+	db := testutil.Tx(t)
+	user := testutil.CreateUser(t, db, "staff")
+	product := testutil.CreateProduct(t, db, 7)
+	warehouse := testutil.CreateWarehouse(t, db)
+	h := NewWarehouseHandler(db)
+
+	// The first count creates the warehouse's record; the second corrects it
+	for _, counted := range []int{10, 4} {
+		w := submitStockTake(h, warehouse.ID, user.ID, []stockTakeCount{{ProductID: product.ID, CountedQuantity: counted}})
+		if w.Code != http.StatusCreated {
+			t.Fatalf("counting %d: status %d: %s", counted, w.Code, w.Body)
+		}
+	}
+
+	var records []models.ProductWarehouse
+	if err := db.Where("product_id = ? AND warehouse_id = ?", product.ID, warehouse.ID).Find(&records).Error; err != nil {
+		t.Fatalf("reading warehouse stock: %v", err)
+	}
+	if len(records) != 1 || records[0].LocationID != nil || records[0].Quantity != 4 {
+		t.Errorf("warehouse stock = %+v, want one record without a location holding 4", records)
+	}
+
+	// 7 on hand, +10 for the first count and -6 for the second
+	if got := productQuantity(t, db, product.ID); got != 11 {
+		t.Errorf("product quantity = %d, want 11", got)
+	}
+}
+
+func TestCreateStockTakeRequiresLocationWhereWarehouseHasThem(t *testing.T) {
+	db := testutil.Tx(t)
+	user := testutil.CreateUser(t, db, "staff")
+	product := testutil.CreateProduct(t, db, 7)
+	warehouse := testutil.CreateWarehouse(t, db)
+	testutil.CreateLocation(t, db, warehouse.ID)
+	h := NewWarehouseHandler(db)
+
+	w := submitStockTake(h, warehouse.ID, user.ID, []stockTakeCount{{ProductID: product.ID, CountedQuantity: 3}})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("count without a location: status %d, want 400: %s", w.Code, w.Body)
+	}
+
+	var records int64
+	if err := db.Model(&models.ProductWarehouse{}).Where("product_id = ?", product.ID).Count(&records).Error; err != nil {
+		t.Fatalf("counting warehouse stock: %v", err)
+	}
+	if records != 0 {
+		t.Errorf("rejected count left %d stock records", records)
+	}
+	if got := productQuantity(t, db, product.ID); got != 7 {
+		t.Errorf("product quantity after a rejected count = %d, want 7", got)
+	}
+}
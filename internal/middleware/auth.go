@@ -2,10 +2,12 @@ package middleware
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/yourusername/inventory-management-system/internal/models"
 )
 
 // Authenticate is a middleware that verifies JWT tokens
@@ -15,14 +17,14 @@ func Authenticate(jwtSecret string) func(http.Handler) http.Handler {
 			// Get token from Authorization header
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" {
-				http.Error(w, "Authorization header is required", http.StatusUnauthorized)
+				writeJSONError(w, http.StatusUnauthorized, "UNAUTHENTICATED", "Authorization header is required")
 				return
 			}
 
 			// Check if the format is "Bearer <token>"
 			parts := strings.Split(authHeader, " ")
 			if len(parts) != 2 || parts[0] != "Bearer" {
-				http.Error(w, "Authorization header format must be 'Bearer <token>'", http.StatusUnauthorized)
+				writeJSONError(w, http.StatusUnauthorized, "UNAUTHENTICATED", "Authorization header format must be 'Bearer <token>'")
 				return
 			}
 
@@ -38,26 +40,26 @@ func Authenticate(jwtSecret string) func(http.Handler) http.Handler {
 			})
 
 			if err != nil {
-				http.Error(w, "Invalid token: "+err.Error(), http.StatusUnauthorized)
+				writeJSONError(w, http.StatusUnauthorized, "UNAUTHENTICATED", "Invalid token: "+err.Error())
 				return
 			}
 
 			if !token.Valid {
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				writeJSONError(w, http.StatusUnauthorized, "UNAUTHENTICATED", "Invalid token")
 				return
 			}
 
 			// Extract claims
 			claims, ok := token.Claims.(jwt.MapClaims)
 			if !ok {
-				http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+				writeJSONError(w, http.StatusUnauthorized, "UNAUTHENTICATED", "Invalid token claims")
 				return
 			}
 
 			// Add user ID to request context
 			userID, ok := claims["user_id"].(float64)
 			if !ok {
-				http.Error(w, "Invalid user ID in token", http.StatusUnauthorized)
+				writeJSONError(w, http.StatusUnauthorized, "UNAUTHENTICATED", "Invalid user ID in token")
 				return
 			}
 
@@ -67,6 +69,8 @@ func Authenticate(jwtSecret string) func(http.Handler) http.Handler {
 				userRole = "user" // Default role
 			}
 
+			setLoggedUser(r, uint(userID))
+			
 			// Create a new context with user information
 			ctx := context.WithValue(r.Context(), "userID", uint(userID))
 			ctx = context.WithValue(ctx, "userRole", userRole)
@@ -77,20 +81,21 @@ func Authenticate(jwtSecret string) func(http.Handler) http.Handler {
 	}
 }
 
-// RequireRole checks if the authenticated user has the required role
+// RequireRole checks if the authenticated user has the required role or a more privileged
+// one (see models.HasRole). Failures are reported as a JSON error body.
 func RequireRole(requiredRole string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Get user role from context
 			userRole, ok := r.Context().Value("userRole").(string)
 			if !ok {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				writeJSONError(w, http.StatusUnauthorized, "UNAUTHENTICATED", "Unauthorized")
 				return
 			}
 
 			// Check if user has the required role
-			if userRole != requiredRole && userRole != "admin" {
-				http.Error(w, "Forbidden", http.StatusForbidden)
+			if !models.HasRole(userRole, requiredRole) {
+				writeJSONError(w, http.StatusForbidden, "FORBIDDEN", "Forbidden: requires the "+requiredRole+" role")
 				return
 			}
 
@@ -98,4 +103,14 @@ func RequireRole(requiredRole string) func(http.Handler) http.Handler {
 			next.ServeHTTP(w, r)
 		})
 	}
+}
+
+// writeJSONError writes an error response as {"error": {"code": code, "message": message}},
+// the same shape the handlers use
+func writeJSONError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{"code": code, "message": message},
+	})
 }
\ No newline at end of file
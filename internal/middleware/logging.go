@@ -1,33 +1,82 @@
 package middleware
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 )
 
-// Logging is a middleware that logs HTTP requests
-func Logging(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Start timer
-		start := time.Now()
+// requestLogFields holds what inner middleware learns about a request that Logging, which
+// runs outside them, needs to log once the request has been served
+type requestLogFields struct {
+	userID uint
+}
+
+// NewLogger builds the application logger: "text" for reading in development, or "json"
+// for log aggregators, at the given level ("debug", "info", "warn" or "error")
+func NewLogger(w io.Writer, format, level string) (*slog.Logger, error) {
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("unknown log level %q: must be debug, info, warn or error", level)
+	}
+	options := &slog.HandlerOptions{Level: logLevel}
+
+	switch strings.ToLower(format) {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q: must be text or json", format)
+	}
+}
+
+// Logging is a middleware that logs each request once it has been served: method, path,
+// status, duration, client address, request ID and, when authenticated, the user ID. It
+// should run inside RequestID so the ID is known.
+func Logging(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Start timer
+			start := time.Now()
+
+			// Authenticate runs further in, on its own copy of the request, so it reports
+			// the user back through this rather than through the context it creates
+			fields := &requestLogFields{}
+			r = r.WithContext(context.WithValue(r.Context(), "requestLogFields", fields))
 
-		// Wrap the ResponseWriter to capture the status code
-		wrapped := wrapResponseWriter(w)
+			// Wrap the ResponseWriter to capture the status code
+			wrapped := wrapResponseWriter(w)
 
-		// Process request
-		next.ServeHTTP(wrapped, r)
+			// Process request
+			next.ServeHTTP(wrapped, r)
 
-		// Log request details
-		log.Printf(
-			"%s %s %s %d %s",
-			r.RemoteAddr,
-			r.Method,
-			r.URL.Path,
-			wrapped.status,
-			time.Since(start),
-		)
-	})
+			// Log request details
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", wrapped.status),
+				slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+				slog.String("remote_addr", r.RemoteAddr),
+				slog.String("request_id", GetRequestID(r.Context())),
+			}
+			if fields.userID != 0 {
+				attrs = append(attrs, slog.Uint64("user_id", uint64(fields.userID)))
+			}
+			logger.LogAttrs(r.Context(), slog.LevelInfo, "request", attrs...)
+		})
+	}
+}
+
+// setLoggedUser records the authenticated user for Logging, if it is running
+func setLoggedUser(r *http.Request, userID uint) {
+	if fields, ok := r.Context().Value("requestLogFields").(*requestLogFields); ok {
+		fields.userID = userID
+	}
 }
 
 // responseWriter is a wrapper around http.ResponseWriter that captures the status code
@@ -45,4 +94,17 @@ func wrapResponseWriter(w http.ResponseWriter) *responseWriter {
 func (rw *responseWriter) WriteHeader(code int) {
 	rw.status = code
 	rw.ResponseWriter.WriteHeader(code)
+}
+
+// Flush sends buffered data to the client, so streamed responses aren't held back by the wrapper
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the wrapped ResponseWriter, letting http.ResponseController reach it to
+// set deadlines
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
 }
\ No newline at end of file
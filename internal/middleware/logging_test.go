@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// discardLogger returns a logger for tests that don't look at the log
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestLoggingResponseWriterFlushes(t *testing.T) {
+	handler := Logging(discardLogger())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first row"))
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			t.Fatal("the wrapped writer is not an http.Flusher")
+		}
+		flusher.Flush()
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !recorder.Flushed {
+		t.Error("Flush did not reach the underlying writer")
+	}
+}
+
+func TestLoggingResponseWriterAllowsWriteDeadline(t *testing.T) {
+	deadlineErr := make(chan error, 1)
+	server := httptest.NewServer(Logging(discardLogger())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadlineErr <- http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Minute))
+	})))
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	response.Body.Close()
+
+	if err := <-deadlineErr; err != nil {
+		t.Errorf("SetWriteDeadline through the logging wrapper: %v", err)
+	}
+}
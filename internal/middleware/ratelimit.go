@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateLimit is a middleware that limits each client IP to a fixed number of
+// requests per window. Counters are kept in memory and reset when the window ends.
+func RateLimit(limit int, window time.Duration) func(http.Handler) http.Handler {
+	var (
+		mu          sync.Mutex
+		windowStart = time.Now()
+		counts      = make(map[string]int)
+	)
+	
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				ip = r.RemoteAddr
+			}
+			
+			mu.Lock()
+			if time.Since(windowStart) >= window {
+				windowStart = time.Now()
+				counts = make(map[string]int)
+			}
+			counts[ip]++
+			exceeded := counts[ip] > limit
+			mu.Unlock()
+			
+			if exceeded {
+				writeJSONError(w, http.StatusTooManyRequests, "RATE_LIMITED", "Too many requests")
+				return
+			}
+			
+			next.ServeHTTP(w, r)
+		})
+	}
+}
\ No newline at end of file
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/yourusername/inventory-management-system/internal/models"
+	"gorm.io/gorm"
+)
+
+// ReadAudit is a middleware that records GET requests to sensitive routes in the
+// audit log with the action "read". Only paths starting with one of the given
+// prefixes are recorded. It must run after Authenticate so the user is known.
+func ReadAudit(db *gorm.DB, prefixes []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet || !hasAnyPrefix(r.URL.Path, prefixes) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			
+			// Wrap the ResponseWriter to capture the status code
+			wrapped := wrapResponseWriter(w)
+			
+			// Process request
+			next.ServeHTTP(wrapped, r)
+			
+			userID, ok := r.Context().Value("userID").(uint)
+			if !ok {
+				return
+			}
+			
+			details, _ := json.Marshal(map[string]interface{}{
+				"path":   r.URL.Path,
+				"query":  r.URL.RawQuery,
+				"status": wrapped.status,
+			})
+			
+			// A failed audit write shouldn't fail a request that has already been served
+			if err := models.CreateAuditLog(db, userID, "read", "route", 0, "{}", string(details), r.RemoteAddr); err != nil {
+				log.Printf("Failed to record read audit for %s: %v", r.URL.Path, err)
+			}
+		})
+	}
+}
+
+// hasAnyPrefix reports whether path starts with any of the prefixes
+func hasAnyPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if prefix != "" && strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
\ No newline at end of file
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RequestIDHeader carries a request's ID in from a client or proxy and back out in the response
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID is a middleware that gives every request an ID for tracing it through the logs.
+// An acceptable X-Request-ID sent by the client or a proxy is kept; otherwise a random one is
+// generated. The ID is returned in the X-Request-ID response header and stored in the
+// request context, where GetRequestID reads it.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		ctx := context.WithValue(r.Context(), "requestID", id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// GetRequestID returns the ID RequestID gave the request, or "" outside that middleware
+func GetRequestID(ctx context.Context) string {
+	id, _ := ctx.Value("requestID").(string)
+	return id
+}
+
+// validRequestID accepts IDs of up to 128 letters, digits, '-', '_', '.' and ':', so a
+// client can't inject arbitrary text into the logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns 16 random bytes as hex, falling back to the current time in the
+// unlikely event the system's random source fails
+func newRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(buf)
+}
\ No newline at end of file
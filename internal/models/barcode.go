@@ -0,0 +1,99 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// barcodePrefix starts every generated barcode; set once at startup from config. The GS1
+// 200-299 range is reserved for in-store numbers, so generated codes can't collide with
+// manufacturer barcodes.
+var barcodePrefix = "200"
+
+// SetBarcodePrefix sets the digits that start every generated EAN-13 barcode
+func SetBarcodePrefix(prefix string) error {
+	if len(prefix) == 0 || len(prefix) > 6 {
+		return fmt.Errorf("barcode prefix must be 1 to 6 digits, got %q", prefix)
+	}
+	for _, c := range prefix {
+		if c < '0' || c > '9' {
+			return fmt.Errorf("barcode prefix must be 1 to 6 digits, got %q", prefix)
+		}
+	}
+	
+	barcodePrefix = prefix
+	return nil
+}
+
+// GenerateEAN13 builds an internal EAN-13 barcode from the configured prefix and the
+// product ID, zero-padded to twelve digits and followed by the check digit
+func GenerateEAN13(productID uint) (string, error) {
+	id := strconv.FormatUint(uint64(productID), 10)
+	width := 12 - len(barcodePrefix)
+	if len(id) > width {
+		return "", fmt.Errorf("product ID %d does not fit in a barcode with prefix %s", productID, barcodePrefix)
+	}
+	
+	body := fmt.Sprintf("%s%0*s", barcodePrefix, width, id)
+	return body + strconv.Itoa(EAN13CheckDigit(body)), nil
+}
+
+// EAN13CheckDigit returns the check digit for the first twelve digits of an EAN-13 code:
+// digits are weighted 1 and 3 alternately and the check digit brings the sum to a multiple of 10
+func EAN13CheckDigit(body string) int {
+	sum := 0
+	for i, c := range body[:12] {
+		digit := int(c - '0')
+		if i%2 == 1 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	return (10 - sum%10) % 10
+}
+
+// ean13L, ean13G and ean13R hold the module patterns for each digit, and ean13Parity the
+// L/G pattern of the left half chosen by the leading digit
+var (
+	ean13L = [10]string{"0001101", "0011001", "0010011", "0111101", "0100011", "0110001", "0101111", "0111011", "0110111", "0001011"}
+	ean13G = [10]string{"0100111", "0110011", "0011011", "0100001", "0011101", "0111001", "0000101", "0010001", "0001001", "0010111"}
+	ean13R = [10]string{"1110010", "1100110", "1101100", "1000010", "1011100", "1001110", "1010000", "1000100", "1001000", "1110100"}
+	
+	ean13Parity = [10]string{"LLLLLL", "LLGLGG", "LLGGLG", "LLGGGL", "LGLLGG", "LGGLLG", "LGGGLL", "LGLGLG", "LGLGGL", "LGGLGL"}
+)
+
+// EAN13Modules returns the 95 bar/space modules of a valid EAN-13 code, true for a bar
+func EAN13Modules(code string) ([]bool, error) {
+	if len(code) != 13 {
+		return nil, fmt.Errorf("EAN-13 barcode must have 13 digits, got %q", code)
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return nil, fmt.Errorf("EAN-13 barcode must have 13 digits, got %q", code)
+		}
+	}
+	if EAN13CheckDigit(code) != int(code[12]-'0') {
+		return nil, fmt.Errorf("barcode %s has an invalid check digit", code)
+	}
+	
+	pattern := "101"
+	parity := ean13Parity[code[0]-'0']
+	for i := 1; i <= 6; i++ {
+		if parity[i-1] == 'L' {
+			pattern += ean13L[code[i]-'0']
+		} else {
+			pattern += ean13G[code[i]-'0']
+		}
+	}
+	pattern += "01010"
+	for i := 7; i <= 12; i++ {
+		pattern += ean13R[code[i]-'0']
+	}
+	pattern += "101"
+	
+	modules := make([]bool, len(pattern))
+	for i, c := range pattern {
+		modules[i] = c == '1'
+	}
+	return modules, nil
+}
\ No newline at end of file
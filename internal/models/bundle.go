@@ -0,0 +1,81 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// BundleComponents returns the products, and how many of each, that make up one unit of a
+// bundle. A product that isn't a bundle has none.
+func BundleComponents(tx *gorm.DB, productID uint) ([]ProductBundle, error) {
+	var components []ProductBundle
+	err := tx.Where("parent_product_id = ?", productID).Order("child_product_id").Find(&components).Error
+	return components, err
+}
+
+// bundleAvailableQuantity returns how many bundles can be made from the components' available stock
+func bundleAvailableQuantity(tx *gorm.DB, components []ProductBundle) (int, error) {
+	available := 0
+	for i, component := range components {
+		componentAvailable, err := AvailableQuantity(tx, component.ChildProductID)
+		if err != nil {
+			return 0, err
+		}
+		
+		count := componentAvailable
+		if count > 0 {
+			count /= component.Quantity
+		}
+		if i == 0 || count < available {
+			available = count
+		}
+	}
+	return available, nil
+}
+
+// ExpandBundle returns the stocked products, and quantities of each, that make up quantity
+// units of a product, descending through nested bundles. A product that isn't a bundle
+// expands to itself.
+func ExpandBundle(tx *gorm.DB, productID uint, quantity int) (map[uint]int, error) {
+	expanded := make(map[uint]int)
+	if err := expandBundle(tx, productID, quantity, expanded); err != nil {
+		return nil, err
+	}
+	return expanded, nil
+}
+
+func expandBundle(tx *gorm.DB, productID uint, quantity int, expanded map[uint]int) error {
+	components, err := BundleComponents(tx, productID)
+	if err != nil {
+		return err
+	}
+	
+	if len(components) == 0 {
+		expanded[productID] += quantity
+		return nil
+	}
+	
+	for _, component := range components {
+		if err := expandBundle(tx, component.ChildProductID, quantity*component.Quantity, expanded); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BundleContains reports whether productID is bundleID itself or one of its components at
+// any depth. Adding a component that contains the bundle would make the bundle its own descendant.
+func BundleContains(tx *gorm.DB, bundleID, productID uint) (bool, error) {
+	var found int64
+	err := tx.Raw(`
+		WITH RECURSIVE descendants(product_id) AS (
+			SELECT CAST(? AS bigint)
+			UNION
+			SELECT product_bundles.child_product_id
+			FROM product_bundles
+			JOIN descendants ON product_bundles.parent_product_id = descendants.product_id
+		)
+		SELECT COUNT(*) FROM descendants WHERE product_id = ?`,
+		bundleID, productID).
+		Scan(&found).Error
+	return found > 0, err
+}
\ No newline at end of file
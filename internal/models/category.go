@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // Category represents a product category
@@ -10,8 +12,10 @@ type Category struct {
 	Name        string    `json:"name" gorm:"uniqueIndex;not null"`
 	Description string    `json:"description"`
 	ParentID    *uint     `json:"parent_id"`
+	Status      string    `json:"status" gorm:"default:'active'"`
 	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt   time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt   gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
 	
 	// Relationships
 	ParentCategory *Category  `json:"parent_category,omitempty" gorm:"foreignKey:ParentID"`
@@ -19,9 +23,25 @@ type Category struct {
 	Products       []Product  `json:"products,omitempty" gorm:"many2many:product_category"`
 }
 
-// GetCategoryPath returns the full path of the category
-func (c *Category) GetCategoryPath() ([]Category, error) {
-	// This would be implemented with recursive SQL query
-	// For simplicity, we're just returning a placeholder
-	return []Category{*c}, nil
+// GetCategoryPath returns the category's ancestors from the root down to the category itself.
+// The walk stops at a parent that is missing or deleted, or that was already visited (a
+// parent_id cycle), so the path then starts below the broken link; its first element has a
+// non-nil ParentID in that case.
+func (c *Category) GetCategoryPath(tx *gorm.DB) ([]Category, error) {
+	var path []Category
+	err := tx.Raw(`
+		WITH RECURSIVE ancestors AS (
+			SELECT categories.*, ARRAY[id] AS visited, 0 AS depth
+			FROM categories
+			WHERE id = ?
+			UNION ALL
+			SELECT parent.*, ancestors.visited || parent.id, ancestors.depth + 1
+			FROM categories parent
+			JOIN ancestors ON parent.id = ancestors.parent_id
+			WHERE parent.deleted_at IS NULL AND NOT parent.id = ANY(ancestors.visited)
+		)
+		SELECT id, name, description, parent_id, status, created_at, updated_at, deleted_at
+		FROM ancestors ORDER BY depth DESC`, c.ID).
+		Scan(&path).Error
+	return path, err
 }
\ No newline at end of file
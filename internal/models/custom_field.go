@@ -0,0 +1,204 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Custom field types
+const (
+	CustomFieldText    = "text"
+	CustomFieldNumber  = "number"
+	CustomFieldBoolean = "boolean"
+	CustomFieldDate    = "date"   // YYYY-MM-DD
+	CustomFieldSelect  = "select" // One of Options
+)
+
+// ErrInvalidCustomField is returned when product custom field values don't match their definitions
+var ErrInvalidCustomField = errors.New("invalid custom field")
+
+// customFieldNamePattern keeps names usable as JSON keys and query parameters
+var customFieldNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,62}$`)
+
+// CustomField defines a product attribute that isn't part of the fixed schema, such as
+// voltage or warranty. Products store their values in Product.CustomFields keyed by Name.
+type CustomField struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"uniqueIndex;not null"` // Key in custom_fields, e.g. "voltage"
+	Label     string    `json:"label"`
+	Type      string    `json:"type" gorm:"not null"`
+	Options   string    `json:"-" gorm:"type:jsonb"` // JSON array of allowed values for select fields
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	
+	// Computed fields
+	OptionList []string `json:"options,omitempty" gorm:"-"`
+}
+
+// AfterFind hook to decode the select options
+func (f *CustomField) AfterFind(tx *gorm.DB) error {
+	if f.Options == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(f.Options), &f.OptionList)
+}
+
+// Validate checks a definition before it is saved and encodes its options
+func (f *CustomField) Validate() error {
+	if !customFieldNamePattern.MatchString(f.Name) {
+		return errors.New("Name must start with a lowercase letter and contain only lowercase letters, digits and underscores")
+	}
+	
+	switch f.Type {
+	case CustomFieldText, CustomFieldNumber, CustomFieldBoolean, CustomFieldDate:
+		if len(f.OptionList) > 0 {
+			return errors.New("Options are only allowed on select fields")
+		}
+		f.Options = ""
+	case CustomFieldSelect:
+		if len(f.OptionList) == 0 {
+			return errors.New("Select fields need at least one option")
+		}
+		encoded, err := json.Marshal(f.OptionList)
+		if err != nil {
+			return err
+		}
+		f.Options = string(encoded)
+	default:
+		return errors.New("Type must be text, number, boolean, date or select")
+	}
+	
+	if f.Label == "" {
+		f.Label = f.Name
+	}
+	return nil
+}
+
+// check reports whether value is valid for the field
+func (f *CustomField) check(value interface{}) error {
+	switch f.Type {
+	case CustomFieldText:
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%w: %s must be text", ErrInvalidCustomField, f.Name)
+		}
+	case CustomFieldNumber:
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%w: %s must be a number", ErrInvalidCustomField, f.Name)
+		}
+	case CustomFieldBoolean:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%w: %s must be true or false", ErrInvalidCustomField, f.Name)
+		}
+	case CustomFieldDate:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%w: %s must be a YYYY-MM-DD date", ErrInvalidCustomField, f.Name)
+		}
+		if _, err := time.Parse("2006-01-02", s); err != nil {
+			return fmt.Errorf("%w: %s must be a YYYY-MM-DD date", ErrInvalidCustomField, f.Name)
+		}
+	case CustomFieldSelect:
+		s, _ := value.(string)
+		for _, option := range f.OptionList {
+			if s == option {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: %s must be one of %v", ErrInvalidCustomField, f.Name, f.OptionList)
+	}
+	return nil
+}
+
+// FilterValue converts a query parameter into the text form the field's values take in
+// the custom_fields column, so products can be filtered with custom_fields ->> name
+func (f *CustomField) FilterValue(raw string) (string, error) {
+	var value interface{} = raw
+	switch f.Type {
+	case CustomFieldNumber:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s must be a number", ErrInvalidCustomField, f.Name)
+		}
+		return strconv.FormatFloat(n, 'f', -1, 64), nil
+	case CustomFieldBoolean:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s must be true or false", ErrInvalidCustomField, f.Name)
+		}
+		return strconv.FormatBool(b), nil
+	}
+	
+	if err := f.check(value); err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// CustomFieldValues holds a product's custom field values, stored as a JSON object
+type CustomFieldValues map[string]interface{}
+
+// Value encodes the values for the jsonb column
+func (v CustomFieldValues) Value() (driver.Value, error) {
+	if v == nil {
+		return "{}", nil
+	}
+	encoded, err := json.Marshal(v)
+	return string(encoded), err
+}
+
+// Scan decodes the jsonb column
+func (v *CustomFieldValues) Scan(src interface{}) error {
+	var data []byte
+	switch s := src.(type) {
+	case nil:
+		*v = CustomFieldValues{}
+		return nil
+	case []byte:
+		data = s
+	case string:
+		data = []byte(s)
+	default:
+		return fmt.Errorf("cannot scan %T into custom field values", src)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// GormDataType stores the values as jsonb
+func (CustomFieldValues) GormDataType() string {
+	return "jsonb"
+}
+
+// ValidateCustomFields checks every value against its field definition. Values for
+// fields that aren't defined are rejected; null values are not allowed, leave the key out.
+func ValidateCustomFields(tx *gorm.DB, values CustomFieldValues) error {
+	if len(values) == 0 {
+		return nil
+	}
+	
+	var fields []CustomField
+	if err := tx.Find(&fields).Error; err != nil {
+		return err
+	}
+	byName := make(map[string]*CustomField, len(fields))
+	for i := range fields {
+		byName[fields[i].Name] = &fields[i]
+	}
+	
+	for name, value := range values {
+		field, ok := byName[name]
+		if !ok {
+			return fmt.Errorf("%w: %s is not a defined custom field", ErrInvalidCustomField, name)
+		}
+		if err := field.check(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
\ No newline at end of file
@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // Customer represents a customer entity
@@ -13,10 +15,12 @@ type Customer struct {
 	Phone         string    `json:"phone"`
 	Address       string    `json:"address"`
 	TaxID         string    `json:"tax_id"`
-	PaymentTerms  string    `json:"payment_terms"`
+	PaymentTerms  string    `json:"payment_terms"` // One of PaymentTermsDays; applied to new sales orders
+	CreditLimit   float64   `json:"credit_limit" gorm:"type:decimal(10,2);default:0"` // 0 means no limit
 	Status        string    `json:"status" gorm:"default:'active'"`
 	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt     time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt     gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
 	
 	// Relationships
 	SalesOrders   []SalesOrder `json:"sales_orders,omitempty" gorm:"foreignKey:CustomerID"`
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// IdempotencyKeyTTL is how long a stored Idempotency-Key answers repeats of its request
+const IdempotencyKeyTTL = 24 * time.Hour
+
+// IdempotencyKey remembers the response to a create request sent with an Idempotency-Key
+// header, so a client retrying the same request gets the original response instead of a
+// duplicate record. Keys are scoped to the user who sent them. StatusCode stays 0 while the
+// first request is still being processed.
+type IdempotencyKey struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	UserID       uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_idempotency_user_key"`
+	Key          string    `json:"key" gorm:"not null;size:255;uniqueIndex:idx_idempotency_user_key"`
+	Endpoint     string    `json:"endpoint" gorm:"not null"`
+	RequestHash  string    `json:"request_hash" gorm:"not null"` // SHA-256 of the request body
+	ResourceID   uint      `json:"resource_id"`
+	StatusCode   int       `json:"status_code"`
+	ResponseBody string    `json:"response_body" gorm:"type:text"`
+	ExpiresAt    time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
\ No newline at end of file
@@ -14,12 +14,17 @@ type InventoryTransaction struct {
 	SourceLocationID      *uint     `json:"source_location_id"`
 	DestinationLocationID *uint     `json:"destination_location_id"`
 	Type                  string    `json:"type" gorm:"not null"` // "receive", "issue", "transfer", "adjustment"
+	ReasonCode            string    `json:"reason_code,omitempty"` // Why stock was adjusted; one of AdjustmentReasonCodes
 	Quantity              int       `json:"quantity" gorm:"not null"`
+	UnitCost              *float64  `json:"unit_cost" gorm:"type:decimal(10,2);not null;default:0"` // Captured at creation so value doesn't drift with later cost changes; nil takes the cost price
 	ReferenceNumber       string    `json:"reference_number"`
 	UserID                uint      `json:"user_id" gorm:"not null"`
 	Notes                 string    `json:"notes"`
 	CreatedAt             time.Time `json:"created_at" gorm:"autoCreateTime"`
 	
+	// Computed fields
+	Value                 float64   `json:"value" gorm:"-"`
+	
 	// Relationships
 	Product             *Product          `json:"product" gorm:"foreignKey:ProductID"`
 	Warehouse           *Warehouse        `json:"warehouse" gorm:"foreignKey:WarehouseID"`
@@ -28,26 +33,54 @@ type InventoryTransaction struct {
 	User                *User              `json:"user" gorm:"foreignKey:UserID"`
 }
 
-// BeforeCreate hook for inventory transaction to update product quantity
-func (it *InventoryTransaction) BeforeCreate(tx *gorm.DB) error {
-	// This would update the product quantity based on the transaction type
-	// In a real implementation, this would be more sophisticated
-	
-	var product Product
-	if err := tx.First(&product, it.ProductID).Error; err != nil {
-		return err
-	}
-	
+// AdjustmentReasonCodes are the accepted reasons for an adjustment transaction
+var AdjustmentReasonCodes = map[string]bool{
+	"damage":      true,
+	"shrinkage":   true,
+	"cycle_count": true,
+	"correction":  true,
+}
+
+// StockDelta returns the transaction's effect on the product's stock on hand: receipts add,
+// issues subtract, adjustments carry their own sign and transfers leave the total unchanged
+func (it *InventoryTransaction) StockDelta() int {
 	switch it.Type {
-	case "receive":
-		product.Quantity += it.Quantity
+	case "receive", "adjustment":
+		return it.Quantity
 	case "issue":
-		product.Quantity -= it.Quantity
-	case "adjustment":
-		// Adjustment logic would go here
-	case "transfer":
-		// Transfer logic would go here
+		return -it.Quantity
+	default:
+		return 0
+	}
+}
+
+// BeforeCreate hook for inventory transaction to capture its unit cost and value.
+// It does not change the product's quantity: whoever records the transaction applies
+// StockDelta in the same database transaction, so the stock moves exactly once.
+func (it *InventoryTransaction) BeforeCreate(tx *gorm.DB) error {
+	// Default an unset unit cost to the product's current cost price. A zero cost, such as a
+	// free receipt, is kept. Soft-deleted products still have their stock moved, so include them.
+	if it.UnitCost == nil {
+		var product Product
+		if err := tx.Unscoped().Select("cost_price").First(&product, it.ProductID).Error; err != nil {
+			return err
+		}
+		it.UnitCost = &product.CostPrice
 	}
+	it.computeValue()
 	
-	return tx.Save(&product).Error
+	return nil
+}
+
+// AfterFind hook for inventory transaction to compute its value
+func (it *InventoryTransaction) AfterFind(tx *gorm.DB) error {
+	it.computeValue()
+	return nil
+}
+
+// computeValue sets Value from the quantity and unit cost
+func (it *InventoryTransaction) computeValue() {
+	if it.UnitCost != nil {
+		it.Value = RoundCurrency(float64(it.Quantity) * *it.UnitCost)
+	}
 }
\ No newline at end of file
@@ -0,0 +1,60 @@
+package models
+
+import "fmt"
+
+// MarginEnforcement selects what happens to sales order lines priced below the minimum margin
+type MarginEnforcement string
+
+const (
+	// MarginWarn flags the line and lets it through once the warning is acknowledged
+	MarginWarn MarginEnforcement = "warn"
+	// MarginBlock rejects the line outright
+	MarginBlock MarginEnforcement = "block"
+)
+
+// The margin policy applies to every product without its own MinimumMarginPercent; set once
+// at startup from config
+var (
+	minimumMarginPercent = 0.0
+	marginEnforcement    = MarginWarn
+)
+
+// SetMarginPolicy sets the default minimum margin and how it is enforced
+func SetMarginPolicy(percent float64, enforcement MarginEnforcement) error {
+	if percent < 0 {
+		return fmt.Errorf("minimum margin percent must not be negative, got %v", percent)
+	}
+	
+	switch enforcement {
+	case MarginWarn, MarginBlock:
+	default:
+		return fmt.Errorf("unknown margin enforcement %q: must be %s or %s", enforcement, MarginWarn, MarginBlock)
+	}
+	
+	minimumMarginPercent = percent
+	marginEnforcement = enforcement
+	return nil
+}
+
+// CurrentMarginEnforcement returns how the minimum margin is enforced
+func CurrentMarginEnforcement() MarginEnforcement {
+	return marginEnforcement
+}
+
+// MinimumNetPrice returns the lowest net unit price that keeps a product at its minimum
+// margin over cost, or 0 when the product has no cost price to protect or its minimum
+// margin is 0, which turns the check off
+func MinimumNetPrice(product *Product) float64 {
+	if product.CostPrice <= 0 {
+		return 0
+	}
+	
+	margin := minimumMarginPercent
+	if product.MinimumMarginPercent != nil {
+		margin = *product.MinimumMarginPercent
+	}
+	if margin <= 0 {
+		return 0
+	}
+	return RoundCurrency(product.CostPrice * (1 + margin/100))
+}
\ No newline at end of file
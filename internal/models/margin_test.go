@@ -0,0 +1,33 @@
+package models
+
+import "testing"
+
+func TestMinimumNetPrice(t *testing.T) {
+	defer SetMarginPolicy(minimumMarginPercent, marginEnforcement)
+
+	twenty := 20.0
+	zero := 0.0
+	tests := []struct {
+		name    string
+		policy  float64
+		product Product
+		want    float64
+	}{
+		{"default of zero turns the check off", 0, Product{CostPrice: 50}, 0},
+		{"configured default applies", 10, Product{CostPrice: 50}, 55},
+		{"product override wins", 10, Product{CostPrice: 50, MinimumMarginPercent: &twenty}, 60},
+		{"product override of zero turns the check off", 10, Product{CostPrice: 50, MinimumMarginPercent: &zero}, 0},
+		{"no cost price to protect", 10, Product{}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetMarginPolicy(tt.policy, MarginWarn); err != nil {
+				t.Fatalf("SetMarginPolicy: %v", err)
+			}
+			if got := MinimumNetPrice(&tt.product); got != tt.want {
+				t.Errorf("MinimumNetPrice = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
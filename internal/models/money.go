@@ -0,0 +1,43 @@
+package models
+
+import (
+	"fmt"
+	"math"
+)
+
+// RoundingMode selects how currency amounts are rounded to cents
+type RoundingMode string
+
+const (
+	// RoundHalfUp rounds halves away from zero (2.345 -> 2.35)
+	RoundHalfUp RoundingMode = "half_up"
+	// RoundHalfEven rounds halves to the nearest even cent, also known as banker's rounding (2.345 -> 2.34)
+	RoundHalfEven RoundingMode = "half_even"
+)
+
+// currencyRoundingMode is applied by RoundCurrency; set once at startup from config
+var currencyRoundingMode = RoundHalfUp
+
+// SetRoundingMode sets the rounding mode used for all currency amounts
+func SetRoundingMode(mode RoundingMode) error {
+	switch mode {
+	case RoundHalfUp, RoundHalfEven:
+		currencyRoundingMode = mode
+		return nil
+	default:
+		return fmt.Errorf("unknown rounding mode %q: must be %s or %s", mode, RoundHalfUp, RoundHalfEven)
+	}
+}
+
+// RoundCurrency rounds an amount to cents using the configured rounding mode. Every line
+// total, tax and order total goes through here so amounts agree wherever they are computed.
+func RoundCurrency(amount float64) float64 {
+	// Shed binary floating point noise first, so 2.675 (stored as 2.67499999...) is treated
+	// as the exact half it was meant to be
+	cents := math.Round(amount*100*1e6) / 1e6
+	
+	if currencyRoundingMode == RoundHalfEven {
+		return math.RoundToEven(cents) / 100
+	}
+	return math.Round(cents) / 100
+}
\ No newline at end of file
@@ -0,0 +1,45 @@
+package models
+
+import "testing"
+
+func TestRoundCurrency(t *testing.T) {
+	defer SetRoundingMode(currencyRoundingMode)
+
+	tests := []struct {
+		amount   float64
+		halfUp   float64
+		halfEven float64
+	}{
+		{2.345, 2.35, 2.34},
+		{2.355, 2.36, 2.36},
+		{2.675, 2.68, 2.68},
+		{0.125, 0.13, 0.12},
+		{-2.345, -2.35, -2.34},
+		{2.344, 2.34, 2.34},
+		{2.346, 2.35, 2.35},
+		{10, 10, 10},
+	}
+
+	for _, mode := range []RoundingMode{RoundHalfUp, RoundHalfEven} {
+		if err := SetRoundingMode(mode); err != nil {
+			t.Fatalf("SetRoundingMode(%s): %v", mode, err)
+		}
+		for _, tt := range tests {
+			want := tt.halfUp
+			if mode == RoundHalfEven {
+				want = tt.halfEven
+			}
+			if got := RoundCurrency(tt.amount); got != want {
+				t.Errorf("%s: RoundCurrency(%v) = %v, want %v", mode, tt.amount, got, want)
+			}
+		}
+	}
+}
+
+func TestSetRoundingModeRejectsUnknownMode(t *testing.T) {
+	defer SetRoundingMode(currencyRoundingMode)
+
+	if err := SetRoundingMode("half_down"); err == nil {
+		t.Error("SetRoundingMode(half_down) succeeded, want an error")
+	}
+}
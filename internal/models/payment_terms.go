@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+// DefaultPaymentTerms applies to orders whose customer has no payment terms set
+const DefaultPaymentTerms = "net_30"
+
+// PaymentTermsDays maps each accepted payment terms code to the days allowed for payment
+var PaymentTermsDays = map[string]int{
+	"due_on_receipt": 0,
+	"net_7":          7,
+	"net_15":         15,
+	"net_30":         30,
+	"net_45":         45,
+	"net_60":         60,
+	"net_90":         90,
+}
+
+// IsValidPaymentTerms reports whether terms is one of the accepted payment terms codes
+func IsValidPaymentTerms(terms string) bool {
+	_, ok := PaymentTermsDays[terms]
+	return ok
+}
+
+// PaymentDueDate returns when payment falls due for an order placed on orderDate
+func PaymentDueDate(orderDate time.Time, terms string) time.Time {
+	return orderDate.AddDate(0, 0, PaymentTermsDays[terms])
+}
\ No newline at end of file
@@ -16,17 +16,24 @@ type Product struct {
 	ReorderLevel  int       `json:"reorder_level" gorm:"default:5"`
 	Price         float64   `json:"price" gorm:"type:decimal(10,2);not null"`
 	CostPrice     float64   `json:"cost_price" gorm:"type:decimal(10,2)"`
+	MinimumMarginPercent *float64 `json:"minimum_margin_percent" gorm:"type:decimal(5,2)"` // Overrides the configured default when set
 	Weight        float64   `json:"weight"`
 	Dimensions    string    `json:"dimensions"`
 	ImageURL      string    `json:"image_url"`
 	Barcode       string    `json:"barcode"`
 	Status        string    `json:"status" gorm:"default:'active'"`
+	CustomFields  CustomFieldValues `json:"custom_fields" gorm:"default:'{}'"` // Values for the defined CustomFields
+	Version       int       `json:"version" gorm:"not null;default:1"` // Bumped on every update; see CheckVersion
 	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt     time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt     gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+	
+	// Computed fields
+	PrimarySupplier *ProductSupplier `json:"primary_supplier,omitempty" gorm:"-"`
 	
 	// Relationships
 	Categories      []Category      `json:"categories" gorm:"many2many:product_category"`
-	Suppliers       []Supplier      `json:"suppliers" gorm:"many2many:product_supplier"`
+	Suppliers       []Supplier      `json:"suppliers" gorm:"many2many:product_suppliers"` // Links with pricing live in ProductSupplier
 	Attachments     []ProductAttachment `json:"attachments" gorm:"foreignKey:ProductID"`
 	Variants        []ProductVariant    `json:"variants" gorm:"foreignKey:ProductID"`
 	ParentBundles   []ProductBundle     `json:"-" gorm:"foreignKey:ChildProductID"`
@@ -44,7 +51,8 @@ type ProductAttachment struct {
 	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
 }
 
-// ProductVariant represents variations of a product
+// ProductVariant represents variations of a product. A variant's quantity is the part of
+// the parent product's stock held as that variant, not stock in addition to it.
 type ProductVariant struct {
 	ID          uint      `json:"id" gorm:"primaryKey"`
 	ProductID   uint      `json:"product_id" gorm:"not null"`
@@ -80,6 +88,7 @@ type ProductSupplier struct {
 	MinOrderQuantity int       `json:"min_order_quantity" gorm:"default:1"`
 	LeadTimeDays     int       `json:"lead_time_days"`
 	SupplierSKU      string    `json:"supplier_sku"`
+	IsPrimary        bool      `json:"is_primary" gorm:"default:false"` // Preferred supplier for reordering and cost defaults
 	CreatedAt        time.Time `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt        time.Time `json:"updated_at" gorm:"autoUpdateTime"`
 
@@ -88,12 +97,18 @@ type ProductSupplier struct {
 	Supplier         *Supplier `json:"supplier" gorm:"foreignKey:SupplierID"`
 }
 
-// ProductWarehouse represents the many-to-many relationship between products and warehouses
+// ProductWarehouse represents the many-to-many relationship between products and warehouses.
+// A product has one record per location it is stocked at within a warehouse, or a single
+// record without a location in a warehouse that has none. The database keeps the three keys
+// unique with NULLS NOT DISTINCT, so there is only ever one location-less record.
 type ProductWarehouse struct {
-	ProductID      uint      `json:"product_id" gorm:"primaryKey"`
-	WarehouseID    uint      `json:"warehouse_id" gorm:"primaryKey"`
-	LocationID     uint      `json:"location_id"`
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	ProductID      uint      `json:"product_id" gorm:"not null"`
+	WarehouseID    uint      `json:"warehouse_id" gorm:"not null"`
+	LocationID     *uint     `json:"location_id"` // Nil when the warehouse has no locations
 	Quantity       int       `json:"quantity" gorm:"not null;default:0"`
+	MinQuantity    int       `json:"min_quantity" gorm:"not null;default:0"` // Stock level to keep in this warehouse; 0 means none
+	MaxQuantity    int       `json:"max_quantity" gorm:"not null;default:0"` // Upper stock level for this warehouse; 0 means none
 	CreatedAt      time.Time `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt      time.Time `json:"updated_at" gorm:"autoUpdateTime"`
 	
@@ -103,6 +118,18 @@ type ProductWarehouse struct {
 	Location       *WarehouseLocation `json:"location" gorm:"foreignKey:LocationID"`
 }
 
+// StockAt scopes a product_warehouses query to a product's record at a location, or to its
+// location-less record when locationID is nil
+func StockAt(productID, warehouseID uint, locationID *uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Where("product_warehouses.product_id = ? AND product_warehouses.warehouse_id = ?", productID, warehouseID)
+		if locationID == nil {
+			return db.Where("product_warehouses.location_id IS NULL")
+		}
+		return db.Where("product_warehouses.location_id = ?", *locationID)
+	}
+}
+
 // ProductCategory represents the many-to-many relationship between products and categories
 type ProductCategory struct {
 	ProductID      uint      `json:"product_id" gorm:"primaryKey"`
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -15,11 +16,18 @@ type PurchaseOrder struct {
 	WarehouseID   uint      `json:"warehouse_id" gorm:"not null"`
 	OrderDate     time.Time `json:"order_date" gorm:"not null"`
 	ExpectedDate  time.Time `json:"expected_date"`
-	Status        string    `json:"status" gorm:"default:'draft'"`
+	Status        string    `json:"status" gorm:"default:'draft'"` // draft -> pending_approval -> approved -> partial/received
 	TotalAmount   float64   `json:"total_amount" gorm:"type:decimal(10,2);default:0"`
 	PaymentTerms  string    `json:"payment_terms"`
 	ShippingTerms string    `json:"shipping_terms"`
+	OnHold        bool      `json:"on_hold" gorm:"default:false"` // Independent of status; blocks receiving
+	HoldReason    string    `json:"hold_reason"`
 	UserID        uint      `json:"user_id" gorm:"not null"`
+	ApprovedBy    *uint      `json:"approved_by"`
+	ApprovedAt    *time.Time `json:"approved_at"`
+	ReceivedDate  *time.Time `json:"received_date"` // When goods first arrived against the order
+	ReceivedBy    *uint      `json:"received_by"`   // Who recorded that first receipt
+	Version       int        `json:"version" gorm:"not null;default:1"` // Bumped on every update; see CheckVersion
 	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt     time.Time `json:"updated_at" gorm:"autoUpdateTime"`
 	
@@ -27,6 +35,8 @@ type PurchaseOrder struct {
 	Supplier      *Supplier         `json:"supplier" gorm:"foreignKey:SupplierID"`
 	Warehouse     *Warehouse        `json:"warehouse" gorm:"foreignKey:WarehouseID"`
 	User          *User             `json:"user" gorm:"foreignKey:UserID"`
+	Approver      *User             `json:"approver,omitempty" gorm:"foreignKey:ApprovedBy"`
+	Receiver      *User             `json:"receiver,omitempty" gorm:"foreignKey:ReceivedBy"`
 	Items         []PurchaseOrderItem `json:"items" gorm:"foreignKey:PurchaseOrderID"`
 }
 
@@ -36,8 +46,10 @@ type PurchaseOrderItem struct {
 	PurchaseOrderID uint      `json:"purchase_order_id" gorm:"not null"`
 	ProductID       uint      `json:"product_id" gorm:"not null"`
 	Quantity        int       `json:"quantity" gorm:"not null"`
+	QuantityReceived int      `json:"quantity_received" gorm:"not null;default:0"`
 	UnitPrice       float64   `json:"unit_price" gorm:"type:decimal(10,2);not null"`
 	TotalPrice      float64   `json:"total_price" gorm:"type:decimal(10,2);not null"`
+	ExpectedDate    time.Time `json:"expected_date"` // Defaults to order date plus the supplier's lead time
 	CreatedAt       time.Time `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt       time.Time `json:"updated_at" gorm:"autoUpdateTime"`
 	
@@ -60,44 +72,127 @@ func (po *PurchaseOrder) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
-// BeforeCreate hook for purchase order item to calculate total price
+// RecordReceipt sets the status a receipt leaves the order in: received once every line is
+// fully received, partial otherwise. The first receipt also records when the goods arrived
+// and who received them; later receipts leave those alone.
+func (po *PurchaseOrder) RecordReceipt(tx *gorm.DB, items []PurchaseOrderItem, userID uint) error {
+	po.Status = "received"
+	for _, item := range items {
+		if item.QuantityReceived < item.Quantity {
+			po.Status = "partial"
+			break
+		}
+	}
+	
+	updates := map[string]interface{}{"status": po.Status}
+	if po.ReceivedDate == nil {
+		now := time.Now()
+		po.ReceivedDate = &now
+		po.ReceivedBy = &userID
+		updates["received_date"] = now
+		updates["received_by"] = userID
+	}
+	return tx.Model(po).Updates(updates).Error
+}
+
+// BeforeCreate hook for purchase order item to calculate total price and default the expected date
 func (poi *PurchaseOrderItem) BeforeCreate(tx *gorm.DB) error {
-	poi.TotalPrice = float64(poi.Quantity) * poi.UnitPrice
+	poi.TotalPrice = RoundCurrency(float64(poi.Quantity) * poi.UnitPrice)
+	
+	if poi.ExpectedDate.IsZero() {
+		var po PurchaseOrder
+		if err := tx.First(&po, poi.PurchaseOrderID).Error; err != nil {
+			return err
+		}
+		
+		// Use the supplier's lead time for this product when the two are linked
+		var link ProductSupplier
+		err := tx.Where("product_id = ? AND supplier_id = ?", poi.ProductID, po.SupplierID).First(&link).Error
+		switch {
+		case err == nil:
+			poi.ExpectedDate = po.OrderDate.AddDate(0, 0, link.LeadTimeDays)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			poi.ExpectedDate = po.ExpectedDate
+		default:
+			return err
+		}
+	}
 	return nil
 }
 
 // BeforeSave hook for purchase order item to recalculate total price
 func (poi *PurchaseOrderItem) BeforeSave(tx *gorm.DB) error {
-	poi.TotalPrice = float64(poi.Quantity) * poi.UnitPrice
+	poi.TotalPrice = RoundCurrency(float64(poi.Quantity) * poi.UnitPrice)
 	return nil
 }
 
-// AfterCreate hook for purchase order item to update purchase order total
+// AfterCreate hook for purchase order item to update purchase order total and expected date
 func (poi *PurchaseOrderItem) AfterCreate(tx *gorm.DB) error {
-	return updatePurchaseOrderTotal(tx, poi.PurchaseOrderID)
+	if err := updatePurchaseOrderTotal(tx, poi.PurchaseOrderID); err != nil {
+		return err
+	}
+	return updatePurchaseOrderExpectedDate(tx, poi.PurchaseOrderID)
 }
 
-// AfterUpdate hook for purchase order item to update purchase order total
+// AfterUpdate hook for purchase order item to update purchase order total and expected date
 func (poi *PurchaseOrderItem) AfterUpdate(tx *gorm.DB) error {
-	return updatePurchaseOrderTotal(tx, poi.PurchaseOrderID)
+	if err := updatePurchaseOrderTotal(tx, poi.PurchaseOrderID); err != nil {
+		return err
+	}
+	return updatePurchaseOrderExpectedDate(tx, poi.PurchaseOrderID)
 }
 
-// AfterDelete hook for purchase order item to update purchase order total
+// AfterDelete hook for purchase order item to update purchase order total and expected date
 func (poi *PurchaseOrderItem) AfterDelete(tx *gorm.DB) error {
-	return updatePurchaseOrderTotal(tx, poi.PurchaseOrderID)
+	if err := updatePurchaseOrderTotal(tx, poi.PurchaseOrderID); err != nil {
+		return err
+	}
+	return updatePurchaseOrderExpectedDate(tx, poi.PurchaseOrderID)
 }
 
-// updatePurchaseOrderTotal recalculates the total amount for a purchase order
+// updatePurchaseOrderTotal recalculates the total amount for a purchase order.
+// It runs inside the item's create/update/delete transaction, so an error here
+// rolls back the item change as well.
 func updatePurchaseOrderTotal(tx *gorm.DB, poID uint) error {
+	// Bulk deletes by condition don't carry the order ID; there is nothing to recompute
+	if poID == 0 {
+		return nil
+	}
+	
 	var total float64
 	if err := tx.Model(&PurchaseOrderItem{}).
 		Where("purchase_order_id = ?", poID).
-		Select("SUM(total_price)").
+		Select("COALESCE(SUM(total_price), 0)").
 		Scan(&total).Error; err != nil {
 		return err
 	}
 	
 	return tx.Model(&PurchaseOrder{}).
 		Where("id = ?", poID).
-		Update("total_amount", total).Error
+		Update("total_amount", RoundCurrency(total)).Error
+}
+
+// updatePurchaseOrderExpectedDate sets a purchase order's expected date to the latest of its line expected dates
+func updatePurchaseOrderExpectedDate(tx *gorm.DB, poID uint) error {
+	// Bulk deletes by condition don't carry the order ID; there is nothing to recompute
+	if poID == 0 {
+		return nil
+	}
+	
+	var latest *time.Time
+	if err := tx.Model(&PurchaseOrderItem{}).
+		Where("purchase_order_id = ?", poID).
+		Select("MAX(expected_date)").
+		Scan(&latest).Error; err != nil {
+		return err
+	}
+	
+	// Keep the order's own date when none of its lines have one
+	if latest == nil || latest.IsZero() {
+		return nil
+	}
+	
+	return tx.Model(&PurchaseOrder{}).
+		Where("id = ?", poID).
+		Update("expected_date", *latest).Error
 }
\ No newline at end of file
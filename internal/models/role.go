@@ -0,0 +1,56 @@
+package models
+
+import "sort"
+
+// User roles, from least to most privileged
+const (
+	RoleUser    = "user"
+	RoleManager = "manager"
+	RoleAdmin   = "admin"
+)
+
+// roleRanks orders the roles so a higher role passes every check a lower one does
+var roleRanks = map[string]int{
+	RoleUser:    1,
+	RoleManager: 2,
+	RoleAdmin:   3,
+}
+
+// capabilityRoles maps each capability to the least privileged role that has it. The
+// route guards in handlers/routes.go require the same roles, so keep the two in step.
+var capabilityRoles = map[string]string{
+	"can_approve_orders":          RoleUser,
+	"can_adjust_stock":            RoleUser,
+	"can_approve_purchase_orders": RoleManager,
+	"can_close_stock_counts":      RoleManager,
+	"can_delete_products":         RoleManager,
+	"can_merge_products":          RoleManager,
+	"can_delete_categories":       RoleManager,
+	"can_delete_suppliers":        RoleManager,
+	"can_delete_warehouses":       RoleManager,
+	"can_delete_customers":        RoleManager,
+	"can_manage_users":            RoleAdmin,
+	"can_view_audit_logs":         RoleAdmin,
+}
+
+// HasRole reports whether a user with the given role passes a check requiring requiredRole.
+// Unknown roles pass nothing.
+func HasRole(role, requiredRole string) bool {
+	rank, ok := roleRanks[role]
+	if !ok {
+		return false
+	}
+	return rank >= roleRanks[requiredRole]
+}
+
+// RoleCapabilities returns the sorted capabilities granted to a role
+func RoleCapabilities(role string) []string {
+	capabilities := []string{}
+	for capability, requiredRole := range capabilityRoles {
+		if HasRole(role, requiredRole) {
+			capabilities = append(capabilities, capability)
+		}
+	}
+	sort.Strings(capabilities)
+	return capabilities
+}
\ No newline at end of file
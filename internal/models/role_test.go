@@ -0,0 +1,71 @@
+package models
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestHasRole(t *testing.T) {
+	tests := []struct {
+		role, required string
+		want           bool
+	}{
+		{RoleUser, RoleUser, true},
+		{RoleUser, RoleManager, false},
+		{RoleManager, RoleUser, true},
+		{RoleManager, RoleAdmin, false},
+		{RoleAdmin, RoleManager, true},
+		{RoleAdmin, RoleAdmin, true},
+		{"", RoleUser, false},
+		{"superuser", RoleUser, false},
+	}
+
+	for _, tt := range tests {
+		if got := HasRole(tt.role, tt.required); got != tt.want {
+			t.Errorf("HasRole(%q, %q) = %v, want %v", tt.role, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestRoleCapabilities(t *testing.T) {
+	userCapabilities := []string{"can_adjust_stock", "can_approve_orders"}
+	managerCapabilities := append(append([]string{}, userCapabilities...),
+		"can_approve_purchase_orders",
+		"can_close_stock_counts",
+		"can_delete_categories",
+		"can_delete_customers",
+		"can_delete_products",
+		"can_delete_suppliers",
+		"can_delete_warehouses",
+		"can_merge_products",
+	)
+	adminCapabilities := append(append([]string{}, managerCapabilities...), "can_manage_users", "can_view_audit_logs")
+
+	tests := []struct {
+		role string
+		want []string
+	}{
+		{RoleUser, userCapabilities},
+		{RoleManager, managerCapabilities},
+		{RoleAdmin, adminCapabilities},
+		{"unknown", []string{}},
+	}
+
+	for _, tt := range tests {
+		got := RoleCapabilities(tt.role)
+		want := append([]string{}, tt.want...)
+		sort.Strings(want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("RoleCapabilities(%q) = %v, want %v", tt.role, got, want)
+		}
+	}
+}
+
+func TestCapabilityRolesAreKnownRoles(t *testing.T) {
+	for capability, role := range capabilityRoles {
+		if _, ok := roleRanks[role]; !ok {
+			t.Errorf("capability %s requires unknown role %q", capability, role)
+		}
+	}
+}
@@ -19,9 +19,20 @@ type SalesOrder struct {
 	Subtotal      float64   `json:"subtotal" gorm:"type:decimal(10,2);default:0"`
 	Tax           float64   `json:"tax" gorm:"type:decimal(10,2);default:0"`
 	ShippingCost  float64   `json:"shipping_cost" gorm:"type:decimal(10,2);default:0"`
+	ShippingCarrier string  `json:"shipping_carrier"`
+	ShippingMethod  string  `json:"shipping_method"`
+	// ShippingBilledToCustomer is true when the customer pays the shipping cost, which is then
+	// added to the order total. When false the business absorbs it: it is left out of the total
+	// and counted against margin. A pointer so an explicit false isn't replaced by the default.
+	ShippingBilledToCustomer *bool `json:"shipping_billed_to_customer" gorm:"default:true"`
 	TotalAmount   float64   `json:"total_amount" gorm:"type:decimal(10,2);default:0"`
 	PaymentStatus string    `json:"payment_status" gorm:"default:'unpaid'"`
+	PaymentTerms  string    `json:"payment_terms"` // Defaults from the customer; see PaymentTermsDays
+	DueDate       time.Time `json:"due_date"`
+	OnHold        bool      `json:"on_hold" gorm:"default:false"` // Independent of status; blocks fulfillment
+	HoldReason    string    `json:"hold_reason"`
 	UserID        uint      `json:"user_id" gorm:"not null"`
+	Version       int       `json:"version" gorm:"not null;default:1"` // Bumped on every update; see CheckVersion
 	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt     time.Time `json:"updated_at" gorm:"autoUpdateTime"`
 	
@@ -38,6 +49,7 @@ type SalesOrderItem struct {
 	SalesOrderID  uint      `json:"sales_order_id" gorm:"not null"`
 	ProductID     uint      `json:"product_id" gorm:"not null"`
 	Quantity      int       `json:"quantity" gorm:"not null"`
+	QuantityFulfilled int   `json:"quantity_fulfilled" gorm:"not null;default:0"`
 	UnitPrice     float64   `json:"unit_price" gorm:"type:decimal(10,2);not null"`
 	Discount      float64   `json:"discount" gorm:"type:decimal(10,2);default:0"`
 	TotalPrice    float64   `json:"total_price" gorm:"type:decimal(10,2);not null"`
@@ -63,39 +75,52 @@ func (so *SalesOrder) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// NetUnitPrice returns the unit price after the line discount
+func (soi *SalesOrderItem) NetUnitPrice() float64 {
+	return soi.UnitPrice * (1 - soi.Discount/100)
+}
+
 // BeforeCreate hook for sales order item to calculate total price
 func (soi *SalesOrderItem) BeforeCreate(tx *gorm.DB) error {
-	soi.TotalPrice = float64(soi.Quantity) * soi.UnitPrice * (1 - soi.Discount/100)
+	soi.TotalPrice = RoundCurrency(float64(soi.Quantity) * soi.UnitPrice * (1 - soi.Discount/100))
 	return nil
 }
 
 // BeforeSave hook for sales order item to recalculate total price
 func (soi *SalesOrderItem) BeforeSave(tx *gorm.DB) error {
-	soi.TotalPrice = float64(soi.Quantity) * soi.UnitPrice * (1 - soi.Discount/100)
+	soi.TotalPrice = RoundCurrency(float64(soi.Quantity) * soi.UnitPrice * (1 - soi.Discount/100))
 	return nil
 }
 
 // AfterCreate hook for sales order item to update sales order total
 func (soi *SalesOrderItem) AfterCreate(tx *gorm.DB) error {
-	return updateSalesOrderTotal(tx, soi.SalesOrderID)
+	return UpdateSalesOrderTotals(tx, soi.SalesOrderID)
 }
 
 // AfterUpdate hook for sales order item to update sales order total
 func (soi *SalesOrderItem) AfterUpdate(tx *gorm.DB) error {
-	return updateSalesOrderTotal(tx, soi.SalesOrderID)
+	return UpdateSalesOrderTotals(tx, soi.SalesOrderID)
 }
 
 // AfterDelete hook for sales order item to update sales order total
 func (soi *SalesOrderItem) AfterDelete(tx *gorm.DB) error {
-	return updateSalesOrderTotal(tx, soi.SalesOrderID)
+	return UpdateSalesOrderTotals(tx, soi.SalesOrderID)
 }
 
-// updateSalesOrderTotal recalculates all totals for a sales order
-func updateSalesOrderTotal(tx *gorm.DB, soID uint) error {
+// UpdateSalesOrderTotals recalculates subtotal, tax and total for a sales order.
+// This is the single place order totals are computed; the item hooks call it inside
+// the item's create/update/delete transaction, so an error here rolls back the item
+// change as well.
+func UpdateSalesOrderTotals(tx *gorm.DB, soID uint) error {
+	// Bulk deletes by condition don't carry the order ID; there is nothing to recompute
+	if soID == 0 {
+		return nil
+	}
+	
 	var subtotal float64
 	if err := tx.Model(&SalesOrderItem{}).
 		Where("sales_order_id = ?", soID).
-		Select("SUM(total_price)").
+		Select("COALESCE(SUM(total_price), 0)").
 		Scan(&subtotal).Error; err != nil {
 		return err
 	}
@@ -106,10 +131,39 @@ func updateSalesOrderTotal(tx *gorm.DB, soID uint) error {
 		return err
 	}
 	
-	so.Subtotal = subtotal
+	so.Subtotal = RoundCurrency(subtotal)
 	// Tax calculation could be more complex in a real system
-	so.Tax = subtotal * 0.10 // Assuming 10% tax rate
-	so.TotalAmount = so.Subtotal + so.Tax + so.ShippingCost
+	so.Tax = RoundCurrency(so.Subtotal * 0.10) // Assuming 10% tax rate
+	so.TotalAmount = so.Subtotal + so.Tax
+	if so.IsShippingBilledToCustomer() {
+		so.TotalAmount += so.ShippingCost
+	}
+	so.TotalAmount = RoundCurrency(so.TotalAmount)
 	
 	return tx.Save(&so).Error
+}
+
+// IsShippingBilledToCustomer reports whether the customer pays for shipping; unset means yes
+func (so *SalesOrder) IsShippingBilledToCustomer() bool {
+	return so.ShippingBilledToCustomer == nil || *so.ShippingBilledToCustomer
+}
+
+// salesOrderStatusTransitions lists the statuses a sales order may be moved to by a plain
+// status change. Confirmation and fulfillment have their own endpoints because they check
+// and move stock, so "confirmed", "partial" and "fulfilled" are never reachable from here.
+var salesOrderStatusTransitions = map[string][]string{
+	"draft":     {"cancelled"},
+	"confirmed": {"cancelled"},
+	"fulfilled": {"shipped"},
+	"shipped":   {"delivered"},
+}
+
+// CanTransitionSalesOrder reports whether a sales order in status from may be moved to status to
+func CanTransitionSalesOrder(from, to string) bool {
+	for _, status := range salesOrderStatusTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
 }
\ No newline at end of file
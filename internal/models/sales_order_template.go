@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+)
+
+// SalesOrderTemplate is a reusable set of order lines for a customer's standing order.
+// Instantiating it creates a fresh draft SalesOrder at current product prices.
+type SalesOrderTemplate struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	Name            string    `json:"name" gorm:"not null"`
+	CustomerID      uint      `json:"customer_id" gorm:"not null;index"`
+	WarehouseID     uint      `json:"warehouse_id" gorm:"not null"`
+	SourceOrderID   *uint     `json:"source_order_id"` // Order the template was derived from, if any
+	PaymentTerms    string    `json:"payment_terms"`   // Empty uses the customer's terms at instantiation
+	ShippingCarrier string    `json:"shipping_carrier"`
+	ShippingMethod  string    `json:"shipping_method"`
+	UserID          uint      `json:"user_id" gorm:"not null"`
+	CreatedAt       time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt       time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	
+	// Relationships
+	Customer  *Customer                `json:"customer,omitempty" gorm:"foreignKey:CustomerID"`
+	Warehouse *Warehouse               `json:"warehouse,omitempty" gorm:"foreignKey:WarehouseID"`
+	Items     []SalesOrderTemplateItem `json:"items" gorm:"foreignKey:TemplateID"`
+}
+
+// SalesOrderTemplateItem is one line of a template. UnitPrice is the price when the line was
+// saved; it is only used to flag price changes, orders always use the current product price.
+type SalesOrderTemplateItem struct {
+	ID         uint    `json:"id" gorm:"primaryKey"`
+	TemplateID uint    `json:"template_id" gorm:"not null;index"`
+	ProductID  uint    `json:"product_id" gorm:"not null"`
+	Quantity   int     `json:"quantity" gorm:"not null"`
+	UnitPrice  float64 `json:"unit_price" gorm:"type:decimal(10,2);default:0"`
+	Discount   float64 `json:"discount" gorm:"type:decimal(10,2);default:0"`
+	
+	// Relationships
+	Product *Product `json:"product,omitempty" gorm:"foreignKey:ProductID"`
+}
\ No newline at end of file
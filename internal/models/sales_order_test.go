@@ -0,0 +1,101 @@
+package models_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/yourusername/inventory-management-system/internal/models"
+	"github.com/yourusername/inventory-management-system/internal/testutil"
+	"gorm.io/gorm"
+)
+
+// newSalesOrder creates a draft sales order and a product to put on it
+func newSalesOrder(t *testing.T, db *gorm.DB) (models.SalesOrder, models.Product) {
+	t.Helper()
+	user := testutil.CreateUser(t, db, "staff")
+	customer := testutil.CreateCustomer(t, db)
+	warehouse := testutil.CreateWarehouse(t, db)
+	product := testutil.CreateProduct(t, db, 100)
+	return testutil.CreateSalesOrder(t, db, customer.ID, warehouse.ID, user.ID), product
+}
+
+// reloadSalesOrder reads the order and its items back from the database
+func reloadSalesOrder(t *testing.T, db *gorm.DB, id uint) models.SalesOrder {
+	t.Helper()
+	var order models.SalesOrder
+	if err := db.Preload("Items").First(&order, id).Error; err != nil {
+		t.Fatalf("reloading sales order: %v", err)
+	}
+	return order
+}
+
+func TestSalesOrderItemFailureRollsBackTotals(t *testing.T) {
+	db := testutil.Tx(t)
+	order, product := newSalesOrder(t, db)
+
+	first := models.SalesOrderItem{SalesOrderID: order.ID, ProductID: product.ID, Quantity: 2, UnitPrice: 10}
+	if err := db.Create(&first).Error; err != nil {
+		t.Fatalf("adding first item: %v", err)
+	}
+
+	// Fail item creates after the hooks have recomputed the order totals, as a crash
+	// between the item insert and the commit would
+	errInjected := errors.New("injected failure")
+	if err := db.Callback().Create().After("gorm:after_create").Register("test:fail_item_create", func(tx *gorm.DB) {
+		if tx.Statement.Schema != nil && tx.Statement.Schema.Table == "sales_order_items" {
+			tx.AddError(errInjected)
+		}
+	}); err != nil {
+		t.Fatalf("registering failing callback: %v", err)
+	}
+
+	second := models.SalesOrderItem{SalesOrderID: order.ID, ProductID: product.ID, Quantity: 5, UnitPrice: 10}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return tx.Create(&second).Error
+	})
+	if !errors.Is(err, errInjected) {
+		t.Fatalf("adding second item: got %v, want the injected failure", err)
+	}
+
+	got := reloadSalesOrder(t, db, order.ID)
+	if len(got.Items) != 1 {
+		t.Errorf("order has %d items, want 1", len(got.Items))
+	}
+	if got.Subtotal != 20 || got.Tax != 2 || got.TotalAmount != 22 {
+		t.Errorf("totals = subtotal %.2f, tax %.2f, total %.2f; want 20.00, 2.00, 22.00",
+			got.Subtotal, got.Tax, got.TotalAmount)
+	}
+}
+
+func TestSalesOrderTotalsFollowItemChanges(t *testing.T) {
+	db := testutil.Tx(t)
+	order, product := newSalesOrder(t, db)
+
+	kept := models.SalesOrderItem{SalesOrderID: order.ID, ProductID: product.ID, Quantity: 3, UnitPrice: 12.50}
+	removed := models.SalesOrderItem{SalesOrderID: order.ID, ProductID: product.ID, Quantity: 2, UnitPrice: 40, Discount: 10}
+	for _, item := range []*models.SalesOrderItem{&kept, &removed} {
+		if err := db.Create(item).Error; err != nil {
+			t.Fatalf("adding item: %v", err)
+		}
+	}
+
+	// 37.50 + 72.00 with 10% tax
+	got := reloadSalesOrder(t, db, order.ID)
+	if got.Subtotal != 109.50 || got.Tax != 10.95 || got.TotalAmount != 120.45 {
+		t.Errorf("totals with two items = subtotal %.2f, tax %.2f, total %.2f; want 109.50, 10.95, 120.45",
+			got.Subtotal, got.Tax, got.TotalAmount)
+	}
+
+	if err := db.Delete(&removed).Error; err != nil {
+		t.Fatalf("deleting item: %v", err)
+	}
+
+	got = reloadSalesOrder(t, db, order.ID)
+	if len(got.Items) != 1 {
+		t.Errorf("order has %d items after the delete, want 1", len(got.Items))
+	}
+	if got.Subtotal != 37.50 || got.Tax != 3.75 || got.TotalAmount != 41.25 {
+		t.Errorf("totals after the delete = subtotal %.2f, tax %.2f, total %.2f; want 37.50, 3.75, 41.25",
+			got.Subtotal, got.Tax, got.TotalAmount)
+	}
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Stock alert statuses. An alert opens as new, may be acknowledged by staff, and is
+// resolved once the product is restocked above its reorder level.
+const (
+	StockAlertNew          = "new"
+	StockAlertAcknowledged = "acknowledged"
+	StockAlertResolved     = "resolved"
+)
+
+// StockAlert records a product falling to or below its reorder level. A product has at
+// most one open (new or acknowledged) alert at a time.
+type StockAlert struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	ProductID      uint       `json:"product_id" gorm:"not null;index"`
+	Quantity       int        `json:"quantity"`      // Stock when the alert opened
+	ReorderLevel   int        `json:"reorder_level"` // Reorder level when the alert opened
+	Status         string     `json:"status" gorm:"not null;default:'new';index"`
+	AcknowledgedBy *uint      `json:"acknowledged_by"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at"`
+	ResolvedAt     *time.Time `json:"resolved_at"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt      time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+	
+	// Relationships
+	Product *Product `json:"product,omitempty" gorm:"foreignKey:ProductID"`
+}
+
+// OpenStockAlert records a low stock alert for product unless one is already open. Call it
+// in the transaction that lowered the product's stock, which holds the product row lock, so
+// two decreases can't both open one.
+func OpenStockAlert(tx *gorm.DB, product *Product) error {
+	var open int64
+	if err := tx.Model(&StockAlert{}).
+		Where("product_id = ? AND status <> ?", product.ID, StockAlertResolved).
+		Count(&open).Error; err != nil {
+		return err
+	}
+	if open > 0 {
+		return nil
+	}
+	
+	return tx.Create(&StockAlert{
+		ProductID:    product.ID,
+		Quantity:     product.Quantity,
+		ReorderLevel: product.ReorderLevel,
+		Status:       StockAlertNew,
+	}).Error
+}
+
+// ResolveRestockedAlerts resolves the open alerts of products whose stock is back above
+// their reorder level. With no product IDs every open alert is checked.
+func ResolveRestockedAlerts(tx *gorm.DB, productIDs ...uint) error {
+	restocked := tx.Model(&Product{}).Select("id").Where("quantity > reorder_level")
+	if len(productIDs) > 0 {
+		restocked = restocked.Where("id IN ?", productIDs)
+	}
+	
+	return tx.Model(&StockAlert{}).
+		Where("status <> ? AND product_id IN (?)", StockAlertResolved, restocked).
+		Updates(map[string]interface{}{
+			"status":      StockAlertResolved,
+			"resolved_at": time.Now(),
+		}).Error
+}
\ No newline at end of file
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+)
+
+// Stock count session statuses. A session opens empty, moves to counting with its first
+// recorded count and is closed once its variances have been applied.
+const (
+	StockCountOpen     = "open"
+	StockCountCounting = "counting"
+	StockCountClosed   = "closed"
+)
+
+// StockCountSession is a formal physical count of a warehouse, or of one zone in it. Counts
+// are recorded against the session, possibly by several counters, and only change stock
+// when the session is closed, which applies them as a StockTake.
+type StockCountSession struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	WarehouseID uint       `json:"warehouse_id" gorm:"not null;index"`
+	Zone        string     `json:"zone"` // Limits counts to locations in this zone when set
+	Status      string     `json:"status" gorm:"not null;default:'open';index"`
+	Notes       string     `json:"notes"`
+	StartedBy   uint       `json:"started_by" gorm:"not null"`
+	ClosedBy    *uint      `json:"closed_by"`
+	ClosedAt    *time.Time `json:"closed_at"`
+	StockTakeID *uint      `json:"stock_take_id"` // The stock take that applied the variances
+	CreatedAt   time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+	
+	// Relationships
+	Warehouse *Warehouse       `json:"warehouse,omitempty" gorm:"foreignKey:WarehouseID"`
+	Lines     []StockCountLine `json:"lines" gorm:"foreignKey:SessionID"`
+}
+
+// StockCountLine is the latest count of one product at one location in a session.
+// Recounting the same product and location replaces it.
+type StockCountLine struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	SessionID       uint      `json:"session_id" gorm:"not null;uniqueIndex:idx_stock_count_line"`
+	ProductID       uint      `json:"product_id" gorm:"not null;uniqueIndex:idx_stock_count_line"`
+	LocationID      uint      `json:"location_id" gorm:"not null;default:0;uniqueIndex:idx_stock_count_line"`
+	CountedQuantity int       `json:"counted_quantity"`
+	CountedBy       uint      `json:"counted_by" gorm:"not null"`
+	CreatedAt       time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt       time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
\ No newline at end of file
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StockReservation holds stock for a confirmed sales order line until it is fulfilled, or
+// for a manual hold placed by a user until it is released or expires.
+// Reserved stock is still counted in Product.Quantity; it is only unavailable to other orders.
+type StockReservation struct {
+	ID               uint       `json:"id" gorm:"primaryKey"`
+	Type             string     `json:"type" gorm:"default:'order';index"` // "order" or "manual"
+	SalesOrderID     *uint      `json:"sales_order_id,omitempty" gorm:"index"`
+	SalesOrderItemID *uint      `json:"sales_order_item_id,omitempty" gorm:"index"`
+	ProductID        uint       `json:"product_id" gorm:"not null;index"`
+	WarehouseID      uint       `json:"warehouse_id"`
+	Quantity         int        `json:"quantity" gorm:"not null"` // Still held; decreases as the line is fulfilled
+	Status           string     `json:"status" gorm:"default:'active'"` // "active", "consumed", "released", "expired"
+	Reason           string     `json:"reason,omitempty"`
+	OwnerUserID      *uint      `json:"owner_user_id,omitempty"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty" gorm:"index"` // Manual holds stop counting once this passes
+	CreatedAt        time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt        time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+	
+	// Relationships
+	SalesOrder       *SalesOrder     `json:"-" gorm:"foreignKey:SalesOrderID"`
+	SalesOrderItem   *SalesOrderItem `json:"-" gorm:"foreignKey:SalesOrderItemID"`
+	Product          *Product        `json:"product,omitempty" gorm:"foreignKey:ProductID"`
+	OwnerUser        *User           `json:"owner_user,omitempty" gorm:"foreignKey:OwnerUserID"`
+}
+
+// ReservedQuantity returns the quantity of a product held by active reservations, including
+// reservations on bundles it is a component of, multiplied out through nested bundles.
+// Holds past their expiry are ignored even before ExpireStockHolds marks them.
+func ReservedQuantity(tx *gorm.DB, productID uint) (int, error) {
+	var reserved int
+	err := tx.Raw(`
+		WITH RECURSIVE holders(product_id, factor) AS (
+			SELECT CAST(? AS bigint), 1
+			UNION ALL
+			SELECT product_bundles.parent_product_id, holders.factor * product_bundles.quantity
+			FROM product_bundles
+			JOIN holders ON product_bundles.child_product_id = holders.product_id
+		)
+		SELECT COALESCE(SUM(stock_reservations.quantity * holders.factor), 0)
+		FROM holders
+		JOIN stock_reservations ON stock_reservations.product_id = holders.product_id
+		WHERE stock_reservations.status = ?
+			AND (stock_reservations.expires_at IS NULL OR stock_reservations.expires_at > ?)`,
+		productID, "active", time.Now()).
+		Scan(&reserved).Error
+	return reserved, err
+}
+
+// AvailableQuantity returns a product's stock on hand less what is reserved for confirmed orders.
+// A bundle's availability is the number of complete bundles its components can still make.
+func AvailableQuantity(tx *gorm.DB, productID uint) (int, error) {
+	components, err := BundleComponents(tx, productID)
+	if err != nil {
+		return 0, err
+	}
+	if len(components) > 0 {
+		return bundleAvailableQuantity(tx, components)
+	}
+	
+	var product Product
+	if err := tx.First(&product, productID).Error; err != nil {
+		return 0, err
+	}
+	
+	reserved, err := ReservedQuantity(tx, productID)
+	if err != nil {
+		return 0, err
+	}
+	
+	return product.Quantity - reserved, nil
+}
+
+// WarehouseAvailableQuantity returns a product's stock at one warehouse less what is reserved there.
+// tracked is false when the product has no per-warehouse stock records at all, in which case
+// callers should fall back to AvailableQuantity.
+func WarehouseAvailableQuantity(tx *gorm.DB, productID, warehouseID uint) (available int, tracked bool, err error) {
+	var records int64
+	if err := tx.Model(&ProductWarehouse{}).Where("product_id = ?", productID).Count(&records).Error; err != nil {
+		return 0, false, err
+	}
+	if records == 0 {
+		return 0, false, nil
+	}
+	
+	var onHand int
+	if err := tx.Model(&ProductWarehouse{}).
+		Where("product_id = ? AND warehouse_id = ?", productID, warehouseID).
+		Select("COALESCE(SUM(quantity), 0)").
+		Scan(&onHand).Error; err != nil {
+		return 0, true, err
+	}
+	
+	var reserved int
+	if err := tx.Model(&StockReservation{}).
+		Where("product_id = ? AND warehouse_id = ? AND status = ?", productID, warehouseID, "active").
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Select("COALESCE(SUM(quantity), 0)").
+		Scan(&reserved).Error; err != nil {
+		return 0, true, err
+	}
+	
+	return onHand - reserved, true, nil
+}
+
+// ReleaseSalesOrderReservations frees any stock still reserved for a sales order
+func ReleaseSalesOrderReservations(tx *gorm.DB, salesOrderID uint) error {
+	return tx.Model(&StockReservation{}).
+		Where("sales_order_id = ? AND status = ?", salesOrderID, "active").
+		Update("status", "released").Error
+}
+
+// ExpireStockHolds marks active holds whose expiry has passed as expired
+func ExpireStockHolds(tx *gorm.DB) error {
+	return tx.Model(&StockReservation{}).
+		Where("status = ? AND expires_at IS NOT NULL AND expires_at <= ?", "active", time.Now()).
+		Update("status", "expired").Error
+}
\ No newline at end of file
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+// StockTake records a physical count submitted for a warehouse. Each line compares the
+// counted quantity with what the system held at that location, and every mismatch is
+// corrected by a cycle_count adjustment transaction.
+type StockTake struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	WarehouseID uint      `json:"warehouse_id" gorm:"not null;index"`
+	UserID      uint      `json:"user_id" gorm:"not null"`
+	Notes       string    `json:"notes"`
+	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
+	
+	// Relationships
+	Lines     []StockTakeLine `json:"lines" gorm:"foreignKey:StockTakeID"`
+	Warehouse *Warehouse      `json:"-" gorm:"foreignKey:WarehouseID"`
+	User      *User           `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// StockTakeLine is one counted product at one location
+type StockTakeLine struct {
+	ID              uint  `json:"id" gorm:"primaryKey"`
+	StockTakeID     uint  `json:"stock_take_id" gorm:"not null;index"`
+	ProductID       uint  `json:"product_id" gorm:"not null"`
+	LocationID      uint  `json:"location_id"`
+	SystemQuantity  int   `json:"system_quantity"`
+	CountedQuantity int   `json:"counted_quantity"`
+	Difference      int   `json:"difference"` // Counted less system; the adjustment applied
+	TransactionID   *uint `json:"transaction_id,omitempty"` // The adjustment, when there was a difference
+}
\ No newline at end of file
@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // Supplier represents a supplier entity
@@ -17,8 +19,9 @@ type Supplier struct {
 	Status        string    `json:"status" gorm:"default:'active'"`
 	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt     time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt     gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
 	
 	// Relationships
-	Products       []Product       `json:"products,omitempty" gorm:"many2many:product_supplier"`
+	Products       []Product       `json:"products,omitempty" gorm:"many2many:product_suppliers"`
 	PurchaseOrders []PurchaseOrder `json:"purchase_orders,omitempty" gorm:"foreignKey:SupplierID"`
 }
\ No newline at end of file
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// ErrVersionConflict is returned when a record's version no longer matches the one the
+// caller read, meaning someone else updated it in between
+var ErrVersionConflict = errors.New("record has been modified since it was read")
+
+// CheckVersion reports ErrVersionConflict when an update scoped to an expected version
+// matched no rows. Callers set the record's Version to expected+1 and add
+// Where("version = ?", expected), so a successful update also bumps the version.
+func CheckVersion(result *gorm.DB) error {
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+	return nil
+}
\ No newline at end of file
@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // Warehouse represents a storage location for inventory
@@ -16,6 +18,7 @@ type Warehouse struct {
 	Status    string    `json:"status" gorm:"default:'active'"`
 	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
 	
 	// Relationships
 	Locations           []WarehouseLocation  `json:"locations,omitempty" gorm:"foreignKey:WarehouseID"`
@@ -37,6 +40,7 @@ type WarehouseLocation struct {
 	Status      string    `json:"status" gorm:"default:'active'"`
 	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt   time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt   gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
 	
 	// Relationships
 	Warehouse    *Warehouse             `json:"warehouse" gorm:"foreignKey:WarehouseID"`
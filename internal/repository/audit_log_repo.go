@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/yourusername/inventory-management-system/internal/models"
+	"gorm.io/gorm"
+)
+
+// AuditLogRepository implements IAuditLogRepository
+type AuditLogRepository struct {
+	db *gorm.DB
+}
+
+// NewAuditLogRepository creates a new audit log repository
+func NewAuditLogRepository(db *gorm.DB) *AuditLogRepository {
+	return &AuditLogRepository{db: db}
+}
+
+// applyAuditLogFilters narrows an audit log query by the filters shared by GetLogs and Count
+func applyAuditLogFilters(query *gorm.DB, params map[string]interface{}) *gorm.DB {
+	if userID, ok := params["user_id"].(uint); ok {
+		query = query.Where("user_id = ?", userID)
+	}
+	
+	if entityType, ok := params["entity_type"].(string); ok && entityType != "" {
+		query = query.Where("entity_type = ?", entityType)
+	}
+	
+	if entityID, ok := params["entity_id"].(uint); ok {
+		query = query.Where("entity_id = ?", entityID)
+	}
+	
+	if action, ok := params["action"].(string); ok && action != "" {
+		query = query.Where("action = ?", action)
+	}
+	
+	if startDate, ok := params["start_date"].(time.Time); ok {
+		query = query.Where("created_at >= ?", startDate)
+	}
+	
+	if endDate, ok := params["end_date"].(time.Time); ok {
+		query = query.Where("created_at < ?", endDate)
+	}
+	
+	return query
+}
+
+// CreateLog records a new audit log entry
+func (r *AuditLogRepository) CreateLog(log *models.AuditLog) error {
+	return r.db.Create(log).Error
+}
+
+// GetLogs retrieves audit log entries, newest first, with optional filtering and pagination
+func (r *AuditLogRepository) GetLogs(params map[string]interface{}) ([]models.AuditLog, error) {
+	var logs []models.AuditLog
+	
+	query := applyAuditLogFilters(r.db.Preload("User"), params).Order("created_at DESC, id DESC")
+	
+	// Apply pagination
+	if page, ok := params["page"].(int); ok {
+		limit := 10 // Default limit
+		if pageLimit, ok := params["limit"].(int); ok {
+			limit = pageLimit
+		}
+		offset := (page - 1) * limit
+		query = query.Limit(limit).Offset(offset)
+	}
+	
+	err := query.Find(&logs).Error
+	return logs, err
+}
+
+// Count returns the number of audit log entries matching the same filters as GetLogs
+func (r *AuditLogRepository) Count(params map[string]interface{}) (int64, error) {
+	var total int64
+	err := applyAuditLogFilters(r.db.Model(&models.AuditLog{}), params).Count(&total).Error
+	return total, err
+}
+
+// GetUserLogs retrieves the audit log entries recorded for a user's actions, newest first
+func (r *AuditLogRepository) GetUserLogs(userID uint) ([]models.AuditLog, error) {
+	return r.GetLogs(map[string]interface{}{"user_id": userID})
+}
+
+// GetEntityLogs retrieves the audit history of a single entity, newest first
+func (r *AuditLogRepository) GetEntityLogs(entityType string, entityID uint) ([]models.AuditLog, error) {
+	return r.GetLogs(map[string]interface{}{"entity_type": entityType, "entity_id": entityID})
+}
\ No newline at end of file
@@ -1,10 +1,24 @@
 package repository
 
 import (
+	"errors"
+	"strings"
+	"time"
+
 	"github.com/yourusername/inventory-management-system/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrSupplierNotLinked is returned when a supplier is not linked to the product
+var ErrSupplierNotLinked = errors.New("supplier is not linked to this product")
+
+// ErrQuantityConflict is returned when a product's quantity changed since the caller read it
+var ErrQuantityConflict = errors.New("product quantity has changed since it was read")
+
+// ErrMergeConflict is returned when products can't be merged because they share an open order
+var ErrMergeConflict = errors.New("products to merge appear together on an open order")
+
 // ProductRepository handles database operations for products
 type ProductRepository struct {
 	db *gorm.DB
@@ -15,32 +29,83 @@ func NewProductRepository(db *gorm.DB) *ProductRepository {
 	return &ProductRepository{db: db}
 }
 
-// GetAll retrieves all products with optional filtering
-func (r *ProductRepository) GetAll(params map[string]interface{}) ([]models.Product, error) {
-	var products []models.Product
-	
-	query := r.db
+// applyProductFilters applies the category, search and status filters shared by GetAll and Count
+func applyProductFilters(query *gorm.DB, params map[string]interface{}) *gorm.DB {
+	if includeDeleted, ok := params["include_deleted"].(bool); ok && includeDeleted {
+		query = query.Unscoped()
+	}
 	
-	// Apply filters
 	if category, ok := params["category"]; ok && category != "" {
 		query = query.Joins("JOIN product_category ON products.id = product_category.product_id").
-			Joins("JOIN categories ON product_category.category_id = categories.id").
+			Joins("JOIN categories ON product_category.category_id = categories.id AND categories.deleted_at IS NULL").
 			Where("categories.name = ?", category)
 	}
 	
-	if search, ok := params["search"]; ok && search != "" {
-		searchPattern := "%" + search.(string) + "%"
-		query = query.Where("products.name LIKE ? OR products.sku LIKE ? OR products.description LIKE ?", 
-			searchPattern, searchPattern, searchPattern)
+	if search, ok := params["search"].(string); ok && search != "" {
+		if params["search_match"] == "exact" {
+			query = query.Where("products.sku = ? OR products.barcode = ?", search, search)
+		} else {
+			// Every term has to match one of the fields
+			for _, term := range strings.Fields(search) {
+				searchPattern := "%" + escapeLike(term) + "%"
+				query = query.Where(`products.name ILIKE ? OR products.sku ILIKE ? OR products.description ILIKE ?
+					OR products.barcode ILIKE ? OR EXISTS (
+						SELECT 1 FROM product_suppliers
+						WHERE product_suppliers.product_id = products.id AND product_suppliers.supplier_sku ILIKE ?)`,
+					searchPattern, searchPattern, searchPattern, searchPattern, searchPattern)
+			}
+		}
 	}
 	
 	if status, ok := params["status"]; ok && status != "" {
 		query = query.Where("products.status = ?", status)
 	}
 	
-	// Apply sorting
-	if sort, ok := params["sort"]; ok && sort != "" {
+	// Custom field values arrive in the text form ->> returns
+	if customFields, ok := params["custom_fields"].(map[string]string); ok {
+		for name, value := range customFields {
+			query = query.Where("products.custom_fields ->> ? = ?", name, value)
+		}
+	}
+	
+	// Creation and update time bounds, used by clients syncing incrementally
+	if createdAfter, ok := params["created_after"].(time.Time); ok {
+		query = query.Where("products.created_at > ?", createdAfter)
+	}
+	
+	if createdBefore, ok := params["created_before"].(time.Time); ok {
+		query = query.Where("products.created_at < ?", createdBefore)
+	}
+	
+	if updatedAfter, ok := params["updated_after"].(time.Time); ok {
+		query = query.Where("products.updated_at > ?", updatedAfter)
+	}
+	
+	return query
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// GetAll retrieves all products with optional filtering
+func (r *ProductRepository) GetAll(params map[string]interface{}) ([]models.Product, error) {
+	var products []models.Product
+	
+	query := applyProductFilters(r.db, params)
+	
+	// Apply sorting; callers must pass an allowlisted ORDER BY clause, never raw client input
+	if sort, ok := params["sort"].(string); ok && sort != "" {
 		query = query.Order(sort)
+	} else if search, ok := params["search"].(string); ok && search != "" {
+		// Rank exact SKU matches first, then names starting with the search, then the rest
+		query = query.Order(clause.OrderBy{Expression: clause.Expr{
+			SQL: `CASE WHEN LOWER(products.sku) = LOWER(?) THEN 0
+				WHEN products.name ILIKE ? THEN 1 ELSE 2 END, products.name ASC`,
+			Vars:               []interface{}{search, escapeLike(search) + "%"},
+			WithoutParentheses: true,
+		}})
 	} else {
 		query = query.Order("products.name ASC")
 	}
@@ -60,6 +125,13 @@ func (r *ProductRepository) GetAll(params map[string]interface{}) ([]models.Prod
 	return products, err
 }
 
+// Count returns how many products match the same filters as GetAll, ignoring pagination
+func (r *ProductRepository) Count(params map[string]interface{}) (int64, error) {
+	var total int64
+	err := applyProductFilters(r.db.Model(&models.Product{}), params).Count(&total).Error
+	return total, err
+}
+
 // GetByID retrieves a product by ID
 func (r *ProductRepository) GetByID(id uint) (*models.Product, error) {
 	var product models.Product
@@ -90,9 +162,18 @@ func (r *ProductRepository) Update(product *models.Product) error {
 	return r.db.Save(product).Error
 }
 
-// Delete soft-deletes a product by updating its status
+// UpdateVersioned saves every field of a product only if its version is still expected,
+// bumping the version, and returns models.ErrVersionConflict otherwise. Quantity is left
+// alone: stock only changes through transactions, which don't bump the version, so a
+// client's stale quantity must not overwrite them.
+func (r *ProductRepository) UpdateVersioned(product *models.Product, expected int) error {
+	product.Version = expected + 1
+	return models.CheckVersion(r.db.Model(product).Where("version = ?", expected).Select("*").Omit("created_at", "quantity").Updates(product))
+}
+
+// Delete soft-deletes a product by setting its deleted_at
 func (r *ProductRepository) Delete(id uint) error {
-	return r.db.Model(&models.Product{}).Where("id = ?", id).Update("status", "inactive").Error
+	return r.db.Delete(&models.Product{}, id).Error
 }
 
 // GetLowStock retrieves products with quantity below their reorder level
@@ -147,4 +228,224 @@ func (r *ProductRepository) AddProductCategory(productID, categoryID uint) error
 // RemoveProductCategory removes a product from a category
 func (r *ProductRepository) RemoveProductCategory(productID, categoryID uint) error {
 	return r.db.Where("product_id = ? AND category_id = ?", productID, categoryID).Delete(&models.ProductCategory{}).Error
+}
+
+// GetPrimarySupplier retrieves the primary supplier link for a product
+func (r *ProductRepository) GetPrimarySupplier(productID uint) (*models.ProductSupplier, error) {
+	var productSupplier models.ProductSupplier
+	err := r.db.Where("product_id = ? AND is_primary = ?", productID, true).
+		Preload("Supplier").
+		First(&productSupplier).Error
+	if err != nil {
+		return nil, err
+	}
+	return &productSupplier, nil
+}
+
+// SetPrimarySupplier marks a linked supplier as the product's primary supplier,
+// clearing the flag on every other supplier of the product
+func (r *ProductRepository) SetPrimarySupplier(productID, supplierID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var productSupplier models.ProductSupplier
+		if err := tx.Where("product_id = ? AND supplier_id = ?", productID, supplierID).
+			First(&productSupplier).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrSupplierNotLinked
+			}
+			return err
+		}
+		
+		if err := tx.Model(&models.ProductSupplier{}).
+			Where("product_id = ? AND supplier_id <> ?", productID, supplierID).
+			Update("is_primary", false).Error; err != nil {
+			return err
+		}
+		
+		return tx.Model(&models.ProductSupplier{}).
+			Where("product_id = ? AND supplier_id = ?", productID, supplierID).
+			Update("is_primary", true).Error
+	})
+}
+
+// ProductDetail aggregates everything shown on a product page
+type ProductDetail struct {
+	Product            *models.Product               `json:"product"`
+	Suppliers          []models.ProductSupplier      `json:"suppliers"`
+	WarehouseStock     []models.ProductWarehouse     `json:"warehouse_stock"`
+	RecentTransactions []models.InventoryTransaction `json:"recent_transactions"`
+}
+
+// GetDetail retrieves a product with its categories, variants and attachments, its supplier
+// pricing, its stock per warehouse and its most recent transactions
+func (r *ProductRepository) GetDetail(id uint, transactionLimit int) (*ProductDetail, error) {
+	var product models.Product
+	if err := r.db.Preload("Categories").Preload("Variants").Preload("Attachments").
+		First(&product, id).Error; err != nil {
+		return nil, err
+	}
+	
+	detail := &ProductDetail{
+		Product:            &product,
+		Suppliers:          []models.ProductSupplier{},
+		WarehouseStock:     []models.ProductWarehouse{},
+		RecentTransactions: []models.InventoryTransaction{},
+	}
+	
+	if err := r.db.Where("product_id = ?", id).Preload("Supplier").
+		Order("is_primary DESC, unit_cost ASC").
+		Find(&detail.Suppliers).Error; err != nil {
+		return nil, err
+	}
+	
+	for i := range detail.Suppliers {
+		if detail.Suppliers[i].IsPrimary {
+			product.PrimarySupplier = &detail.Suppliers[i]
+		}
+	}
+	
+	if err := r.db.Where("product_id = ?", id).Preload("Warehouse").Preload("Location").
+		Find(&detail.WarehouseStock).Error; err != nil {
+		return nil, err
+	}
+	
+	if err := r.db.Where("product_id = ?", id).Preload("Warehouse").Preload("User").
+		Order("created_at DESC").Limit(transactionLimit).
+		Find(&detail.RecentTransactions).Error; err != nil {
+		return nil, err
+	}
+	
+	return detail, nil
+}
+
+// MergeProducts folds duplicate products into a primary product in one transaction. The
+// duplicates' transactions, order lines, reservations, variants, attachments, bundles and
+// category/supplier links move to the primary, their stock is added to it per warehouse and
+// in total, and they are left inactive with no stock. Links the primary already has are kept
+// as they are. Products that share an open order are refused with ErrMergeConflict, since the
+// order would end up with two lines for the same product.
+func (r *ProductRepository) MergeProducts(primaryID uint, duplicateIDs []uint) (*models.Product, error) {
+	var merged models.Product
+	
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		allIDs := append([]uint{primaryID}, duplicateIDs...)
+		
+		// Lock every product involved so stock can't move mid-merge
+		var products []models.Product
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ?", allIDs).Order("id").Find(&products).Error; err != nil {
+			return err
+		}
+		if len(products) != len(allIDs) {
+			return gorm.ErrRecordNotFound
+		}
+		
+		// Refuse when two of the products sit on the same open order
+		var conflicts int64
+		if err := tx.Table("sales_order_items").
+			Joins("JOIN sales_orders ON sales_order_items.sales_order_id = sales_orders.id").
+			Where("sales_order_items.product_id IN ? AND sales_orders.status NOT IN ?", allIDs, []string{"fulfilled", "cancelled", "shipped", "delivered"}).
+			Group("sales_order_items.sales_order_id").
+			Having("COUNT(DISTINCT sales_order_items.product_id) > 1").
+			Count(&conflicts).Error; err != nil {
+			return err
+		}
+		if conflicts == 0 {
+			if err := tx.Table("purchase_order_items").
+				Joins("JOIN purchase_orders ON purchase_order_items.purchase_order_id = purchase_orders.id").
+				Where("purchase_order_items.product_id IN ? AND purchase_orders.status NOT IN ?", allIDs, []string{"received", "cancelled"}).
+				Group("purchase_order_items.purchase_order_id").
+				Having("COUNT(DISTINCT purchase_order_items.product_id) > 1").
+				Count(&conflicts).Error; err != nil {
+				return err
+			}
+		}
+		if conflicts > 0 {
+			return ErrMergeConflict
+		}
+		
+		// Rows that simply point at the product move across; UpdateColumn skips the item
+		// hooks, as order totals don't change
+		for _, table := range []string{"inventory_transactions", "sales_order_items", "purchase_order_items",
+			"stock_reservations", "product_variants", "product_attachments"} {
+			if err := tx.Table(table).Where("product_id IN ?", duplicateIDs).
+				UpdateColumn("product_id", primaryID).Error; err != nil {
+				return err
+			}
+		}
+		
+		if err := tx.Table("product_bundles").Where("parent_product_id IN ?", duplicateIDs).
+			UpdateColumn("parent_product_id", primaryID).Error; err != nil {
+			return err
+		}
+		if err := tx.Table("product_bundles").Where("child_product_id IN ?", duplicateIDs).
+			UpdateColumn("child_product_id", primaryID).Error; err != nil {
+			return err
+		}
+		// A bundle between the primary and one of its duplicates would now contain itself
+		if err := tx.Where("parent_product_id = child_product_id").Delete(&models.ProductBundle{}).Error; err != nil {
+			return err
+		}
+		
+		// Category and supplier links are keyed by product; only move the ones the primary lacks
+		if err := tx.Exec(`INSERT INTO product_category (product_id, category_id)
+			SELECT DISTINCT ?, category_id FROM product_category WHERE product_id IN ?
+			ON CONFLICT DO NOTHING`, primaryID, duplicateIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM product_category WHERE product_id IN ?", duplicateIDs).Error; err != nil {
+			return err
+		}
+		
+		var primaryHasPrimarySupplier int64
+		if err := tx.Model(&models.ProductSupplier{}).Where("product_id = ? AND is_primary = ?", primaryID, true).
+			Count(&primaryHasPrimarySupplier).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`INSERT INTO product_suppliers (product_id, supplier_id, unit_cost, min_order_quantity, lead_time_days, supplier_sku, is_primary, created_at, updated_at)
+			SELECT DISTINCT ON (supplier_id) ?, supplier_id, unit_cost, min_order_quantity, lead_time_days, supplier_sku, is_primary AND ?, created_at, NOW()
+			FROM product_suppliers WHERE product_id IN ?
+			ORDER BY supplier_id, is_primary DESC
+			ON CONFLICT DO NOTHING`, primaryID, primaryHasPrimarySupplier == 0, duplicateIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("product_id IN ?", duplicateIDs).Delete(&models.ProductSupplier{}).Error; err != nil {
+			return err
+		}
+		
+		// Warehouse stock adds into the primary's row for each warehouse location
+		if err := tx.Exec(`INSERT INTO product_warehouses (product_id, warehouse_id, location_id, quantity, created_at, updated_at)
+			SELECT ?, warehouse_id, location_id, SUM(quantity), NOW(), NOW()
+			FROM product_warehouses WHERE product_id IN ?
+			GROUP BY warehouse_id, location_id
+			ON CONFLICT (product_id, warehouse_id, location_id)
+			DO UPDATE SET quantity = product_warehouses.quantity + EXCLUDED.quantity, updated_at = NOW()`,
+			primaryID, duplicateIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("product_id IN ?", duplicateIDs).Delete(&models.ProductWarehouse{}).Error; err != nil {
+			return err
+		}
+		
+		total := 0
+		for _, product := range products {
+			total += product.Quantity
+		}
+		
+		if err := tx.Model(&models.Product{}).Where("id = ?", primaryID).
+			UpdateColumn("quantity", total).Error; err != nil {
+			return err
+		}
+		
+		if err := tx.Model(&models.Product{}).Where("id IN ?", duplicateIDs).
+			UpdateColumns(map[string]interface{}{"quantity": 0, "status": "inactive", "version": gorm.Expr("version + 1")}).Error; err != nil {
+			return err
+		}
+		
+		return tx.First(&merged, primaryID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	
+	return &merged, nil
 }
\ No newline at end of file
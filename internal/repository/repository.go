@@ -9,6 +9,7 @@ import (
 // ProductRepository defines the interface for product database operations
 type IProductRepository interface {
 	GetAll(params map[string]interface{}) ([]models.Product, error)
+	Count(params map[string]interface{}) (int64, error)
 	GetByID(id uint) (*models.Product, error)
 	GetBySKU(sku string) (*models.Product, error)
 	Create(product *models.Product) error
@@ -21,6 +22,10 @@ type IProductRepository interface {
 	GetProductCategories(productID uint) ([]models.Category, error)
 	AddProductCategory(productID, categoryID uint) error
 	RemoveProductCategory(productID, categoryID uint) error
+	GetPrimarySupplier(productID uint) (*models.ProductSupplier, error)
+	SetPrimarySupplier(productID, supplierID uint) error
+	GetDetail(id uint, transactionLimit int) (*ProductDetail, error)
+	MergeProducts(primaryID uint, duplicateIDs []uint) (*models.Product, error)
 }
 
 // CategoryRepository defines the interface for category database operations
@@ -63,8 +68,11 @@ type ITransactionRepository interface {
 	GetAll(params map[string]interface{}) ([]models.InventoryTransaction, error)
 	GetByID(id uint) (*models.InventoryTransaction, error)
 	Create(transaction *models.InventoryTransaction) error
+	Adjust(transaction *models.InventoryTransaction, allowNegative bool) error
+	AdjustFrom(transaction *models.InventoryTransaction, expectedQty int) error
 	GetProductTransactions(productID uint, startDate, endDate time.Time) ([]models.InventoryTransaction, error)
 	GetProductMovementSummary(startDate, endDate time.Time) ([]map[string]interface{}, error)
+	GetWarehouseMovementSummary(warehouseID uint, startDate, endDate time.Time) ([]ProductMovement, error)
 }
 
 // PurchaseOrderRepository defines the interface for purchase order database operations
@@ -129,6 +137,7 @@ type IReportRepository interface {
 type IAuditLogRepository interface {
 	CreateLog(log *models.AuditLog) error
 	GetLogs(params map[string]interface{}) ([]models.AuditLog, error)
+	Count(params map[string]interface{}) (int64, error)
 	GetUserLogs(userID uint) ([]models.AuditLog, error)
 	GetEntityLogs(entityType string, entityID uint) ([]models.AuditLog, error)
 }
\ No newline at end of file
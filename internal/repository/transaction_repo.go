@@ -1,15 +1,30 @@
 package repository
 
 import (
+	"errors"
 	"time"
 
+	"github.com/yourusername/inventory-management-system/internal/alerts"
 	"github.com/yourusername/inventory-management-system/internal/models"
 	"gorm.io/gorm"
 )
 
+// ErrNegativeStock is returned when an issue or adjustment would take a product's quantity below zero
+var ErrNegativeStock = errors.New("transaction would take stock below zero")
+
+// ErrLocationRequired is returned when a receive or issue names no location in a warehouse that has locations
+var ErrLocationRequired = errors.New("a location is required in a warehouse with defined locations")
+
+// ErrInsufficientLocationStock is returned when an issue asks for more than its source location holds
+var ErrInsufficientLocationStock = errors.New("insufficient stock at the source location")
+
+// ErrLocationNotInWarehouse is returned when a receive or issue names a location in another warehouse
+var ErrLocationNotInWarehouse = errors.New("location does not belong to the transaction's warehouse")
+
 // TransactionRepository handles database operations for inventory transactions
 type TransactionRepository struct {
-	db *gorm.DB
+	db      *gorm.DB
+	alerter alerts.StockAlerter
 }
 
 // NewTransactionRepository creates a new transaction repository
@@ -17,12 +32,51 @@ func NewTransactionRepository(db *gorm.DB) *TransactionRepository {
 	return &TransactionRepository{db: db}
 }
 
+// SetAlerter makes the repository notify alerter when an issue or adjustment takes a
+// product to or below its reorder level. Without one no notifications are sent, though the
+// StockAlert is still recorded.
+func (r *TransactionRepository) SetAlerter(alerter alerts.StockAlerter) {
+	r.alerter = alerter
+}
+
+// LowStockCrossing returns the product if taking amount from its stock has just moved its
+// quantity from above its reorder level to at or below it, so an alert fires once when the
+// level is crossed rather than on every later decrease, and opens a StockAlert for it. Call
+// it after the decrease, inside the same transaction; it returns nil if the level wasn't crossed.
+func LowStockCrossing(tx *gorm.DB, productID uint, amount int) (*models.Product, error) {
+	var product models.Product
+	if err := tx.First(&product, productID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	
+	if product.Quantity <= product.ReorderLevel && product.Quantity+amount > product.ReorderLevel {
+		if err := models.OpenStockAlert(tx, &product); err != nil {
+			return nil, err
+		}
+		return &product, nil
+	}
+	return nil, nil
+}
+
+// notifyLowStock sends an alert for a product found by LowStockCrossing, once its
+// transaction has committed
+func (r *TransactionRepository) notifyLowStock(product *models.Product) {
+	if r.alerter != nil && product != nil {
+		r.alerter.Notify(*product, product.Quantity)
+	}
+}
+
 // GetAll retrieves all inventory transactions with optional filtering
 func (r *TransactionRepository) GetAll(params map[string]interface{}) ([]models.InventoryTransaction, error) {
 	var transactions []models.InventoryTransaction
 	
+	// Deleted users are still loaded so their past transactions stay attributed
 	query := r.db.Preload("Product").Preload("Warehouse").
-		Preload("SourceLocation").Preload("DestinationLocation").Preload("User")
+		Preload("SourceLocation").Preload("DestinationLocation").
+		Preload("User", func(db *gorm.DB) *gorm.DB { return db.Unscoped() })
 	
 	// Apply filters
 	if productID, ok := params["product_id"].(uint); ok {
@@ -33,6 +87,10 @@ func (r *TransactionRepository) GetAll(params map[string]interface{}) ([]models.
 		query = query.Where("warehouse_id = ?", warehouseID)
 	}
 	
+	if userID, ok := params["user_id"].(uint); ok {
+		query = query.Where("user_id = ?", userID)
+	}
+	
 	if txType, ok := params["type"].(string); ok {
 		query = query.Where("type = ?", txType)
 	}
@@ -63,6 +121,70 @@ func (r *TransactionRepository) GetAll(params map[string]interface{}) ([]models.
 	return transactions, err
 }
 
+// Adjust applies an adjustment transaction's signed quantity to the product's stock and
+// records the transaction, in one database transaction. The quantity is changed with a
+// single conditional UPDATE, so concurrent adjustments can't lose each other's changes or
+// slip below zero together; ErrNegativeStock is returned unless allowNegative is set.
+func (r *TransactionRepository) Adjust(transaction *models.InventoryTransaction, allowNegative bool) error {
+	return r.adjust(transaction, allowNegative, nil)
+}
+
+// AdjustFrom is Adjust for clients doing read-modify-write on stock: the adjustment only
+// applies while the product's quantity still equals expectedQty, and ErrQuantityConflict is
+// returned otherwise, so a concurrent change is detected rather than overwritten. It never
+// takes the quantity below zero.
+func (r *TransactionRepository) AdjustFrom(transaction *models.InventoryTransaction, expectedQty int) error {
+	return r.adjust(transaction, false, &expectedQty)
+}
+
+// adjust implements Adjust and AdjustFrom; expectedQty is nil when any current quantity will do
+func (r *TransactionRepository) adjust(transaction *models.InventoryTransaction, allowNegative bool, expectedQty *int) error {
+	var lowStock *models.Product
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&models.Product{}).Where("id = ?", transaction.ProductID)
+		if !allowNegative {
+			query = query.Where("quantity + ? >= 0", transaction.Quantity)
+		}
+		if expectedQty != nil {
+			query = query.Where("quantity = ?", *expectedQty)
+		}
+		
+		result := query.UpdateColumn("quantity", gorm.Expr("quantity + ?", transaction.Quantity))
+		if result.Error != nil {
+			return result.Error
+		}
+		
+		if result.RowsAffected == 0 {
+			// Distinguish a missing product or a stale expected quantity from one without enough stock
+			var product models.Product
+			if err := tx.Select("quantity").First(&product, transaction.ProductID).Error; err != nil {
+				return err
+			}
+			if expectedQty != nil && product.Quantity != *expectedQty {
+				return ErrQuantityConflict
+			}
+			return ErrNegativeStock
+		}
+		
+		if transaction.Quantity < 0 {
+			var err error
+			if lowStock, err = LowStockCrossing(tx, transaction.ProductID, -transaction.Quantity); err != nil {
+				return err
+			}
+		} else if err := models.ResolveRestockedAlerts(tx, transaction.ProductID); err != nil {
+			return err
+		}
+		
+		return tx.Create(transaction).Error
+	})
+	if err != nil {
+		return err
+	}
+	
+	r.notifyLowStock(lowStock)
+	return nil
+}
+
 // GetByID retrieves a transaction by ID
 func (r *TransactionRepository) GetByID(id uint) (*models.InventoryTransaction, error) {
 	var transaction models.InventoryTransaction
@@ -77,35 +199,56 @@ func (r *TransactionRepository) GetByID(id uint) (*models.InventoryTransaction,
 
 // Create creates a new inventory transaction
 func (r *TransactionRepository) Create(transaction *models.InventoryTransaction) error {
+	var lowStock *models.Product
+	
 	// Start a transaction
-	return r.db.Transaction(func(tx *gorm.DB) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
 		// Create the transaction record
 		if err := tx.Create(transaction).Error; err != nil {
 			return err
 		}
 		
-		// Update the product quantity based on the transaction type
-		var product models.Product
-		if err := tx.First(&product, transaction.ProductID).Error; err != nil {
-			return err
-		}
-		
-		switch transaction.Type {
-		case "receive":
-			product.Quantity += transaction.Quantity
-		case "issue":
-			product.Quantity -= transaction.Quantity
-		case "transfer":
-			// No change in overall quantity for transfers
-			// In a real system, we might track quantities by location
-		case "adjustment":
-			// For adjustments, the quantity might be positive or negative
-			// Here we assume the quantity represents the change to make
-			product.Quantity += transaction.Quantity
+		// Update the product quantity based on the transaction type. This is the only place
+		// the quantity changes; the model hook leaves it alone. Transfers don't change the
+		// overall quantity, only the per-location stock below.
+		if delta := transaction.StockDelta(); delta != 0 {
+			// As in Adjust, an issue may not take the quantity below zero
+			query := tx.Model(&models.Product{}).Where("id = ?", transaction.ProductID)
+			if delta < 0 {
+				query = query.Where("quantity + ? >= 0", delta)
+			}
+			
+			result := query.UpdateColumn("quantity", gorm.Expr("quantity + ?", delta))
+			if result.Error != nil {
+				return result.Error
+			}
+			
+			if result.RowsAffected == 0 {
+				var count int64
+				if err := tx.Model(&models.Product{}).Where("id = ?", transaction.ProductID).Count(&count).Error; err != nil {
+					return err
+				}
+				if count == 0 {
+					return gorm.ErrRecordNotFound
+				}
+				return ErrNegativeStock
+			}
+			
+			if delta < 0 {
+				var err error
+				if lowStock, err = LowStockCrossing(tx, transaction.ProductID, -delta); err != nil {
+					return err
+				}
+			} else if err := models.ResolveRestockedAlerts(tx, transaction.ProductID); err != nil {
+				return err
+			}
 		}
 		
-		if err := tx.Save(&product).Error; err != nil {
-			return err
+		// Receipts and issues also move the stock held at their location
+		if transaction.Type == "receive" || transaction.Type == "issue" {
+			if err := ApplyLocationStock(tx, transaction); err != nil {
+				return err
+			}
 		}
 		
 		// If it's a warehouse transfer, update product_warehouse records
@@ -134,7 +277,7 @@ func (r *TransactionRepository) Create(transaction *models.InventoryTransaction)
 				destProductWarehouse = models.ProductWarehouse{
 					ProductID:   transaction.ProductID,
 					WarehouseID: transaction.WarehouseID,
-					LocationID:  *transaction.DestinationLocationID,
+					LocationID:  transaction.DestinationLocationID,
 					Quantity:    transaction.Quantity,
 				}
 				if err := tx.Create(&destProductWarehouse).Error; err != nil {
@@ -153,6 +296,96 @@ func (r *TransactionRepository) Create(transaction *models.InventoryTransaction)
 		
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	
+	r.notifyLowStock(lowStock)
+	return nil
+}
+
+// ApplyLocationStock adds a receipt to its destination location's product_warehouse record,
+// creating the record on the first receipt, or takes an issue from its source location's record.
+// A location may be omitted only when the warehouse has none defined; the stock is then kept
+// in the warehouse's location-less record, which issues draw on once a receipt or stock take
+// has created it. Callers that create receive or issue transactions themselves must call it
+// inside the same database transaction.
+func ApplyLocationStock(tx *gorm.DB, transaction *models.InventoryTransaction) error {
+	locationID := transaction.DestinationLocationID
+	if transaction.Type == "issue" {
+		locationID = transaction.SourceLocationID
+	}
+	
+	if err := CheckLocation(tx, transaction.WarehouseID, locationID); err != nil {
+		return err
+	}
+	stock := models.StockAt(transaction.ProductID, transaction.WarehouseID, locationID)
+	
+	if transaction.Type == "issue" {
+		if locationID == nil {
+			var records int64
+			if err := tx.Model(&models.ProductWarehouse{}).Scopes(stock).Count(&records).Error; err != nil {
+				return err
+			}
+			if records == 0 {
+				return nil
+			}
+		}
+		
+		// The guard in the WHERE clause keeps concurrent issues from overdrawing the location
+		result := tx.Model(&models.ProductWarehouse{}).Scopes(stock).
+			Where("quantity >= ?", transaction.Quantity).
+			UpdateColumn("quantity", gorm.Expr("quantity - ?", transaction.Quantity))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInsufficientLocationStock
+		}
+		return nil
+	}
+	
+	result := tx.Model(&models.ProductWarehouse{}).Scopes(stock).
+		UpdateColumn("quantity", gorm.Expr("quantity + ?", transaction.Quantity))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+	
+	return tx.Create(&models.ProductWarehouse{
+		ProductID:   transaction.ProductID,
+		WarehouseID: transaction.WarehouseID,
+		LocationID:  locationID,
+		Quantity:    transaction.Quantity,
+	}).Error
+}
+
+// CheckLocation returns ErrLocationRequired when locationID is nil but the warehouse has
+// locations, and ErrLocationNotInWarehouse when it names a location in another warehouse
+func CheckLocation(tx *gorm.DB, warehouseID uint, locationID *uint) error {
+	if locationID == nil {
+		var locations int64
+		if err := tx.Model(&models.WarehouseLocation{}).Where("warehouse_id = ?", warehouseID).Count(&locations).Error; err != nil {
+			return err
+		}
+		if locations > 0 {
+			return ErrLocationRequired
+		}
+		return nil
+	}
+	
+	var locations int64
+	if err := tx.Model(&models.WarehouseLocation{}).
+		Where("id = ? AND warehouse_id = ?", *locationID, warehouseID).
+		Count(&locations).Error; err != nil {
+		return err
+	}
+	if locations == 0 {
+		return ErrLocationNotInWarehouse
+	}
+	return nil
 }
 
 // GetProductTransactions retrieves transactions for a specific product
@@ -174,71 +407,87 @@ func (r *TransactionRepository) GetProductTransactions(productID uint, startDate
 	return transactions, err
 }
 
-// GetProductMovementSummary returns a summary of product movements
+// GetProductMovementSummary returns a summary of product movements across all warehouses,
+// aggregated in the database
 func (r *TransactionRepository) GetProductMovementSummary(startDate, endDate time.Time) ([]map[string]interface{}, error) {
-	// This would typically use SQL GROUP BY for efficient aggregation
-	// Here's a simplified approach
-	var transactions []models.InventoryTransaction
+	// Deleted products are left out, as they can no longer be looked up
+	movements, err := r.movementSummary(
+		r.db.Where("products.deleted_at IS NULL"), startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	
+	// Convert to maps for response
+	result := make([]map[string]interface{}, 0, len(movements))
+	
+	for _, movement := range movements {
+		result = append(result, map[string]interface{}{
+			"product_id":   movement.ProductID,
+			"product_name": movement.ProductName,
+			"product_sku":  movement.ProductSKU,
+			"received":     movement.Received,
+			"issued":       movement.Issued,
+			"adjusted":     movement.Adjusted,
+			"transferred":  movement.Transferred,
+			"net_change":   movement.NetChange,
+		})
+	}
 	
-	query := r.db.Preload("Product")
+	return result, nil
+}
+
+// ProductMovement is one product's transaction totals over a period
+type ProductMovement struct {
+	ProductID   uint   `json:"product_id"`
+	ProductName string `json:"product_name"`
+	ProductSKU  string `json:"product_sku"`
+	Received    int    `json:"received"`
+	Issued      int    `json:"issued"`
+	Adjusted    int    `json:"adjusted"`
+	Transferred int    `json:"transferred"`
+	NetChange   int    `json:"net_change"`
+}
+
+// GetWarehouseMovementSummary returns per-product received, issued, adjusted and transferred
+// totals for one warehouse, aggregated in the database. Zero start or end dates leave that
+// side of the period open.
+func (r *TransactionRepository) GetWarehouseMovementSummary(warehouseID uint, startDate, endDate time.Time) ([]ProductMovement, error) {
+	return r.movementSummary(
+		r.db.Where("inventory_transactions.warehouse_id = ?", warehouseID), startDate, endDate)
+}
+
+// movementSummary totals transactions by product and type with a single GROUP BY, joined to
+// products for their names. query carries any extra conditions on the two tables.
+func (r *TransactionRepository) movementSummary(query *gorm.DB, startDate, endDate time.Time) ([]ProductMovement, error) {
+	query = query.Table("inventory_transactions").
+		Select(`inventory_transactions.product_id,
+			products.name AS product_name,
+			products.sku AS product_sku,
+			COALESCE(SUM(CASE WHEN inventory_transactions.type = 'receive' THEN inventory_transactions.quantity ELSE 0 END), 0) AS received,
+			COALESCE(SUM(CASE WHEN inventory_transactions.type = 'issue' THEN inventory_transactions.quantity ELSE 0 END), 0) AS issued,
+			COALESCE(SUM(CASE WHEN inventory_transactions.type = 'adjustment' THEN inventory_transactions.quantity ELSE 0 END), 0) AS adjusted,
+			COALESCE(SUM(CASE WHEN inventory_transactions.type = 'transfer' THEN inventory_transactions.quantity ELSE 0 END), 0) AS transferred`).
+		Joins("JOIN products ON products.id = inventory_transactions.product_id")
 	
 	if !startDate.IsZero() {
-		query = query.Where("created_at >= ?", startDate)
+		query = query.Where("inventory_transactions.created_at >= ?", startDate)
 	}
 	
 	if !endDate.IsZero() {
-		query = query.Where("created_at <= ?", endDate)
+		query = query.Where("inventory_transactions.created_at <= ?", endDate)
 	}
 	
-	if err := query.Find(&transactions).Error; err != nil {
+	var movements []ProductMovement
+	if err := query.Group("inventory_transactions.product_id, products.name, products.sku").
+		Order("inventory_transactions.product_id").
+		Scan(&movements).Error; err != nil {
 		return nil, err
 	}
 	
-	// Aggregate by product
-	productSummary := make(map[uint]map[string]int)
-	
-	for _, tx := range transactions {
-		if _, exists := productSummary[tx.ProductID]; !exists {
-			productSummary[tx.ProductID] = map[string]int{
-				"received":   0,
-				"issued":     0,
-				"adjusted":   0,
-				"transferred": 0,
-			}
-		}
-		
-		switch tx.Type {
-		case "receive":
-			productSummary[tx.ProductID]["received"] += tx.Quantity
-		case "issue":
-			productSummary[tx.ProductID]["issued"] += tx.Quantity
-		case "adjustment":
-			productSummary[tx.ProductID]["adjusted"] += tx.Quantity
-		case "transfer":
-			productSummary[tx.ProductID]["transferred"] += tx.Quantity
-		}
-	}
-	
-	// Convert to slice for response
-	result := make([]map[string]interface{}, 0, len(productSummary))
-	
-	for productID, summary := range productSummary {
-		var product models.Product
-		if err := r.db.First(&product, productID).Error; err != nil {
-			continue
-		}
-		
-		result = append(result, map[string]interface{}{
-			"product_id":   productID,
-			"product_name": product.Name,
-			"product_sku":  product.SKU,
-			"received":     summary["received"],
-			"issued":       summary["issued"],
-			"adjusted":     summary["adjusted"],
-			"transferred":  summary["transferred"],
-			"net_change":   summary["received"] - summary["issued"] + summary["adjusted"],
-		})
+	// Transfers move stock between locations in the same warehouse, so they don't change the total
+	for i := range movements {
+		movements[i].NetChange = movements[i].Received - movements[i].Issued + movements[i].Adjusted
 	}
 	
-	return result, nil
+	return movements, nil
 }
\ No newline at end of file
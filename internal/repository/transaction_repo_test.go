@@ -0,0 +1,342 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yourusername/inventory-management-system/internal/models"
+	"github.com/yourusername/inventory-management-system/internal/testutil"
+	"gorm.io/gorm"
+)
+
+// locationQuantity returns the quantity held at a location, or -1 when it has no record
+func locationQuantity(t *testing.T, db *gorm.DB, productID, warehouseID, locationID uint) int {
+	t.Helper()
+	var stock models.ProductWarehouse
+	err := db.Where("product_id = ? AND warehouse_id = ? AND location_id = ?", productID, warehouseID, locationID).
+		First(&stock).Error
+	if err == gorm.ErrRecordNotFound {
+		return -1
+	}
+	if err != nil {
+		t.Fatalf("reading location stock: %v", err)
+	}
+	return stock.Quantity
+}
+
+func TestCreateReceiveCreatesLocationStockOnFirstReceipt(t *testing.T) {
+	db := testutil.Tx(t)
+	user := testutil.CreateUser(t, db, "staff")
+	product := testutil.CreateProduct(t, db, 0)
+	warehouse := testutil.CreateWarehouse(t, db)
+	location := testutil.CreateLocation(t, db, warehouse.ID)
+	repo := NewTransactionRepository(db)
+
+	if got := locationQuantity(t, db, product.ID, warehouse.ID, location.ID); got != -1 {
+		t.Fatalf("location stock before first receipt = %d, want no record", got)
+	}
+
+	for _, quantity := range []int{10, 5} {
+		receipt := models.InventoryTransaction{
+			ProductID:             product.ID,
+			WarehouseID:           warehouse.ID,
+			DestinationLocationID: &location.ID,
+			Type:                  "receive",
+			Quantity:              quantity,
+			UserID:                user.ID,
+		}
+		if err := repo.Create(&receipt); err != nil {
+			t.Fatalf("receiving %d: %v", quantity, err)
+		}
+	}
+
+	if got := locationQuantity(t, db, product.ID, warehouse.ID, location.ID); got != 15 {
+		t.Errorf("location stock = %d, want 15", got)
+	}
+}
+
+func TestCreateReceiveKeepsLocationsSeparate(t *testing.T) {
+	db := testutil.Tx(t)
+	user := testutil.CreateUser(t, db, "staff")
+	product := testutil.CreateProduct(t, db, 0)
+	warehouse := testutil.CreateWarehouse(t, db)
+	first := testutil.CreateLocation(t, db, warehouse.ID)
+	second := testutil.CreateLocation(t, db, warehouse.ID)
+	repo := NewTransactionRepository(db)
+
+	for _, location := range []models.WarehouseLocation{first, second} {
+		receipt := models.InventoryTransaction{
+			ProductID:             product.ID,
+			WarehouseID:           warehouse.ID,
+			DestinationLocationID: &location.ID,
+			Type:                  "receive",
+			Quantity:              4,
+			UserID:                user.ID,
+		}
+		if err := repo.Create(&receipt); err != nil {
+			t.Fatalf("receiving at location %d: %v", location.ID, err)
+		}
+	}
+
+	for _, location := range []models.WarehouseLocation{first, second} {
+		if got := locationQuantity(t, db, product.ID, warehouse.ID, location.ID); got != 4 {
+			t.Errorf("location %d stock = %d, want 4", location.ID, got)
+		}
+	}
+}
+
+func TestCreateIssueRejectsInsufficientLocationStock(t *testing.T) {
+	db := testutil.Tx(t)
+	user := testutil.CreateUser(t, db, "staff")
+	product := testutil.CreateProduct(t, db, 0)
+	warehouse := testutil.CreateWarehouse(t, db)
+	stocked := testutil.CreateLocation(t, db, warehouse.ID)
+	empty := testutil.CreateLocation(t, db, warehouse.ID)
+	repo := NewTransactionRepository(db)
+
+	receipt := models.InventoryTransaction{
+		ProductID:             product.ID,
+		WarehouseID:           warehouse.ID,
+		DestinationLocationID: &stocked.ID,
+		Type:                  "receive",
+		Quantity:              5,
+		UserID:                user.ID,
+	}
+	if err := repo.Create(&receipt); err != nil {
+		t.Fatalf("receiving: %v", err)
+	}
+
+	// The product holds enough overall, but not at the location being issued from
+	issue := models.InventoryTransaction{
+		ProductID:        product.ID,
+		WarehouseID:      warehouse.ID,
+		SourceLocationID: &empty.ID,
+		Type:             "issue",
+		Quantity:         3,
+		UserID:           user.ID,
+	}
+	if err := repo.Create(&issue); !errors.Is(err, ErrInsufficientLocationStock) {
+		t.Fatalf("issuing from empty location: got %v, want ErrInsufficientLocationStock", err)
+	}
+
+	issue.ID = 0
+	issue.SourceLocationID = &stocked.ID
+	issue.Quantity = 6
+	if err := repo.Create(&issue); !errors.Is(err, ErrInsufficientLocationStock) {
+		t.Fatalf("issuing more than the location holds: got %v, want ErrInsufficientLocationStock", err)
+	}
+
+	var reloaded models.Product
+	if err := db.First(&reloaded, product.ID).Error; err != nil {
+		t.Fatalf("reloading product: %v", err)
+	}
+	if reloaded.Quantity != 5 {
+		t.Errorf("product quantity after rejected issues = %d, want 5", reloaded.Quantity)
+	}
+	if got := locationQuantity(t, db, product.ID, warehouse.ID, stocked.ID); got != 5 {
+		t.Errorf("location stock after rejected issues = %d, want 5", got)
+	}
+}
+
+func TestCreateKeepsStockWithoutLocation(t *testing.T) {
+	db := testutil.Tx(t)
+	user := testutil.CreateUser(t, db, "staff")
+	product := testutil.CreateProduct(t, db, 0)
+	warehouse := testutil.CreateWarehouse(t, db)
+	repo := NewTransactionRepository(db)
+
+	for _, transaction := range []models.InventoryTransaction{
+		{ProductID: product.ID, WarehouseID: warehouse.ID, Type: "receive", Quantity: 10, UserID: user.ID},
+		{ProductID: product.ID, WarehouseID: warehouse.ID, Type: "receive", Quantity: 5, UserID: user.ID},
+		{ProductID: product.ID, WarehouseID: warehouse.ID, Type: "issue", Quantity: 4, UserID: user.ID},
+	} {
+		if err := repo.Create(&transaction); err != nil {
+			t.Fatalf("recording %s of %d: %v", transaction.Type, transaction.Quantity, err)
+		}
+	}
+
+	// A warehouse without locations keeps a single record with no location
+	var records []models.ProductWarehouse
+	if err := db.Where("product_id = ? AND warehouse_id = ?", product.ID, warehouse.ID).Find(&records).Error; err != nil {
+		t.Fatalf("reading warehouse stock: %v", err)
+	}
+	if len(records) != 1 || records[0].LocationID != nil || records[0].Quantity != 11 {
+		t.Fatalf("warehouse stock = %+v, want one record without a location holding 11", records)
+	}
+
+	// Once the warehouse has locations, receipts have to name one
+	testutil.CreateLocation(t, db, warehouse.ID)
+	receipt := models.InventoryTransaction{ProductID: product.ID, WarehouseID: warehouse.ID, Type: "receive", Quantity: 1, UserID: user.ID}
+	if err := repo.Create(&receipt); !errors.Is(err, ErrLocationRequired) {
+		t.Fatalf("receiving without a location: got %v, want ErrLocationRequired", err)
+	}
+}
+
+func TestCreateCapturesUnitCost(t *testing.T) {
+	db := testutil.Tx(t)
+	user := testutil.CreateUser(t, db, "staff")
+	product := testutil.CreateProduct(t, db, 0)
+	warehouse := testutil.CreateWarehouse(t, db)
+	repo := NewTransactionRepository(db)
+
+	free := 0.0
+	tests := []struct {
+		name     string
+		unitCost *float64
+		want     float64
+	}{
+		{"unset takes the cost price", nil, product.CostPrice},
+		{"free receipt keeps its zero cost", &free, 0},
+	}
+
+	for _, tt := range tests {
+		receipt := models.InventoryTransaction{
+			ProductID:   product.ID,
+			WarehouseID: warehouse.ID,
+			Type:        "receive",
+			Quantity:    2,
+			UnitCost:    tt.unitCost,
+			UserID:      user.ID,
+		}
+		if err := repo.Create(&receipt); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		var stored models.InventoryTransaction
+		if err := db.First(&stored, receipt.ID).Error; err != nil {
+			t.Fatalf("%s: reloading: %v", tt.name, err)
+		}
+		if stored.UnitCost == nil || *stored.UnitCost != tt.want {
+			t.Errorf("%s: unit cost = %v, want %v", tt.name, stored.UnitCost, tt.want)
+		}
+	}
+
+	// Transactions can still be recorded against a soft-deleted product, at its last cost price
+	if err := db.Delete(&product).Error; err != nil {
+		t.Fatalf("deleting product: %v", err)
+	}
+	issue := models.InventoryTransaction{ProductID: product.ID, WarehouseID: warehouse.ID, Type: "issue", Quantity: 1, UserID: user.ID}
+	if err := repo.Create(&issue); err != nil {
+		t.Fatalf("issuing a deleted product: %v", err)
+	}
+	if issue.UnitCost == nil || *issue.UnitCost != product.CostPrice {
+		t.Errorf("deleted product's unit cost = %v, want %v", issue.UnitCost, product.CostPrice)
+	}
+}
+
+func TestCreateRejectsLocationInAnotherWarehouse(t *testing.T) {
+	db := testutil.Tx(t)
+	user := testutil.CreateUser(t, db, "staff")
+	product := testutil.CreateProduct(t, db, 0)
+	warehouse := testutil.CreateWarehouse(t, db)
+	testutil.CreateLocation(t, db, warehouse.ID)
+	other := testutil.CreateWarehouse(t, db)
+	foreign := testutil.CreateLocation(t, db, other.ID)
+
+	receipt := models.InventoryTransaction{
+		ProductID:             product.ID,
+		WarehouseID:           warehouse.ID,
+		DestinationLocationID: &foreign.ID,
+		Type:                  "receive",
+		Quantity:              5,
+		UserID:                user.ID,
+	}
+	if err := NewTransactionRepository(db).Create(&receipt); !errors.Is(err, ErrLocationNotInWarehouse) {
+		t.Fatalf("receiving into another warehouse's location: got %v, want ErrLocationNotInWarehouse", err)
+	}
+}
+
+func TestCreateIssueRejectsNegativeStock(t *testing.T) {
+	db := testutil.Tx(t)
+	user := testutil.CreateUser(t, db, "staff")
+	product := testutil.CreateProduct(t, db, 2)
+	warehouse := testutil.CreateWarehouse(t, db)
+
+	// Without locations there is no location stock to stop the issue
+	issue := models.InventoryTransaction{
+		ProductID:   product.ID,
+		WarehouseID: warehouse.ID,
+		Type:        "issue",
+		Quantity:    5,
+		UserID:      user.ID,
+	}
+	if err := NewTransactionRepository(db).Create(&issue); !errors.Is(err, ErrNegativeStock) {
+		t.Fatalf("issuing more than the product holds: got %v, want ErrNegativeStock", err)
+	}
+
+	var reloaded models.Product
+	if err := db.First(&reloaded, product.ID).Error; err != nil {
+		t.Fatalf("reloading product: %v", err)
+	}
+	if reloaded.Quantity != 2 {
+		t.Errorf("product quantity after rejected issue = %d, want 2", reloaded.Quantity)
+	}
+}
+
+func TestCreateReceiveAppliesQuantityOnce(t *testing.T) {
+	db := testutil.Tx(t)
+	user := testutil.CreateUser(t, db, "staff")
+	product := testutil.CreateProduct(t, db, 3)
+	warehouse := testutil.CreateWarehouse(t, db)
+	location := testutil.CreateLocation(t, db, warehouse.ID)
+
+	receipt := models.InventoryTransaction{
+		ProductID:             product.ID,
+		WarehouseID:           warehouse.ID,
+		DestinationLocationID: &location.ID,
+		Type:                  "receive",
+		Quantity:              10,
+		UserID:                user.ID,
+	}
+	if err := NewTransactionRepository(db).Create(&receipt); err != nil {
+		t.Fatalf("receiving: %v", err)
+	}
+
+	var reloaded models.Product
+	if err := db.First(&reloaded, product.ID).Error; err != nil {
+		t.Fatalf("reloading product: %v", err)
+	}
+	if reloaded.Quantity != 13 {
+		t.Errorf("product quantity after receiving 10 onto 3 = %d, want 13", reloaded.Quantity)
+	}
+	if got := locationQuantity(t, db, product.ID, warehouse.ID, location.ID); got != 10 {
+		t.Errorf("location stock = %d, want 10", got)
+	}
+}
+
+func BenchmarkGetProductMovementSummary(b *testing.B) {
+	db := testutil.Tx(b)
+	user := testutil.CreateUser(b, db, "staff")
+	warehouse := testutil.CreateWarehouse(b, db)
+
+	// 50 products with 40 mixed movements each
+	types := []string{"receive", "issue", "adjustment", "transfer"}
+	unitCost := 6.0
+	transactions := make([]models.InventoryTransaction, 0, 50*40)
+	for i := 0; i < 50; i++ {
+		product := testutil.CreateProduct(b, db, 0)
+		for j := 0; j < 40; j++ {
+			transactions = append(transactions, models.InventoryTransaction{
+				ProductID:   product.ID,
+				WarehouseID: warehouse.ID,
+				Type:        types[j%len(types)],
+				Quantity:    j + 1,
+				UnitCost:    &unitCost,
+				UserID:      user.ID,
+			})
+		}
+	}
+	if err := db.CreateInBatches(&transactions, 500).Error; err != nil {
+		b.Fatalf("creating transactions: %v", err)
+	}
+
+	repo := NewTransactionRepository(db)
+	start, end := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := repo.GetProductMovementSummary(start, end); err != nil {
+			b.Fatalf("summarising movements: %v", err)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Package testutil provides a PostgreSQL database and fixtures for tests. Tests that use it
+// are skipped unless TEST_DATABASE_URL names a database they may freely write to.
+package testutil
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yourusername/inventory-management-system/internal/config"
+	"github.com/yourusername/inventory-management-system/internal/database"
+	"github.com/yourusername/inventory-management-system/internal/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var (
+	migrateOnce sync.Once
+	migrateErr  error
+	sequence    int64
+)
+
+// DB returns a migrated connection to the test database, skipping the test when
+// TEST_DATABASE_URL isn't set. Data written through it is committed; use Tx for data
+// that should disappear when the test ends.
+func DB(t testing.TB) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("opening test database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	
+	migrateOnce.Do(func() {
+		migrateErr = database.MigrateDB(db, &config.Config{
+			AdminUsername: "admin",
+			AdminEmail:    "admin@example.com",
+		})
+	})
+	if migrateErr != nil {
+		t.Fatalf("migrating test database: %v", migrateErr)
+	}
+	return db
+}
+
+// Tx returns a transaction on the test database that is rolled back when the test ends
+func Tx(t testing.TB) *gorm.DB {
+	t.Helper()
+	tx := DB(t).Begin()
+	if tx.Error != nil {
+		t.Fatalf("beginning test transaction: %v", tx.Error)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+	return tx
+}
+
+// unique returns a suffix that keeps fixture names from colliding across tests and runs
+func unique() string {
+	return fmt.Sprintf("%d-%d", os.Getpid(), atomic.AddInt64(&sequence, 1))
+}
+
+// CreateUser creates an active user with the given role
+func CreateUser(t testing.TB, db *gorm.DB, role string) models.User {
+	t.Helper()
+	suffix := unique()
+	user := models.User{
+		Username:     "user-" + suffix,
+		Email:        "user-" + suffix + "@example.com",
+		FullName:     "Test User",
+		Role:         role,
+		Status:       "active",
+		PasswordHash: "password",
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	return user
+}
+
+// CreateProduct creates an active product holding quantity units
+func CreateProduct(t testing.TB, db *gorm.DB, quantity int) models.Product {
+	t.Helper()
+	product := models.Product{
+		SKU:          "SKU-" + unique(),
+		Name:         "Test Product",
+		Quantity:     quantity,
+		Price:        10,
+		CostPrice:    6,
+		Status:       "active",
+	}
+	if err := db.Create(&product).Error; err != nil {
+		t.Fatalf("creating product: %v", err)
+	}
+	return product
+}
+
+// CreateWarehouse creates an active warehouse with no locations
+func CreateWarehouse(t testing.TB, db *gorm.DB) models.Warehouse {
+	t.Helper()
+	warehouse := models.Warehouse{Name: "Warehouse " + unique(), Status: "active"}
+	if err := db.Create(&warehouse).Error; err != nil {
+		t.Fatalf("creating warehouse: %v", err)
+	}
+	return warehouse
+}
+
+// CreateLocation creates an active location in a warehouse
+func CreateLocation(t testing.TB, db *gorm.DB, warehouseID uint) models.WarehouseLocation {
+	t.Helper()
+	location := models.WarehouseLocation{
+		WarehouseID: warehouseID,
+		Zone:        "A",
+		Aisle:       "01",
+		Rack:        "R",
+		Shelf:       "S",
+		Bin:         unique(),
+		Status:      "active",
+	}
+	if err := db.Create(&location).Error; err != nil {
+		t.Fatalf("creating location: %v", err)
+	}
+	return location
+}
+
+// CreateCustomer creates an active customer with no credit limit
+func CreateCustomer(t testing.TB, db *gorm.DB) models.Customer {
+	t.Helper()
+	customer := models.Customer{Name: "Customer " + unique(), Status: "active"}
+	if err := db.Create(&customer).Error; err != nil {
+		t.Fatalf("creating customer: %v", err)
+	}
+	return customer
+}
+
+// CreateSalesOrder creates an empty draft sales order shipping from a warehouse
+func CreateSalesOrder(t testing.TB, db *gorm.DB, customerID, warehouseID, userID uint) models.SalesOrder {
+	t.Helper()
+	order := models.SalesOrder{
+		SONumber:    "SO-" + unique(),
+		CustomerID:  customerID,
+		WarehouseID: warehouseID,
+		OrderDate:   time.Now(),
+		Status:      "draft",
+		UserID:      userID,
+	}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatalf("creating sales order: %v", err)
+	}
+	return order
+}
+
+// CreateSupplier creates an active supplier
+func CreateSupplier(t testing.TB, db *gorm.DB) models.Supplier {
+	t.Helper()
+	supplier := models.Supplier{Name: "Supplier " + unique(), Status: "active"}
+	if err := db.Create(&supplier).Error; err != nil {
+		t.Fatalf("creating supplier: %v", err)
+	}
+	return supplier
+}
+
+// CreatePurchaseOrder creates an approved purchase order for quantity units of a product,
+// delivering to a warehouse. The order's single item is loaded into Items.
+func CreatePurchaseOrder(t testing.TB, db *gorm.DB, supplierID, warehouseID, userID, productID uint, quantity int) models.PurchaseOrder {
+	t.Helper()
+	order := models.PurchaseOrder{
+		PONumber:    "PO-" + unique(),
+		SupplierID:  supplierID,
+		WarehouseID: warehouseID,
+		OrderDate:   time.Now(),
+		Status:      "approved",
+		UserID:      userID,
+	}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatalf("creating purchase order: %v", err)
+	}
+	
+	item := models.PurchaseOrderItem{PurchaseOrderID: order.ID, ProductID: productID, Quantity: quantity, UnitPrice: 6}
+	if err := db.Create(&item).Error; err != nil {
+		t.Fatalf("creating purchase order item: %v", err)
+	}
+	order.Items = []models.PurchaseOrderItem{item}
+	return order
+}
\ No newline at end of file